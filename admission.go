@@ -0,0 +1,126 @@
+package xcache
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/SipengXie/xcache/freq"
+)
+
+// ErrNotAdmitted is returned by the methods that write a new key to a cache
+// when the admission policy of the cache has rejected the key.
+// Values that are loaded by LoaderFunc are returned to the caller anyway.
+var ErrNotAdmitted = errors.New("key not admitted")
+
+// AdmissionPolicy decides whether a key that is not present in a cache may be
+// added to it. Admit is called under the lock of the cache for every new key
+// that is written to it, including loaded keys, before anything is evicted to
+// make room for the key. Keys that are already present are always admitted.
+// The buckets of an XCache share the policy, so Admit must be safe for concurrent use.
+type AdmissionPolicy interface {
+	Admit(key interface{}) bool
+}
+
+// AdmissionFunc is an AdmissionPolicy implemented by a function.
+type AdmissionFunc func(key interface{}) bool
+
+// Admit calls f.
+func (f AdmissionFunc) Admit(key interface{}) bool {
+	return f(key)
+}
+
+// admit consults the admission policy, if any, before key is added to the cache.
+// present reports whether key is already in the cache. The caller must hold the lock.
+func (c *baseCache) admit(key interface{}, present bool) error {
+	if c.admission == nil || present || c.restoring {
+		return nil
+	}
+	if !c.admission.Admit(key) {
+		return ErrNotAdmitted
+	}
+	return nil
+}
+
+// FrequencyAdmission returns an admission policy that counts every write of a
+// new key in sketch and admits the key once it has been counted at least minCount
+// times, as TinyLFU does. The sketch can be shared with other policies and
+// queried with HashKey to estimate how often keys are written.
+func FrequencyAdmission(sketch *freq.Sketch, minCount int) AdmissionPolicy {
+	return AdmissionFunc(func(key interface{}) bool {
+		h := hashAny(key)
+		sketch.Increment(h)
+		return sketch.Estimate(h) >= minCount
+	})
+}
+
+// doorkeeper is a Bloom filter that admits the keys it has seen before.
+type doorkeeper struct {
+	words  []uint64
+	mask   uint64
+	hashes int
+	window uint64
+	seen   uint64
+}
+
+// Doorkeeper returns an admission policy that rejects a key the first time it
+// is written and admits it when it is written again within a window, so that
+// keys that are used only once, as in a scan, do not evict the resident entries.
+// It remembers the keys in a Bloom filter of bits bits, rounded up to a power of
+// two, with hashes hash functions. The filter is cleared once it has remembered
+// about as many keys as it can hold at a low false positive rate, which is
+// bits × ln 2 / hashes; a key seen before the filter is cleared has to be seen
+// twice again. A false positive admits a key on its first write.
+func Doorkeeper(bits, hashes int) AdmissionPolicy {
+	bits = nextPowerOfTwo(maxInt(bits, 64))
+	hashes = maxInt(hashes, 1)
+	window := uint64(float64(bits) * 0.69 / float64(hashes))
+	return &doorkeeper{
+		words:  make([]uint64, bits/64),
+		mask:   uint64(bits - 1),
+		hashes: hashes,
+		window: uint64(maxInt(int(window), 1)),
+	}
+}
+
+// Admit reports whether key has been seen before and remembers it otherwise.
+func (d *doorkeeper) Admit(key interface{}) bool {
+	h := hashAny(key)
+	h1, h2 := h&0xffffffff, h>>32|1
+	seen := true
+	for i := 0; i < d.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) & d.mask
+		if d.set(bit) {
+			seen = false
+		}
+	}
+	if seen {
+		return true
+	}
+	if atomic.AddUint64(&d.seen, 1) == d.window {
+		d.reset()
+	}
+	return false
+}
+
+// set sets bit and reports whether it was clear.
+func (d *doorkeeper) set(bit uint64) bool {
+	word := &d.words[bit/64]
+	mask := uint64(1) << (bit % 64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&mask != 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(word, old, old|mask) {
+			return true
+		}
+	}
+}
+
+// reset clears the filter. Keys that are remembered concurrently may be lost.
+func (d *doorkeeper) reset() {
+	for i := range d.words {
+		atomic.StoreUint64(&d.words[i], 0)
+	}
+	atomic.StoreUint64(&d.seen, 0)
+}
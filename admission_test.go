@@ -0,0 +1,111 @@
+package xcache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/SipengXie/xcache/freq"
+)
+
+func TestDoorkeeper(t *testing.T) {
+	d := Doorkeeper(1024, 3)
+	if d.Admit("a") {
+		t.Error("a key should not be admitted the first time")
+	}
+	if !d.Admit("a") {
+		t.Error("a key should be admitted the second time")
+	}
+
+	// the filter is cleared once its window is full
+	dk := d.(*doorkeeper)
+	for i := 0; dk.seen != 0; i++ {
+		d.Admit(i)
+	}
+	if d.Admit("a") {
+		t.Error("a key should be forgotten when the filter is cleared")
+	}
+}
+
+func TestFrequencyAdmission(t *testing.T) {
+	sketch := freq.New(1024)
+	gc := New(10).LRU().Admission(FrequencyAdmission(sketch, 3)).Build()
+	for i := 0; i < 2; i++ {
+		if err := gc.Set("a", i); err != ErrNotAdmitted {
+			t.Errorf("%v != %v", err, ErrNotAdmitted)
+		}
+	}
+	if err := gc.Set("a", 2); err != nil {
+		t.Error(err)
+	}
+	if n := sketch.Estimate(HashKey("a")); n != 3 {
+		t.Errorf("%v != %v", n, 3)
+	}
+}
+
+func TestAdmissionProtectsResidents(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL} {
+		t.Run(tp, func(t *testing.T) {
+			gc := New(10).EvictType(tp).Admission(Doorkeeper(1<<12, 3)).Build()
+			for i := 0; i < 10; i++ {
+				if err := gc.Set(i, i); err != ErrNotAdmitted {
+					t.Errorf("%v != %v", err, ErrNotAdmitted)
+				}
+				if err := gc.Set(i, i); err != nil {
+					t.Error(err)
+				}
+			}
+			// a scan of keys that are written once
+			for i := 100; i < 200; i++ {
+				gc.Set(i, i)
+			}
+			if n := gc.Len(false); n != 10 {
+				t.Errorf("%v != %v", n, 10)
+			}
+			for i := 0; i < 10; i++ {
+				if !gc.Has(i) {
+					t.Errorf("key %v should be resident", i)
+				}
+			}
+			// a present key is always admitted
+			if err := gc.Set(0, "a"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdmissionLoader(t *testing.T) {
+	loads := 0
+	gc := New(10).LRU().
+		Admission(Doorkeeper(1<<12, 3)).
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			loads++
+			return fmt.Sprint(key), nil
+		}).
+		Build()
+	for i := 0; i < 3; i++ {
+		if v, err := gc.Get(1); err != nil || v != "1" {
+			t.Errorf("%v, %v", v, err)
+		}
+	}
+	// the first load is returned but not stored
+	if loads != 2 {
+		t.Errorf("%v != %v", loads, 2)
+	}
+}
+
+func TestXCacheAdmission(t *testing.T) {
+	rejected := map[int]bool{1: true}
+	xc := NewXCache[int, int](10).BucketCount(2).
+		Admission(AdmissionFunc(func(key interface{}) bool { return !rejected[key.(int)] })).
+		Build()
+	if err := xc.Set(1, 1); err != ErrNotAdmitted {
+		t.Errorf("%v != %v", err, ErrNotAdmitted)
+	}
+	if err := xc.SetMulti(map[int]int{1: 1, 2: 2}); err != nil {
+		t.Error(err)
+	}
+	if xc.Has(1) || !xc.Has(2) {
+		t.Errorf("%v, %v != false, true", xc.Has(1), xc.Has(2))
+	}
+}
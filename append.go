@@ -0,0 +1,54 @@
+package xcache
+
+import (
+	"fmt"
+)
+
+// Append atomically appends elems to the slice stored for the specified key
+// and returns the resulting slice. If the key is not present in the cache,
+// it is created with elems as its value.
+// The returned slice may share its backing array with the cached value,
+// so callers must not append to or modify it.
+func Append[K comparable, E any](xc *XCache[K, []E], key K, elems ...E) ([]E, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, err := bucket.compute(key, func(old interface{}, found bool) (interface{}, error) {
+		if !found {
+			return append([]E(nil), elems...), nil
+		}
+		s, ok := old.([]E)
+		if !ok {
+			return nil, fmt.Errorf("type assertion failed")
+		}
+		return append(s, elems...), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]E), nil
+}
+
+// AppendString atomically appends s to the string stored for the specified key
+// and returns the resulting string. If the key is not present in the cache,
+// it is created with s as its value.
+func AppendString[K comparable, V ~string](xc *XCache[K, V], key K, s V) (V, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, err := bucket.compute(key, func(old interface{}, found bool) (interface{}, error) {
+		if !found {
+			return s, nil
+		}
+		str, ok := old.(V)
+		if !ok {
+			return nil, fmt.Errorf("type assertion failed")
+		}
+		return str + s, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return value.(V), nil
+}
@@ -0,0 +1,882 @@
+package xcache
+
+import (
+	"io"
+	"math/rand"
+	"time"
+)
+
+// DefaultApproxLRUSampleSize is the number of eviction candidates
+// sampled by ApproxLRUCache if no sample size is configured.
+const DefaultApproxLRUSampleSize = 5
+
+// ApproxLRUCache approximates LRU by sampling a few random entries when it is full
+// and discarding the least recently used among them.
+// Unlike LRUCache it does not maintain a list that has to be updated on every access.
+type ApproxLRUCache struct {
+	baseCache
+	items      map[interface{}]*approxLRUItem
+	keyList    []interface{}
+	sampleSize int
+	tick       uint64
+}
+
+func newApproxLRUCache(cb *CacheBuilder) *ApproxLRUCache {
+	c := &ApproxLRUCache{
+		sampleSize: cb.sampleSize,
+	}
+	if c.sampleSize <= 0 {
+		c.sampleSize = DefaultApproxLRUSampleSize
+	}
+	buildCache(&c.baseCache, cb)
+	c.eventExpiration = c.expirationOf
+
+	c.init()
+	c.loadGroup.cache = c
+	c.startJanitor(c.DeleteExpired)
+	c.startTrimmer(c.shrink)
+	c.watchMemory(c.shrink)
+	return c
+}
+
+func (c *ApproxLRUCache) init() {
+	if c.items != nil {
+		for k := range c.items {
+			delete(c.items, k)
+		}
+		c.keyList = clearSlice(c.keyList)
+		return
+	}
+	c.items = make(map[interface{}]*approxLRUItem, c.size)
+	c.keyList = make([]interface{}, 0, c.size)
+}
+
+// Set a new key-value pair
+func (c *ApproxLRUCache) Set(key, value interface{}) error {
+	c.mu.Lock()
+	defer c.unlock()
+	_, err := c.set(key, value)
+	return err
+}
+
+// Set a new key-value pair with an expiration time
+func (c *ApproxLRUCache) SetWithExpire(key, value interface{}, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	item, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	item.(*approxLRUItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return nil
+}
+
+// SetWithExpireAndIdle sets a new key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (c *ApproxLRUCache) SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	item, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	it := item.(*approxLRUItem)
+	if expiration > 0 {
+		t := c.clock.Now().Add(expiration)
+		it.expiration = &t
+		c.scheduleExpiration(key, t)
+	} else {
+		it.expiration = nil
+	}
+	c.setMaxIdle(key, &it.accessInfo, maxIdle)
+	return nil
+}
+
+// SetIfAbsent sets a new key-value pair only if the key is not present in the cache.
+func (c *ApproxLRUCache) SetIfAbsent(key, value interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfAbsentWithExpire sets a new key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (c *ApproxLRUCache) SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	item, err := c.set(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	item.(*approxLRUItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return true, nil
+}
+
+// setMulti sets the specified key-value pairs, acquiring the lock only once.
+// If expiration is not nil, it is applied to every pair.
+func (c *ApproxLRUCache) setMulti(items map[interface{}]interface{}, expiration *time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, value := range items {
+		item, err := c.set(key, value)
+		if err == ErrNotAdmitted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			item.(*approxLRUItem).expiration = &t
+			c.scheduleExpiration(key, t)
+		}
+	}
+	return nil
+}
+
+func (c *ApproxLRUCache) set(key, value interface{}) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	c.removeStale(key, c.deadlineOf, c.remove)
+	if err := c.admit(key, c.has(key, nil)); err != nil {
+		return nil, err
+	}
+	var err error
+	if c.serializeFunc != nil {
+		value, err = c.serialize(key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.maxCost > 0 {
+		c.fitCost(key, value, func() { c.evict(1) })
+	}
+
+	// Check for existing item
+	item, ok := c.items[key]
+	if ok {
+		c.notifyReplaced(key, item.value, value)
+		item.value = value
+	} else {
+		// Verify size not exceeded
+		if c.full(len(c.items)) {
+			c.evict(c.evictionBatch())
+		}
+		item = &approxLRUItem{
+			clock:      c.clock,
+			value:      value,
+			index:      len(c.keyList),
+			accessInfo: newAccessInfo(c.clock.Now()),
+		}
+		c.items[key] = item
+		c.notifyAdded(key, value)
+		c.keyList = append(c.keyList, key)
+	}
+
+	item.version = c.nextVersion()
+	c.recordWrite(key, &item.accessInfo)
+	item.lastUsed = c.nextTick()
+	if c.expiration != nil {
+		t := c.clock.Now().Add(*c.expiration)
+		item.expiration = &t
+		c.scheduleExpiration(key, t)
+	}
+
+	c.callAdded(key, value)
+
+	return item, nil
+}
+
+// Get a value from cache pool using key if it exists.
+// If it does not exists key and has LoaderFunc,
+// generate a value using `LoaderFunc` method returns value.
+func (c *ApproxLRUCache) Get(key interface{}) (interface{}, error) {
+	v, err := c.get(key, false)
+	if err == ErrKeyNotFoundError {
+		return c.getWithLoader(key, true)
+	}
+	return v, err
+}
+
+// GetIFPresent gets a value from cache pool using key if it exists.
+// If it does not exists key, returns KeyNotFoundError.
+// And send a request which refresh value for specified key if cache object has LoaderFunc.
+func (c *ApproxLRUCache) GetIFPresent(key interface{}) (interface{}, error) {
+	v, err := c.get(key, false)
+	if err == ErrKeyNotFoundError {
+		return c.getWithLoader(key, false)
+	}
+	return v, nil
+}
+
+// GetWithExpiration gets a value from cache pool using key if it exists,
+// together with the time at which it expires.
+// The returned time is nil if the value never expires.
+// LoaderFunc is not invoked if the key does not exist.
+func (c *ApproxLRUCache) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, nil, err
+	}
+	var expiration *time.Time
+	if exp := c.items[key].expiration; exp != nil {
+		t := *exp
+		expiration = &t
+	}
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v, expiration, nil
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet.
+// It neither resurrects expired values nor updates eviction state or statistics.
+func (c *ApproxLRUCache) GetStale(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	item, ok := c.items[key]
+	if !ok {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	value := item.value
+	c.mu.RUnlock()
+
+	if c.deserializeFunc != nil {
+		v, err := c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+		return v, true
+	}
+	return value, true
+}
+
+// Info returns the metadata of the specified key without updating
+// any eviction algorithm statistics or positions.
+func (c *ApproxLRUCache) Info(key interface{}) (EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.has(key, nil) {
+		return EntryInfo{}, false
+	}
+	item := c.items[key]
+	return newEntryInfo(item.accessInfo, item.expiration, item.pinned, ""), true
+}
+
+// GetVersioned gets a value from cache pool using key if it exists, together with its version.
+// The version is 0 if the key does not exist. LoaderFunc is not invoked.
+func (c *ApproxLRUCache) GetVersioned(key interface{}) (interface{}, uint64) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, 0
+	}
+	version := c.items[key].version
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, 0
+		}
+	}
+	return v, version
+}
+
+// SetIfVersion sets a new key-value pair only if the current version of the key equals version.
+// A version of 0 means the key must not exist.
+func (c *ApproxLRUCache) SetIfVersion(key, value interface{}, version uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var current uint64
+	if c.has(key, nil) {
+		current = c.items[key].version
+	}
+	if current != version {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Peek returns the value for the specified key if it is present in the cache
+// without updating any eviction algorithm statistics or positions.
+// This is a pure read operation that does not affect cache state.
+func (c *ApproxLRUCache) Peek(key interface{}) (interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return nil, ErrKeyNotFoundError
+	}
+
+	if item.IsExpired(nil) {
+		return nil, ErrKeyNotFoundError
+	}
+
+	value := item.value
+	if c.deserializeFunc != nil {
+		c.mu.RUnlock()
+		defer c.mu.RLock()
+		return c.deserializeFunc(key, value)
+	}
+
+	return value, nil
+}
+
+func (c *ApproxLRUCache) get(key interface{}, onLoad bool) (interface{}, error) {
+	v, err := c.getValue(key, onLoad)
+	if err != nil {
+		return nil, err
+	}
+	if c.deserializeFunc != nil {
+		return c.deserializeFunc(key, v)
+	}
+	return v, nil
+}
+
+func (c *ApproxLRUCache) getValue(key interface{}, onLoad bool) (interface{}, error) {
+	if v, ok := c.readUnlocked(key, onLoad, c.lookup); ok {
+		return v, nil
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	return c.readLocked(key, onLoad, c.lookup, c.deadlineOf)
+}
+
+// getMulti returns the values of the specified keys that are present in the cache
+// and the keys that are not, acquiring the lock only once.
+func (c *ApproxLRUCache) getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{}) {
+	return c.lookupMulti(keys, c.lookup)
+}
+
+// lookup returns the value for the specified key and updates the eviction state.
+// The caller must hold the lock.
+func (c *ApproxLRUCache) lookup(key interface{}, onLoad bool) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	item, ok := c.items[key]
+	if ok {
+		if !item.IsExpired(nil) {
+			item.lastUsed = c.nextTick()
+			if !onLoad {
+				c.stats.IncrHitCount()
+				item.recordAccess(c.clock.Now())
+				if c.sliding && item.expiration != nil {
+					t := c.clock.Now().Add(*c.expiration)
+					item.expiration = &t
+					c.scheduleExpiration(key, t)
+				}
+				if c.shouldRefresh(&item.accessInfo) {
+					c.refresh(key)
+				}
+			}
+			return item.value, nil
+		}
+		c.expireOnAccess(key, c.remove)
+	}
+	if !onLoad {
+		c.stats.IncrMissCount()
+	}
+	return nil, ErrKeyNotFoundError
+}
+
+func (c *ApproxLRUCache) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
+	if v, ok := c.recallVictim(key, c); ok {
+		return v, nil
+	}
+	if c.loaderExpireFunc == nil {
+		return nil, ErrKeyNotFoundError
+	}
+	value, _, err := c.load(key, func(v interface{}, expiration *time.Duration, e error) (interface{}, error) {
+		if e != nil {
+			return nil, e
+		}
+		c.mu.Lock()
+		defer c.unlock()
+		item, err := c.set(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			item.(*approxLRUItem).expiration = &t
+			c.scheduleExpiration(key, t)
+		}
+		return v, nil
+	}, isWait)
+	if err != nil {
+		// value is the stale value, if any.
+		return value, err
+	}
+	return value, nil
+}
+
+// nextTick returns the logical time of an access. The caller must hold the lock.
+func (c *ApproxLRUCache) nextTick() uint64 {
+	c.tick++
+	return c.tick
+}
+
+// evict removes count items from the cache. For each eviction, sampleSize
+// random unpinned items are drawn and the least recently used of them is removed.
+func (c *ApproxLRUCache) evict(count int) {
+	defer c.beginEviction()()
+	for i := 0; i < count && len(c.keyList) > 0; i++ {
+		var (
+			victim interface{}
+			oldest *approxLRUItem
+		)
+		for j := 0; j < c.sampleSize; j++ {
+			key := c.keyList[rand.Intn(len(c.keyList))]
+			item := c.items[key]
+			if item.pinned {
+				continue
+			}
+			if oldest == nil || item.lastUsed < oldest.lastUsed {
+				victim, oldest = key, item
+			}
+		}
+		if oldest == nil {
+			// All samples were pinned, fall back to scanning for any unpinned item.
+			for _, key := range c.keyList {
+				if item := c.items[key]; !item.pinned {
+					victim, oldest = key, item
+					break
+				}
+			}
+			if oldest == nil {
+				return
+			}
+		}
+		c.remove(victim)
+	}
+}
+
+// compute atomically replaces the value for the specified key with the result of fn.
+// fn receives the current value and whether the key is present in the cache.
+func (c *ApproxLRUCache) compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var (
+		old interface{}
+		err error
+	)
+	found := c.has(key, nil)
+	if found {
+		old = c.items[key].value
+		if c.deserializeFunc != nil {
+			old, err = c.deserializeFunc(key, old)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, err := fn(old, found)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.set(key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Touch resets the expiration of the provided key to the default expiration
+// without updating any eviction algorithm statistics or positions.
+// If the cache has no default expiration, the key will never expire.
+func (c *ApproxLRUCache) Touch(key interface{}) bool {
+	return c.setExpiration(key, c.expiration)
+}
+
+// TouchWithExpire resets the expiration of the provided key to the given duration
+// without updating any eviction algorithm statistics or positions.
+func (c *ApproxLRUCache) TouchWithExpire(key interface{}, expiration time.Duration) bool {
+	return c.setExpiration(key, &expiration)
+}
+
+// SetExpiration changes the expiration of the provided key in place
+// without updating any eviction algorithm statistics or positions.
+// A non-positive duration removes the expiration so that the key never expires.
+func (c *ApproxLRUCache) SetExpiration(key interface{}, expiration time.Duration) bool {
+	if expiration <= 0 {
+		return c.setExpiration(key, nil)
+	}
+	return c.setExpiration(key, &expiration)
+}
+
+func (c *ApproxLRUCache) setExpiration(key interface{}, expiration *time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	item := c.items[key]
+	if expiration == nil {
+		item.expiration = nil
+	} else {
+		t := c.clock.Now().Add(*expiration)
+		item.expiration = &t
+		c.scheduleExpiration(key, t)
+	}
+	return true
+}
+
+// Pin prevents the provided key from being evicted.
+// A pinned key is still removed by Remove and on expiration.
+func (c *ApproxLRUCache) Pin(key interface{}) bool {
+	return c.setPinned(key, true)
+}
+
+// Unpin makes the provided key eligible for eviction again.
+func (c *ApproxLRUCache) Unpin(key interface{}) bool {
+	return c.setPinned(key, false)
+}
+
+func (c *ApproxLRUCache) setPinned(key interface{}, pinned bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	c.items[key].pinned = pinned
+	return true
+}
+
+// Has checks if key exists in cache
+func (c *ApproxLRUCache) Has(key interface{}) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	return c.has(key, &now)
+}
+
+func (c *ApproxLRUCache) has(key interface{}, now *time.Time) bool {
+	item, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	return !item.IsExpired(now)
+}
+
+// deadlineOf returns the time at which key expires if it is present in the cache and expires.
+func (c *ApproxLRUCache) deadlineOf(key interface{}) (time.Time, bool) {
+	item, ok := c.items[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return item.deadline(item.expiration)
+}
+
+// expirationOf returns the time at which key expires, or nil if it does not
+// expire or is not present. The caller must hold the lock.
+func (c *ApproxLRUCache) expirationOf(key interface{}) *time.Time {
+	if item, ok := c.items[key]; ok {
+		return item.expiration
+	}
+	return nil
+}
+
+// GetAndRemove removes the provided key from the cache and returns its value.
+// Returns false if the key is not present in the cache.
+func (c *ApproxLRUCache) GetAndRemove(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if !c.has(key, nil) {
+		return nil, false
+	}
+	value := c.items[key].value
+	if c.deserializeFunc != nil {
+		var err error
+		value, err = c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+	}
+	c.remove(key)
+	return value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *ApproxLRUCache) Remove(key interface{}) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	return c.remove(key)
+}
+
+func (c *ApproxLRUCache) remove(key interface{}) bool {
+	item, ok := c.items[key]
+	if ok {
+		delete(c.items, key)
+		last := len(c.keyList) - 1
+		if item.index != last {
+			moved := c.keyList[last]
+			c.keyList[item.index] = moved
+			c.items[moved].index = item.index
+		}
+		c.keyList[last] = nil
+		c.keyList = c.keyList[:last]
+		c.notifyEvicted(key, item.value)
+		return true
+	}
+	return false
+}
+
+// Returns a slice of the keys in the cache.
+func (c *ApproxLRUCache) keys() []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([]interface{}, len(c.items))
+	var i = 0
+	for k := range c.items {
+		keys[i] = k
+		i++
+	}
+	return keys
+}
+
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+func (c *ApproxLRUCache) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.deleteExpired(c.deadlineOf, c.remove)
+}
+
+// sample returns up to n unexpired entries, chosen uniformly at random, with their
+// values deserialized.
+func (c *ApproxLRUCache) sample(n int) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := reservoir[interface{}, interface{}]{n: n}
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		r.offer(key, item.value)
+	}
+	return c.sampled(&r)
+}
+
+// entries returns a point-in-time copy of all unexpired entries.
+func (c *ApproxLRUCache) entries() []cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]cacheEntry, 0, len(c.items))
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		entries = append(entries, newCacheEntry(key, item.value, item.expiration))
+	}
+	return entries
+}
+
+// restore inserts entries, as returned by entries, with their expiration times.
+func (c *ApproxLRUCache) restore(entries []cacheEntry) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.beginRestore()()
+	for _, e := range entries {
+		item, err := c.set(e.key, e.value)
+		if err != nil {
+			continue
+		}
+		if e.expiration != nil {
+			item.(*approxLRUItem).expiration = e.expiration
+			c.scheduleExpiration(e.key, *e.expiration)
+		}
+	}
+}
+
+// shrink evicts up to n entries and returns the number of evicted entries.
+func (c *ApproxLRUCache) shrink(n int) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := c.entryCount
+	c.evict(n)
+	return int(count - c.entryCount)
+}
+
+// walk calls fn for each entry, with its value deserialized, while holding the read
+// lock and skips expired entries if checkExpired is true. It stops and returns false
+// as soon as fn returns false.
+func (c *ApproxLRUCache) walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool {
+	fn = c.deserializing(fn, true)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if checkExpired && item.IsExpired(&now) {
+			continue
+		}
+		if !fn(key, item.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeMulti removes the specified keys, acquiring the lock only once.
+func (c *ApproxLRUCache) removeMulti(keys []interface{}) int {
+	return c.removeKeys(keys, c.remove)
+}
+
+// removeIf removes all entries that satisfy fn, which is called with the deserialized
+// values, and returns the number of removed entries.
+func (c *ApproxLRUCache) removeIf(fn func(interface{}, interface{}) bool) int {
+	fn = c.deserializing(fn, false)
+	c.mu.Lock()
+	defer c.unlock()
+	var keys []interface{}
+	for key, item := range c.items {
+		if fn(key, item.value) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.remove(key)
+	}
+	return len(keys)
+}
+
+// GetALL returns all key-value pairs in the cache.
+func (c *ApproxLRUCache) GetALL(checkExpired bool) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make(map[interface{}]interface{}, len(c.items))
+	now := time.Now()
+	for k, item := range c.items {
+		if !checkExpired || c.has(k, &now) {
+			items[k] = item.value
+		}
+	}
+	return items
+}
+
+// Keys returns a slice of the keys in the cache.
+func (c *ApproxLRUCache) Keys(checkExpired bool) []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([]interface{}, 0, len(c.items))
+	now := time.Now()
+	for k := range c.items {
+		if !checkExpired || c.has(k, &now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of items in the cache.
+func (c *ApproxLRUCache) Len(checkExpired bool) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !checkExpired {
+		return len(c.items)
+	}
+	return len(c.items) - c.countExpired(c.deadlineOf)
+}
+
+// Completely clear the cache
+func (c *ApproxLRUCache) Purge() {
+	c.purge(c.purgeVisitorFunc)
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live to w.
+func (c *ApproxLRUCache) SaveTo(w io.Writer) error {
+	return c.saveTo(w, c.entries())
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache.
+func (c *ApproxLRUCache) LoadFrom(r io.Reader) error {
+	entries, err := c.loadFrom(r)
+	if err != nil {
+		return err
+	}
+	c.restore(entries)
+	return nil
+}
+
+// purge clears the cache and calls visit, if not nil, for each entry.
+func (c *ApproxLRUCache) purge(visit PurgeVisitorFunc) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if visit != nil {
+		for key, item := range c.items {
+			visit(key, item.value)
+		}
+	}
+
+	c.resetExpirations()
+	c.resetSize()
+	c.init()
+}
+
+// DebugState returns the number of entries of the cache.
+func (c *ApproxLRUCache) DebugState() DebugState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return DebugState{Policy: TYPE_APPROX_LRU, Entries: len(c.items)}
+}
+
+type approxLRUItem struct {
+	clock      Clock
+	value      interface{}
+	index      int
+	lastUsed   uint64
+	expiration *time.Time
+	pinned     bool
+	version    uint64
+	accessInfo
+}
+
+// IsExpired returns boolean value whether this item is expired or not.
+func (si *approxLRUItem) IsExpired(now *time.Time) bool {
+	deadline, ok := si.deadline(si.expiration)
+	if !ok {
+		return false
+	}
+	if now == nil {
+		t := si.clock.Now()
+		now = &t
+	}
+	return deadline.Before(*now)
+}
@@ -0,0 +1,85 @@
+package xcache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestApproxLRUGet(t *testing.T) {
+	size := 1000
+	gc := buildTestCache(t, TYPE_APPROX_LRU, size)
+	testSetCache(t, gc, size)
+	testGetCache(t, gc, size)
+}
+
+func TestLoadingApproxLRUGet(t *testing.T) {
+	size := 1000
+	gc := buildTestLoadingCache(t, TYPE_APPROX_LRU, size, loader)
+	testGetCache(t, gc, size)
+}
+
+func TestApproxLRUEvictItem(t *testing.T) {
+	cacheSize := 10
+	numbers := 100
+	gc := buildTestLoadingCache(t, TYPE_APPROX_LRU, cacheSize, loader)
+
+	for i := 0; i < numbers; i++ {
+		_, err := gc.Get(fmt.Sprintf("Key-%d", i))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if gc.Len(false) != cacheSize {
+		t.Errorf("Expected length is %v, not %v", cacheSize, gc.Len(false))
+	}
+}
+
+func TestApproxLRUGetIFPresent(t *testing.T) {
+	testGetIFPresent(t, TYPE_APPROX_LRU)
+}
+
+func TestApproxLRUSampleSize(t *testing.T) {
+	gc := New(10).ApproxLRU(0).Build()
+	if n := gc.(*ApproxLRUCache).sampleSize; n != DefaultApproxLRUSampleSize {
+		t.Errorf("%v != %v", n, DefaultApproxLRUSampleSize)
+	}
+	xc := NewXCache[int, int](10).ApproxLRU(3).Build()
+	if n := xc.buckets[0].(*ApproxLRUCache).sampleSize; n != 3 {
+		t.Errorf("%v != 3", n)
+	}
+}
+
+func TestApproxLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	// With a sample size well above the cache size every entry is sampled
+	// with high probability, so eviction behaves like exact LRU.
+	gc := New(3).ApproxLRU(64).Build()
+	gc.Set(1, 1)
+	gc.Set(2, 2)
+	gc.Set(3, 3)
+	gc.Get(1)
+	gc.Set(4, 4)
+
+	if _, err := gc.Get(2); err != ErrKeyNotFoundError {
+		t.Error("least recently used key should be evicted")
+	}
+	for _, key := range []int{1, 3, 4} {
+		if _, err := gc.Get(key); err != nil {
+			t.Errorf("key %v should still be cached: %v", key, err)
+		}
+	}
+}
+
+func TestApproxLRUEvictSkipsPinned(t *testing.T) {
+	gc := New(2).ApproxLRU(1).Build()
+	gc.Set(1, 1)
+	gc.Set(2, 2)
+	gc.Pin(1)
+	gc.Pin(2)
+	gc.Unpin(2)
+	for i := 3; i < 10; i++ {
+		gc.Set(i, i)
+	}
+	if _, err := gc.Get(1); err != nil {
+		t.Error("pinned key should not be evicted")
+	}
+}
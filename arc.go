@@ -1,7 +1,7 @@
 package xcache
 
 import (
-	"container/list"
+	"io"
 	"time"
 )
 
@@ -13,54 +13,127 @@ type ARC struct {
 	part int
 	t1   *arcList
 	t2   *arcList
-	b1   *arcList
-	b2   *arcList
+	b1   *arcGhosts
+	b2   *arcGhosts
+
+	ghostLimit int
+}
+
+// ARCState describes how an ARC cache has adapted to its workload.
+type ARCState struct {
+	// P is the target size of T1 that ARC adapts between 0 and the cache size.
+	P int
+	// T1 is the number of resident entries that have been accessed once recently.
+	T1 int
+	// T2 is the number of resident entries that have been accessed at least twice recently.
+	T2 int
+	// B1 is the number of ghost entries recently evicted from T1.
+	B1 int
+	// B2 is the number of ghost entries recently evicted from T2.
+	B2 int
 }
 
 func newARC(cb *CacheBuilder) *ARC {
-	c := &ARC{}
+	c := &ARC{
+		ghostLimit: cb.arcGhostLimit,
+	}
 	buildCache(&c.baseCache, cb)
+	c.eventExpiration = c.expirationOf
 
 	c.init()
 	c.loadGroup.cache = c
+	c.startJanitor(c.DeleteExpired)
+	c.startTrimmer(c.shrink)
 	return c
 }
 
 func (c *ARC) init() {
-	c.items = make(map[interface{}]*arcItem)
-	c.t1 = newARCList()
-	c.t2 = newARCList()
-	c.b1 = newARCList()
-	c.b2 = newARCList()
+	if c.items != nil {
+		for k := range c.items {
+			delete(c.items, k)
+		}
+		c.t1.Reset()
+		c.t2.Reset()
+		c.b1.Reset()
+		c.b2.Reset()
+		return
+	}
+	// T1 and T2 share the size between them
+	c.items = make(map[interface{}]*arcItem, c.size)
+	c.t1 = newARCList(c.size / 2)
+	c.t2 = newARCList(c.size / 2)
+	c.b1 = newARCGhosts()
+	c.b2 = newARCGhosts()
 }
 
 func (c *ARC) replace(key interface{}) {
-	if !c.isCacheFull() {
-		return
+	if c.isCacheFull() {
+		c.evictOne(key)
 	}
-	var old interface{}
-	if c.t1.Len() > 0 && ((c.b2.Has(key) && c.t1.Len() == c.part) || (c.t1.Len() > c.part)) {
-		old = c.t1.RemoveTail()
-		c.b1.PushFront(old)
-	} else if c.t2.Len() > 0 {
-		old = c.t2.RemoveTail()
-		c.b2.PushFront(old)
+}
+
+// evictOne evicts the entry that ARC chooses to make room for key, which may be nil.
+// Returns false if every resident entry is pinned.
+func (c *ARC) evictOne(key interface{}) bool {
+	defer c.beginEviction()()
+	var (
+		old *arcItem
+		ok  bool
+	)
+	if c.t2.Len() == 0 || (c.t1.Len() > 0 && ((c.b2.Has(key) && c.t1.Len() == c.part) || (c.t1.Len() > c.part))) {
+		if old, ok = c.demote(c.t1, c.b1); !ok {
+			old, ok = c.demote(c.t2, c.b2)
+		}
 	} else {
-		old = c.t1.RemoveTail()
-		c.b1.PushFront(old)
+		if old, ok = c.demote(c.t2, c.b2); !ok {
+			old, ok = c.demote(c.t1, c.b1)
+		}
+	}
+	if !ok {
+		// every resident entry is pinned
+		return false
+	}
+	if _, ok := c.items[old.key]; ok {
+		delete(c.items, old.key)
+		c.notifyEvicted(old.key, old.value)
 	}
-	item, ok := c.items[old]
+	old.value = nil
+	return true
+}
+
+// demote moves the least recently used unpinned item of t to the front of the ghost list b.
+func (c *ARC) demote(t *arcList, b *arcGhosts) (*arcItem, bool) {
+	old, ok := t.RemoveTailFunc(c.isEvictable)
 	if ok {
-		delete(c.items, old)
-		if c.evictedFunc != nil {
-			c.evictedFunc(item.key, item.value)
+		c.pushGhost(b, old)
+	}
+	return old, ok
+}
+
+// pushGhost adds the evicted item to the front of the ghost list b and, if the ghost
+// lists are limited, drops the oldest ghost keys of the longer list until they fit.
+func (c *ARC) pushGhost(b *arcGhosts, item *arcItem) {
+	b.Push(item)
+	if c.ghostLimit <= 0 {
+		return
+	}
+	for c.b1.Len()+c.b2.Len() > c.ghostLimit {
+		if c.b1.Len() >= c.b2.Len() {
+			c.b1.RemoveOldest()
+		} else {
+			c.b2.RemoveOldest()
 		}
 	}
 }
 
+func (c *ARC) isEvictable(key interface{}) bool {
+	item, ok := c.items[key]
+	return !ok || !item.pinned
+}
+
 func (c *ARC) Set(key, value interface{}) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 	_, err := c.set(key, value)
 	return err
 }
@@ -68,80 +141,171 @@ func (c *ARC) Set(key, value interface{}) error {
 // Set a new key-value pair with an expiration time
 func (c *ARC) SetWithExpire(key, value interface{}, expiration time.Duration) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+	item, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	item.(*arcItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return nil
+}
+
+// SetWithExpireAndIdle sets a new key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (c *ARC) SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
 	item, err := c.set(key, value)
 	if err != nil {
 		return err
 	}
 
+	it := item.(*arcItem)
+	if expiration > 0 {
+		t := c.clock.Now().Add(expiration)
+		it.expiration = &t
+		c.scheduleExpiration(key, t)
+	} else {
+		it.expiration = nil
+	}
+	c.setMaxIdle(key, &it.accessInfo, maxIdle)
+	return nil
+}
+
+// SetIfAbsent sets a new key-value pair only if the key is not present in the cache.
+func (c *ARC) SetIfAbsent(key, value interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfAbsentWithExpire sets a new key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (c *ARC) SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	item, err := c.set(key, value)
+	if err != nil {
+		return false, err
+	}
+
 	t := c.clock.Now().Add(expiration)
 	item.(*arcItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return true, nil
+}
+
+// setMulti sets the specified key-value pairs, acquiring the lock only once.
+// If expiration is not nil, it is applied to every pair.
+func (c *ARC) setMulti(items map[interface{}]interface{}, expiration *time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, value := range items {
+		item, err := c.set(key, value)
+		if err == ErrNotAdmitted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			item.(*arcItem).expiration = &t
+			c.scheduleExpiration(key, t)
+		}
+	}
 	return nil
 }
 
 func (c *ARC) set(key, value interface{}) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	c.removeStale(key, c.deadlineOf, c.remove)
+	if err := c.admit(key, c.has(key, nil)); err != nil {
+		return nil, err
+	}
 	var err error
 	if c.serializeFunc != nil {
-		value, err = c.serializeFunc(key, value)
+		value, err = c.serialize(key, value)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if c.maxCost > 0 {
+		c.fitCost(key, value, func() { c.evictOne(key) })
+	}
 
 	item, ok := c.items[key]
 	if ok {
+		c.notifyReplaced(key, item.value, value)
 		item.value = value
 	} else {
 		item = &arcItem{
-			clock: c.clock,
-			key:   key,
-			value: value,
+			clock:      c.clock,
+			key:        key,
+			value:      value,
+			accessInfo: newAccessInfo(c.clock.Now()),
 		}
 		c.items[key] = item
+		c.notifyAdded(key, value)
 	}
 
+	item.version = c.nextVersion()
+	c.recordWrite(key, &item.accessInfo)
 	if c.expiration != nil {
 		t := c.clock.Now().Add(*c.expiration)
 		item.expiration = &t
+		c.scheduleExpiration(key, t)
 	}
 
-	defer func() {
-		if c.addedFunc != nil {
-			c.addedFunc(key, value)
-		}
-	}()
+	defer c.callAdded(key, value)
 
 	if c.t1.Has(key) || c.t2.Has(key) {
 		return item, nil
 	}
 
-	if elt := c.b1.Lookup(key); elt != nil {
+	if ghost := c.b1.Lookup(key); ghost != nil {
 		c.setPart(minInt(c.size, c.part+maxInt(c.b2.Len()/c.b1.Len(), 1)))
 		c.replace(key)
-		c.b1.Remove(key, elt)
-		c.t2.PushFront(key)
+		c.b1.Remove(ghost)
+		c.t2.PushFront(item)
 		return item, nil
 	}
 
-	if elt := c.b2.Lookup(key); elt != nil {
+	if ghost := c.b2.Lookup(key); ghost != nil {
 		c.setPart(maxInt(0, c.part-maxInt(c.b1.Len()/c.b2.Len(), 1)))
 		c.replace(key)
-		c.b2.Remove(key, elt)
-		c.t2.PushFront(key)
+		c.b2.Remove(ghost)
+		c.t2.PushFront(item)
 		return item, nil
 	}
 
 	if c.isCacheFull() && c.t1.Len()+c.b1.Len() == c.size {
 		if c.t1.Len() < c.size {
-			c.b1.RemoveTail()
+			c.b1.RemoveOldest()
 			c.replace(key)
 		} else {
-			pop := c.t1.RemoveTail()
-			item, ok := c.items[pop]
+			pop, ok := c.t1.RemoveTailFunc(c.isEvictable)
 			if ok {
-				delete(c.items, pop)
-				if c.evictedFunc != nil {
-					c.evictedFunc(item.key, item.value)
+				if _, found := c.items[pop.key]; found {
+					delete(c.items, pop.key)
+					endEviction := c.beginEviction()
+					c.notifyEvicted(pop.key, pop.value)
+					endEviction()
 				}
 			}
 		}
@@ -150,15 +314,15 @@ func (c *ARC) set(key, value interface{}) (interface{}, error) {
 		if total >= c.size {
 			if total == (2 * c.size) {
 				if c.b2.Len() > 0 {
-					c.b2.RemoveTail()
+					c.b2.RemoveOldest()
 				} else {
-					c.b1.RemoveTail()
+					c.b1.RemoveOldest()
 				}
 			}
 			c.replace(key)
 		}
 	}
-	c.t1.PushFront(key)
+	c.t1.PushFront(item)
 	return item, nil
 }
 
@@ -182,6 +346,107 @@ func (c *ARC) GetIFPresent(key interface{}) (interface{}, error) {
 	return v, err
 }
 
+// GetWithExpiration gets a value from cache pool using key if it exists,
+// together with the time at which it expires.
+// The returned time is nil if the value never expires.
+// LoaderFunc is not invoked if the key does not exist.
+func (c *ARC) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, nil, err
+	}
+	var expiration *time.Time
+	if exp := c.items[key].expiration; exp != nil {
+		t := *exp
+		expiration = &t
+	}
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v, expiration, nil
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet.
+// It neither resurrects expired values nor updates eviction state or statistics.
+func (c *ARC) GetStale(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	item, ok := c.items[key]
+	if !ok {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	value := item.value
+	c.mu.RUnlock()
+
+	if c.deserializeFunc != nil {
+		v, err := c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+		return v, true
+	}
+	return value, true
+}
+
+// Info returns the metadata of the specified key without updating
+// any eviction algorithm statistics or positions.
+func (c *ARC) Info(key interface{}) (EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.has(key, nil) {
+		return EntryInfo{}, false
+	}
+	item := c.items[key]
+	return newEntryInfo(item.accessInfo, item.expiration, item.pinned, c.segmentOf(key)), true
+}
+
+// GetVersioned gets a value from cache pool using key if it exists, together with its version.
+// The version is 0 if the key does not exist. LoaderFunc is not invoked.
+func (c *ARC) GetVersioned(key interface{}) (interface{}, uint64) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, 0
+	}
+	version := c.items[key].version
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, 0
+		}
+	}
+	return v, version
+}
+
+// SetIfVersion sets a new key-value pair only if the current version of the key equals version.
+// A version of 0 means the key must not exist.
+func (c *ARC) SetIfVersion(key, value interface{}, version uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var current uint64
+	if c.has(key, nil) {
+		current = c.items[key].version
+	}
+	if current != version {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Peek returns the value for the specified key if it is present in the cache
 // without updating any eviction algorithm statistics or positions.
 // This is a pure read operation that does not affect cache state.
@@ -220,41 +485,64 @@ func (c *ARC) get(key interface{}, onLoad bool) (interface{}, error) {
 }
 
 func (c *ARC) getValue(key interface{}, onLoad bool) (interface{}, error) {
+	if v, ok := c.readUnlocked(key, onLoad, c.lookup); ok {
+		return v, nil
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if elt := c.t1.Lookup(key); elt != nil {
-		c.t1.Remove(key, elt)
-		item := c.items[key]
+	defer c.unlock()
+	return c.readLocked(key, onLoad, c.lookup, c.deadlineOf)
+}
+
+// getMulti returns the values of the specified keys that are present in the cache
+// and the keys that are not, acquiring the lock only once.
+func (c *ARC) getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{}) {
+	return c.lookupMulti(keys, c.lookup)
+}
+
+// lookup returns the value for the specified key and updates the eviction state.
+// The caller must hold the lock.
+func (c *ARC) lookup(key interface{}, onLoad bool) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	if item := c.t1.Lookup(key); item != nil {
 		if !item.IsExpired(nil) {
-			c.t2.PushFront(key)
+			c.t1.Remove(item)
+			c.t2.PushFront(item)
 			if !onLoad {
 				c.stats.IncrHitCount()
+				item.recordAccess(c.clock.Now())
+				if c.sliding && item.expiration != nil {
+					t := c.clock.Now().Add(*c.expiration)
+					item.expiration = &t
+					c.scheduleExpiration(key, t)
+				}
+				if c.shouldRefresh(&item.accessInfo) {
+					c.refresh(key)
+				}
 			}
 			return item.value, nil
-		} else {
-			delete(c.items, key)
-			c.b1.PushFront(key)
-			if c.evictedFunc != nil {
-				c.evictedFunc(item.key, item.value)
-			}
 		}
+		c.expireOnAccess(key, c.remove)
 	}
-	if elt := c.t2.Lookup(key); elt != nil {
-		item := c.items[key]
+	if item := c.t2.Lookup(key); item != nil {
 		if !item.IsExpired(nil) {
-			c.t2.MoveToFront(elt)
+			c.t2.MoveToFront(item)
 			if !onLoad {
 				c.stats.IncrHitCount()
+				item.recordAccess(c.clock.Now())
+				if c.sliding && item.expiration != nil {
+					t := c.clock.Now().Add(*c.expiration)
+					item.expiration = &t
+					c.scheduleExpiration(key, t)
+				}
+				if c.shouldRefresh(&item.accessInfo) {
+					c.refresh(key)
+				}
 			}
 			return item.value, nil
-		} else {
-			delete(c.items, key)
-			c.t2.Remove(key, elt)
-			c.b2.PushFront(key)
-			if c.evictedFunc != nil {
-				c.evictedFunc(item.key, item.value)
-			}
 		}
+		c.expireOnAccess(key, c.remove)
 	}
 
 	if !onLoad {
@@ -264,6 +552,9 @@ func (c *ARC) getValue(key interface{}, onLoad bool) (interface{}, error) {
 }
 
 func (c *ARC) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
+	if v, ok := c.recallVictim(key, c); ok {
+		return v, nil
+	}
 	if c.loaderExpireFunc == nil {
 		return nil, ErrKeyNotFoundError
 	}
@@ -272,7 +563,7 @@ func (c *ARC) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
 			return nil, e
 		}
 		c.mu.Lock()
-		defer c.mu.Unlock()
+		defer c.unlock()
 		item, err := c.set(key, v)
 		if err != nil {
 			return nil, err
@@ -280,15 +571,109 @@ func (c *ARC) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
 		if expiration != nil {
 			t := c.clock.Now().Add(*expiration)
 			item.(*arcItem).expiration = &t
+			c.scheduleExpiration(key, t)
 		}
 		return v, nil
 	}, isWait)
 	if err != nil {
+		// value is the stale value, if any.
+		return value, err
+	}
+	return value, nil
+}
+
+// compute atomically replaces the value for the specified key with the result of fn.
+// fn receives the current value and whether the key is present in the cache.
+func (c *ARC) compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var (
+		old interface{}
+		err error
+	)
+	found := c.has(key, nil)
+	if found {
+		old = c.items[key].value
+		if c.deserializeFunc != nil {
+			old, err = c.deserializeFunc(key, old)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, err := fn(old, found)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.set(key, value); err != nil {
 		return nil, err
 	}
 	return value, nil
 }
 
+// Touch resets the expiration of the provided key to the default expiration
+// without updating any eviction algorithm statistics or positions.
+// If the cache has no default expiration, the key will never expire.
+func (c *ARC) Touch(key interface{}) bool {
+	return c.setExpiration(key, c.expiration)
+}
+
+// TouchWithExpire resets the expiration of the provided key to the given duration
+// without updating any eviction algorithm statistics or positions.
+func (c *ARC) TouchWithExpire(key interface{}, expiration time.Duration) bool {
+	return c.setExpiration(key, &expiration)
+}
+
+// SetExpiration changes the expiration of the provided key in place
+// without updating any eviction algorithm statistics or positions.
+// A non-positive duration removes the expiration so that the key never expires.
+func (c *ARC) SetExpiration(key interface{}, expiration time.Duration) bool {
+	if expiration <= 0 {
+		return c.setExpiration(key, nil)
+	}
+	return c.setExpiration(key, &expiration)
+}
+
+func (c *ARC) setExpiration(key interface{}, expiration *time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	item := c.items[key]
+	if expiration == nil {
+		item.expiration = nil
+	} else {
+		t := c.clock.Now().Add(*expiration)
+		item.expiration = &t
+		c.scheduleExpiration(key, t)
+	}
+	return true
+}
+
+// Pin prevents the provided key from being evicted.
+// A pinned key is still removed by Remove and on expiration.
+func (c *ARC) Pin(key interface{}) bool {
+	return c.setPinned(key, true)
+}
+
+// Unpin makes the provided key eligible for eviction again.
+func (c *ARC) Unpin(key interface{}) bool {
+	return c.setPinned(key, false)
+}
+
+func (c *ARC) setPinned(key interface{}, pinned bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	c.items[key].pinned = pinned
+	return true
+}
+
 // Has checks if key exists in cache
 func (c *ARC) Has(key interface{}) bool {
 	c.mu.RLock()
@@ -305,40 +690,198 @@ func (c *ARC) has(key interface{}, now *time.Time) bool {
 	return !item.IsExpired(now)
 }
 
+// storedKey returns the key of the entry of key, which the cache owns, without retaining key.
+func (c *ARC) storedKey(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if item := c.t1.Lookup(key); item != nil {
+		return item.key, true
+	}
+	if item := c.t2.Lookup(key); item != nil {
+		return item.key, true
+	}
+	return nil, false
+}
+
+// deadlineOf returns the time at which key expires if it is present in the cache and expires.
+func (c *ARC) deadlineOf(key interface{}) (time.Time, bool) {
+	item, ok := c.items[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return item.deadline(item.expiration)
+}
+
+// expirationOf returns the time at which key expires, or nil if it does not
+// expire or is not present. The caller must hold the lock.
+func (c *ARC) expirationOf(key interface{}) *time.Time {
+	if item, ok := c.items[key]; ok {
+		return item.expiration
+	}
+	return nil
+}
+
+// GetAndRemove removes the provided key from the cache and returns its value.
+// Returns false if the key is not present in the cache.
+func (c *ARC) GetAndRemove(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if !c.has(key, nil) {
+		return nil, false
+	}
+	value := c.items[key].value
+	if c.deserializeFunc != nil {
+		var err error
+		value, err = c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+	}
+	c.remove(key)
+	return value, true
+}
+
 // Remove removes the provided key from the cache.
 func (c *ARC) Remove(key interface{}) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	return c.remove(key)
 }
 
 func (c *ARC) remove(key interface{}) bool {
-	if elt := c.t1.Lookup(key); elt != nil {
-		c.t1.Remove(key, elt)
-		item := c.items[key]
+	if item := c.t1.Lookup(key); item != nil {
+		c.t1.Remove(item)
 		delete(c.items, key)
-		c.b1.PushFront(key)
-		if c.evictedFunc != nil {
-			c.evictedFunc(key, item.value)
-		}
+		c.pushGhost(c.b1, item)
+		c.notifyEvicted(key, item.value)
+		item.value = nil
 		return true
 	}
 
-	if elt := c.t2.Lookup(key); elt != nil {
-		c.t2.Remove(key, elt)
-		item := c.items[key]
+	if item := c.t2.Lookup(key); item != nil {
+		c.t2.Remove(item)
 		delete(c.items, key)
-		c.b2.PushFront(key)
-		if c.evictedFunc != nil {
-			c.evictedFunc(key, item.value)
-		}
+		c.pushGhost(c.b2, item)
+		c.notifyEvicted(key, item.value)
+		item.value = nil
 		return true
 	}
 
 	return false
 }
 
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+func (c *ARC) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.deleteExpired(c.deadlineOf, c.remove)
+}
+
+// sample returns up to n unexpired entries, chosen uniformly at random, with their
+// values deserialized.
+func (c *ARC) sample(n int) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := reservoir[interface{}, interface{}]{n: n}
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		r.offer(key, item.value)
+	}
+	return c.sampled(&r)
+}
+
+// entries returns a point-in-time copy of all unexpired entries.
+func (c *ARC) entries() []cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]cacheEntry, 0, len(c.items))
+	now := c.clock.Now()
+	for _, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		entries = append(entries, newCacheEntry(item.key, item.value, item.expiration))
+	}
+	return entries
+}
+
+// restore inserts entries, as returned by entries, with their expiration times.
+func (c *ARC) restore(entries []cacheEntry) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.beginRestore()()
+	for _, e := range entries {
+		item, err := c.set(e.key, e.value)
+		if err != nil {
+			continue
+		}
+		if e.expiration != nil {
+			item.(*arcItem).expiration = e.expiration
+			c.scheduleExpiration(e.key, *e.expiration)
+		}
+	}
+}
+
+// shrink evicts up to n entries and returns the number of evicted entries.
+func (c *ARC) shrink(n int) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := c.entryCount
+	for i := 0; i < n; i++ {
+		if !c.evictOne(nil) {
+			break
+		}
+	}
+	return int(count - c.entryCount)
+}
+
+// walk calls fn for each entry, with its value deserialized, while holding the read
+// lock and skips expired entries if checkExpired is true. It stops and returns false
+// as soon as fn returns false.
+func (c *ARC) walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool {
+	fn = c.deserializing(fn, true)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if checkExpired && item.IsExpired(&now) {
+			continue
+		}
+		if !fn(key, item.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeMulti removes the specified keys, acquiring the lock only once.
+func (c *ARC) removeMulti(keys []interface{}) int {
+	return c.removeKeys(keys, c.remove)
+}
+
+// removeIf removes all entries that satisfy fn, which is called with the deserialized
+// values, and returns the number of removed entries.
+func (c *ARC) removeIf(fn func(interface{}, interface{}) bool) int {
+	fn = c.deserializing(fn, false)
+	c.mu.Lock()
+	defer c.unlock()
+	var keys []interface{}
+	for key, item := range c.items {
+		if fn(key, item.value) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.remove(key)
+	}
+	return len(keys)
+}
+
 // GetALL returns all key-value pairs in the cache.
 func (c *ARC) GetALL(checkExpired bool) map[interface{}]interface{} {
 	c.mu.RLock()
@@ -374,30 +917,74 @@ func (c *ARC) Len(checkExpired bool) int {
 	if !checkExpired {
 		return len(c.items)
 	}
-	var length int
-	now := time.Now()
-	for k := range c.items {
-		if c.has(k, &now) {
-			length++
-		}
-	}
-	return length
+	return len(c.items) - c.countExpired(c.deadlineOf)
 }
 
 // Purge is used to completely clear the cache
 func (c *ARC) Purge() {
+	c.purge(c.purgeVisitorFunc)
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live to w.
+func (c *ARC) SaveTo(w io.Writer) error {
+	return c.saveTo(w, c.entries())
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache.
+func (c *ARC) LoadFrom(r io.Reader) error {
+	entries, err := c.loadFrom(r)
+	if err != nil {
+		return err
+	}
+	c.restore(entries)
+	return nil
+}
+
+// purge clears the cache and calls visit, if not nil, for each entry.
+func (c *ARC) purge(visit PurgeVisitorFunc) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if c.purgeVisitorFunc != nil {
+	if visit != nil {
 		for _, item := range c.items {
-			c.purgeVisitorFunc(item.key, item.value)
+			visit(item.key, item.value)
 		}
 	}
 
+	c.resetExpirations()
+	c.resetSize()
 	c.init()
 }
 
+// ARCState returns the current adaptation target and list sizes of the cache.
+func (c *ARC) ARCState() ARCState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return ARCState{
+		P:  c.part,
+		T1: c.t1.Len(),
+		T2: c.t2.Len(),
+		B1: c.b1.Len(),
+		B2: c.b2.Len(),
+	}
+}
+
+// DebugState returns the number of entries of the cache and its ARC state.
+func (c *ARC) DebugState() DebugState {
+	state := c.ARCState()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return DebugState{Policy: TYPE_ARC, Entries: len(c.items), ARC: &state}
+}
+
+// segmentOf returns the list in which the specified resident key resides.
+func (c *ARC) segmentOf(key interface{}) string {
+	if c.t2.Has(key) {
+		return SegmentARCT2
+	}
+	return SegmentARCT1
+}
+
 func (c *ARC) setPart(p int) {
 	if c.isCacheFull() {
 		c.part = p
@@ -405,24 +992,20 @@ func (c *ARC) setPart(p int) {
 }
 
 func (c *ARC) isCacheFull() bool {
-	return (c.t1.Len() + c.t2.Len()) == c.size
+	return (c.t1.Len() + c.t2.Len()) >= c.size
 }
 
 // IsExpired returns boolean value whether this item is expired or not.
 func (it *arcItem) IsExpired(now *time.Time) bool {
-	if it.expiration == nil {
+	deadline, ok := it.deadline(it.expiration)
+	if !ok {
 		return false
 	}
 	if now == nil {
 		t := it.clock.Now()
 		now = &t
 	}
-	return it.expiration.Before(*now)
-}
-
-type arcList struct {
-	l    *list.List
-	keys map[interface{}]*list.Element
+	return deadline.Before(*now)
 }
 
 type arcItem struct {
@@ -430,13 +1013,39 @@ type arcItem struct {
 	key        interface{}
 	value      interface{}
 	expiration *time.Time
+	pinned     bool
+	version    uint64
+	accessInfo
+
+	prev, next *arcItem
+	pos        uint64 // position in a ghost ring
+}
+
+// arcList is a doubly linked list of items, linked through the items themselves,
+// with an index from key to item.
+type arcList struct {
+	root arcItem // sentinel: root.next is the front, root.prev the back
+	n    int
+	keys map[interface{}]*arcItem
+}
+
+func newARCList(size int) *arcList {
+	al := &arcList{
+		keys: make(map[interface{}]*arcItem, size),
+	}
+	al.root.prev = &al.root
+	al.root.next = &al.root
+	return al
 }
 
-func newARCList() *arcList {
-	return &arcList{
-		l:    list.New(),
-		keys: make(map[interface{}]*list.Element),
+// Reset removes all items and keeps the storage of the key index.
+func (al *arcList) Reset() {
+	for k := range al.keys {
+		delete(al.keys, k)
 	}
+	al.root.prev = &al.root
+	al.root.next = &al.root
+	al.n = 0
 }
 
 func (al *arcList) Has(key interface{}) bool {
@@ -444,39 +1053,120 @@ func (al *arcList) Has(key interface{}) bool {
 	return ok
 }
 
-func (al *arcList) Lookup(key interface{}) *list.Element {
-	elt := al.keys[key]
-	return elt
+func (al *arcList) Lookup(key interface{}) *arcItem {
+	return al.keys[key]
 }
 
-func (al *arcList) MoveToFront(elt *list.Element) {
-	al.l.MoveToFront(elt)
+func (al *arcList) insertFront(it *arcItem) {
+	it.prev = &al.root
+	it.next = al.root.next
+	al.root.next.prev = it
+	al.root.next = it
 }
 
-func (al *arcList) PushFront(key interface{}) {
-	if elt, ok := al.keys[key]; ok {
-		al.l.MoveToFront(elt)
+func (al *arcList) unlink(it *arcItem) {
+	it.prev.next = it.next
+	it.next.prev = it.prev
+	it.prev = nil
+	it.next = nil
+}
+
+func (al *arcList) MoveToFront(it *arcItem) {
+	if al.root.next == it {
 		return
 	}
-	elt := al.l.PushFront(key)
-	al.keys[key] = elt
+	al.unlink(it)
+	al.insertFront(it)
 }
 
-func (al *arcList) Remove(key interface{}, elt *list.Element) {
-	delete(al.keys, key)
-	al.l.Remove(elt)
+func (al *arcList) PushFront(it *arcItem) {
+	if old, ok := al.keys[it.key]; ok {
+		if old == it {
+			al.MoveToFront(it)
+			return
+		}
+		al.Remove(old)
+	}
+	al.insertFront(it)
+	al.keys[it.key] = it
+	al.n++
 }
 
-func (al *arcList) RemoveTail() interface{} {
-	elt := al.l.Back()
-	al.l.Remove(elt)
-
-	key := elt.Value
-	delete(al.keys, key)
+func (al *arcList) Remove(it *arcItem) {
+	delete(al.keys, it.key)
+	al.unlink(it)
+	al.n--
+}
 
-	return key
+// RemoveTailFunc removes and returns the item closest to the tail for whose key fn returns true.
+func (al *arcList) RemoveTailFunc(fn func(interface{}) bool) (*arcItem, bool) {
+	for it := al.root.prev; it != &al.root; it = it.prev {
+		if fn(it.key) {
+			al.Remove(it)
+			return it, true
+		}
+	}
+	return nil, false
 }
 
 func (al *arcList) Len() int {
-	return al.l.Len()
+	return al.n
+}
+
+// arcGhosts is a ring of evicted items whose value has been dropped, oldest
+// first, with an index from key to item.
+type arcGhosts struct {
+	items *ring[*arcItem]
+	keys  map[interface{}]*arcItem
+}
+
+func newARCGhosts() *arcGhosts {
+	return &arcGhosts{
+		items: newRing(0, func(it *arcItem, pos uint64) { it.pos = pos }),
+		keys:  make(map[interface{}]*arcItem),
+	}
+}
+
+func (g *arcGhosts) Has(key interface{}) bool {
+	_, ok := g.keys[key]
+	return ok
+}
+
+func (g *arcGhosts) Lookup(key interface{}) *arcItem {
+	return g.keys[key]
+}
+
+// Push adds it as the newest ghost, replacing any ghost of the same key.
+func (g *arcGhosts) Push(it *arcItem) {
+	if old, ok := g.keys[it.key]; ok {
+		g.Remove(old)
+	}
+	g.items.Push(it)
+	g.keys[it.key] = it
+}
+
+func (g *arcGhosts) Remove(it *arcItem) {
+	delete(g.keys, it.key)
+	g.items.Remove(it.pos)
+}
+
+// RemoveOldest removes and returns the oldest ghost, or nil if there is none.
+func (g *arcGhosts) RemoveOldest() *arcItem {
+	it := g.items.Oldest()
+	if it != nil {
+		g.Remove(it)
+	}
+	return it
+}
+
+func (g *arcGhosts) Len() int {
+	return g.items.Len()
+}
+
+// Reset removes all ghosts and keeps their storage.
+func (g *arcGhosts) Reset() {
+	g.items.Reset()
+	for k := range g.keys {
+		delete(g.keys, k)
+	}
 }
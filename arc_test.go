@@ -112,3 +112,56 @@ func TestARCHas(t *testing.T) {
 		})
 	}
 }
+
+func TestARCState(t *testing.T) {
+	gc := New(4).ARC().Build().(*ARC)
+	for i := 0; i < 4; i++ {
+		gc.Set(i, i)
+	}
+	gc.Get(0)
+	gc.Get(1)
+	if s := gc.ARCState(); s != (ARCState{T1: 2, T2: 2}) {
+		t.Fatalf("unexpected state: %+v", s)
+	}
+
+	// Evict 2 and 3 from T1 into B1.
+	gc.Set(4, 4)
+	gc.Set(5, 5)
+	s := gc.ARCState()
+	if s.T1+s.T2 != 4 || s.B1 != 2 {
+		t.Fatalf("unexpected state: %+v", s)
+	}
+
+	// A hit in B1 makes ARC favour recency.
+	gc.Set(2, 2)
+	if s := gc.ARCState(); s.P == 0 {
+		t.Errorf("P should grow after a B1 hit: %+v", s)
+	}
+}
+
+func TestARCGhostLimit(t *testing.T) {
+	gc := New(10).ARC().ARCGhostLimit(3).Build().(*ARC)
+	for i := 0; i < 100; i++ {
+		gc.Set(i, i)
+		gc.Get(i)
+		gc.Get(i - 5)
+		if s := gc.ARCState(); s.B1+s.B2 > 3 || s.T1+s.T2 > 10 {
+			t.Fatalf("ghost lists exceed the limit: %+v", s)
+		}
+	}
+	if s := gc.ARCState(); s.T1+s.T2 != 10 {
+		t.Errorf("cache should be full: %+v", s)
+	}
+}
+
+func TestARCDebugState(t *testing.T) {
+	gc := New(4).ARC().Build()
+	for i := 0; i < 4; i++ {
+		gc.Set(i, i)
+	}
+	gc.Get(0)
+	s := gc.DebugState()
+	if s.Policy != TYPE_ARC || s.Entries != 4 || s.ARC == nil || *s.ARC != (ARCState{T1: 3, T2: 1}) {
+		t.Fatalf("unexpected state: %+v", s)
+	}
+}
@@ -0,0 +1,1196 @@
+package xcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// StorageType selects how a cache stores its entries, see CacheBuilder.Storage.
+type StorageType int
+
+const (
+	// HeapStorage stores keys and values as Go values in the data structures of
+	// the eviction policy. It is the default.
+	HeapStorage StorageType = iota
+	// BytesArena stores serialized entries in large byte segments and indexes them
+	// by the hash of their key in a map that holds no pointers, so that the garbage
+	// collector does not scan the entries. It needs SerializeFunc to return []byte
+	// and DeserializeFunc to decode it, supports only string and integer keys, and
+	// evicts entries in the order in which they have been written.
+	BytesArena
+)
+
+// ErrUnsupportedKey is returned when a key cannot be stored by the storage of the cache,
+// such as a key that is neither a string nor an integer with BytesArena storage.
+var ErrUnsupportedKey = errors.New("key type is not supported by the storage")
+
+const (
+	// arenaMinSegment and arenaMaxSegment bound the size of the segments of an
+	// ArenaCache, which doubles with every new segment. Larger entries get a
+	// segment of their own.
+	arenaMinSegment = 4 << 10
+	arenaMaxSegment = 1 << 20
+)
+
+// ArenaCache stores serialized entries in byte segments, see BytesArena.
+// Every entry is appended to the newest segment as a record of its encoded key
+// and value, and is indexed by the hash of its key. Overwritten and removed
+// records stay in their segment until all records of the segment are gone.
+// Discards the oldest written items first, so that segments drain in order.
+// If two keys have the same hash, writing one of them evicts the other.
+type ArenaCache struct {
+	baseCache
+	items    map[uint64]arenaItem
+	segments [][]byte // nil once all of its records are gone
+	live     []int    // number of live records per segment
+	first    int      // number of segments[0]
+	head     int      // offset in segments[0] before which all records are gone
+}
+
+func newArenaCache(cb *CacheBuilder) *ArenaCache {
+	c := &ArenaCache{}
+	buildCache(&c.baseCache, cb)
+	c.eventExpiration = c.expirationOf
+
+	c.init()
+	c.loadGroup.cache = c
+	c.startJanitor(c.DeleteExpired)
+	c.startTrimmer(c.shrink)
+	c.watchMemory(c.shrink)
+	return c
+}
+
+func (c *ArenaCache) init() {
+	if c.items != nil {
+		for k := range c.items {
+			delete(c.items, k)
+		}
+	} else {
+		c.items = make(map[uint64]arenaItem, c.size+1)
+	}
+	c.segments = nil
+	c.live = nil
+	c.first = 0
+	c.head = 0
+}
+
+func (c *ArenaCache) set(key, value interface{}) (uint64, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	c.removeStale(key, c.deadlineOf, c.remove)
+	if err := c.admit(key, c.has(key, nil)); err != nil {
+		return 0, err
+	}
+	var err error
+	if c.serializeFunc != nil {
+		value, err = c.serialize(key, value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		return 0, fmt.Errorf("xcache: BytesArena storage needs SerializeFunc to return []byte, not %T", value)
+	}
+	encoded, ok := appendArenaKey(nil, key)
+	if !ok {
+		return 0, ErrUnsupportedKey
+	}
+	if c.maxCost > 0 {
+		c.fitCost(key, data, func() { c.evict(1) })
+	}
+
+	// Check for existing item
+	h := arenaKeyHash(encoded)
+	item, ok := c.items[h]
+	if ok && !arenaKeyEqual(c.keyBytes(item), key) {
+		func() {
+			defer c.beginEviction()()
+			c.removeItem(h, item)
+		}()
+		ok = false
+	}
+	if ok {
+		c.notifyReplaced(key, c.valueBytes(item), data)
+		c.release(item)
+	} else {
+		// Verify size not exceeded
+		if c.full(len(c.items)) {
+			c.evict(c.evictionBatch())
+		}
+		item = arenaItem{}
+		item.setAccessInfo(newAccessInfo(c.clock.Now()))
+	}
+	item.segment, item.offset = c.write(encoded, data)
+	item.keyLen, item.valueLen = len(encoded), len(data)
+	if !ok {
+		c.items[h] = item
+		c.notifyAdded(key, data)
+	}
+
+	item.version = c.nextVersion()
+	ai := item.accessInfo()
+	c.recordWrite(key, &ai)
+	item.setAccessInfo(ai)
+	c.items[h] = item
+	if c.expiration != nil {
+		t := c.clock.Now().Add(*c.expiration)
+		c.setItemExpiration(h, key, &t)
+	}
+
+	c.callAdded(key, data)
+
+	return h, nil
+}
+
+// setItemExpiration changes the expiration of the item with hash h.
+// The caller must hold the lock.
+func (c *ArenaCache) setItemExpiration(h uint64, key interface{}, expiration *time.Time) {
+	item := c.items[h]
+	item.expiration = packTime(expiration)
+	c.items[h] = item
+	if expiration != nil {
+		c.scheduleExpiration(key, *expiration)
+	}
+}
+
+// write appends a record of an encoded key and its value to the newest segment
+// and returns the number of the segment and the offset of the key in it.
+func (c *ArenaCache) write(key, value []byte) (int, int) {
+	var header [2 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(len(key)))
+	n += binary.PutUvarint(header[n:], uint64(len(value)))
+	size := n + len(key) + len(value)
+
+	last := len(c.segments) - 1
+	if last < 0 || len(c.segments[last])+size > cap(c.segments[last]) {
+		segmentSize := arenaMinSegment
+		if last >= 0 {
+			segmentSize = minInt(2*cap(c.segments[last]), arenaMaxSegment)
+		}
+		c.segments = append(c.segments, make([]byte, 0, maxInt(segmentSize, size)))
+		c.live = append(c.live, 0)
+		if last >= 0 && c.live[last] == 0 {
+			c.drop(last)
+		}
+		last = len(c.segments) - 1
+	}
+	segment := append(c.segments[last], header[:n]...)
+	offset := len(segment)
+	segment = append(segment, key...)
+	c.segments[last] = append(segment, value...)
+	c.live[last]++
+	return c.first + last, offset
+}
+
+// release forgets the record of item, and the segment of the record once
+// all of its records are gone.
+func (c *ArenaCache) release(item arenaItem) {
+	i := item.segment - c.first
+	c.live[i]--
+	if c.live[i] == 0 && i != len(c.segments)-1 {
+		c.drop(i)
+	}
+}
+
+// drop frees the segment at index i, which must not be the newest segment.
+func (c *ArenaCache) drop(i int) {
+	c.segments[i] = nil
+	for c.segments[0] == nil {
+		c.segments = c.segments[1:]
+		c.live = c.live[1:]
+		c.first++
+		c.head = 0
+	}
+}
+
+// keyBytes returns the encoded key of item.
+func (c *ArenaCache) keyBytes(item arenaItem) []byte {
+	segment := c.segments[item.segment-c.first]
+	return segment[item.offset : item.offset+item.keyLen : item.offset+item.keyLen]
+}
+
+// valueBytes returns the serialized value of item. Records are never modified,
+// so it stays valid after the lock has been released.
+func (c *ArenaCache) valueBytes(item arenaItem) []byte {
+	segment := c.segments[item.segment-c.first]
+	start := item.offset + item.keyLen
+	return segment[start : start+item.valueLen : start+item.valueLen]
+}
+
+// find returns the hash and the item of key, if it is present in the cache.
+func (c *ArenaCache) find(key interface{}) (uint64, arenaItem, bool) {
+	h, ok := arenaHash(key)
+	if !ok {
+		return 0, arenaItem{}, false
+	}
+	item, ok := c.items[h]
+	if !ok || !arenaKeyEqual(c.keyBytes(item), key) {
+		return 0, arenaItem{}, false
+	}
+	return h, item, true
+}
+
+// scan calls fn for each record that is still in use, oldest first, until fn returns false.
+func (c *ArenaCache) scan(fn func(h uint64, item arenaItem) bool) {
+	for i, segment := range c.segments {
+		offset := 0
+		if i == 0 {
+			offset = c.head
+		}
+		for offset < len(segment) {
+			keyLen, n := binary.Uvarint(segment[offset:])
+			valueLen, m := binary.Uvarint(segment[offset+n:])
+			start := offset + n + m
+			offset = start + int(keyLen) + int(valueLen)
+			h := arenaKeyHash(segment[start : start+int(keyLen)])
+			item, ok := c.items[h]
+			if !ok || item.segment != c.first+i || item.offset != start {
+				continue
+			}
+			if !fn(h, item) {
+				return
+			}
+		}
+	}
+}
+
+// skipHead advances the head of the oldest segment over the records that are gone.
+func (c *ArenaCache) skipHead() {
+	if len(c.segments) == 0 {
+		return
+	}
+	segment := c.segments[0]
+	for c.head < len(segment) {
+		keyLen, n := binary.Uvarint(segment[c.head:])
+		valueLen, m := binary.Uvarint(segment[c.head+n:])
+		start := c.head + n + m
+		item, ok := c.items[arenaKeyHash(segment[start:start+int(keyLen)])]
+		if ok && item.segment == c.first && item.offset == start {
+			return
+		}
+		c.head = start + int(keyLen) + int(valueLen)
+	}
+}
+
+// set a new key-value pair
+func (c *ArenaCache) Set(key, value interface{}) error {
+	c.mu.Lock()
+	defer c.unlock()
+	_, err := c.set(key, value)
+	return err
+}
+
+// Set a new key-value pair with an expiration time
+func (c *ArenaCache) SetWithExpire(key, value interface{}, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	h, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	c.setItemExpiration(h, key, &t)
+	return nil
+}
+
+// SetWithExpireAndIdle sets a new key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (c *ArenaCache) SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	h, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	if expiration > 0 {
+		t := c.clock.Now().Add(expiration)
+		c.setItemExpiration(h, key, &t)
+	} else {
+		c.setItemExpiration(h, key, nil)
+	}
+	item := c.items[h]
+	ai := item.accessInfo()
+	c.setMaxIdle(key, &ai, maxIdle)
+	item.setAccessInfo(ai)
+	c.items[h] = item
+	return nil
+}
+
+// SetIfAbsent sets a new key-value pair only if the key is not present in the cache.
+func (c *ArenaCache) SetIfAbsent(key, value interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfAbsentWithExpire sets a new key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (c *ArenaCache) SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	h, err := c.set(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	c.setItemExpiration(h, key, &t)
+	return true, nil
+}
+
+// setMulti sets the specified key-value pairs, acquiring the lock only once.
+// If expiration is not nil, it is applied to every pair.
+func (c *ArenaCache) setMulti(items map[interface{}]interface{}, expiration *time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, value := range items {
+		h, err := c.set(key, value)
+		if err == ErrNotAdmitted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			c.setItemExpiration(h, key, &t)
+		}
+	}
+	return nil
+}
+
+// Get a value from cache pool using key if it exists.
+// If it does not exists key and has LoaderFunc,
+// generate a value using `LoaderFunc` method returns value.
+func (c *ArenaCache) Get(key interface{}) (interface{}, error) {
+	v, err := c.get(key, false)
+	if err == ErrKeyNotFoundError {
+		return c.getWithLoader(key, true)
+	}
+	return v, err
+}
+
+// GetIFPresent gets a value from cache pool using key if it exists.
+// If it does not exists key, returns KeyNotFoundError.
+// And send a request which refresh value for specified key if cache object has LoaderFunc.
+func (c *ArenaCache) GetIFPresent(key interface{}) (interface{}, error) {
+	v, err := c.get(key, false)
+	if err == ErrKeyNotFoundError {
+		return c.getWithLoader(key, false)
+	}
+	return v, err
+}
+
+// GetWithExpiration gets a value from cache pool using key if it exists,
+// together with the time at which it expires.
+// The returned time is nil if the value never expires.
+// LoaderFunc is not invoked if the key does not exist.
+func (c *ArenaCache) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, nil, err
+	}
+	_, item, _ := c.find(key)
+	expiration := item.expirationTime()
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v, expiration, nil
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet.
+// It neither resurrects expired values nor updates eviction state or statistics.
+func (c *ArenaCache) GetStale(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	_, item, ok := c.find(key)
+	if !ok {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	value := c.valueBytes(item)
+	c.mu.RUnlock()
+
+	if c.deserializeFunc != nil {
+		v, err := c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+		return v, true
+	}
+	return value, true
+}
+
+// Info returns the metadata of the specified key without updating
+// any eviction algorithm statistics or positions.
+func (c *ArenaCache) Info(key interface{}) (EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.has(key, nil) {
+		return EntryInfo{}, false
+	}
+	_, item, _ := c.find(key)
+	return newEntryInfo(item.accessInfo(), item.expirationTime(), item.pinned, ""), true
+}
+
+// GetVersioned gets a value from cache pool using key if it exists, together with its version.
+// The version is 0 if the key does not exist. LoaderFunc is not invoked.
+func (c *ArenaCache) GetVersioned(key interface{}) (interface{}, uint64) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, 0
+	}
+	_, item, _ := c.find(key)
+	version := item.version
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, 0
+		}
+	}
+	return v, version
+}
+
+// SetIfVersion sets a new key-value pair only if the current version of the key equals version.
+// A version of 0 means the key must not exist.
+func (c *ArenaCache) SetIfVersion(key, value interface{}, version uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var current uint64
+	if c.has(key, nil) {
+		_, item, _ := c.find(key)
+		current = item.version
+	}
+	if current != version {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Peek returns the value for the specified key if it is present in the cache
+// without updating any eviction algorithm statistics or positions.
+// This is a pure read operation that does not affect cache state.
+func (c *ArenaCache) Peek(key interface{}) (interface{}, error) {
+	c.mu.RLock()
+	_, item, ok := c.find(key)
+	if !ok || item.isExpired(c.clock, nil) {
+		c.mu.RUnlock()
+		return nil, ErrKeyNotFoundError
+	}
+	value := c.valueBytes(item)
+	c.mu.RUnlock()
+
+	if c.deserializeFunc != nil {
+		return c.deserializeFunc(key, value)
+	}
+	return value, nil
+}
+
+func (c *ArenaCache) get(key interface{}, onLoad bool) (interface{}, error) {
+	v, err := c.getValue(key, onLoad)
+	if err != nil {
+		return nil, err
+	}
+	if c.deserializeFunc != nil {
+		return c.deserializeFunc(key, v)
+	}
+	return v, nil
+}
+
+func (c *ArenaCache) getValue(key interface{}, onLoad bool) (interface{}, error) {
+	if v, ok := c.readUnlocked(key, onLoad, c.lookup); ok {
+		return v, nil
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	return c.readLocked(key, onLoad, c.lookup, c.deadlineOf)
+}
+
+// getMulti returns the values of the specified keys that are present in the cache
+// and the keys that are not, acquiring the lock only once.
+func (c *ArenaCache) getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{}) {
+	return c.lookupMulti(keys, c.lookup)
+}
+
+// lookup returns the serialized value for the specified key and updates the access
+// information of the entry. The caller must hold the lock.
+func (c *ArenaCache) lookup(key interface{}, onLoad bool) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	h, item, ok := c.find(key)
+	if ok {
+		if !item.isExpired(c.clock, nil) {
+			if !onLoad {
+				c.stats.IncrHitCount()
+				ai := item.accessInfo()
+				ai.recordAccess(c.clock.Now())
+				if c.sliding && item.expiration != 0 {
+					t := c.clock.Now().Add(*c.expiration)
+					item.expiration = packTime(&t)
+					c.scheduleExpiration(key, t)
+				}
+				refresh := c.shouldRefresh(&ai)
+				item.setAccessInfo(ai)
+				c.items[h] = item
+				if refresh {
+					c.refresh(key)
+				}
+			}
+			return c.valueBytes(item), nil
+		}
+		c.expireOnAccess(key, c.remove)
+	}
+	if !onLoad {
+		c.stats.IncrMissCount()
+	}
+	return nil, ErrKeyNotFoundError
+}
+
+func (c *ArenaCache) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
+	if v, ok := c.recallVictim(key, c); ok {
+		return v, nil
+	}
+	if c.loaderExpireFunc == nil {
+		return nil, ErrKeyNotFoundError
+	}
+	value, _, err := c.load(key, func(v interface{}, expiration *time.Duration, e error) (interface{}, error) {
+		if e != nil {
+			return nil, e
+		}
+		c.mu.Lock()
+		defer c.unlock()
+		h, err := c.set(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			c.setItemExpiration(h, key, &t)
+		}
+		return v, nil
+	}, isWait)
+	if err != nil {
+		// value is the stale value, if any.
+		return value, err
+	}
+	return value, nil
+}
+
+// evict removes the oldest unpinned item from the cache.
+func (c *ArenaCache) evict(count int) {
+	defer c.beginEviction()()
+	c.skipHead()
+	var victims []uint64
+	c.scan(func(h uint64, item arenaItem) bool {
+		if !item.pinned {
+			victims = append(victims, h)
+		}
+		return len(victims) < count
+	})
+	for _, h := range victims {
+		c.removeItem(h, c.items[h])
+	}
+}
+
+// compute atomically replaces the value for the specified key with the result of fn.
+// fn receives the current value and whether the key is present in the cache.
+func (c *ArenaCache) compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var (
+		old interface{}
+		err error
+	)
+	found := c.has(key, nil)
+	if found {
+		_, item, _ := c.find(key)
+		old = c.valueBytes(item)
+		if c.deserializeFunc != nil {
+			old, err = c.deserializeFunc(key, old)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, err := fn(old, found)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.set(key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Touch resets the expiration of the provided key to the default expiration
+// without updating any eviction algorithm statistics or positions.
+// If the cache has no default expiration, the key will never expire.
+func (c *ArenaCache) Touch(key interface{}) bool {
+	return c.setExpiration(key, c.expiration)
+}
+
+// TouchWithExpire resets the expiration of the provided key to the given duration
+// without updating any eviction algorithm statistics or positions.
+func (c *ArenaCache) TouchWithExpire(key interface{}, expiration time.Duration) bool {
+	return c.setExpiration(key, &expiration)
+}
+
+// SetExpiration changes the expiration of the provided key in place
+// without updating any eviction algorithm statistics or positions.
+// A non-positive duration removes the expiration so that the key never expires.
+func (c *ArenaCache) SetExpiration(key interface{}, expiration time.Duration) bool {
+	if expiration <= 0 {
+		return c.setExpiration(key, nil)
+	}
+	return c.setExpiration(key, &expiration)
+}
+
+func (c *ArenaCache) setExpiration(key interface{}, expiration *time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	h, _, _ := c.find(key)
+	if expiration == nil {
+		c.setItemExpiration(h, key, nil)
+	} else {
+		t := c.clock.Now().Add(*expiration)
+		c.setItemExpiration(h, key, &t)
+	}
+	return true
+}
+
+// Pin prevents the provided key from being evicted.
+// A pinned key is still removed by Remove and on expiration.
+func (c *ArenaCache) Pin(key interface{}) bool {
+	return c.setPinned(key, true)
+}
+
+// Unpin makes the provided key eligible for eviction again.
+func (c *ArenaCache) Unpin(key interface{}) bool {
+	return c.setPinned(key, false)
+}
+
+func (c *ArenaCache) setPinned(key interface{}, pinned bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	h, item, _ := c.find(key)
+	item.pinned = pinned
+	c.items[h] = item
+	return true
+}
+
+// Has checks if key exists in cache
+func (c *ArenaCache) Has(key interface{}) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	return c.has(key, &now)
+}
+
+func (c *ArenaCache) has(key interface{}, now *time.Time) bool {
+	_, item, ok := c.find(key)
+	if !ok {
+		return false
+	}
+	return !item.isExpired(c.clock, now)
+}
+
+// deadlineOf returns the time at which key expires if it is present in the cache and expires.
+func (c *ArenaCache) deadlineOf(key interface{}) (time.Time, bool) {
+	_, item, ok := c.find(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return item.deadline()
+}
+
+// expirationOf returns the time at which key expires, or nil if it does not
+// expire or is not present. The caller must hold the lock.
+func (c *ArenaCache) expirationOf(key interface{}) *time.Time {
+	if _, item, ok := c.find(key); ok {
+		return item.expirationTime()
+	}
+	return nil
+}
+
+// GetAndRemove removes the provided key from the cache and returns its value.
+// Returns false if the key is not present in the cache.
+func (c *ArenaCache) GetAndRemove(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if !c.has(key, nil) {
+		return nil, false
+	}
+	h, item, _ := c.find(key)
+	var value interface{} = c.valueBytes(item)
+	if c.deserializeFunc != nil {
+		var err error
+		value, err = c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+	}
+	c.removeItem(h, item)
+	return value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *ArenaCache) Remove(key interface{}) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	return c.remove(key)
+}
+
+func (c *ArenaCache) remove(key interface{}) bool {
+	if h, item, ok := c.find(key); ok {
+		c.removeItem(h, item)
+		return true
+	}
+	return false
+}
+
+func (c *ArenaCache) removeItem(h uint64, item arenaItem) {
+	key, value := decodeArenaKey(c.keyBytes(item)), c.valueBytes(item)
+	delete(c.items, h)
+	c.release(item)
+	c.notifyEvicted(key, value)
+}
+
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+func (c *ArenaCache) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.deleteExpired(c.deadlineOf, c.remove)
+}
+
+// sample returns up to n unexpired entries, chosen uniformly at random, with their
+// values deserialized.
+func (c *ArenaCache) sample(n int) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := reservoir[uint64, arenaItem]{n: n}
+	now := c.clock.Now()
+	for hash, item := range c.items {
+		if item.isExpired(c.clock, &now) {
+			continue
+		}
+		r.offer(hash, item)
+	}
+	items := make(map[interface{}]interface{}, len(r.values))
+	for _, item := range r.values {
+		key := decodeArenaKey(c.keyBytes(item))
+		if v, ok := c.deserialized(key, c.valueBytes(item)); ok {
+			items[key] = v
+		}
+	}
+	return items
+}
+
+// entries returns a point-in-time copy of all unexpired entries.
+func (c *ArenaCache) entries() []cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]cacheEntry, 0, len(c.items))
+	now := c.clock.Now()
+	// oldest first, so that re-inserting the entries in order restores write order
+	c.scan(func(h uint64, item arenaItem) bool {
+		if !item.isExpired(c.clock, &now) {
+			entries = append(entries, newCacheEntry(decodeArenaKey(c.keyBytes(item)), c.valueBytes(item), item.expirationTime()))
+		}
+		return true
+	})
+	return entries
+}
+
+// restore inserts entries, as returned by entries, with their expiration times.
+func (c *ArenaCache) restore(entries []cacheEntry) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.beginRestore()()
+	for _, e := range entries {
+		h, err := c.set(e.key, e.value)
+		if err != nil {
+			continue
+		}
+		if e.expiration != nil {
+			c.setItemExpiration(h, e.key, e.expiration)
+		}
+	}
+}
+
+// shrink evicts up to n entries and returns the number of evicted entries.
+func (c *ArenaCache) shrink(n int) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := c.entryCount
+	c.evict(n)
+	return int(count - c.entryCount)
+}
+
+// walk calls fn for each entry, with its value deserialized, while holding the read
+// lock and skips expired entries if checkExpired is true. It stops and returns false
+// as soon as fn returns false.
+func (c *ArenaCache) walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool {
+	fn = c.deserializing(fn, true)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for _, item := range c.items {
+		if checkExpired && item.isExpired(c.clock, &now) {
+			continue
+		}
+		if !fn(decodeArenaKey(c.keyBytes(item)), c.valueBytes(item)) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeMulti removes the specified keys, acquiring the lock only once.
+func (c *ArenaCache) removeMulti(keys []interface{}) int {
+	return c.removeKeys(keys, c.remove)
+}
+
+// removeIf removes all entries that satisfy fn, which is called with the deserialized
+// values, and returns the number of removed entries.
+func (c *ArenaCache) removeIf(fn func(interface{}, interface{}) bool) int {
+	fn = c.deserializing(fn, false)
+	c.mu.Lock()
+	defer c.unlock()
+	var keys []interface{}
+	for _, item := range c.items {
+		key := decodeArenaKey(c.keyBytes(item))
+		if fn(key, c.valueBytes(item)) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.remove(key)
+	}
+	return len(keys)
+}
+
+// GetALL returns all key-value pairs in the cache.
+func (c *ArenaCache) GetALL(checkExpired bool) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make(map[interface{}]interface{}, len(c.items))
+	now := time.Now()
+	for _, item := range c.items {
+		if !checkExpired || !item.isExpired(c.clock, &now) {
+			items[decodeArenaKey(c.keyBytes(item))] = c.valueBytes(item)
+		}
+	}
+	return items
+}
+
+// Keys returns a slice of the keys in the cache.
+func (c *ArenaCache) Keys(checkExpired bool) []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([]interface{}, 0, len(c.items))
+	now := time.Now()
+	for _, item := range c.items {
+		if !checkExpired || !item.isExpired(c.clock, &now) {
+			keys = append(keys, decodeArenaKey(c.keyBytes(item)))
+		}
+	}
+	return keys
+}
+
+// Len returns the number of items in the cache.
+func (c *ArenaCache) Len(checkExpired bool) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !checkExpired {
+		return len(c.items)
+	}
+	return len(c.items) - c.countExpired(c.deadlineOf)
+}
+
+// Completely clear the cache
+func (c *ArenaCache) Purge() {
+	c.purge(c.purgeVisitorFunc)
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live to w.
+func (c *ArenaCache) SaveTo(w io.Writer) error {
+	return c.saveTo(w, c.entries())
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache.
+func (c *ArenaCache) LoadFrom(r io.Reader) error {
+	entries, err := c.loadFrom(r)
+	if err != nil {
+		return err
+	}
+	c.restore(entries)
+	return nil
+}
+
+// purge clears the cache and calls visit, if not nil, for each entry.
+func (c *ArenaCache) purge(visit PurgeVisitorFunc) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if visit != nil {
+		for _, item := range c.items {
+			visit(decodeArenaKey(c.keyBytes(item)), c.valueBytes(item))
+		}
+	}
+
+	c.resetExpirations()
+	c.resetSize()
+	c.init()
+}
+
+// DebugState returns the number of entries of the cache.
+func (c *ArenaCache) DebugState() DebugState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return DebugState{Policy: TYPE_FIFO, Entries: len(c.items)}
+}
+
+// arenaItem locates the record of an entry and holds its metadata. It contains no
+// pointers, so that the garbage collector does not need to scan the items map.
+type arenaItem struct {
+	segment    int
+	offset     int
+	keyLen     int
+	valueLen   int
+	expiration int64 // unix nanoseconds, or zero if the entry does not expire
+	created    int64
+	accessed   int64
+	used       int64
+	refreshed  int64
+	accesses   uint64
+	maxIdle    time.Duration
+	version    uint64
+	pinned     bool
+}
+
+func (it *arenaItem) accessInfo() accessInfo {
+	return accessInfo{
+		created:   unpackTime(it.created),
+		accessed:  unpackTime(it.accessed),
+		accesses:  it.accesses,
+		used:      unpackTime(it.used),
+		refreshed: unpackTime(it.refreshed),
+		maxIdle:   it.maxIdle,
+	}
+}
+
+func (it *arenaItem) setAccessInfo(ai accessInfo) {
+	it.created = packTime(&ai.created)
+	it.accessed = packTime(&ai.accessed)
+	it.accesses = ai.accesses
+	it.used = packTime(&ai.used)
+	it.refreshed = packTime(&ai.refreshed)
+	it.maxIdle = ai.maxIdle
+}
+
+func (it *arenaItem) expirationTime() *time.Time {
+	if it.expiration == 0 {
+		return nil
+	}
+	t := unpackTime(it.expiration)
+	return &t
+}
+
+func (it *arenaItem) deadline() (time.Time, bool) {
+	ai := it.accessInfo()
+	return ai.deadline(it.expirationTime())
+}
+
+// isExpired returns boolean value whether this item is expired or not.
+func (it *arenaItem) isExpired(clock Clock, now *time.Time) bool {
+	deadline, ok := it.deadline()
+	if !ok {
+		return false
+	}
+	if now == nil {
+		t := clock.Now()
+		now = &t
+	}
+	return deadline.Before(*now)
+}
+
+// packTime returns t as unix nanoseconds, or zero if t is nil or the zero time.
+func packTime(t *time.Time) int64 {
+	if t == nil || t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// unpackTime returns the time of unix nanoseconds n, or the zero time for zero.
+func unpackTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// The kinds of keys that ArenaCache encodes as the first byte of a key.
+const (
+	arenaKeyString byte = iota
+	arenaKeyInt
+	arenaKeyInt8
+	arenaKeyInt16
+	arenaKeyInt32
+	arenaKeyInt64
+	arenaKeyUint
+	arenaKeyUint8
+	arenaKeyUint16
+	arenaKeyUint32
+	arenaKeyUint64
+	arenaKeyUintptr
+)
+
+// appendArenaKey appends the encoding of key to dst: its kind followed by the
+// bytes of a string or the 8 little endian bytes of an integer.
+// Returns false if key is neither a string nor an integer.
+func appendArenaKey(dst []byte, key interface{}) ([]byte, bool) {
+	var (
+		kind byte
+		v    uint64
+	)
+	switch k := key.(type) {
+	case string:
+		return append(append(dst, arenaKeyString), k...), true
+	case int:
+		kind, v = arenaKeyInt, uint64(k)
+	case int8:
+		kind, v = arenaKeyInt8, uint64(k)
+	case int16:
+		kind, v = arenaKeyInt16, uint64(k)
+	case int32:
+		kind, v = arenaKeyInt32, uint64(k)
+	case int64:
+		kind, v = arenaKeyInt64, uint64(k)
+	case uint:
+		kind, v = arenaKeyUint, uint64(k)
+	case uint8:
+		kind, v = arenaKeyUint8, uint64(k)
+	case uint16:
+		kind, v = arenaKeyUint16, uint64(k)
+	case uint32:
+		kind, v = arenaKeyUint32, uint64(k)
+	case uint64:
+		kind, v = arenaKeyUint64, k
+	case uintptr:
+		kind, v = arenaKeyUintptr, uint64(k)
+	default:
+		return dst, false
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(append(dst, kind), b[:]...), true
+}
+
+// decodeArenaKey returns the key encoded by appendArenaKey.
+func decodeArenaKey(b []byte) interface{} {
+	if b[0] == arenaKeyString {
+		return string(b[1:])
+	}
+	v := binary.LittleEndian.Uint64(b[1:])
+	switch b[0] {
+	case arenaKeyInt:
+		return int(v)
+	case arenaKeyInt8:
+		return int8(v)
+	case arenaKeyInt16:
+		return int16(v)
+	case arenaKeyInt32:
+		return int32(v)
+	case arenaKeyInt64:
+		return int64(v)
+	case arenaKeyUint:
+		return uint(v)
+	case arenaKeyUint8:
+		return uint8(v)
+	case arenaKeyUint16:
+		return uint16(v)
+	case arenaKeyUint32:
+		return uint32(v)
+	case arenaKeyUint64:
+		return v
+	}
+	return uintptr(v)
+}
+
+// arenaKeyEqual reports whether b is the encoding of key, without allocating.
+func arenaKeyEqual(b []byte, key interface{}) bool {
+	if s, ok := key.(string); ok {
+		return b[0] == arenaKeyString && string(b[1:]) == s
+	}
+	var buf [9]byte
+	encoded, ok := appendArenaKey(buf[:0], key)
+	return ok && string(encoded) == string(b)
+}
+
+// arenaKeyHash returns the hash of an encoded key. Integers are hashed together
+// with their kind, so that equal integers of different types do not collide.
+func arenaKeyHash(b []byte) uint64 {
+	if b[0] == arenaKeyString {
+		return xxhash.Sum64(b[1:])
+	}
+	return xxhash.Sum64(b)
+}
+
+// arenaHash returns arenaKeyHash of the encoding of key, without allocating.
+// Returns false if key is neither a string nor an integer.
+func arenaHash(key interface{}) (uint64, bool) {
+	if s, ok := key.(string); ok {
+		return xxhash.Sum64String(s), true
+	}
+	var buf [9]byte
+	encoded, ok := appendArenaKey(buf[:0], key)
+	if !ok {
+		return 0, false
+	}
+	return xxhash.Sum64(encoded), true
+}
@@ -0,0 +1,196 @@
+package xcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func buildTestArenaCache(size int) *CacheBuilder {
+	return New(size).
+		FIFO().
+		Storage(BytesArena).
+		SerializeFunc(func(key, value interface{}) (interface{}, error) {
+			return []byte(value.(string)), nil
+		}).
+		DeserializeFunc(func(key, value interface{}) (interface{}, error) {
+			return string(value.([]byte)), nil
+		})
+}
+
+func TestArenaGet(t *testing.T) {
+	size := 1000
+	gc := buildTestArenaCache(size).LoaderFunc(loader).Build()
+	testSetCache(t, gc, size)
+	testGetCache(t, gc, size)
+	if n := gc.Len(false); n != size {
+		t.Errorf("%v != %v", n, size)
+	}
+}
+
+func TestArenaKeys(t *testing.T) {
+	gc := buildTestArenaCache(100).Build()
+	keys := []interface{}{"a", "", 1, -1, int8(-1), int16(2), int32(3), int64(4), uint(5), uint8(6), uint16(7), uint32(8), uint64(9), uintptr(10)}
+	for i, key := range keys {
+		if err := gc.Set(key, fmt.Sprint(i)); err != nil {
+			t.Fatalf("%v: %v", key, err)
+		}
+	}
+	for i, key := range keys {
+		if v, err := gc.Get(key); err != nil || v != fmt.Sprint(i) {
+			t.Errorf("%v: %v, %v != %v", key, v, err, i)
+		}
+	}
+	got := keysToMap(gc.Keys(false))
+	if !reflect.DeepEqual(got, keysToMap(keys)) {
+		t.Errorf("%v != %v", got, keys)
+	}
+
+	if err := gc.Set(struct{}{}, "x"); err != ErrUnsupportedKey {
+		t.Errorf("%v != %v", err, ErrUnsupportedKey)
+	}
+	if _, err := gc.Get(struct{}{}); err != ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+	}
+}
+
+func TestArenaEvictsInWriteOrder(t *testing.T) {
+	var evicted []interface{}
+	gc := buildTestArenaCache(3).
+		EvictedFunc(func(key, value interface{}) {
+			evicted = append(evicted, key)
+		}).
+		Build()
+	gc.Set(1, "a")
+	gc.Set(2, "b")
+	gc.Set(3, "c")
+	gc.Pin(2)
+	gc.Set(1, "A") // rewriting makes key 1 the newest entry
+
+	gc.Set(4, "d")
+	gc.Set(5, "e")
+	if !reflect.DeepEqual(evicted, []interface{}{3, 1}) {
+		t.Errorf("%v != %v", evicted, []interface{}{3, 1})
+	}
+	if !gc.Has(2) {
+		t.Error("pinned key 2 should not be evicted")
+	}
+}
+
+func TestArenaReleasesSegments(t *testing.T) {
+	gc := buildTestArenaCache(10).Build()
+	value := string(make([]byte, 1000))
+	for i := 0; i < 10000; i++ {
+		gc.Set(i, value)
+	}
+	c := gc.(*ArenaCache)
+	var bytes int
+	for _, segment := range c.segments {
+		bytes += cap(segment)
+	}
+	if bytes > 2*arenaMaxSegment {
+		t.Errorf("%v segments with %v bytes for 10 entries", len(c.segments), bytes)
+	}
+	for i := 9990; i < 10000; i++ {
+		if v, err := gc.Get(i); err != nil || v != value {
+			t.Errorf("%v: %v", i, err)
+		}
+	}
+
+	for i := 9990; i < 10000; i++ {
+		gc.Remove(i)
+	}
+	gc.Set("last", "x")
+	if n := len(c.segments); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+}
+
+func TestArenaExpiration(t *testing.T) {
+	clock := NewFakeClock()
+	var expired []interface{}
+	gc := buildTestArenaCache(10).
+		Clock(clock).
+		Expiration(time.Second).
+		ExpiredFunc(func(key, value interface{}) {
+			expired = append(expired, key)
+		}).
+		Build()
+	gc.Set("a", "1")
+	gc.SetWithExpire("b", "2", 3*time.Second)
+	if _, exp, err := gc.GetWithExpiration("b"); err != nil || !exp.Equal(clock.Now().Add(3*time.Second)) {
+		t.Errorf("%v, %v", exp, err)
+	}
+
+	clock.Advance(2 * time.Second)
+	if _, err := gc.Get("a"); err != ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+	}
+	if v, err := gc.Get("b"); err != nil || v != "2" {
+		t.Errorf("%v, %v", v, err)
+	}
+	clock.Advance(2 * time.Second)
+	if n := gc.DeleteExpired(); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+	if !reflect.DeepEqual(expired, []interface{}{"a", "b"}) {
+		t.Errorf("%v != %v", expired, []interface{}{"a", "b"})
+	}
+}
+
+func TestArenaBuildE(t *testing.T) {
+	if _, err := New(10).Storage(BytesArena).BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+	if _, err := buildTestArenaCache(10).LRU().BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+	if _, err := buildTestArenaCache(10).Storage(StorageType(-1)).BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+	gc := buildTestArenaCache(10).Build()
+	if _, ok := gc.(*ArenaCache); !ok {
+		t.Errorf("%T is not an arena cache", gc)
+	}
+}
+
+func TestArenaItemHasNoPointers(t *testing.T) {
+	tp := reflect.TypeOf(arenaItem{})
+	for i := 0; i < tp.NumField(); i++ {
+		switch tp.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int64, reflect.Uint64, reflect.Bool:
+		default:
+			t.Errorf("field %v of kind %v", tp.Field(i).Name, tp.Field(i).Type.Kind())
+		}
+	}
+}
+
+func TestXCacheArena(t *testing.T) {
+	cache := NewXCache[string, string](100).
+		BucketCount(4).
+		Storage(BytesArena).
+		EvictType(TYPE_FIFO).
+		SerializeFunc(func(key, value string) ([]byte, error) {
+			return []byte(value), nil
+		}).
+		DeserializeFunc(func(key string, b []byte) (string, error) {
+			return string(b), nil
+		}).
+		Build()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprint(i), fmt.Sprint("value", i))
+	}
+	snapshot := cache.Snapshot()
+	if err := cache.Rebucket(8); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*XCache[string, string]{cache, snapshot} {
+		for i := 0; i < 100; i++ {
+			if v, err := c.Get(fmt.Sprint(i)); err != nil || v != fmt.Sprint("value", i) {
+				t.Errorf("%v: %v, %v", i, v, err)
+			}
+		}
+	}
+}
@@ -22,6 +22,10 @@ func BenchmarkAlgorithms_BasicOperations(b *testing.B) {
 		{"LRU", TYPE_LRU},
 		{"LFU", TYPE_LFU},
 		{"ARC", TYPE_ARC},
+		{"FIFO", TYPE_FIFO},
+		{"Random", TYPE_RANDOM},
+		{"ApproxLRU", TYPE_APPROX_LRU},
+		{"TTL", TYPE_TTL},
 	}
 
 	for _, algo := range algorithms {
@@ -80,6 +84,10 @@ func BenchmarkAlgorithms_AccessPatterns(b *testing.B) {
 		{"LRU", TYPE_LRU},
 		{"LFU", TYPE_LFU},
 		{"ARC", TYPE_ARC},
+		{"FIFO", TYPE_FIFO},
+		{"Random", TYPE_RANDOM},
+		{"ApproxLRU", TYPE_APPROX_LRU},
+		{"TTL", TYPE_TTL},
 	}
 
 	// 1. Sequential access pattern
@@ -199,6 +207,10 @@ func BenchmarkAlgorithms_Concurrent(b *testing.B) {
 		{"LRU", TYPE_LRU},
 		{"LFU", TYPE_LFU},
 		{"ARC", TYPE_ARC},
+		{"FIFO", TYPE_FIFO},
+		{"Random", TYPE_RANDOM},
+		{"ApproxLRU", TYPE_APPROX_LRU},
+		{"TTL", TYPE_TTL},
 	}
 
 	for _, algo := range algorithms {
@@ -234,6 +246,10 @@ func BenchmarkAlgorithms_LargeScale(b *testing.B) {
 		{"LRU", TYPE_LRU},
 		{"LFU", TYPE_LFU},
 		{"ARC", TYPE_ARC},
+		{"FIFO", TYPE_FIFO},
+		{"Random", TYPE_RANDOM},
+		{"ApproxLRU", TYPE_APPROX_LRU},
+		{"TTL", TYPE_TTL},
 	}
 
 	largeCacheSize := 10000
@@ -281,6 +297,10 @@ func BenchmarkAlgorithms_WorkloadPatterns(b *testing.B) {
 		{"LRU", TYPE_LRU},
 		{"LFU", TYPE_LFU},
 		{"ARC", TYPE_ARC},
+		{"FIFO", TYPE_FIFO},
+		{"Random", TYPE_RANDOM},
+		{"ApproxLRU", TYPE_APPROX_LRU},
+		{"TTL", TYPE_TTL},
 	}
 
 	// Database-like access pattern - Time locality strong
@@ -372,6 +392,10 @@ func runAlgorithmComparison(b *testing.B, name string, workloadFunc func(Cache)
 		{"LRU", TYPE_LRU},
 		{"LFU", TYPE_LFU},
 		{"ARC", TYPE_ARC},
+		{"FIFO", TYPE_FIFO},
+		{"Random", TYPE_RANDOM},
+		{"ApproxLRU", TYPE_APPROX_LRU},
+		{"TTL", TYPE_TTL},
 	}
 
 	results := make(map[string]float64)
@@ -3,7 +3,9 @@ package xcache
 import (
 	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,15 +15,55 @@ const (
 	TYPE_LFU    = "lfu"
 	TYPE_ARC    = "arc"
 	TYPE_LIRS   = "lirs"
+	TYPE_FIFO   = "fifo"
+	TYPE_RANDOM = "random"
+
+	TYPE_APPROX_LRU = "approx_lru"
+	TYPE_TTL        = "ttl"
+	TYPE_SCORE      = "score"
 )
 
 var ErrKeyNotFoundError = errors.New("key not found")
 
+// ErrInvalidConfig is wrapped by the errors that BuildE returns for an invalid configuration.
+var ErrInvalidConfig = errors.New("invalid cache configuration")
+
+// StaleError is returned together with the previous value of a key when
+// loading a new value has failed and the cache serves stale values.
+type StaleError struct {
+	// Err is the error of the loader.
+	Err error
+}
+
+func (e *StaleError) Error() string {
+	return "stale value: " + e.Err.Error()
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// ErrLoaderTimeout is returned when the loader does not return within the loader timeout.
+var ErrLoaderTimeout = errors.New("loader timed out")
+
+// ErrLoaderPanic is wrapped by the error returned to all callers waiting for a load when the loader panics.
+var ErrLoaderPanic = errors.New("loader panicked")
+
 type Cache interface {
 	// Set inserts or updates the specified key-value pair.
 	Set(key, value interface{}) error
 	// SetWithExpire inserts or updates the specified key-value pair with an expiration time.
 	SetWithExpire(key, value interface{}, expiration time.Duration) error
+	// SetWithExpireAndIdle inserts or updates the specified key-value pair that expires
+	// after expiration or once it has not been used for maxIdle, whichever comes first.
+	SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error
+	// SetIfAbsent inserts the specified key-value pair only if the key is not present in the cache.
+	// Returns true if the pair has been inserted.
+	SetIfAbsent(key, value interface{}) (bool, error)
+	// SetIfAbsentWithExpire inserts the specified key-value pair with an expiration time
+	// only if the key is not present in the cache.
+	// Returns true if the pair has been inserted.
+	SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error)
 	// Get returns the value for the specified key if it is present in the cache.
 	// If the key is not present in the cache and the cache has LoaderFunc,
 	// invoke the `LoaderFunc` function and inserts the key-value pair in the cache.
@@ -31,6 +73,25 @@ type Cache interface {
 	// GetIFPresent returns the value for the specified key if it is present in the cache.
 	// Return KeyNotFoundError if the key is not present.
 	GetIFPresent(key interface{}) (interface{}, error)
+	// GetWithExpiration returns the value for the specified key if it is present in the cache,
+	// together with its expiration time. The expiration time is nil if the value never expires.
+	// Return KeyNotFoundError if the key is not present.
+	GetWithExpiration(key interface{}) (interface{}, *time.Time, error)
+	// GetStale returns the value for the specified key even if it has expired,
+	// as long as it has not been removed from the cache yet.
+	// Returns false if the key is not present.
+	GetStale(key interface{}) (interface{}, bool)
+	// Info returns the metadata of the specified key without affecting cache state.
+	// Returns false if the key is not present.
+	Info(key interface{}) (EntryInfo, bool)
+	// GetVersioned returns the value for the specified key together with its version.
+	// Every write assigns the entry a new version that is greater than all versions
+	// previously assigned by the cache. The version is 0 if the key is not present.
+	GetVersioned(key interface{}) (interface{}, uint64)
+	// SetIfVersion inserts or updates the specified key-value pair only if the current
+	// version of the key equals version. A version of 0 means the key must not be present.
+	// Returns true if the pair has been written.
+	SetIfVersion(key, value interface{}, version uint64) (bool, error)
 	// Peek returns the value for the specified key if it is present in the cache
 	// without updating any eviction algorithm statistics or positions.
 	// This is a pure read operation that does not affect cache state.
@@ -39,44 +100,201 @@ type Cache interface {
 	// GetAll returns a map containing all key-value pairs in the cache.
 	GetALL(checkExpired bool) map[interface{}]interface{}
 	get(key interface{}, onLoad bool) (interface{}, error)
+	getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{})
+	setMulti(items map[interface{}]interface{}, expiration *time.Duration) error
+	removeIf(fn func(interface{}, interface{}) bool) int
+	removeMulti(keys []interface{}) int
+	sample(n int) map[interface{}]interface{}
+	entries() []cacheEntry
+	restore(entries []cacheEntry)
+	shrink(n int) int
+	purge(visit PurgeVisitorFunc)
+	detach()
+	setVictim(victim Tier)
+	walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool
+	compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error)
 	// Remove removes the specified key from the cache if the key is present.
 	// Returns true if the key was present and the key has been deleted.
 	Remove(key interface{}) bool
+	// GetAndRemove removes the specified key from the cache and returns its value.
+	// Returns false if the key was not present.
+	GetAndRemove(key interface{}) (interface{}, bool)
+	// DeleteExpired removes all expired key-value pairs from the cache,
+	// invoking ExpiredFunc for each of them, and returns the number of removed pairs.
+	DeleteExpired() int
 	// Purge removes all key-value pairs from the cache.
 	Purge()
+	// Close stops the background janitor of the cache, if any, and delivers
+	// the pending callbacks. The cache remains usable, but expired entries are
+	// then only removed lazily and callbacks are called right away.
+	Close()
+	// SaveTo writes the entries of the cache with the time they have left to live
+	// to w as a gob stream, so that they can be restored by LoadFrom, for example
+	// after a restart. Keys and values are encoded as interface values, so their
+	// types other than the basic types must be registered with gob.Register.
+	// Values are written as returned by Get, not as stored with SerializeFunc.
+	SaveTo(w io.Writer) error
+	// LoadFrom adds the entries written by SaveTo to the cache, replacing the values
+	// of keys that are present, without calling AddedFunc or consulting the admission
+	// policy. The entries expire after the time they had left to live when they were
+	// written. Nothing is added if r cannot be read; ErrUnknownFormat is returned if
+	// r has not been written by SaveTo.
+	LoadFrom(r io.Reader) error
 	// Keys returns a slice containing all keys in the cache.
 	Keys(checkExpired bool) []interface{}
 	// Len returns the number of items in the cache.
 	Len(checkExpired bool) int
 	// Has returns true if the key exists in the cache.
 	Has(key interface{}) bool
+	// Touch resets the expiration of the specified key to the default expiration
+	// without returning its value or updating hit/miss statistics.
+	// Returns false if the key is not present in the cache.
+	Touch(key interface{}) bool
+	// TouchWithExpire resets the expiration of the specified key to the given duration
+	// without returning its value or updating hit/miss statistics.
+	// Returns false if the key is not present in the cache.
+	TouchWithExpire(key interface{}, expiration time.Duration) bool
+	// SetExpiration changes the expiration of the specified key in place.
+	// A non-positive duration removes the expiration so that the key never expires.
+	// Returns false if the key is not present in the cache.
+	SetExpiration(key interface{}, expiration time.Duration) bool
+	// Pin prevents the specified key from being evicted. Pinned keys are still
+	// removed by Remove and on expiration, and are not counted as eviction candidates,
+	// so a cache whose entries are all pinned may grow beyond its size.
+	// Returns false if the key is not present in the cache.
+	Pin(key interface{}) bool
+	// Unpin makes the specified key eligible for eviction again.
+	// Returns false if the key is not present in the cache.
+	Unpin(key interface{}) bool
+	// Events returns the channel on which the changes of the entries are published,
+	// or nil if events are not enabled.
+	Events() <-chan Event
+	// DroppedEventCount returns the number of events that have been dropped
+	// because the event buffer was full.
+	DroppedEventCount() uint64
+	// Subscribe calls fn for every keyspace notification of a key that matches
+	// the glob pattern until the returned function is called.
+	Subscribe(pattern string, fn func(KeyspaceNotification)) (func(), error)
+	// SubscribeChan sends every keyspace notification of a key that matches
+	// the glob pattern to the returned channel until the returned function is called.
+	SubscribeChan(pattern string, size int) (<-chan KeyspaceNotification, func(), error)
+	// DroppedNotificationCount returns the number of keyspace notifications that
+	// have been dropped because the channel of a subscription was full.
+	DroppedNotificationCount() uint64
+	// EstimatedBytes returns the estimated number of bytes used by the entries,
+	// or zero if sizes are not estimated.
+	EstimatedBytes() int64
+	// Cost returns the total weight of the entries as computed by the Weigher,
+	// or zero if no Weigher is set.
+	Cost() int64
+	// DebugState returns a snapshot of the internal state of the eviction policy,
+	// intended for debugging and monitoring.
+	DebugState() DebugState
 
 	statsAccessor
 }
 
+// DebugState describes the internal state of the eviction policy of a cache.
+// Only the field of the policy of the cache, if any, is set.
+type DebugState struct {
+	// Policy is the eviction type of the cache, such as TYPE_LRU.
+	Policy string
+	// Entries is the number of entries stored in the cache, including expired
+	// entries that have not been removed yet.
+	Entries int
+	ARC     *ARCState
+	LIRS    *LIRSState
+	LFU     *LFUState
+}
+
+// OrderedCache is implemented by caches that keep their entries in eviction order,
+// such as LRUCache. It allows inspecting both ends of that order.
+type OrderedCache interface {
+	Cache
+	// Oldest returns the key, value and expiration time of the entry that will be evicted next.
+	// Returns false if the cache is empty.
+	Oldest() (interface{}, interface{}, *time.Time, bool)
+	// Newest returns the key, value and expiration time of the entry that will be evicted last.
+	// Returns false if the cache is empty.
+	Newest() (interface{}, interface{}, *time.Time, bool)
+}
+
+var (
+	_ OrderedCache = (*LRUCache)(nil)
+	_ OrderedCache = (*FIFOCache)(nil)
+)
+
 type baseCache struct {
 	clock            Clock
 	size             int
 	loaderExpireFunc LoaderExpireFunc
 	evictedFunc      EvictedFunc
+	expiredFunc      ExpiredFunc
 	purgeVisitorFunc PurgeVisitorFunc
 	addedFunc        AddedFunc
 	deserializeFunc  DeserializeFunc
 	serializeFunc    SerializeFunc
 	expiration       *time.Duration
-	mu               sync.RWMutex
+	expiring         bool
+	evicting         bool
+	restoring        bool
+	mu               profiledMutex
 	loadGroup        Group
+	version          uint64
+	wheel            *timingWheel
+	expirations      *expirationHeap
+	sliding          bool
+	maxIdle          time.Duration
+	expirationMode   ExpirationMode
+	janitor          *janitor
+	refreshAfter     time.Duration
+	callbacks        *callbackQueue
+	loaderTimeout    time.Duration
+	retryPolicy      *RetryPolicy
+	serveStale       bool
+	telemetry        Telemetry
+	events           *eventStream
+	heldEvents       []Event                          // added and updated events, see publish
+	eventExpiration  func(key interface{}) *time.Time // the expirationOf method of the policy
+	logger           Logger
+	sizeFunc         SizeFunc
+	bytes            int64
+	slowCallback     time.Duration
+	keyspace         *keyspace
+	entryCount       int64
+	capacity         *globalCapacity
+	weigher          WeigherFunc
+	maxCost          int64
+	cost             int64
+	sharedCost       *globalCapacity
+	reads            *readIndex
+	evictBatch       int
+	admission        AdmissionPolicy
+	pressure         *memoryWatcher
+	victim           Tier
+	tierOps          []tierOp   // changes of victim queued under the lock, see unlock
+	tierMu           sync.Mutex // orders the application of tierOps
+	trimmer          *trimmer
+	trimLimit        int // the capacity while trimmed under memory pressure, if not 0
 	*stats
 }
 
 type (
 	LoaderFunc       func(interface{}) (interface{}, error)
 	LoaderExpireFunc func(interface{}) (interface{}, *time.Duration, error)
+	BulkLoaderFunc   func([]interface{}) (map[interface{}]interface{}, error)
 	EvictedFunc      func(interface{}, interface{})
+	ExpiredFunc      func(interface{}, interface{})
 	PurgeVisitorFunc func(interface{}, interface{})
 	AddedFunc        func(interface{}, interface{})
 	DeserializeFunc  func(interface{}, interface{}) (interface{}, error)
 	SerializeFunc    func(interface{}, interface{}) (interface{}, error)
+	ScoreFunc        func(interface{}, interface{}, EntryMeta) float64
+	SizeFunc         func(interface{}, interface{}) int
+	WeigherFunc      func(interface{}, interface{}) int64
+	// Middleware wraps a cache to intercept its operations. It usually returns
+	// a struct that embeds next and overrides the methods it intercepts.
+	Middleware func(next Cache) Cache
 )
 
 type CacheBuilder struct {
@@ -85,11 +303,52 @@ type CacheBuilder struct {
 	size             int
 	loaderExpireFunc LoaderExpireFunc
 	evictedFunc      EvictedFunc
+	expiredFunc      ExpiredFunc
 	purgeVisitorFunc PurgeVisitorFunc
 	addedFunc        AddedFunc
 	expiration       *time.Duration
 	deserializeFunc  DeserializeFunc
 	serializeFunc    SerializeFunc
+	lfuDecay         time.Duration
+	sampleSize       int
+	arcGhostLimit    int
+	scoreFunc        ScoreFunc
+	wheelTick        time.Duration
+	sliding          bool
+	maxIdle          time.Duration
+	expirationMode   ExpirationMode
+	janitorInterval  time.Duration
+	refreshAfter     time.Duration
+	callbackBurst    int
+	callbackInterval time.Duration
+	loaderTimeout    time.Duration
+	retryPolicy      *RetryPolicy
+	serveStale       bool
+	telemetry        Telemetry
+	latencyBuckets   []time.Duration
+	events           *eventStream
+	logger           Logger
+	sizeFunc         SizeFunc
+	middlewares      []Middleware
+	slowCallback     time.Duration
+	lockProfiling    bool
+	keyspace         *keyspace
+	capacity         *globalCapacity
+	weigher          WeigherFunc
+	maxCost          int64
+	sharedCost       *globalCapacity
+	storage          StorageType
+	lockFreeReads    bool
+	deferPromotion   bool
+	evictBatch       int
+	admission        AdmissionPolicy
+	pressure         *memoryWatcher
+	victim           Tier
+	lowWatermark     float64
+	highWatermark    float64
+	preset           Preset
+	// newLRU, if not nil, builds the LRU cache instead of newLRUCache.
+	newLRU func(*CacheBuilder) Cache
 }
 
 func New(size int) *CacheBuilder {
@@ -123,6 +382,18 @@ func (cb *CacheBuilder) LoaderExpireFunc(loaderExpireFunc LoaderExpireFunc) *Cac
 	return cb
 }
 
+// CoalesceLoads sets a loader function that loads all the keys that are missed within
+// window with a single call, so that bursts of misses turn into one query.
+// Keys that bulkLoader does not return are not found. It replaces any other loader function.
+func (cb *CacheBuilder) CoalesceLoads(window time.Duration, bulkLoader BulkLoaderFunc) *CacheBuilder {
+	batcher := newLoadBatcher(window, bulkLoader)
+	cb.loaderExpireFunc = func(k interface{}) (interface{}, *time.Duration, error) {
+		v, err := batcher.load(k)
+		return v, nil, err
+	}
+	return cb
+}
+
 func (cb *CacheBuilder) EvictType(tp string) *CacheBuilder {
 	cb.tp = tp
 	return cb
@@ -148,11 +419,243 @@ func (cb *CacheBuilder) LIRS() *CacheBuilder {
 	return cb.EvictType(TYPE_LIRS)
 }
 
+func (cb *CacheBuilder) FIFO() *CacheBuilder {
+	return cb.EvictType(TYPE_FIFO)
+}
+
+func (cb *CacheBuilder) Random() *CacheBuilder {
+	return cb.EvictType(TYPE_RANDOM)
+}
+
+// ARCGhostLimit caps the total number of keys an ARC cache remembers
+// in its ghost lists B1 and B2 to limit its metadata footprint.
+// By default the ghost lists may hold up to the cache size.
+func (cb *CacheBuilder) ARCGhostLimit(limit int) *CacheBuilder {
+	cb.arcGhostLimit = limit
+	return cb
+}
+
+// ApproxLRU selects an approximated LRU that evicts the least recently used
+// of sampleSize randomly chosen entries.
+// A non-positive sampleSize uses DefaultApproxLRUSampleSize.
+func (cb *CacheBuilder) ApproxLRU(sampleSize int) *CacheBuilder {
+	cb.sampleSize = sampleSize
+	return cb.EvictType(TYPE_APPROX_LRU)
+}
+
+// TTL selects an eviction type that discards the items expiring soonest first.
+func (cb *CacheBuilder) TTL() *CacheBuilder {
+	return cb.EvictType(TYPE_TTL)
+}
+
+// ScoreFunc selects an eviction type that discards the entries with the lowest
+// score as rated by scoreFunc. Scores are recomputed whenever an entry is written,
+// read or its expiration changes, and kept in a heap until then.
+func (cb *CacheBuilder) ScoreFunc(scoreFunc ScoreFunc) *CacheBuilder {
+	cb.scoreFunc = scoreFunc
+	return cb.EvictType(TYPE_SCORE)
+}
+
+// EvictedFunc sets a function that is called for entries that are removed from the cache.
+// Panics in the function are recovered.
 func (cb *CacheBuilder) EvictedFunc(evictedFunc EvictedFunc) *CacheBuilder {
 	cb.evictedFunc = evictedFunc
 	return cb
 }
 
+// SlowCallbackThreshold makes the cache log a warning to its Logger whenever
+// EvictedFunc, ExpiredFunc, AddedFunc or SerializeFunc runs longer than threshold.
+// The time spent in these callbacks is reported by CallbackTime either way.
+func (cb *CacheBuilder) SlowCallbackThreshold(threshold time.Duration) *CacheBuilder {
+	cb.slowCallback = threshold
+	return cb
+}
+
+// LockProfiling makes the cache measure how often and how long its operations wait
+// for its lock while another goroutine holds it, which is reported by LockCount,
+// LockContentionCount and LockWaitTime. It adds a little overhead to every operation.
+func (cb *CacheBuilder) LockProfiling() *CacheBuilder {
+	cb.lockProfiling = true
+	return cb
+}
+
+// LockFreeReads makes Get serve hits on entries that have been read before
+// without taking the cache lock, which removes the lock as a bottleneck when
+// many goroutines read the same cache. The hits are applied to the eviction
+// policy in batches and may be dropped under contention, so the eviction order
+// is only approximately maintained, and they are not reflected in the
+// LastAccess and AccessCount of Info. Entries with a max idle time are always
+// read under the lock. It cannot be combined with SlidingExpiration, MaxIdle
+// or RefreshAfter, which update entries on every hit.
+func (cb *CacheBuilder) LockFreeReads() *CacheBuilder {
+	cb.lockFreeReads = true
+	return cb
+}
+
+// DeferredPromotion makes an LRU cache serve hits under the read lock, so that
+// concurrent readers do not wait for each other. Moving a hit entry to the front
+// of the eviction list needs the write lock, so it is queued and applied by the
+// next write, locked lookup or eviction, or when the queue is full. Until then,
+// Info, Oldest and Newest do not reflect the hit. Misses, expired entries and
+// entries with a max idle time are still looked up under the write lock.
+// It is only supported by LRU caches and cannot be combined with LockFreeReads,
+// SlidingExpiration, MaxIdle or RefreshAfter.
+func (cb *CacheBuilder) DeferredPromotion() *CacheBuilder {
+	cb.deferPromotion = true
+	return cb
+}
+
+// Use wraps the cache built by Build with middlewares, so that they can intercept
+// its operations. The first middleware is the outermost one, which sees each call first.
+// Calls that the cache makes internally, such as storing loaded values, are not intercepted.
+// Note that Build then returns the outermost wrapper instead of the cache itself.
+func (cb *CacheBuilder) Use(middlewares ...Middleware) *CacheBuilder {
+	cb.middlewares = append(cb.middlewares, middlewares...)
+	return cb
+}
+
+// EstimateSize makes the cache estimate the memory used by its entries with sizeFunc,
+// which returns the number of bytes used by a key and its value, as reported by
+// EstimatedBytes. If sizeFunc is nil, ReflectSize is used. The size of an entry
+// is estimated whenever it is written or removed, so sizeFunc should be fast
+// and return the same size for the same value.
+func (cb *CacheBuilder) EstimateSize(sizeFunc SizeFunc) *CacheBuilder {
+	if sizeFunc == nil {
+		sizeFunc = ReflectSize
+	}
+	cb.sizeFunc = sizeFunc
+	return cb
+}
+
+// Weigher makes the cache weigh its entries with weigher in units of the caller's
+// choice, such as bytes or rows, as reported by Cost. Together with MaxCost, the
+// capacity of the cache is enforced in these units. An entry is weighed whenever it
+// is written or removed, so weigher should be fast and return the same weight for
+// the same value. It receives the stored value, which is serialized if SerializeFunc is set.
+func (cb *CacheBuilder) Weigher(weigher WeigherFunc) *CacheBuilder {
+	cb.weigher = weigher
+	return cb
+}
+
+// MaxCost bounds the total weight of the entries, as computed by the Weigher, to cost.
+// Before an entry is written, entries are evicted according to the eviction policy
+// until it fits next to the others; an entry that weighs more than cost evicts all
+// other entries. Replacing the value of a key evicts as if the old value did not count.
+// The size passed to New still bounds the number of entries.
+func (cb *CacheBuilder) MaxCost(cost int64) *CacheBuilder {
+	cb.maxCost = cost
+	return cb
+}
+
+// EvictionBatch makes a full cache evict n entries at once, instead of one,
+// when a new key is added, so that writers under heavy churn do the eviction
+// bookkeeping less often. The cache then holds up to n - 1 entries fewer than
+// its size until it fills up again. Evictions to fit MaxCost are not batched.
+// It is not supported by ARC and LIRS caches, whose policies evict one entry per miss.
+func (cb *CacheBuilder) EvictionBatch(n int) *CacheBuilder {
+	cb.evictBatch = n
+	return cb
+}
+
+// Admission makes the cache consult policy before a new key is added to it, so
+// that keys which are unlikely to be used again do not evict the resident entries,
+// for example Admission(Doorkeeper(1<<16, 3)). A rejected key is not stored and
+// the write returns ErrNotAdmitted. It works with every eviction policy.
+func (cb *CacheBuilder) Admission(policy AdmissionPolicy) *CacheBuilder {
+	cb.admission = policy
+	return cb
+}
+
+// MemoryPressure makes the cache evict fraction of its entries when the heap in
+// use, as reported by runtime.MemStats, exceeds limit bytes, and keep its capacity
+// at the remaining number of entries until the heap has dropped by fraction below
+// the limit. A limit of 0 selects the soft memory limit of the runtime, set with
+// GOMEMLIMIT or debug.SetMemoryLimit, which requires Go 1.19; before, a limit of 0
+// disables the check. The heap is checked every interval, or every
+// DefaultMemoryCheckInterval if it is not positive, and the cache is trimmed again
+// only after a GC cycle has completed. Reading runtime.MemStats briefly stops the
+// world, so the interval should not be too short.
+// It is not supported by ARC and LIRS caches, whose policies need their full size.
+func (cb *CacheBuilder) MemoryPressure(limit uint64, fraction float64, interval time.Duration) *CacheBuilder {
+	cb.pressure = newMemoryWatcher(limit, fraction, interval)
+	return cb
+}
+
+// Watermarks makes the cache evict entries in the background, down to low times
+// its size, once it holds more than high times its size, so that writers rarely
+// evict entries themselves. The size remains a hard limit: a write to a full cache
+// evicts entries inline as usual, which happens only if the writers outpace the
+// background eviction. It requires 0 <= low < high < 1, e.g. Watermarks(0.8, 0.9).
+func (cb *CacheBuilder) Watermarks(low, high float64) *CacheBuilder {
+	cb.lowWatermark = low
+	cb.highWatermark = high
+	return cb
+}
+
+// VictimCache makes the cache move the entries it evicts to make room for others
+// to victim, usually a larger cache that serializes or compresses its values, and
+// look up keys that Get and GetIFPresent miss in victim before calling LoaderFunc.
+// An entry found in victim is moved back to the cache, so that the entries the
+// eviction policy has dropped too early get a second chance. Entries keep their
+// expiration time in victim; removed and expired entries are not moved to it.
+// Keys that are written to the cache are removed from victim, so that it does not
+// keep outdated values. Victim is only written once the lock of the cache has been
+// released, so that it may be a remote store.
+func (cb *CacheBuilder) VictimCache(victim Tier) *CacheBuilder {
+	cb.victim = victim
+	return cb
+}
+
+// MaxBytes bounds the memory used by the entries to about n bytes, as estimated by
+// ShallowSize, so that the cache does not need a Weigher of its own. It is MaxCost
+// with ShallowSize as the Weigher, and makes EstimatedBytes use ShallowSize unless
+// EstimateSize is set. Values that reference large amounts of memory through nested
+// pointers need a Weigher that knows the stored types instead.
+func (cb *CacheBuilder) MaxBytes(n int64) *CacheBuilder {
+	cb.weigher = shallowWeigher
+	if cb.sizeFunc == nil {
+		cb.sizeFunc = ShallowSize
+	}
+	return cb.MaxCost(n)
+}
+
+// shallowWeigher weighs entries by ShallowSize.
+func shallowWeigher(key, value interface{}) int64 {
+	return int64(ShallowSize(key, value))
+}
+
+// Logger makes the cache report recovered panics of loaders and callbacks, dropped
+// events and the activity of the janitor to logger.
+func (cb *CacheBuilder) Logger(logger Logger) *CacheBuilder {
+	cb.logger = logger
+	return cb
+}
+
+// KeyspaceNotifications enables Redis style keyspace notifications: Subscribe and
+// SubscribeChan report "set", "del", "expired" and "evicted" events for the keys
+// that match a pattern, for example to keep caches of other services coherent.
+func (cb *CacheBuilder) KeyspaceNotifications() *CacheBuilder {
+	cb.keyspace = newKeyspace()
+	return cb
+}
+
+// EventBuffer publishes the changes of the entries of the cache as Events on the
+// channel returned by Events, which buffers up to size events. Events are published
+// without blocking the cache: events that do not fit into the buffer are dropped
+// and counted by DroppedEventCount.
+func (cb *CacheBuilder) EventBuffer(size int) *CacheBuilder {
+	cb.events = newEventStream(size)
+	return cb
+}
+
+// ExpiredFunc sets a function that is called for entries that are removed
+// because they have expired. If it is not set, evictedFunc is called for them instead.
+// Panics in the function are recovered.
+func (cb *CacheBuilder) ExpiredFunc(expiredFunc ExpiredFunc) *CacheBuilder {
+	cb.expiredFunc = expiredFunc
+	return cb
+}
+
 func (cb *CacheBuilder) PurgeVisitorFunc(purgeVisitorFunc PurgeVisitorFunc) *CacheBuilder {
 	cb.purgeVisitorFunc = purgeVisitorFunc
 	return cb
@@ -168,6 +671,16 @@ func (cb *CacheBuilder) DeserializeFunc(deserializeFunc DeserializeFunc) *CacheB
 	return cb
 }
 
+// Storage selects how the cache stores its entries. With BytesArena, SerializeFunc
+// must return []byte and DeserializeFunc must decode it, and the type must be
+// TYPE_SIMPLE or TYPE_FIFO, as the entries are evicted in the order in which they
+// have been written. The []byte passed to DeserializeFunc and to the callbacks
+// refers to the memory of the cache and must not be modified.
+func (cb *CacheBuilder) Storage(storage StorageType) *CacheBuilder {
+	cb.storage = storage
+	return cb
+}
+
 func (cb *CacheBuilder) SerializeFunc(serializeFunc SerializeFunc) *CacheBuilder {
 	cb.serializeFunc = serializeFunc
 	return cb
@@ -178,19 +691,212 @@ func (cb *CacheBuilder) Expiration(expiration time.Duration) *CacheBuilder {
 	return cb
 }
 
+// SlidingExpiration makes every successful read reset the expiration of the entry
+// to the default expiration set by Expiration, so that entries expire once they
+// have not been read for that long. Entries that never expire are not affected.
+func (cb *CacheBuilder) SlidingExpiration() *CacheBuilder {
+	cb.sliding = true
+	return cb
+}
+
+// MaxIdle makes entries expire once they have been neither read nor written for maxIdle,
+// in addition to any absolute expiration.
+func (cb *CacheBuilder) MaxIdle(maxIdle time.Duration) *CacheBuilder {
+	cb.maxIdle = maxIdle
+	return cb
+}
+
+// LoaderTimeout makes loads fail with ErrLoaderTimeout if the loader does not
+// return within loaderTimeout, so that a stuck loader does not block the callers
+// waiting for the key indefinitely. The result of a timed out loader is discarded.
+func (cb *CacheBuilder) LoaderTimeout(loaderTimeout time.Duration) *CacheBuilder {
+	cb.loaderTimeout = loaderTimeout
+	return cb
+}
+
+// LoaderRetry retries failed loader calls according to policy.
+// With a loader timeout, the timeout applies to each attempt.
+func (cb *CacheBuilder) LoaderRetry(policy RetryPolicy) *CacheBuilder {
+	cb.retryPolicy = &policy
+	return cb
+}
+
+// WithTelemetry reports the hits and misses of the cache and its loader calls to
+// telemetry, such as the OpenTelemetry metrics and spans of package xotel.
+func (cb *CacheBuilder) WithTelemetry(telemetry Telemetry) *CacheBuilder {
+	cb.telemetry = telemetry
+	return cb
+}
+
+// LoadLatencyBuckets sets the upper bounds of the buckets of the load latency histogram,
+// which is DefaultLoadLatencyBuckets by default.
+func (cb *CacheBuilder) LoadLatencyBuckets(bounds ...time.Duration) *CacheBuilder {
+	cb.latencyBuckets = bounds
+	return cb
+}
+
+// ServeStale makes Get return the previous value of a key together with a *StaleError
+// if loading a new value fails, even if the previous value has expired.
+// Expired entries are then kept until they are evicted or removed by DeleteExpired.
+func (cb *CacheBuilder) ServeStale() *CacheBuilder {
+	cb.serveStale = true
+	return cb
+}
+
+// BatchCallbacks delivers the calls of evictedFunc and expiredFunc in the background,
+// at most maxBurst calls per interval, so that removing many entries at once does
+// not stall the cache. The callbacks are then called without holding the lock of the cache.
+// Close delivers the callbacks that are still pending.
+func (cb *CacheBuilder) BatchCallbacks(maxBurst int, interval time.Duration) *CacheBuilder {
+	cb.callbackBurst = maxBurst
+	cb.callbackInterval = interval
+	return cb
+}
+
+// RefreshAfter makes reads of entries that were written more than refreshAfter ago
+// reload the entry in the background using the loader, while the current value
+// is still returned. The current value is kept if the loader fails.
+func (cb *CacheBuilder) RefreshAfter(refreshAfter time.Duration) *CacheBuilder {
+	cb.refreshAfter = refreshAfter
+	return cb
+}
+
+// TimingWheel tracks expirations in a hierarchical timing wheel with the given tick.
+// Expired entries are then removed, and expiredFunc is called for them, as the
+// cache is used, without having to scan the cache. Entries expire with a
+// granularity of tick. DeleteExpired also relies on the timing wheel.
+func (cb *CacheBuilder) TimingWheel(tick time.Duration) *CacheBuilder {
+	cb.wheelTick = tick
+	return cb
+}
+
+// LFUDecay halves the frequency counts of an LFU cache every interval,
+// so that entries that were popular in the past can be displaced.
+// It has no effect on other eviction types.
+func (cb *CacheBuilder) LFUDecay(interval time.Duration) *CacheBuilder {
+	cb.lfuDecay = interval
+	return cb
+}
+
+// ExpirationMode sets when expired entries are removed from the cache.
+// In ExpirationEager and ExpirationHybrid mode a background janitor calls
+// DeleteExpired every interval, or every DefaultJanitorInterval if interval is not positive.
+func (cb *CacheBuilder) ExpirationMode(mode ExpirationMode, interval time.Duration) *CacheBuilder {
+	cb.expirationMode = mode
+	cb.janitorInterval = interval
+	return cb
+}
+
+// Build creates the cache. It panics if the configuration is invalid, see BuildE.
 func (cb *CacheBuilder) Build() Cache {
-	if cb.size <= 0 && cb.tp != TYPE_SIMPLE {
-		panic("gcache: Cache size <= 0")
+	c, err := cb.BuildE()
+	if err != nil {
+		panic("gcache: " + err.Error())
 	}
+	return c
+}
 
-	return cb.build()
+// BuildE creates the cache, or returns an error wrapping ErrInvalidConfig
+// if the configuration is invalid.
+func (cb *CacheBuilder) BuildE() (Cache, error) {
+	if err := cb.validate(); err != nil {
+		return nil, err
+	}
+	c := cb.build()
+	for i := len(cb.middlewares) - 1; i >= 0; i-- {
+		c = cb.middlewares[i](c)
+	}
+	return c, nil
+}
+
+// validate returns an error wrapping ErrInvalidConfig for the first problem of the configuration.
+func (cb *CacheBuilder) validate() error {
+	switch cb.tp {
+	case TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO,
+		TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL, TYPE_SCORE:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidConfig, cb.tp)
+	}
+	if cb.size <= 0 && cb.tp != TYPE_SIMPLE {
+		return fmt.Errorf("%w: cache size <= 0", ErrInvalidConfig)
+	}
+	if cb.tp == TYPE_SCORE && cb.scoreFunc == nil {
+		return fmt.Errorf("%w: ScoreFunc is not set", ErrInvalidConfig)
+	}
+	if cb.expiration != nil && *cb.expiration <= 0 {
+		return fmt.Errorf("%w: expiration <= 0", ErrInvalidConfig)
+	}
+	if cb.expirationMode < ExpirationLazy || cb.expirationMode > ExpirationHybrid {
+		return fmt.Errorf("%w: unknown expiration mode %d", ErrInvalidConfig, cb.expirationMode)
+	}
+	if cb.maxCost != 0 && cb.weigher == nil {
+		return fmt.Errorf("%w: MaxCost without Weigher", ErrInvalidConfig)
+	}
+	if cb.maxCost < 0 {
+		return fmt.Errorf("%w: max cost < 0", ErrInvalidConfig)
+	}
+	if cb.lockFreeReads && (cb.sliding || cb.maxIdle > 0 || cb.refreshAfter > 0) {
+		return fmt.Errorf("%w: LockFreeReads with SlidingExpiration, MaxIdle or RefreshAfter", ErrInvalidConfig)
+	}
+	if cb.evictBatch < 0 {
+		return fmt.Errorf("%w: eviction batch < 0", ErrInvalidConfig)
+	}
+	if cb.evictBatch > 1 && (cb.tp == TYPE_ARC || cb.tp == TYPE_LIRS) {
+		return fmt.Errorf("%w: EvictionBatch with type %q", ErrInvalidConfig, cb.tp)
+	}
+	if cb.pressure != nil {
+		if cb.pressure.fraction <= 0 || cb.pressure.fraction > 1 {
+			return fmt.Errorf("%w: memory pressure fraction not in (0, 1]", ErrInvalidConfig)
+		}
+		if cb.tp == TYPE_ARC || cb.tp == TYPE_LIRS {
+			return fmt.Errorf("%w: MemoryPressure with type %q", ErrInvalidConfig, cb.tp)
+		}
+	}
+	if err := validatePreset(cb.preset); err != nil {
+		return err
+	}
+	if cb.lowWatermark != 0 || cb.highWatermark != 0 {
+		if cb.lowWatermark < 0 || cb.lowWatermark >= cb.highWatermark || cb.highWatermark >= 1 {
+			return fmt.Errorf("%w: watermarks not 0 <= low < high < 1", ErrInvalidConfig)
+		}
+		if cb.size <= 0 {
+			return fmt.Errorf("%w: Watermarks without size", ErrInvalidConfig)
+		}
+	}
+	if cb.deferPromotion {
+		if cb.tp != TYPE_LRU {
+			return fmt.Errorf("%w: DeferredPromotion with type %q", ErrInvalidConfig, cb.tp)
+		}
+		if cb.lockFreeReads || cb.sliding || cb.maxIdle > 0 || cb.refreshAfter > 0 {
+			return fmt.Errorf("%w: DeferredPromotion with LockFreeReads, SlidingExpiration, MaxIdle or RefreshAfter", ErrInvalidConfig)
+		}
+	}
+	switch cb.storage {
+	case HeapStorage:
+	case BytesArena:
+		if cb.serializeFunc == nil || cb.deserializeFunc == nil {
+			return fmt.Errorf("%w: BytesArena storage without SerializeFunc and DeserializeFunc", ErrInvalidConfig)
+		}
+		if cb.tp != TYPE_SIMPLE && cb.tp != TYPE_FIFO {
+			return fmt.Errorf("%w: BytesArena storage with type %q", ErrInvalidConfig, cb.tp)
+		}
+	default:
+		return fmt.Errorf("%w: unknown storage %d", ErrInvalidConfig, cb.storage)
+	}
+	return nil
 }
 
 func (cb *CacheBuilder) build() Cache {
+	if cb.storage == BytesArena {
+		return newArenaCache(cb)
+	}
 	switch cb.tp {
 	case TYPE_SIMPLE:
 		return newSimpleCache(cb)
 	case TYPE_LRU:
+		if cb.newLRU != nil {
+			return cb.newLRU(cb)
+		}
 		return newLRUCache(cb)
 	case TYPE_LFU:
 		return newLFUCache(cb)
@@ -198,6 +904,16 @@ func (cb *CacheBuilder) build() Cache {
 		return newARC(cb)
 	case TYPE_LIRS:
 		return newLIRSCache(cb)
+	case TYPE_FIFO:
+		return newFIFOCache(cb)
+	case TYPE_RANDOM:
+		return newRandomCache(cb)
+	case TYPE_APPROX_LRU:
+		return newApproxLRUCache(cb)
+	case TYPE_TTL:
+		return newTTLCache(cb)
+	case TYPE_SCORE:
+		return newScoreCache(cb)
 	default:
 		panic("gcache: Unknown type " + cb.tp)
 	}
@@ -212,22 +928,789 @@ func buildCache(c *baseCache, cb *CacheBuilder) {
 	c.deserializeFunc = cb.deserializeFunc
 	c.serializeFunc = cb.serializeFunc
 	c.evictedFunc = cb.evictedFunc
+	c.expiredFunc = cb.expiredFunc
 	c.purgeVisitorFunc = cb.purgeVisitorFunc
-	c.stats = &stats{}
+	c.sliding = cb.sliding && cb.expiration != nil
+	c.maxIdle = cb.maxIdle
+	c.refreshAfter = cb.refreshAfter
+	c.loaderTimeout = cb.loaderTimeout
+	c.retryPolicy = cb.retryPolicy
+	c.serveStale = cb.serveStale && cb.loaderExpireFunc != nil
+	if cb.callbackBurst > 0 && cb.callbackInterval > 0 {
+		c.callbacks = newCallbackQueue(cb.callbackBurst, cb.callbackInterval, cb.logger)
+	}
+	if cb.wheelTick > 0 {
+		c.wheel = newTimingWheel(cb.wheelTick, c.clock.Now())
+	}
+	c.expirations = newExpirationHeap()
+	c.expirationMode = cb.expirationMode
+	if cb.expirationMode != ExpirationLazy {
+		interval := cb.janitorInterval
+		if interval <= 0 {
+			interval = DefaultJanitorInterval
+		}
+		c.janitor = newJanitor(interval)
+	}
+	c.telemetry = cb.telemetry
+	c.events = cb.events
+	c.logger = cb.logger
+	c.sizeFunc = cb.sizeFunc
+	c.slowCallback = cb.slowCallback
+	c.keyspace = cb.keyspace
+	c.capacity = cb.capacity
+	c.weigher = cb.weigher
+	c.maxCost = cb.maxCost
+	c.sharedCost = cb.sharedCost
+	c.evictBatch = cb.evictBatch
+	c.admission = cb.admission
+	c.pressure = cb.pressure
+	c.victim = cb.victim
+	if cb.highWatermark > 0 {
+		c.trimmer = newTrimmer(int(cb.lowWatermark*float64(cb.size)), int(cb.highWatermark*float64(cb.size)))
+	}
+	latencyBuckets := cb.latencyBuckets
+	if latencyBuckets == nil {
+		latencyBuckets = DefaultLoadLatencyBuckets
+	}
+	c.stats = &stats{
+		loadLatencies: newLatencyHistogram(latencyBuckets),
+		telemetry:     cb.telemetry,
+	}
+	c.loadGroup.stats = c.stats
+	if cb.lockProfiling {
+		c.mu.stats = c.stats
+	}
+	if cb.lockFreeReads {
+		c.reads = newReadIndex()
+	}
 }
 
 // load a new value using by specified key.
 func (c *baseCache) load(key interface{}, cb func(interface{}, *time.Duration, error) (interface{}, error), isWait bool) (interface{}, bool, error) {
+	// a loaded value that is not admitted is returned without being stored
+	store := func(v interface{}, expiration *time.Duration, err error) (interface{}, error) {
+		value, err := cb(v, expiration, err)
+		if err == ErrNotAdmitted {
+			return v, nil
+		}
+		return value, err
+	}
 	v, called, err := c.loadGroup.Do(key, func() (v interface{}, e error) {
 		defer func() {
 			if r := recover(); r != nil {
-				e = fmt.Errorf("loader panics: %v", r)
+				e = fmt.Errorf("%w: %v", ErrLoaderPanic, r)
+			}
+			if errors.Is(e, ErrLoaderPanic) {
+				logWarn(c.logger, "xcache: recovered loader panic", "key", key, "error", e)
 			}
 		}()
-		return cb(c.loaderExpireFunc(key))
+		if c.telemetry != nil {
+			return store(c.telemetry.TraceLoad(key, func() (interface{}, *time.Duration, error) {
+				return c.callLoaderWithRetry(key)
+			}))
+		}
+		return store(c.callLoaderWithRetry(key))
 	}, isWait)
 	if err != nil {
+		if c.serveStale && err != ErrKeyNotFoundError {
+			if stale, ok := c.loadGroup.cache.GetStale(key); ok {
+				return stale, called, &StaleError{Err: err}
+			}
+		}
 		return nil, called, err
 	}
 	return v, called, nil
 }
+
+// callLoaderWithRetry calls the loader for key and retries failed calls
+// according to the retry policy, if any.
+func (c *baseCache) callLoaderWithRetry(key interface{}) (interface{}, *time.Duration, error) {
+	start := time.Now()
+	defer func() { c.loadLatencies.observe(time.Since(start)) }()
+	v, expiration, err := c.callLoader(key)
+	if c.retryPolicy == nil {
+		return v, expiration, err
+	}
+	for attempts := 1; err != nil && c.retryPolicy.retryable(err, attempts); attempts++ {
+		time.Sleep(c.retryPolicy.backoff(attempts))
+		v, expiration, err = c.callLoader(key)
+	}
+	return v, expiration, err
+}
+
+// callLoader calls the loader for key. If a loader timeout is set and the loader
+// does not return in time, it returns ErrLoaderTimeout and discards the result
+// of the loader once it returns.
+func (c *baseCache) callLoader(key interface{}) (interface{}, *time.Duration, error) {
+	if c.loaderTimeout <= 0 {
+		return c.loaderExpireFunc(key)
+	}
+	type result struct {
+		value      interface{}
+		expiration *time.Duration
+		err        error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("%w: %v", ErrLoaderPanic, r)}
+			}
+		}()
+		v, expiration, err := c.loaderExpireFunc(key)
+		done <- result{v, expiration, err}
+	}()
+	timer := time.NewTimer(c.loaderTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.value, r.expiration, r.err
+	case <-timer.C:
+		return nil, nil, ErrLoaderTimeout
+	}
+}
+
+// lookupMulti looks up the specified keys under a single lock acquisition.
+// It returns the values of the keys present in the cache and the keys that are not.
+func (c *baseCache) lookupMulti(keys []interface{}, lookup func(interface{}, bool) (interface{}, error)) (map[interface{}]interface{}, []interface{}) {
+	found := make(map[interface{}]interface{}, len(keys))
+	var missing []interface{}
+	c.mu.Lock()
+	for _, key := range keys {
+		v, err := lookup(key, false)
+		if err != nil {
+			missing = append(missing, key)
+			continue
+		}
+		found[key] = v
+	}
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		for key, v := range found {
+			dv, err := c.deserializeFunc(key, v)
+			if err != nil {
+				delete(found, key)
+				missing = append(missing, key)
+				continue
+			}
+			found[key] = dv
+		}
+	}
+	return found, missing
+}
+
+// cacheEntry is a point-in-time copy of a cache entry.
+type cacheEntry struct {
+	key        interface{}
+	value      interface{}
+	expiration *time.Time
+}
+
+func newCacheEntry(key, value interface{}, expiration *time.Time) cacheEntry {
+	e := cacheEntry{key: key, value: value}
+	if expiration != nil {
+		t := *expiration
+		e.expiration = &t
+	}
+	return e
+}
+
+// removeKeys removes the specified keys under a single lock acquisition
+// and returns the number of keys that were present.
+func (c *baseCache) removeKeys(keys []interface{}, remove func(interface{}) bool) int {
+	c.mu.Lock()
+	defer c.unlock()
+	removed := 0
+	for _, key := range keys {
+		if remove(key) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// nextVersion returns a new entry version that is greater than any version
+// previously handed out by this cache. The caller must hold the lock.
+func (c *baseCache) nextVersion() uint64 {
+	c.version++
+	return c.version
+}
+
+// scheduleExpiration records the expiration of key in the expiration heap
+// and the timing wheel, if any. The caller must hold the lock.
+func (c *baseCache) scheduleExpiration(key interface{}, expiration time.Time) {
+	c.forgetRead(key)
+	c.expirations.schedule(key, expiration)
+	if c.wheel != nil {
+		c.wheel.schedule(key, expiration)
+	}
+}
+
+// deleteExpired removes the entries that have expired, as found by the timing
+// wheel if any or the expiration heap otherwise, and returns the number of
+// removed entries. The caller must hold the lock.
+func (c *baseCache) deleteExpired(deadlineOf func(interface{}) (time.Time, bool), remove func(interface{}) bool) int {
+	if c.wheel != nil {
+		return c.expireDue(deadlineOf, remove)
+	}
+	removed := 0
+	for _, key := range c.expirations.expired(c.clock.Now(), deadlineOf) {
+		if c.removeExpired(key, remove) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// countExpired returns the number of entries that have expired but have not
+// been removed yet. The caller must hold the lock.
+func (c *baseCache) countExpired(deadlineOf func(interface{}) (time.Time, bool)) int {
+	return c.expirations.countExpired(c.clock.Now(), deadlineOf)
+}
+
+// expireDue removes the entries that the timing wheel reports as due and that
+// have actually expired, and returns the number of removed entries.
+// Entries whose expiration has been extended in the meantime are rescheduled.
+// The caller must hold the lock.
+func (c *baseCache) expireDue(deadlineOf func(interface{}) (time.Time, bool), remove func(interface{}) bool) int {
+	now := c.clock.Now()
+	removed := 0
+	for _, key := range c.wheel.advance(now) {
+		deadline, ok := deadlineOf(key)
+		if !ok {
+			continue
+		}
+		if !deadline.Before(now) {
+			c.wheel.schedule(key, deadline)
+			continue
+		}
+		if c.removeExpired(key, remove) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// recordWrite records that an entry has just been written: it restarts the
+// idle timer and the refresh timer of the entry and applies the default max
+// idle time, if any. The caller must hold the lock.
+func (c *baseCache) recordWrite(key interface{}, ai *accessInfo) {
+	if c.restartTimers(ai) {
+		c.scheduleExpiration(key, ai.used.Add(ai.maxIdle))
+	}
+}
+
+// restartTimers restarts the timers of an entry that has just been written like
+// recordWrite, and reports whether the entry has a max idle time, in which case
+// the caller must schedule its expiration. The caller must hold the lock.
+func (c *baseCache) restartTimers(ai *accessInfo) bool {
+	ai.used = c.clock.Now()
+	ai.refreshed = ai.used
+	if c.maxIdle > 0 {
+		ai.maxIdle = c.maxIdle
+	}
+	return ai.maxIdle > 0
+}
+
+// setMaxIdle changes the max idle time of an entry. The caller must hold the lock.
+func (c *baseCache) setMaxIdle(key interface{}, ai *accessInfo, maxIdle time.Duration) {
+	if maxIdle < 0 {
+		maxIdle = 0
+	}
+	ai.maxIdle = maxIdle
+	if c.reads != nil {
+		if maxIdle > 0 {
+			c.reads.idle[key] = struct{}{}
+		} else {
+			delete(c.reads.idle, key)
+		}
+	}
+	if maxIdle > 0 {
+		c.scheduleExpiration(key, ai.used.Add(maxIdle))
+	}
+}
+
+// resetExpirations discards all expirations recorded in the expiration heap
+// and the timing wheel. The caller must hold the lock.
+func (c *baseCache) resetExpirations() {
+	c.forgetReads()
+	c.expirations.reset()
+	if c.wheel != nil {
+		c.wheel.reset(c.clock.Now())
+	}
+}
+
+// notifyEvicted is called for every entry that has been removed from the cache.
+// It forgets the expiration and the published value of the entry and calls the callback.
+func (c *baseCache) notifyEvicted(key, value interface{}) {
+	if c.evicting && !c.expiring {
+		c.pushVictim(key, value)
+	}
+	c.forgetRead(key)
+	if c.reads != nil {
+		delete(c.reads.idle, key)
+	}
+	c.expirations.unschedule(key)
+	c.countEntries(-1)
+	if c.expiring {
+		c.IncrExpirationCount()
+		c.publish(EventExpired, key, value)
+		c.addSize(key, value, -1)
+		c.notifyExpired(key, value)
+		return
+	}
+	c.addSize(key, value, -1)
+	if c.evicting {
+		c.IncrEvictionCount()
+		c.publish(EventEvicted, key, value)
+	} else {
+		c.IncrRemovalCount()
+		c.publish(EventRemoved, key, value)
+	}
+	if c.evictedFunc != nil {
+		c.callback("evicted", c.evictedFunc, key, value)
+	}
+}
+
+// deserialized returns value deserialized with DeserializeFunc, if any, like Get
+// returns it. Returns false if it cannot be deserialized.
+func (c *baseCache) deserialized(key, value interface{}) (interface{}, bool) {
+	if c.deserializeFunc == nil {
+		return value, true
+	}
+	v, err := c.deserializeFunc(key, value)
+	return v, err == nil
+}
+
+// sampled returns the pairs of r with their values deserialized like Get.
+func (c *baseCache) sampled(r *reservoir[interface{}, interface{}]) map[interface{}]interface{} {
+	items := make(map[interface{}]interface{}, len(r.keys))
+	for i, key := range r.keys {
+		if v, ok := c.deserialized(key, r.values[i]); ok {
+			items[key] = v
+		}
+	}
+	return items
+}
+
+// deserializing returns fn, which visits the entries of the cache, so that it is
+// called with the deserialized values. For values that cannot be deserialized it
+// returns skip instead.
+func (c *baseCache) deserializing(fn func(interface{}, interface{}) bool, skip bool) func(interface{}, interface{}) bool {
+	if c.deserializeFunc == nil {
+		return fn
+	}
+	return func(key, value interface{}) bool {
+		v, ok := c.deserialized(key, value)
+		if !ok {
+			return skip
+		}
+		return fn(key, v)
+	}
+}
+
+// tracksEntries reports whether notifyAdded, notifyReplaced and notifyEvicted use
+// the keys and values of the entries. If they do not, a cache that stores its keys
+// and values unboxed, see typedLRUCache, only counts the entries instead, with
+// countEntries, IncrReplacementCount and countRemoved, so that it does not box them.
+// The caller must hold the lock.
+func (c *baseCache) tracksEntries() bool {
+	return c.reads != nil || c.victim != nil || c.sizeFunc != nil || c.weigher != nil ||
+		c.events != nil || c.keyspace != nil || c.evictedFunc != nil || c.expiredFunc != nil ||
+		len(c.expirations.index) > 0
+}
+
+// countRemoved counts an entry that has been removed like notifyEvicted does,
+// if the cache does not track entries, see tracksEntries. The caller must hold the lock.
+func (c *baseCache) countRemoved() {
+	c.countEntries(-1)
+	switch {
+	case c.expiring:
+		c.IncrExpirationCount()
+	case c.evicting:
+		c.IncrEvictionCount()
+	default:
+		c.IncrRemovalCount()
+	}
+}
+
+// notifyAdded is called for every key that has been added to the cache.
+func (c *baseCache) notifyAdded(key, value interface{}) {
+	c.forgetRead(key)
+	c.invalidateVictim(key)
+	c.addSize(key, value, 1)
+	c.countEntries(1)
+	if !c.restoring {
+		c.publish(EventAdded, key, value)
+	}
+}
+
+// notifyReplaced is called for every entry whose value old has been replaced by value.
+func (c *baseCache) notifyReplaced(key, old, value interface{}) {
+	c.forgetRead(key)
+	c.invalidateVictim(key)
+	c.addSize(key, old, -1)
+	c.addSize(key, value, 1)
+	c.IncrReplacementCount()
+	c.publish(EventUpdated, key, value)
+}
+
+// addSize adds the estimated size and the weight of an entry, multiplied by sign,
+// to the estimated size and the cost of the cache, if they are tracked.
+func (c *baseCache) addSize(key, value interface{}, sign int) {
+	if c.sizeFunc != nil {
+		atomic.AddInt64(&c.bytes, int64(sign*c.sizeFunc(key, value)))
+	}
+	if c.weigher != nil {
+		c.addCost(int64(sign) * c.weigher(key, value))
+	}
+}
+
+// addCost adds n to the cost of the cache, and of all buckets if their cost is shared.
+func (c *baseCache) addCost(n int64) {
+	atomic.AddInt64(&c.cost, n)
+	if c.sharedCost != nil {
+		c.sharedCost.add(n)
+	}
+}
+
+// resetSize resets the estimated size of the cache after all entries have been removed.
+func (c *baseCache) resetSize() {
+	atomic.StoreInt64(&c.bytes, 0)
+	c.addCost(-atomic.LoadInt64(&c.cost))
+	c.countEntries(-c.entryCount)
+}
+
+// detach stops counting the entries of a bucket that has been replaced towards the
+// global capacity and cost it shares with other buckets, so that it can be purged
+// without changing them.
+func (c *baseCache) detach() {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.capacity != nil {
+		c.capacity.add(-c.entryCount)
+		c.capacity = nil
+	}
+	if c.sharedCost != nil {
+		c.sharedCost.add(-atomic.LoadInt64(&c.cost))
+		c.sharedCost = nil
+	}
+}
+
+// evictionBatch returns the number of entries to evict when a key is added to
+// the full cache: the EvictionBatch, but at least one and at most the size.
+func (c *baseCache) evictionBatch() int {
+	if c.evictBatch <= 1 {
+		return 1
+	}
+	return minInt(c.evictBatch, c.size)
+}
+
+// fitCost calls evict, which evicts an entry according to the eviction policy, until
+// an entry of key and value fits into MaxCost next to the other entries or no entry
+// can be evicted. The caller must hold the lock.
+func (c *baseCache) fitCost(key, value interface{}, evict func()) {
+	weight := c.weigher(key, value)
+	for c.entryCount > 0 && atomic.LoadInt64(&c.cost)+weight > c.maxCost {
+		count := c.entryCount
+		evict()
+		if c.entryCount == count {
+			// every entry is pinned
+			return
+		}
+	}
+}
+
+// Cost returns the total weight of the entries of the cache as computed by
+// the Weigher, or zero if no Weigher is set.
+func (c *baseCache) Cost() int64 {
+	return atomic.LoadInt64(&c.cost)
+}
+
+// countEntries adds n to the number of entries of the cache, and of all
+// buckets if their capacity is shared. The caller must hold the lock.
+func (c *baseCache) countEntries(n int64) {
+	c.entryCount += n
+	if c.capacity != nil {
+		c.capacity.add(n)
+	}
+	if c.trimmer != nil && c.entryCount > int64(c.trimmer.high) {
+		c.trimmer.signal()
+	}
+}
+
+// EstimatedBytes returns the estimated number of bytes used by the entries
+// of the cache, or zero if sizes are not estimated.
+func (c *baseCache) EstimatedBytes() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
+
+// publish publishes an event, if events are enabled, and notifies the keyspace subscriptions.
+// Added and updated events are held until the write that caused them has scheduled
+// the expiration of the entry, so that they carry it: they are published before
+// the next other event, or by unlock.
+// The caller must hold the lock.
+func (c *baseCache) publish(tp EventType, key, value interface{}) {
+	if c.events == nil && c.keyspace == nil {
+		return
+	}
+	e := Event{Type: tp, Key: key, Value: value}
+	if tp == EventAdded || tp == EventUpdated {
+		c.heldEvents = append(c.heldEvents, e)
+		return
+	}
+	c.publishHeld()
+	c.emit(e)
+}
+
+// publishHeld publishes the held events with the expiration times of their entries.
+// The caller must hold the lock.
+func (c *baseCache) publishHeld() {
+	for i, e := range c.heldEvents {
+		if expiration := c.eventExpiration(e.Key); expiration != nil {
+			t := *expiration
+			e.Expiration = &t
+		}
+		c.emit(e)
+		c.heldEvents[i] = Event{}
+	}
+	c.heldEvents = c.heldEvents[:0]
+}
+
+func (c *baseCache) emit(e Event) {
+	if c.events != nil && !c.events.publish(e) {
+		logWarn(c.logger, "xcache: dropped event because the event buffer is full", "type", e.Type, "key", e.Key)
+	}
+	if c.keyspace != nil {
+		c.keyspace.notify(e.Type, e.Key, e.Value, c.logger)
+	}
+}
+
+// Subscribe calls fn for every keyspace notification of a key that matches the
+// glob pattern, as in KeysMatching, until the returned function is called.
+// fn is called while the cache is locked, so it must not call the cache.
+// Returns ErrKeyspaceNotificationsDisabled unless the cache has been built with KeyspaceNotifications.
+func (c *baseCache) Subscribe(pattern string, fn func(KeyspaceNotification)) (func(), error) {
+	if c.keyspace == nil {
+		return nil, ErrKeyspaceNotificationsDisabled
+	}
+	return c.keyspace.subscribe(&subscription{pattern: compileGlob(pattern), fn: fn}), nil
+}
+
+// SubscribeChan sends every keyspace notification of a key that matches the glob
+// pattern to the returned channel, which buffers up to size notifications,
+// until the returned function is called. Notifications that do not fit are dropped
+// and counted by DroppedNotificationCount.
+// Returns ErrKeyspaceNotificationsDisabled unless the cache has been built with KeyspaceNotifications.
+func (c *baseCache) SubscribeChan(pattern string, size int) (<-chan KeyspaceNotification, func(), error) {
+	if c.keyspace == nil {
+		return nil, nil, ErrKeyspaceNotificationsDisabled
+	}
+	ch := make(chan KeyspaceNotification, size)
+	return ch, c.keyspace.subscribe(&subscription{pattern: compileGlob(pattern), ch: ch}), nil
+}
+
+// DroppedNotificationCount returns the number of keyspace notifications that have
+// been dropped because the channel of a subscription was full.
+func (c *baseCache) DroppedNotificationCount() uint64 {
+	if c.keyspace == nil {
+		return 0
+	}
+	return c.keyspace.droppedCount()
+}
+
+// Events returns the channel on which the changes of the entries of the cache
+// are published, or nil if events are not enabled by EventBuffer.
+func (c *baseCache) Events() <-chan Event {
+	if c.events == nil {
+		return nil
+	}
+	return c.events.ch
+}
+
+// DroppedEventCount returns the number of events that have been dropped
+// because the event buffer was full.
+func (c *baseCache) DroppedEventCount() uint64 {
+	if c.events == nil {
+		return 0
+	}
+	return c.events.droppedCount()
+}
+
+// notifyExpired calls the callback for an entry that has been removed
+// because it has expired, falling back to evictedFunc.
+func (c *baseCache) notifyExpired(key, value interface{}) {
+	if c.expiredFunc != nil {
+		c.callback("expired", c.expiredFunc, key, value)
+	} else if c.evictedFunc != nil {
+		c.callback("evicted", c.evictedFunc, key, value)
+	}
+}
+
+// callback calls fn, or queues it if callbacks are delivered in the background,
+// and records the time spent in it.
+func (c *baseCache) callback(name string, fn func(interface{}, interface{}), key, value interface{}) {
+	timed := func(key, value interface{}) {
+		defer c.observeCallback(name, key, time.Now())
+		fn(key, value)
+	}
+	if c.callbacks != nil {
+		c.callbacks.enqueue(timed, key, value)
+	} else {
+		safeCallback(c.logger, timed, key, value)
+	}
+}
+
+// callAdded calls addedFunc, if any, and records the time spent in it.
+func (c *baseCache) callAdded(key, value interface{}) {
+	if c.addedFunc != nil && !c.restoring {
+		defer c.observeCallback("added", key, time.Now())
+		c.addedFunc(key, value)
+	}
+}
+
+// serialize calls serializeFunc and records the time spent in it.
+func (c *baseCache) serialize(key, value interface{}) (interface{}, error) {
+	if c.restoring {
+		return value, nil
+	}
+	defer c.observeCallback("serialize", key, time.Now())
+	return c.serializeFunc(key, value)
+}
+
+// observeCallback records the time spent in a callback that was called at start,
+// and logs a warning if it exceeds the slow callback threshold.
+func (c *baseCache) observeCallback(name string, key interface{}, start time.Time) {
+	d := time.Since(start)
+	c.addCallbackTime(d)
+	if c.slowCallback > 0 && d > c.slowCallback {
+		logWarn(c.logger, "xcache: slow callback", "callback", name, "key", key, "duration", d)
+	}
+}
+
+// safeCallback calls fn and recovers from panics in it, so that a panicking
+// callback cannot leave the cache half updated.
+func safeCallback(logger Logger, fn func(interface{}, interface{}), key, value interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logWarn(logger, "xcache: recovered callback panic", "key", key, "panic", r)
+		}
+	}()
+	fn(key, value)
+}
+
+// removeExpired removes an expired key with remove so that notifyEvicted
+// reports it to expiredFunc.
+func (c *baseCache) removeExpired(key interface{}, remove func(interface{}) bool) bool {
+	c.expiring = true
+	defer func() { c.expiring = false }()
+	return remove(key)
+}
+
+// removeStale removes key if it is stored but has expired, so that a value set
+// in its place does not keep the expiration of the old entry.
+// The caller must hold the lock.
+func (c *baseCache) removeStale(key interface{}, deadlineOf func(interface{}) (time.Time, bool), remove func(interface{}) bool) {
+	if deadline, ok := deadlineOf(key); ok && deadline.Before(c.clock.Now()) {
+		c.removeExpired(key, remove)
+	}
+}
+
+// beginEviction makes notifyEvicted count the entries that are removed until
+// the returned function is called as evicted to make room for other entries.
+// The caller must hold the lock.
+func (c *baseCache) beginEviction() func() {
+	evicting := c.evicting
+	c.evicting = true
+	return func() { c.evicting = evicting }
+}
+
+// beginRestore makes set insert values as they are, without serializing them,
+// publishing EventAdded or calling AddedFunc, until the returned function is called.
+// It is used to move entries that have already been added to another cache.
+// The caller must hold the lock.
+func (c *baseCache) beginRestore() func() {
+	c.restoring = true
+	return func() { c.restoring = false }
+}
+
+// expiresOnAccess reports whether expired entries are removed as the cache is used.
+// They are kept if they are only removed by the janitor or may be served as stale values.
+func (c *baseCache) expiresOnAccess() bool {
+	return c.expirationMode != ExpirationEager && !c.serveStale
+}
+
+// expireOnAccess removes an expired key that has been looked up, if expired
+// entries are removed as the cache is used.
+func (c *baseCache) expireOnAccess(key interface{}, remove func(interface{}) bool) {
+	if c.expiresOnAccess() {
+		c.removeExpired(key, remove)
+	}
+}
+
+// startJanitor starts the background janitor, if any, with the DeleteExpired method of the cache.
+func (c *baseCache) startJanitor(deleteExpired func() int) {
+	if c.janitor != nil {
+		go c.janitor.run(func() int {
+			removed := deleteExpired()
+			if removed > 0 {
+				logDebug(c.logger, "xcache: janitor removed expired entries", "count", removed)
+			}
+			return removed
+		})
+	}
+}
+
+// Close stops the background janitor, if any, and delivers the pending callbacks.
+func (c *baseCache) Close() {
+	if c.janitor != nil {
+		c.janitor.stop()
+	}
+	if c.pressure != nil {
+		c.pressure.unwatch(c)
+	}
+	if c.trimmer != nil {
+		c.trimmer.stop()
+	}
+	if c.callbacks != nil {
+		c.callbacks.close()
+	}
+}
+
+// shouldRefresh reports whether an entry that has just been read should be
+// reloaded in the background, and if so restarts its refresh timer so that
+// it is not reloaded again for another refreshAfter. The caller must hold the lock.
+func (c *baseCache) shouldRefresh(ai *accessInfo) bool {
+	if c.refreshAfter <= 0 || c.loaderExpireFunc == nil {
+		return false
+	}
+	now := c.clock.Now()
+	if now.Sub(ai.refreshed) < c.refreshAfter {
+		return false
+	}
+	ai.refreshed = now
+	return true
+}
+
+// refresh reloads the value of key in the background and stores it in the cache.
+// Errors and panics of the loader leave the current value in place.
+func (c *baseCache) refresh(key interface{}) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logWarn(c.logger, "xcache: recovered panic in refresh", "key", key, "panic", r)
+			}
+		}()
+		v, expiration, err := c.callLoaderWithRetry(key)
+		if err != nil {
+			logWarn(c.logger, "xcache: refresh failed", "key", key, "error", err)
+			return
+		}
+		if expiration != nil {
+			c.loadGroup.cache.SetWithExpire(key, v, *expiration)
+		} else {
+			c.loadGroup.cache.Set(key, v)
+		}
+	}()
+}
@@ -3,6 +3,8 @@ package xcache
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -279,3 +281,1041 @@ func TestExpiredItems(t *testing.T) {
 		})
 	}
 }
+
+func TestSetIfAbsent(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).EvictType(tp).Clock(clock).Build()
+
+			ok, err := cc.SetIfAbsent("key", "v1")
+			if err != nil || !ok {
+				t.Fatalf("first SetIfAbsent should succeed: %v, %v", ok, err)
+			}
+			ok, err = cc.SetIfAbsent("key", "v2")
+			if err != nil || ok {
+				t.Fatalf("second SetIfAbsent should not succeed: %v, %v", ok, err)
+			}
+			if v, _ := cc.Get("key"); v != "v1" {
+				t.Errorf("%v != %v", v, "v1")
+			}
+
+			ok, err = cc.SetIfAbsentWithExpire("expiring", "v1", time.Second)
+			if err != nil || !ok {
+				t.Fatalf("SetIfAbsentWithExpire should succeed: %v, %v", ok, err)
+			}
+			clock.Advance(2 * time.Second)
+			ok, err = cc.SetIfAbsentWithExpire("expiring", "v2", time.Second)
+			if err != nil || !ok {
+				t.Fatalf("SetIfAbsentWithExpire should replace an expired entry: %v, %v", ok, err)
+			}
+			if v, _ := cc.Get("expiring"); v != "v2" {
+				t.Errorf("%v != %v", v, "v2")
+			}
+		})
+	}
+}
+
+func TestSetOverExpired(t *testing.T) {
+	clock := NewFakeClock()
+	builders := map[string]*CacheBuilder{"arena": buildTestArenaCache(8)}
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL} {
+		builders[tp] = New(8).EvictType(tp)
+	}
+	for name, builder := range builders {
+		t.Run(name, func(t *testing.T) {
+			cc := builder.Clock(clock).Build()
+
+			cc.SetWithExpire("absent", "v1", time.Second)
+			cc.SetWithExpire("versioned", "v1", time.Second)
+			clock.Advance(2 * time.Second)
+
+			if ok, err := cc.SetIfAbsent("absent", "v2"); err != nil || !ok {
+				t.Fatalf("SetIfAbsent should replace an expired entry: %v, %v", ok, err)
+			}
+			if v, err := cc.Get("absent"); err != nil || v != "v2" {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+			if ok, err := cc.SetIfVersion("versioned", "v2", 0); err != nil || !ok {
+				t.Fatalf("SetIfVersion should replace an expired entry: %v, %v", ok, err)
+			}
+			if v, err := cc.Get("versioned"); err != nil || v != "v2" {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+		})
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			cc := New(8).EvictType(tp).Build()
+			setItemsByRange(t, cc, 0, 4)
+
+			found, missing := cc.getMulti([]interface{}{0, 1, 2, 3, 4, 5})
+			if len(found) != 4 {
+				t.Fatalf("%v != %v", len(found), 4)
+			}
+			if len(missing) != 2 {
+				t.Fatalf("%v != %v", len(missing), 2)
+			}
+			if cc.HitCount() != 4 || cc.MissCount() != 2 {
+				t.Errorf("unexpected stats: hit=%v miss=%v", cc.HitCount(), cc.MissCount())
+			}
+		})
+	}
+}
+
+func TestGetAndRemove(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			var evicted int
+			cc := New(8).
+				EvictType(tp).
+				EvictedFunc(func(key, value interface{}) {
+					evicted++
+				}).
+				Build()
+			cc.Set("key", "value")
+
+			v, ok := cc.GetAndRemove("key")
+			if !ok || v != "value" {
+				t.Fatalf("unexpected result: %v, %v", v, ok)
+			}
+			if cc.Has("key") {
+				t.Error("key should be removed")
+			}
+			if evicted != 1 {
+				t.Errorf("%v != %v", evicted, 1)
+			}
+			if _, ok := cc.GetAndRemove("key"); ok {
+				t.Error("GetAndRemove should return false for a missing key")
+			}
+			if cc.LookupCount() != 0 {
+				t.Errorf("GetAndRemove should not affect stats: %v", cc.LookupCount())
+			}
+		})
+	}
+}
+
+func TestTouch(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				Expiration(2 * time.Second).
+				Build()
+			cc.Set("key", "value")
+
+			clock.Advance(time.Second)
+			if !cc.Touch("key") {
+				t.Fatal("Touch should succeed for a present key")
+			}
+			clock.Advance(1500 * time.Millisecond)
+			if _, err := cc.Peek("key"); err != nil {
+				t.Fatalf("key should not expire after Touch: %v", err)
+			}
+
+			if !cc.TouchWithExpire("key", 10*time.Second) {
+				t.Fatal("TouchWithExpire should succeed for a present key")
+			}
+			clock.Advance(5 * time.Second)
+			if _, err := cc.Peek("key"); err != nil {
+				t.Fatalf("key should not expire after TouchWithExpire: %v", err)
+			}
+
+			if cc.Touch("missing") {
+				t.Error("Touch should fail for a missing key")
+			}
+			if cc.LookupCount() != 0 {
+				t.Errorf("Touch should not affect stats: %v", cc.LookupCount())
+			}
+		})
+	}
+}
+
+func TestGetWithExpiration(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).EvictType(tp).Clock(clock).Build()
+			cc.Set("forever", "value")
+			cc.SetWithExpire("expiring", "value", time.Minute)
+
+			v, exp, err := cc.GetWithExpiration("forever")
+			if err != nil || v != "value" || exp != nil {
+				t.Fatalf("unexpected result: %v, %v, %v", v, exp, err)
+			}
+			v, exp, err = cc.GetWithExpiration("expiring")
+			if err != nil || v != "value" {
+				t.Fatalf("unexpected result: %v, %v", v, err)
+			}
+			if want := clock.Now().Add(time.Minute); exp == nil || !exp.Equal(want) {
+				t.Errorf("%v != %v", exp, want)
+			}
+			if _, _, err := cc.GetWithExpiration("missing"); err != ErrKeyNotFoundError {
+				t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+			}
+		})
+	}
+}
+
+func TestSetExpiration(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).EvictType(tp).Clock(clock).Build()
+			cc.Set("key", "value")
+
+			if !cc.SetExpiration("key", time.Second) {
+				t.Fatal("SetExpiration should succeed for a present key")
+			}
+			if _, exp, _ := cc.GetWithExpiration("key"); exp == nil {
+				t.Fatal("key should have an expiration")
+			}
+			if !cc.SetExpiration("key", 0) {
+				t.Fatal("SetExpiration should succeed for a present key")
+			}
+			clock.Advance(time.Hour)
+			if _, err := cc.Peek("key"); err != nil {
+				t.Fatalf("key should never expire: %v", err)
+			}
+			if cc.SetExpiration("missing", time.Second) {
+				t.Error("SetExpiration should fail for a missing key")
+			}
+		})
+	}
+}
+
+func TestLRUSetExpirationKeepsRecency(t *testing.T) {
+	cc := New(2).LRU().Build()
+	cc.Set(1, 1)
+	cc.Set(2, 2)
+	cc.SetExpiration(1, time.Hour)
+	cc.Set(3, 3)
+	if cc.Has(1) {
+		t.Error("SetExpiration should not update recency")
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			var evicted int
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				EvictedFunc(func(key, value interface{}) {
+					evicted++
+				}).
+				Build()
+			cc.SetWithExpire(1, 1, time.Second)
+			cc.SetWithExpire(2, 2, time.Second)
+			cc.Set(3, 3)
+
+			if n := cc.DeleteExpired(); n != 0 {
+				t.Fatalf("%v != %v", n, 0)
+			}
+			clock.Advance(2 * time.Second)
+			if n := cc.DeleteExpired(); n != 2 {
+				t.Fatalf("%v != %v", n, 2)
+			}
+			if evicted != 2 {
+				t.Errorf("%v != %v", evicted, 2)
+			}
+			if l := cc.Len(false); l != 1 {
+				t.Errorf("%v != %v", l, 1)
+			}
+		})
+	}
+}
+
+func TestPin(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			size := 4
+			cc := New(size).EvictType(tp).Build()
+			cc.Set("pinned", "value")
+			if !cc.Pin("pinned") {
+				t.Fatal("Pin should succeed for a present key")
+			}
+			if cc.Pin("missing") {
+				t.Fatal("Pin should fail for a missing key")
+			}
+
+			for i := 0; i < size*10; i++ {
+				cc.Set(i, i)
+				cc.Get(i)
+			}
+			if !cc.Has("pinned") {
+				t.Fatal("pinned key should not be evicted")
+			}
+			if l := cc.Len(false); l > size {
+				t.Errorf("cache should not grow beyond its size: %v", l)
+			}
+
+			if !cc.Unpin("pinned") {
+				t.Fatal("Unpin should succeed for a present key")
+			}
+			if !cc.Remove("pinned") {
+				t.Fatal("Remove should remove a key that was pinned")
+			}
+		})
+	}
+}
+
+func TestPinHonorsExpiration(t *testing.T) {
+	clock := NewFakeClock()
+	cc := New(4).LRU().Clock(clock).Build()
+	cc.SetWithExpire("pinned", "value", time.Second)
+	cc.Pin("pinned")
+	clock.Advance(2 * time.Second)
+	if _, err := cc.Get("pinned"); err != ErrKeyNotFoundError {
+		t.Errorf("pinned key should expire: %v", err)
+	}
+}
+
+func TestGetStale(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).EvictType(tp).Clock(clock).Build()
+			cc.SetWithExpire("key", "value", time.Second)
+			clock.Advance(2 * time.Second)
+
+			if _, err := cc.Peek("key"); err != ErrKeyNotFoundError {
+				t.Fatalf("key should be expired: %v", err)
+			}
+			v, ok := cc.GetStale("key")
+			if !ok || v != "value" {
+				t.Fatalf("unexpected result: %v, %v", v, ok)
+			}
+			if _, err := cc.Peek("key"); err != ErrKeyNotFoundError {
+				t.Error("GetStale should not resurrect the key")
+			}
+			if cc.LookupCount() != 0 {
+				t.Errorf("GetStale should not affect stats: %v", cc.LookupCount())
+			}
+			if _, ok := cc.GetStale("missing"); ok {
+				t.Error("GetStale should return false for a missing key")
+			}
+		})
+	}
+}
+
+func TestInfo(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).EvictType(tp).Clock(clock).Build()
+			created := clock.Now()
+			cc.SetWithExpire("key", "value", time.Hour)
+
+			info, ok := cc.Info("key")
+			if !ok {
+				t.Fatal("Info should succeed for a present key")
+			}
+			if !info.Created.Equal(created) || !info.LastAccess.IsZero() || info.AccessCount != 0 {
+				t.Errorf("unexpected info before access: %+v", info)
+			}
+
+			clock.Advance(time.Minute)
+			cc.Get("key")
+			cc.Get("key")
+			cc.Peek("key")
+
+			info, _ = cc.Info("key")
+			if !info.LastAccess.Equal(clock.Now()) || info.AccessCount != 2 {
+				t.Errorf("unexpected info after access: %+v", info)
+			}
+			if info.Expiration == nil || !info.Expiration.Equal(created.Add(time.Hour)) {
+				t.Errorf("unexpected expiration: %v", info.Expiration)
+			}
+			if _, ok := cc.Info("missing"); ok {
+				t.Error("Info should fail for a missing key")
+			}
+		})
+	}
+}
+
+func TestInfoSegment(t *testing.T) {
+	arc := New(8).ARC().Build()
+	arc.Set("key", "value")
+	if info, _ := arc.Info("key"); info.Segment != SegmentARCT1 {
+		t.Errorf("%v != %v", info.Segment, SegmentARCT1)
+	}
+	arc.Get("key")
+	if info, _ := arc.Info("key"); info.Segment != SegmentARCT2 {
+		t.Errorf("%v != %v", info.Segment, SegmentARCT2)
+	}
+
+	lirs := New(8).LIRS().Build()
+	lirs.Set("key", "value")
+	if info, _ := lirs.Info("key"); info.Segment != SegmentLIRSLIR {
+		t.Errorf("%v != %v", info.Segment, SegmentLIRSLIR)
+	}
+}
+
+func TestSetIfVersion(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			cc := New(8).EvictType(tp).Build()
+
+			if _, version := cc.GetVersioned("key"); version != 0 {
+				t.Fatalf("missing key should have version 0: %v", version)
+			}
+			if ok, err := cc.SetIfVersion("key", "v1", 0); err != nil || !ok {
+				t.Fatalf("SetIfVersion should create a missing key: %v, %v", ok, err)
+			}
+			v, version := cc.GetVersioned("key")
+			if v != "v1" || version == 0 {
+				t.Fatalf("unexpected result: %v, %v", v, version)
+			}
+
+			cc.Set("key", "v2")
+			if ok, _ := cc.SetIfVersion("key", "v3", version); ok {
+				t.Fatal("SetIfVersion should fail on a stale version")
+			}
+			_, latest := cc.GetVersioned("key")
+			if latest <= version {
+				t.Fatalf("versions should increase: %v <= %v", latest, version)
+			}
+			if ok, _ := cc.SetIfVersion("key", "v3", latest); !ok {
+				t.Fatal("SetIfVersion should succeed on the current version")
+			}
+			if v, _ := cc.Get("key"); v != "v3" {
+				t.Errorf("%v != %v", v, "v3")
+			}
+
+			cc.Remove("key")
+			cc.Set("key", "v4")
+			if _, v := cc.GetVersioned("key"); v <= latest {
+				t.Errorf("versions should increase across removals: %v <= %v", v, latest)
+			}
+		})
+	}
+}
+
+func TestTimingWheel(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			var evicted []interface{}
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				TimingWheel(100 * time.Millisecond).
+				EvictedFunc(func(key, value interface{}) {
+					evicted = append(evicted, key)
+				}).
+				Build()
+			cc.SetWithExpire(1, 1, time.Second)
+			cc.SetWithExpire(2, 2, time.Second)
+			cc.SetWithExpire(3, 3, time.Minute)
+			cc.Set(4, 4)
+			cc.TouchWithExpire(2, time.Hour)
+
+			// Expired entries are removed by any later write without a scan.
+			clock.Advance(2 * time.Second)
+			cc.Set(5, 5)
+			if len(evicted) != 1 || evicted[0] != 1 {
+				t.Fatalf("unexpected evicted keys: %v", evicted)
+			}
+			if l := cc.Len(false); l != 4 {
+				t.Errorf("%v != %v", l, 4)
+			}
+
+			clock.Advance(time.Minute)
+			if n := cc.DeleteExpired(); n != 1 {
+				t.Fatalf("%v != %v", n, 1)
+			}
+			if len(evicted) != 2 || evicted[1] != 3 {
+				t.Fatalf("unexpected evicted keys: %v", evicted)
+			}
+
+			cc.Purge()
+			cc.SetWithExpire(2, 2, time.Second)
+			clock.Advance(time.Hour)
+			if n := cc.DeleteExpired(); n != 1 {
+				t.Errorf("%v != %v", n, 1)
+			}
+		})
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				Expiration(time.Minute).
+				SlidingExpiration().
+				Build()
+			cc.Set("read", 1)
+			cc.Set("peeked", 2)
+			cc.Set("forever", 3)
+			cc.SetExpiration("forever", 0)
+
+			for i := 0; i < 3; i++ {
+				clock.Advance(40 * time.Second)
+				if _, err := cc.Get("read"); err != nil {
+					t.Fatalf("read entry should not expire: %v", err)
+				}
+				cc.Peek("peeked")
+			}
+			if _, err := cc.Get("peeked"); err != ErrKeyNotFoundError {
+				t.Error("Peek should not extend the expiration")
+			}
+
+			clock.Advance(61 * time.Second)
+			if _, err := cc.Get("read"); err != ErrKeyNotFoundError {
+				t.Error("idle entry should expire")
+			}
+			if _, err := cc.Get("forever"); err != nil {
+				t.Errorf("entry without expiration should not expire: %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				Expiration(time.Hour).
+				MaxIdle(10 * time.Minute).
+				Build()
+			cc.Set("busy", 1)
+			cc.Set("idle", 2)
+			cc.Set("written", 3)
+			cc.SetWithExpireAndIdle("custom", 4, 0, 2*time.Minute)
+
+			clock.Advance(3 * time.Minute)
+			if _, err := cc.Get("custom"); err != ErrKeyNotFoundError {
+				t.Error("entry should expire after its own max idle time")
+			}
+			clock.Advance(5 * time.Minute)
+			cc.Set("written", 3)
+			cc.Get("busy")
+			clock.Advance(5 * time.Minute)
+			if _, err := cc.Get("idle"); err != ErrKeyNotFoundError {
+				t.Error("unused entry should expire")
+			}
+			if _, err := cc.Get("written"); err != nil {
+				t.Errorf("a write should reset the idle time: %v", err)
+			}
+
+			// The absolute expiration still applies to entries in use.
+			for i := 0; i < 10; i++ {
+				if _, err := cc.Get("busy"); err != nil {
+					t.Fatalf("entry in use should not expire: %v", err)
+				}
+				clock.Advance(5 * time.Minute)
+			}
+			if _, err := cc.Get("busy"); err != ErrKeyNotFoundError {
+				t.Error("entry should expire after its absolute expiration")
+			}
+		})
+	}
+}
+
+func TestMaxIdleTimingWheel(t *testing.T) {
+	var evicted []interface{}
+	clock := NewFakeClock()
+	cc := New(8).
+		LRU().
+		Clock(clock).
+		TimingWheel(time.Second).
+		EvictedFunc(func(key, value interface{}) {
+			evicted = append(evicted, key)
+		}).
+		Build()
+	cc.SetWithExpireAndIdle("idle", 1, time.Hour, time.Minute)
+	cc.SetWithExpireAndIdle("busy", 2, time.Hour, time.Minute)
+	for i := 0; i < 5; i++ {
+		clock.Advance(30 * time.Second)
+		if _, err := cc.Get("busy"); err != nil {
+			t.Fatalf("entry in use should not expire: %v", err)
+		}
+	}
+	if len(evicted) != 1 || evicted[0] != "idle" {
+		t.Fatalf("unexpected evicted keys: %v", evicted)
+	}
+	clock.Advance(2 * time.Minute)
+	if n := cc.DeleteExpired(); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+}
+
+func TestExpiredFunc(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			var evicted, expired []interface{}
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				EvictedFunc(func(key, value interface{}) {
+					evicted = append(evicted, key)
+				}).
+				ExpiredFunc(func(key, value interface{}) {
+					expired = append(expired, key)
+				}).
+				Build()
+			cc.SetWithExpire(1, 1, time.Second)
+			cc.SetWithExpire(2, 2, time.Second)
+			cc.Set(3, 3)
+
+			clock.Advance(2 * time.Second)
+			if _, err := cc.Get(1); err != ErrKeyNotFoundError {
+				t.Fatalf("expired entry should not be returned: %v", err)
+			}
+			if n := cc.DeleteExpired(); n != 1 {
+				t.Fatalf("%v != %v", n, 1)
+			}
+			cc.Remove(3)
+			if len(expired) != 2 || expired[0] != 1 || expired[1] != 2 {
+				t.Errorf("unexpected expired keys: %v", expired)
+			}
+			if len(evicted) != 1 || evicted[0] != 3 {
+				t.Errorf("unexpected evicted keys: %v", evicted)
+			}
+		})
+	}
+}
+
+func TestExpiredFuncTimingWheel(t *testing.T) {
+	var evicted, expired int
+	clock := NewFakeClock()
+	cc := New(8).
+		LRU().
+		Clock(clock).
+		TimingWheel(time.Second).
+		EvictedFunc(func(key, value interface{}) {
+			evicted++
+		}).
+		ExpiredFunc(func(key, value interface{}) {
+			expired++
+		}).
+		Build()
+	for i := 0; i < 4; i++ {
+		cc.SetWithExpire(i, i, time.Second)
+	}
+	clock.Advance(2 * time.Second)
+	cc.Set("a", 1)
+	if expired != 4 {
+		t.Errorf("%v != %v", expired, 4)
+	}
+	if evicted != 0 {
+		t.Errorf("%v != %v", evicted, 0)
+	}
+}
+
+func TestRefreshAfter(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			var calls int32
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				Expiration(time.Hour).
+				RefreshAfter(time.Minute).
+				LoaderFunc(func(key interface{}) (interface{}, error) {
+					return atomic.AddInt32(&calls, 1), nil
+				}).
+				Build()
+			if v, err := cc.Get("config"); err != nil || v != int32(1) {
+				t.Fatalf("%v, %v != 1", v, err)
+			}
+			clock.Advance(30 * time.Second)
+			if v, _ := cc.Get("config"); v != int32(1) {
+				t.Fatalf("%v != 1", v)
+			}
+			if n := atomic.LoadInt32(&calls); n != 1 {
+				t.Fatalf("entry should not be refreshed yet: %v", n)
+			}
+
+			clock.Advance(time.Minute)
+			if v, _ := cc.Get("config"); v != int32(1) {
+				t.Fatalf("current value should be returned while refreshing: %v", v)
+			}
+			deadline := time.Now().Add(time.Second)
+			for {
+				if v, _ := cc.Get("config"); v == int32(2) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("entry should be refreshed in the background")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if n := atomic.LoadInt32(&calls); n != 2 {
+				t.Errorf("%v != %v", n, 2)
+			}
+		})
+	}
+}
+
+func TestRefreshAfterKeepsValueOnError(t *testing.T) {
+	var calls int32
+	clock := NewFakeClock()
+	cc := New(8).
+		LRU().
+		Clock(clock).
+		RefreshAfter(time.Minute).
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			if atomic.AddInt32(&calls, 1) > 1 {
+				return nil, errors.New("unavailable")
+			}
+			return "v1", nil
+		}).
+		Build()
+	cc.Get("config")
+	clock.Advance(2 * time.Minute)
+	cc.Get("config")
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("entry should be refreshed in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v, err := cc.Get("config"); err != nil || v != "v1" {
+		t.Errorf("%v, %v != v1", v, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("failed refresh should not be retried before refreshAfter: %v", n)
+	}
+}
+
+func TestLenCheckExpired(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(16).
+				EvictType(tp).
+				Clock(clock).
+				Build()
+			for i := 0; i < 4; i++ {
+				cc.SetWithExpire(i, i, time.Second)
+			}
+			cc.SetWithExpireAndIdle(4, 4, time.Hour, time.Minute)
+			cc.Set(5, 5)
+			cc.SetWithExpire(6, 6, time.Second)
+			cc.SetExpiration(6, time.Hour)
+
+			if l := cc.Len(true); l != 7 {
+				t.Fatalf("%v != %v", l, 7)
+			}
+			clock.Advance(30 * time.Second)
+			if l := cc.Len(true); l != 3 {
+				t.Fatalf("%v != %v", l, 3)
+			}
+			cc.Get(4)
+			clock.Advance(45 * time.Second)
+			if l := cc.Len(true); l != 3 {
+				t.Errorf("%v != %v", l, 3)
+			}
+			if n := cc.DeleteExpired(); n != 4 {
+				t.Errorf("%v != %v", n, 4)
+			}
+			clock.Advance(time.Minute)
+			if l := cc.Len(true); l != 2 {
+				t.Errorf("%v != %v", l, 2)
+			}
+			if n := cc.DeleteExpired(); n != 1 {
+				t.Errorf("%v != %v", n, 1)
+			}
+			if l := cc.Len(false); l != 2 {
+				t.Errorf("%v != %v", l, 2)
+			}
+		})
+	}
+}
+
+func TestLoaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	cc := New(8).
+		LRU().
+		LoaderTimeout(20 * time.Millisecond).
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			<-release
+			return key, nil
+		}).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cc.Get("key"); err != ErrLoaderTimeout {
+				t.Errorf("%v != %v", err, ErrLoaderTimeout)
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	if v, err := cc.Get("key"); err != nil || v != "key" {
+		t.Errorf("%v, %v != key", v, err)
+	}
+}
+
+func TestServeStale(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			var calls int32
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				Expiration(time.Second).
+				ServeStale().
+				LoaderFunc(func(key interface{}) (interface{}, error) {
+					switch atomic.AddInt32(&calls, 1) {
+					case 1:
+						return "v1", nil
+					case 2:
+						return nil, errUnavailable
+					default:
+						return "v2", nil
+					}
+				}).
+				Build()
+			if v, err := cc.Get("key"); err != nil || v != "v1" {
+				t.Fatalf("%v, %v != v1", v, err)
+			}
+			clock.Advance(2 * time.Second)
+
+			v, err := cc.Get("key")
+			var staleErr *StaleError
+			if !errors.As(err, &staleErr) || !errors.Is(err, errUnavailable) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v != "v1" {
+				t.Errorf("%v != v1", v)
+			}
+			if v, err := cc.Get("key"); err != nil || v != "v2" {
+				t.Errorf("%v, %v != v2", v, err)
+			}
+		})
+	}
+}
+
+func TestLoaderPanic(t *testing.T) {
+	release := make(chan struct{})
+	cc := New(8).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			<-release
+			panic("boom")
+		}).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cc.Get("key"); !errors.Is(err, ErrLoaderPanic) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+func TestCallbackPanic(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(2).
+				EvictType(tp).
+				Clock(clock).
+				EvictedFunc(func(key, value interface{}) {
+					panic(key)
+				}).
+				Build()
+			for i := 0; i < 10; i++ {
+				cc.Set(i, i)
+			}
+			if l := cc.Len(false); l > 2 {
+				t.Errorf("%v > %v", l, 2)
+			}
+			cc.SetWithExpire("key", 1, time.Second)
+			clock.Advance(2 * time.Second)
+			if _, err := cc.Get("key"); err != ErrKeyNotFoundError {
+				t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+			}
+			cc.Set("after", 1)
+			if !cc.Remove("after") {
+				t.Error("entry should be removed")
+			}
+			cc.Set("after", 1)
+			if v, err := cc.Get("after"); err != nil || v != 1 {
+				t.Errorf("%v, %v != 1", v, err)
+			}
+		})
+	}
+}
+
+// recordingCache records the operations that pass through it.
+type recordingCache struct {
+	Cache
+	name string
+	ops  *[]string
+}
+
+func (c recordingCache) Get(key interface{}) (interface{}, error) {
+	*c.ops = append(*c.ops, fmt.Sprintf("%s get %v", c.name, key))
+	return c.Cache.Get(key)
+}
+
+func (c recordingCache) Set(key, value interface{}) error {
+	*c.ops = append(*c.ops, fmt.Sprintf("%s set %v", c.name, key))
+	return c.Cache.Set(key, value)
+}
+
+func recording(name string, ops *[]string) Middleware {
+	return func(next Cache) Cache {
+		return recordingCache{Cache: next, name: name, ops: ops}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var ops []string
+	cc := New(8).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			return key, nil
+		}).
+		Use(recording("outer", &ops), recording("inner", &ops)).
+		Build()
+
+	cc.Set("a", 1)
+	if v, err := cc.Get("b"); err != nil || v != "b" {
+		t.Fatalf("%v, %v != %v", v, err, "b")
+	}
+	if !cc.Remove("a") {
+		t.Error("a should be removed")
+	}
+
+	want := []string{"outer set a", "inner set a", "outer get b", "inner get b"}
+	if fmt.Sprint(ops) != fmt.Sprint(want) {
+		t.Errorf("%v != %v", ops, want)
+	}
+}
+
+func TestBuildE(t *testing.T) {
+	invalid := map[string]*CacheBuilder{
+		"size":       New(0).LRU(),
+		"type":       New(10).EvictType("mru"),
+		"score":      New(10).EvictType(TYPE_SCORE),
+		"expiration": New(10).Expiration(-time.Second),
+		"mode":       New(10).ExpirationMode(ExpirationMode(7), 0),
+		"batch":      New(10).LRU().EvictionBatch(-1),
+		"batch arc":  New(10).ARC().EvictionBatch(4),
+	}
+	for name, cb := range invalid {
+		c, err := cb.BuildE()
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%v: %v", name, err)
+		}
+		if c != nil {
+			t.Errorf("%v: cache should be nil", name)
+		}
+	}
+
+	if _, err := New(0).Simple().Expiration(time.Second).BuildE(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEvictionBatch(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			evicted := 0
+			gc := New(10).EvictType(tp).EvictionBatch(4).
+				EvictedFunc(func(interface{}, interface{}) { evicted++ }).
+				Build()
+			for i := 0; i < 10; i++ {
+				gc.Set(i, i)
+			}
+			gc.Set(10, 10)
+			if evicted != 4 {
+				t.Errorf("%v != %v", evicted, 4)
+			}
+			if n := gc.Len(false); n != 7 {
+				t.Errorf("%v != %v", n, 7)
+			}
+			// no eviction until the cache is full again
+			for i := 11; i < 14; i++ {
+				gc.Set(i, i)
+			}
+			if evicted != 4 {
+				t.Errorf("%v != %v", evicted, 4)
+			}
+			if !gc.Has(10) {
+				t.Error("key 10 should be present")
+			}
+		})
+	}
+}
+
+func TestPurgeAndRefill(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL} {
+		t.Run(tp, func(t *testing.T) {
+			gc := New(100).EvictType(tp).Build()
+			for round := 0; round < 3; round++ {
+				for i := 0; i < 150; i++ {
+					gc.Set(i, round)
+				}
+				if n := gc.Len(false); n != 100 {
+					t.Errorf("%v != %v", n, 100)
+				}
+				for k, v := range gc.GetALL(false) {
+					if v != round {
+						t.Fatalf("%v: %v != %v", k, v, round)
+					}
+				}
+				gc.Purge()
+				if n := gc.Len(false); n != 0 {
+					t.Errorf("%v != %v", n, 0)
+				}
+			}
+		})
+	}
+}
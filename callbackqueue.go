@@ -0,0 +1,125 @@
+package xcache
+
+import (
+	"sync"
+	"time"
+)
+
+// callbackQueue delivers eviction and expiration callbacks in the background,
+// so that removing many entries at once does not stall the cache.
+// At most maxBurst callbacks are delivered per interval.
+type callbackQueue struct {
+	maxBurst int
+	interval time.Duration
+	logger   Logger
+
+	mu      sync.Mutex
+	pending []pendingCallback
+	closed  bool
+	signal  chan struct{}
+	done    chan struct{}
+	exited  chan struct{}
+	once    sync.Once
+}
+
+type pendingCallback struct {
+	fn         func(interface{}, interface{})
+	key, value interface{}
+}
+
+func newCallbackQueue(maxBurst int, interval time.Duration, logger Logger) *callbackQueue {
+	q := &callbackQueue{
+		maxBurst: maxBurst,
+		interval: interval,
+		logger:   logger,
+		signal:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// enqueue schedules fn to be called with key and value. It never blocks,
+// except that fn is called right away once the queue has been closed.
+func (q *callbackQueue) enqueue(fn func(interface{}, interface{}), key, value interface{}) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		safeCallback(q.logger, fn, key, value)
+		return
+	}
+	q.pending = append(q.pending, pendingCallback{fn: fn, key: key, value: value})
+	q.mu.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take removes and returns up to n pending callbacks, or all of them if n is not positive.
+func (q *callbackQueue) take(n int) []pendingCallback {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n <= 0 || n > len(q.pending) {
+		n = len(q.pending)
+	}
+	batch := make([]pendingCallback, n)
+	copy(batch, q.pending)
+	q.pending = q.pending[n:]
+	if len(q.pending) == 0 {
+		q.pending = nil
+	}
+	return batch
+}
+
+func (q *callbackQueue) run() {
+	defer close(q.exited)
+	timer := time.NewTimer(q.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-q.signal:
+		case <-q.done:
+			q.deliver(q.take(0))
+			return
+		}
+		for {
+			batch := q.take(q.maxBurst)
+			if len(batch) == 0 {
+				break
+			}
+			q.deliver(batch)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(q.interval)
+			select {
+			case <-timer.C:
+			case <-q.done:
+				q.deliver(q.take(0))
+				return
+			}
+		}
+	}
+}
+
+func (q *callbackQueue) deliver(batch []pendingCallback) {
+	for _, cb := range batch {
+		safeCallback(q.logger, cb.fn, cb.key, cb.value)
+	}
+}
+
+// close delivers all pending callbacks and stops the queue.
+func (q *callbackQueue) close() {
+	q.once.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		close(q.done)
+	})
+	<-q.exited
+}
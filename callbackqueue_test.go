@@ -0,0 +1,75 @@
+package xcache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchCallbacks(t *testing.T) {
+	var expired, closed int32
+	clock := NewFakeClock()
+	var cc Cache
+	cc = New(1000).
+		LRU().
+		Clock(clock).
+		BatchCallbacks(10, 50*time.Millisecond).
+		ExpiredFunc(func(key, value interface{}) {
+			// Callbacks are delivered without holding the lock of the cache
+			// until it is closed.
+			if atomic.LoadInt32(&closed) == 0 {
+				cc.Has(key)
+			}
+			atomic.AddInt32(&expired, 1)
+		}).
+		Build()
+	for i := 0; i < 100; i++ {
+		cc.SetWithExpire(i, i, time.Second)
+	}
+	clock.Advance(2 * time.Second)
+
+	if n := cc.DeleteExpired(); n != 100 {
+		t.Fatalf("%v != %v", n, 100)
+	}
+	if n := atomic.LoadInt32(&expired); n > 10 {
+		t.Errorf("at most one burst should be delivered right away: %v", n)
+	}
+	atomic.StoreInt32(&closed, 1)
+	cc.Close()
+	if n := atomic.LoadInt32(&expired); n != 100 {
+		t.Errorf("%v != %v", n, 100)
+	}
+
+	cc.Set("a", 1)
+	cc.SetWithExpire("b", 2, time.Second)
+	clock.Advance(2 * time.Second)
+	cc.DeleteExpired()
+	if n := atomic.LoadInt32(&expired); n != 101 {
+		t.Errorf("callbacks should be called right away once closed: %v", n)
+	}
+}
+
+func TestCallbackQueueRateLimit(t *testing.T) {
+	delivered := make(chan interface{}, 100)
+	q := newCallbackQueue(5, 20*time.Millisecond, nil)
+	defer q.close()
+	for i := 0; i < 20; i++ {
+		q.enqueue(func(key, value interface{}) {
+			delivered <- key
+		}, i, i)
+	}
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		select {
+		case key := <-delivered:
+			if key != i {
+				t.Fatalf("%v != %v", key, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("callbacks should be delivered")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("20 callbacks in bursts of 5 should take at least 3 intervals: %v", elapsed)
+	}
+}
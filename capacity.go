@@ -0,0 +1,26 @@
+package xcache
+
+import (
+	"sync/atomic"
+)
+
+// globalCapacity counts the entries, or the cost of the entries, of all buckets
+// of an XCache whose capacity is shared across its buckets, see
+// XCacheBuilder.GlobalCapacity and XCacheBuilder.MaxCost.
+type globalCapacity struct {
+	limit int64
+	used  int64
+}
+
+func newGlobalCapacity(limit int64) *globalCapacity {
+	return &globalCapacity{limit: limit}
+}
+
+func (g *globalCapacity) add(n int64) {
+	atomic.AddInt64(&g.used, n)
+}
+
+// excess returns the number of entries or cost units beyond the limit.
+func (g *globalCapacity) excess() int64 {
+	return atomic.LoadInt64(&g.used) - g.limit
+}
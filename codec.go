@@ -0,0 +1,70 @@
+package xcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// FormatKey formats key as a string, for stores and protocols that identify
+// entries by strings, such as Redis or URLs. Keys of string types, such as
+// type UserID string, are used as is and other keys are encoded as JSON, or with
+// fmt.Sprint if they cannot be. ParseKey parses the keys formatted by FormatKey.
+func FormatKey[K any](key K) string {
+	if s, ok := any(key).(string); ok {
+		return s
+	}
+	if v := reflect.ValueOf(&key).Elem(); v.Kind() == reflect.String {
+		return v.String()
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Sprint(key)
+	}
+	return string(b)
+}
+
+// ParseKey parses a key formatted by FormatKey.
+func ParseKey[K any](s string) (K, error) {
+	var key K
+	if p, ok := any(&key).(*string); ok {
+		*p = s
+		return key, nil
+	}
+	if v := reflect.ValueOf(&key).Elem(); v.Kind() == reflect.String {
+		v.SetString(s)
+		return key, nil
+	}
+	err := json.Unmarshal([]byte(s), &key)
+	return key, err
+}
+
+// MarshalValue encodes value as bytes, for stores and protocols that carry
+// values as bytes. []byte and string values are used as is and other values
+// are encoded as JSON, which decodes interface values as the JSON types, e.g.
+// numbers as float64. UnmarshalValue decodes the values encoded by MarshalValue.
+func MarshalValue[V any](value V) ([]byte, error) {
+	switch v := any(&value).(type) {
+	case *[]byte:
+		return *v, nil
+	case *string:
+		return []byte(*v), nil
+	}
+	return json.Marshal(value)
+}
+
+// UnmarshalValue decodes a value encoded by MarshalValue.
+func UnmarshalValue[V any](b []byte) (V, error) {
+	var value V
+	switch p := any(&value).(type) {
+	case *[]byte:
+		*p = b
+	case *string:
+		*p = string(b)
+	default:
+		if err := json.Unmarshal(b, &value); err != nil {
+			return value, err
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,52 @@
+package xcache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatKey(t *testing.T) {
+	type point struct{ X, Y int }
+	if s := FormatKey("a b"); s != "a b" {
+		t.Errorf("%v != a b", s)
+	}
+	if s := FormatKey(point{1, 2}); s != `{"X":1,"Y":2}` {
+		t.Errorf("%v", s)
+	}
+	if k, err := ParseKey[point](FormatKey(point{1, 2})); err != nil || k != (point{1, 2}) {
+		t.Errorf("%v, %v", k, err)
+	}
+	if k, err := ParseKey[int](FormatKey(42)); err != nil || k != 42 {
+		t.Errorf("%v, %v != 42", k, err)
+	}
+	if _, err := ParseKey[int]("x"); err == nil {
+		t.Error("x should not be parsed as an int")
+	}
+
+	type userID string
+	if s := FormatKey(userID("a b")); s != "a b" {
+		t.Errorf("%v != a b", s)
+	}
+	if k, err := ParseKey[userID]("a b"); err != nil || k != "a b" {
+		t.Errorf("%v, %v != a b", k, err)
+	}
+}
+
+func TestMarshalValue(t *testing.T) {
+	if b, err := MarshalValue([]byte{0xff}); err != nil || !reflect.DeepEqual(b, []byte{0xff}) {
+		t.Errorf("%v, %v", b, err)
+	}
+	if b, err := MarshalValue("a"); err != nil || string(b) != "a" {
+		t.Errorf("%s, %v", b, err)
+	}
+	b, err := MarshalValue(map[string]int{"a": 1})
+	if err != nil || string(b) != `{"a":1}` {
+		t.Errorf("%s, %v", b, err)
+	}
+	if v, err := UnmarshalValue[map[string]int](b); err != nil || v["a"] != 1 {
+		t.Errorf("%v, %v", v, err)
+	}
+	if v, err := UnmarshalValue[string](b); err != nil || v != `{"a":1}` {
+		t.Errorf("%v, %v", v, err)
+	}
+}
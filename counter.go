@@ -0,0 +1,53 @@
+package xcache
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// counterStripes is the number of stripes of a stripedCounter. It must be a power of two.
+const counterStripes = 16
+
+// cacheLineSize is the assumed size of a CPU cache line.
+const cacheLineSize = 64
+
+// paddedUint64 is a counter that occupies a whole cache line, so that
+// updating it does not invalidate the cache lines of its neighbours.
+type paddedUint64 struct {
+	n uint64
+	_ [cacheLineSize - 8]byte
+}
+
+// stripedCounter is a counter for the hot path that is updated by many
+// goroutines at once. Each goroutine adds to one of several padded stripes,
+// picked by the address of its stack, so that concurrent increments rarely
+// touch the same cache line. Reads sum up all stripes.
+// The zero value is a counter of 0.
+type stripedCounter struct {
+	stripes [counterStripes]paddedUint64
+}
+
+// add adds delta to the counter and returns the value of the stripe it has
+// been added to, which is not the value of the counter.
+func (c *stripedCounter) add(delta uint64) uint64 {
+	return atomic.AddUint64(&c.stripes[stripe()].n, delta)
+}
+
+// load returns the value of the counter. It is not an atomic snapshot of
+// all stripes, but it never misses an increment that finished before it was called.
+func (c *stripedCounter) load() uint64 {
+	var n uint64
+	for i := range c.stripes {
+		n += atomic.LoadUint64(&c.stripes[i].n)
+	}
+	return n
+}
+
+// stripe returns the stripe used by the calling goroutine. Goroutines run on
+// distinct stacks, so hashing a stack address spreads them over the stripes,
+// while a goroutine keeps using the same stripe as long as its stack does not move.
+func stripe() int {
+	var local byte
+	p := uint64(uintptr(unsafe.Pointer(&local))) >> 10
+	return int((p * 0x9e3779b97f4a7c15) >> 32 & (counterStripes - 1))
+}
@@ -0,0 +1,108 @@
+package xcache
+
+import (
+	"time"
+)
+
+// Segments reported in EntryInfo.Segment.
+const (
+	SegmentARCT1   = "T1"
+	SegmentARCT2   = "T2"
+	SegmentLIRSLIR = "LIR"
+	SegmentLIRSHIR = "HIR"
+)
+
+// EntryInfo describes the metadata of a cache entry.
+type EntryInfo struct {
+	// Created is the time at which the entry was inserted.
+	Created time.Time
+	// LastAccess is the time of the last read hit, or zero if it has never been read.
+	LastAccess time.Time
+	// AccessCount is the number of read hits.
+	AccessCount uint64
+	// Expiration is the time at which the entry expires, or nil if it never expires.
+	Expiration *time.Time
+	// Pinned reports whether the entry is excluded from eviction.
+	Pinned bool
+	// Segment is the part of the cache the entry resides in for policies that
+	// have one: SegmentARCT1 or SegmentARCT2 for ARC, and SegmentLIRSLIR or
+	// SegmentLIRSHIR for LIRS. It is empty for the other policies.
+	Segment string
+}
+
+// EntryMeta is the metadata of a cache entry passed to a ScoreFunc.
+type EntryMeta struct {
+	// Created is the time at which the entry was inserted.
+	Created time.Time
+	// LastAccess is the time of the last read hit, or zero if it has never been read.
+	LastAccess time.Time
+	// AccessCount is the number of read hits.
+	AccessCount uint64
+	// Expiration is the time at which the entry expires, or nil if it never expires.
+	Expiration *time.Time
+}
+
+// accessInfo keeps track of when an entry was created and how it has been used.
+type accessInfo struct {
+	created   time.Time
+	accessed  time.Time
+	accesses  uint64
+	used      time.Time     // last write or read hit
+	refreshed time.Time     // last write or background refresh
+	maxIdle   time.Duration // expire if unused for this long, unless zero
+}
+
+func newAccessInfo(now time.Time) accessInfo {
+	return accessInfo{created: now, used: now}
+}
+
+// recordAccess records a read hit at the given time.
+func (ai *accessInfo) recordAccess(now time.Time) {
+	ai.accessed = now
+	ai.accesses++
+	ai.used = now
+}
+
+// deadline returns the earlier of expiration and the time at which the entry
+// becomes idle for too long. Returns false if the entry never expires.
+func (ai *accessInfo) deadline(expiration *time.Time) (time.Time, bool) {
+	if ai.maxIdle <= 0 {
+		if expiration == nil {
+			return time.Time{}, false
+		}
+		return *expiration, true
+	}
+	idle := ai.used.Add(ai.maxIdle)
+	if expiration != nil && expiration.Before(idle) {
+		return *expiration, true
+	}
+	return idle, true
+}
+
+func newEntryInfo(ai accessInfo, expiration *time.Time, pinned bool, segment string) EntryInfo {
+	info := EntryInfo{
+		Created:     ai.created,
+		LastAccess:  ai.accessed,
+		AccessCount: ai.accesses,
+		Pinned:      pinned,
+		Segment:     segment,
+	}
+	if expiration != nil {
+		t := *expiration
+		info.Expiration = &t
+	}
+	return info
+}
+
+func newEntryMeta(ai accessInfo, expiration *time.Time) EntryMeta {
+	meta := EntryMeta{
+		Created:     ai.created,
+		LastAccess:  ai.accessed,
+		AccessCount: ai.accesses,
+	}
+	if expiration != nil {
+		t := *expiration
+		meta.Expiration = &t
+	}
+	return meta
+}
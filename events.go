@@ -0,0 +1,75 @@
+package xcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventType describes why an Event has been published.
+type EventType int
+
+const (
+	// EventAdded is published when a key is added to the cache.
+	EventAdded EventType = iota
+	// EventUpdated is published when the value of a key is replaced by a new value.
+	EventUpdated
+	// EventEvicted is published when an entry is evicted to make room for other entries.
+	EventEvicted
+	// EventExpired is published when an entry is removed because it has expired.
+	EventExpired
+	// EventRemoved is published when an entry is removed explicitly, for example by Remove.
+	EventRemoved
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "added"
+	case EventUpdated:
+		return "updated"
+	case EventEvicted:
+		return "evicted"
+	case EventExpired:
+		return "expired"
+	case EventRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// Event describes a change of an entry of a cache.
+type Event struct {
+	Type  EventType
+	Key   interface{}
+	Value interface{}
+	// Expiration is the time at which the entry expires after the change of an
+	// EventAdded or EventUpdated, or nil if it does not expire.
+	Expiration *time.Time
+}
+
+// eventStream publishes events to a buffered channel. Events that do not fit
+// into the buffer are dropped and counted, so that a slow subscriber never
+// blocks the cache.
+type eventStream struct {
+	ch      chan Event
+	dropped uint64
+}
+
+func newEventStream(size int) *eventStream {
+	return &eventStream{ch: make(chan Event, size)}
+}
+
+// publish publishes e and reports whether it fit into the buffer.
+func (s *eventStream) publish(e Event) bool {
+	select {
+	case s.ch <- e:
+		return true
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+}
+
+func (s *eventStream) droppedCount() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
@@ -0,0 +1,123 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(2).EvictType(tp).Clock(clock).EventBuffer(16).Build()
+			cc.Set("a", 1)
+			cc.Set("a", 2)
+			cc.Remove("a")
+			cc.SetWithExpire("b", 3, time.Second)
+			clock.Advance(2 * time.Second)
+			cc.DeleteExpired()
+			for i := 0; i < 3; i++ {
+				cc.Set(i, i)
+			}
+
+			want := []EventType{EventAdded, EventUpdated, EventRemoved, EventAdded, EventExpired, EventAdded, EventAdded}
+			events := cc.Events()
+			for i, tp := range want {
+				select {
+				case e := <-events:
+					if e.Type != tp {
+						t.Fatalf("event %v: %v != %v", i, e.Type, tp)
+					}
+				default:
+					t.Fatalf("event %v: missing %v", i, tp)
+				}
+			}
+			// Adding the third key evicts one of the others.
+			var added, evicted int
+			for len(events) > 0 {
+				switch e := <-events; e.Type {
+				case EventAdded:
+					added++
+				case EventEvicted:
+					evicted++
+				}
+			}
+			if added != 1 || evicted != 1 {
+				t.Errorf("added/evicted: %v/%v != %v/%v", added, evicted, 1, 1)
+			}
+		})
+	}
+}
+
+func TestEventsExpiration(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(10).EvictType(tp).Clock(clock).EventBuffer(16).Build()
+			cc.SetWithExpire("a", 1, time.Minute)
+			cc.Set("b", 2)
+			cc.SetWithExpire("a", 3, time.Hour)
+
+			want := []*time.Time{timePtr(clock.Now().Add(time.Minute)), nil, timePtr(clock.Now().Add(time.Hour))}
+			events := cc.Events()
+			for i, expiration := range want {
+				e := <-events
+				if (e.Expiration == nil) != (expiration == nil) || e.Expiration != nil && !e.Expiration.Equal(*expiration) {
+					t.Errorf("event %v: %v != %v", i, e.Expiration, expiration)
+				}
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestEventsDropped(t *testing.T) {
+	cc := New(8).LRU().EventBuffer(2).Build()
+	for i := 0; i < 5; i++ {
+		cc.Set(i, i)
+	}
+	if n := len(cc.Events()); n != 2 {
+		t.Errorf("%v != %v", n, 2)
+	}
+	if n := cc.DroppedEventCount(); n != 3 {
+		t.Errorf("%v != %v", n, 3)
+	}
+	e := <-cc.Events()
+	if e.Type != EventAdded || e.Key != 0 || e.Value != 0 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	if New(8).LRU().Build().Events() != nil {
+		t.Error("events should be disabled by default")
+	}
+}
+
+func TestXCacheEvents(t *testing.T) {
+	xc := NewXCache[int, int](8).
+		BucketCount(4).
+		EventBuffer(16).
+		Build()
+	for i := 0; i < 4; i++ {
+		xc.Set(i, i)
+	}
+	xc.Remove(0)
+	if n := len(xc.Events()); n != 5 {
+		t.Fatalf("%v != %v", n, 5)
+	}
+	for i := 0; i < 4; i++ {
+		if e := <-xc.Events(); e.Type != EventAdded {
+			t.Errorf("%v != %v", e.Type, EventAdded)
+		}
+	}
+	if e := <-xc.Events(); e.Type != EventRemoved || e.Key != 0 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if xc.DroppedEventCount() != 0 {
+		t.Errorf("%v != %v", xc.DroppedEventCount(), 0)
+	}
+}
@@ -40,11 +40,9 @@ func main() {
 
 	// 2. Show bucket statistics
 	fmt.Println("=== Bucket Statistics ===")
-	bucketStats := cache.GetBucketStats()
-	for i := 0; i < cache.GetBucketCount(); i++ {
-		stats := bucketStats[i]
+	for i, stats := range cache.BucketStats() {
 		fmt.Printf("Bucket %d: size=%d, hit_rate=%.1f%%\n",
-			i, stats["len"], stats["hit_rate"].(float64)*100)
+			i, stats.Entries, stats.HitRate*100)
 	}
 	fmt.Println()
 
@@ -10,9 +10,9 @@ import (
 
 func main() {
 	// Create an XCache that supports string key and interface{} value
-	// Default 32 buckets, each bucket size is 100
+	// 32 buckets, each bucket size is 100
 	cache := xcache.NewXCache[string, interface{}](100).
-		BucketCount(32).             // Set 32 buckets (default value)
+		BucketCount(32).             // Set 32 buckets (default: AutoBucketCount)
 		LRU().                       // Use LRU eviction strategy
 		Expiration(time.Minute * 5). // Set 5 minutes expiration time
 		EvictedFunc(func(key string, value interface{}) {
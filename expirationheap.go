@@ -0,0 +1,133 @@
+package xcache
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expirationHeap keeps the keys of a cache that can expire ordered by deadline,
+// so that expired entries can be counted and removed without scanning the cache.
+//
+// Every key has at most one node, whose deadline is never later than the
+// actual deadline of the entry. Deadlines that have been extended in the
+// meantime, for example by a read of an entry with a max idle time, are
+// validated and corrected by the cache when the node comes up.
+type expirationHeap struct {
+	nodes expirationNodes
+	index map[interface{}]*expirationNode
+}
+
+type expirationNode struct {
+	key      interface{}
+	deadline time.Time
+	index    int
+}
+
+func newExpirationHeap() *expirationHeap {
+	return &expirationHeap{index: make(map[interface{}]*expirationNode)}
+}
+
+// schedule records that key expires at deadline, unless it is already
+// scheduled to expire earlier.
+func (h *expirationHeap) schedule(key interface{}, deadline time.Time) {
+	if node, ok := h.index[key]; ok {
+		if deadline.Before(node.deadline) {
+			node.deadline = deadline
+			heap.Fix(&h.nodes, node.index)
+		}
+		return
+	}
+	node := &expirationNode{key: key, deadline: deadline}
+	h.index[key] = node
+	heap.Push(&h.nodes, node)
+}
+
+// unschedule forgets the deadline of key.
+func (h *expirationHeap) unschedule(key interface{}) {
+	if node, ok := h.index[key]; ok {
+		delete(h.index, key)
+		heap.Remove(&h.nodes, node.index)
+	}
+}
+
+// reset forgets all deadlines.
+func (h *expirationHeap) reset() {
+	h.nodes = nil
+	h.index = make(map[interface{}]*expirationNode)
+}
+
+// countExpired returns the number of keys that have expired at now, according
+// to deadlineOf. Only the nodes that are due at now are visited.
+func (h *expirationHeap) countExpired(now time.Time, deadlineOf func(interface{}) (time.Time, bool)) int {
+	count := 0
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(h.nodes) || !h.nodes[i].deadline.Before(now) {
+			continue
+		}
+		if deadline, ok := deadlineOf(h.nodes[i].key); ok && deadline.Before(now) {
+			count++
+		}
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return count
+}
+
+// expired returns the keys that have expired at now, according to deadlineOf.
+// Keys whose deadline has been extended are rescheduled, and keys that
+// no longer expire are forgotten. The returned keys remain scheduled until
+// they are unscheduled.
+func (h *expirationHeap) expired(now time.Time, deadlineOf func(interface{}) (time.Time, bool)) []interface{} {
+	var keys []interface{}
+	var due []*expirationNode
+	for len(h.nodes) > 0 && h.nodes[0].deadline.Before(now) {
+		node := heap.Pop(&h.nodes).(*expirationNode)
+		deadline, ok := deadlineOf(node.key)
+		if !ok {
+			delete(h.index, node.key)
+			continue
+		}
+		node.deadline = deadline
+		due = append(due, node)
+		if deadline.Before(now) {
+			keys = append(keys, node.key)
+		}
+	}
+	for _, node := range due {
+		heap.Push(&h.nodes, node)
+	}
+	return keys
+}
+
+// expirationNodes implements heap.Interface ordered by deadline.
+type expirationNodes []*expirationNode
+
+func (n expirationNodes) Len() int { return len(n) }
+
+func (n expirationNodes) Less(i, j int) bool {
+	return n[i].deadline.Before(n[j].deadline)
+}
+
+func (n expirationNodes) Swap(i, j int) {
+	n[i], n[j] = n[j], n[i]
+	n[i].index = i
+	n[j].index = j
+}
+
+func (n *expirationNodes) Push(x interface{}) {
+	node := x.(*expirationNode)
+	node.index = len(*n)
+	*n = append(*n, node)
+}
+
+func (n *expirationNodes) Pop() interface{} {
+	old := *n
+	last := len(old) - 1
+	node := old[last]
+	old[last] = nil
+	node.index = -1
+	*n = old[:last]
+	return node
+}
@@ -0,0 +1,57 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpirationHeap(t *testing.T) {
+	now := time.Date(1984, time.April, 4, 0, 0, 0, 0, time.UTC)
+	deadlines := map[interface{}]time.Time{}
+	deadlineOf := func(key interface{}) (time.Time, bool) {
+		d, ok := deadlines[key]
+		return d, ok
+	}
+	h := newExpirationHeap()
+	for i := 0; i < 100; i++ {
+		d := now.Add(time.Duration(i) * time.Second)
+		deadlines[i] = d
+		h.schedule(i, d)
+	}
+	// A later deadline does not replace an earlier one.
+	h.schedule(0, now.Add(time.Hour))
+	h.unschedule(1)
+	delete(deadlines, 1)
+	// Extended deadlines are only noticed once they come up.
+	deadlines[2] = now.Add(time.Hour)
+
+	at := now.Add(10 * time.Second)
+	if n := h.countExpired(at, deadlineOf); n != 8 {
+		t.Fatalf("%v != %v", n, 8)
+	}
+	keys := h.expired(at, deadlineOf)
+	if len(keys) != 8 {
+		t.Fatalf("unexpected expired keys: %v", keys)
+	}
+	for _, key := range keys {
+		if key == 1 || key == 2 {
+			t.Errorf("key %v should not expire", key)
+		}
+		h.unschedule(key)
+		delete(deadlines, key)
+	}
+	if n := h.countExpired(at, deadlineOf); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+	if len(h.nodes) != 91 || len(h.index) != 91 {
+		t.Errorf("unexpected heap size: %v, %v", len(h.nodes), len(h.index))
+	}
+	if n := h.countExpired(now.Add(2*time.Hour), deadlineOf); n != 91 {
+		t.Errorf("%v != %v", n, 91)
+	}
+
+	h.reset()
+	if n := h.countExpired(now.Add(2*time.Hour), deadlineOf); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+}
@@ -0,0 +1,94 @@
+package xcache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFIFOGet(t *testing.T) {
+	size := 1000
+	gc := buildTestCache(t, TYPE_FIFO, size)
+	testSetCache(t, gc, size)
+	testGetCache(t, gc, size)
+}
+
+func TestLoadingFIFOGet(t *testing.T) {
+	size := 1000
+	gc := buildTestLoadingCache(t, TYPE_FIFO, size, loader)
+	testGetCache(t, gc, size)
+}
+
+func TestFIFOLength(t *testing.T) {
+	gc := buildTestLoadingCache(t, TYPE_FIFO, 1000, loader)
+	gc.Get("test1")
+	gc.Get("test2")
+	length := gc.Len(true)
+	expectedLength := 2
+	if length != expectedLength {
+		t.Errorf("Expected length is %v, not %v", length, expectedLength)
+	}
+}
+
+func TestFIFOEvictItem(t *testing.T) {
+	cacheSize := 10
+	numbers := 11
+	gc := buildTestLoadingCache(t, TYPE_FIFO, cacheSize, loader)
+
+	for i := 0; i < numbers; i++ {
+		_, err := gc.Get(fmt.Sprintf("Key-%d", i))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if gc.Len(false) != cacheSize {
+		t.Errorf("Expected length is %v, not %v", cacheSize, gc.Len(false))
+	}
+}
+
+func TestFIFOGetIFPresent(t *testing.T) {
+	testGetIFPresent(t, TYPE_FIFO)
+}
+
+func TestFIFOReadsDoNotChangeOrder(t *testing.T) {
+	cc := New(3).FIFO().Build()
+	cc.Set(1, "a")
+	cc.Set(2, "b")
+	cc.Set(3, "c")
+
+	// Reads and updates must not protect key 1 from eviction.
+	cc.Get(1)
+	cc.Get(1)
+	cc.Set(1, "A")
+
+	cc.Set(4, "d")
+	if _, err := cc.Get(1); err != ErrKeyNotFoundError {
+		t.Errorf("key 1 should be evicted first, got %v", err)
+	}
+	for _, key := range []int{2, 3, 4} {
+		if _, err := cc.Get(key); err != nil {
+			t.Errorf("key %v should still be cached: %v", key, err)
+		}
+	}
+}
+
+func TestFIFOOldestNewest(t *testing.T) {
+	cc := New(3).FIFO().Build().(OrderedCache)
+	if _, _, _, ok := cc.Oldest(); ok {
+		t.Fatal("Oldest should return false for an empty cache")
+	}
+
+	cc.Set(1, "a")
+	cc.SetWithExpire(2, "b", time.Minute)
+	cc.Set(3, "c")
+	cc.Get(1)
+
+	k, v, exp, ok := cc.Oldest()
+	if !ok || k != 1 || v != "a" || exp != nil {
+		t.Errorf("unexpected oldest entry: %v, %v, %v, %v", k, v, exp, ok)
+	}
+	k, v, _, ok = cc.Newest()
+	if !ok || k != 3 || v != "c" {
+		t.Errorf("unexpected newest entry: %v, %v, %v", k, v, ok)
+	}
+}
@@ -0,0 +1,108 @@
+// Package freq estimates how often keys occur in a stream with a count-min
+// sketch of 4-bit counters, as used by TinyLFU. Keys are identified by 64-bit
+// hashes, which should be well distributed, such as those of xcache.HashKey.
+package freq
+
+import "sync/atomic"
+
+// depth is the number of counters that each key is counted in.
+const depth = 4
+
+// MaxCount is the largest frequency a Sketch counts up to.
+const MaxCount = 15
+
+// resetMask keeps the three low bits of every 4-bit counter of a word after
+// it has been shifted right by one, which halves all counters at once.
+const resetMask = 0x7777777777777777
+
+// Sketch is a count-min sketch of 4-bit counters that ages its counts: after
+// a number of increments, the sample size, all counters are halved, so that
+// the estimates follow the recent frequencies of the keys.
+// A Sketch is safe for concurrent use.
+type Sketch struct {
+	table      []uint64 // 16 counters per word
+	mask       uint64   // number of counters - 1
+	sampleSize uint64
+	additions  uint64
+}
+
+// New returns a sketch for about keys distinct keys, rounded up to a power of
+// two. It has 16 counters per key, which keeps the estimates of most keys exact,
+// and ages after 10 × keys increments.
+func New(keys int) *Sketch {
+	n := 1
+	for n < keys {
+		n <<= 1
+	}
+	return &Sketch{
+		table:      make([]uint64, n),
+		mask:       uint64(16*n - 1),
+		sampleSize: 10 * uint64(n),
+	}
+}
+
+// Increment counts an occurrence of the key with hash h.
+func (s *Sketch) Increment(h uint64) {
+	for i := uint64(0); i < depth; i++ {
+		s.increment(s.index(h, i))
+	}
+	if atomic.AddUint64(&s.additions, 1) == s.sampleSize {
+		s.age()
+	}
+}
+
+// Estimate returns the estimated number of occurrences of the key with hash h
+// since it has last been aged, up to MaxCount. It may overestimate but never
+// underestimates, apart from the aging.
+func (s *Sketch) Estimate(h uint64) int {
+	estimate := MaxCount
+	for i := uint64(0); i < depth; i++ {
+		if n := s.count(s.index(h, i)); n < estimate {
+			estimate = n
+		}
+	}
+	return estimate
+}
+
+// Reset sets all counters to zero.
+func (s *Sketch) Reset() {
+	for i := range s.table {
+		atomic.StoreUint64(&s.table[i], 0)
+	}
+	atomic.StoreUint64(&s.additions, 0)
+}
+
+// index returns the counter of row i for the key with hash h.
+func (s *Sketch) index(h, i uint64) uint64 {
+	h1, h2 := h&0xffffffff, h>>32|1
+	return (h1 + i*h2) & s.mask
+}
+
+func (s *Sketch) count(c uint64) int {
+	return int(atomic.LoadUint64(&s.table[c/16]) >> (c % 16 * 4) & 0xf)
+}
+
+// increment increments counter c unless it is saturated.
+func (s *Sketch) increment(c uint64) {
+	word := &s.table[c/16]
+	shift := c % 16 * 4
+	for {
+		old := atomic.LoadUint64(word)
+		if old>>shift&0xf == MaxCount || atomic.CompareAndSwapUint64(word, old, old+1<<shift) {
+			return
+		}
+	}
+}
+
+// age halves all counters.
+func (s *Sketch) age() {
+	for i := range s.table {
+		for {
+			old := atomic.LoadUint64(&s.table[i])
+			if atomic.CompareAndSwapUint64(&s.table[i], old, old>>1&resetMask) {
+				break
+			}
+		}
+	}
+	atomic.StoreUint64(&s.additions, 0)
+}
@@ -0,0 +1,75 @@
+package freq
+
+import "testing"
+
+// hash spreads i over 64 bits like a real hash function would.
+func hash(i int) uint64 {
+	h := uint64(i) * 0x9e3779b97f4a7c15
+	return h ^ h>>29
+}
+
+func TestSketch(t *testing.T) {
+	s := New(1000)
+	for i := 0; i < 5; i++ {
+		s.Increment(hash(1))
+	}
+	for i := 0; i < 100; i++ {
+		s.Increment(hash(2))
+	}
+	if n := s.Estimate(hash(1)); n < 5 {
+		t.Errorf("%v < %v", n, 5)
+	}
+	if n := s.Estimate(hash(2)); n != MaxCount {
+		t.Errorf("%v != %v", n, MaxCount)
+	}
+	if n := s.Estimate(hash(3)); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+
+	s.Reset()
+	if n := s.Estimate(hash(2)); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+}
+
+func TestSketchAging(t *testing.T) {
+	s := New(16)
+	for i := 0; i < 20; i++ {
+		s.Increment(hash(1))
+	}
+	if n := s.Estimate(hash(1)); n != MaxCount {
+		t.Errorf("%v != %v", n, MaxCount)
+	}
+	// the sample is full after 160 increments, which halves all counts
+	for i := 20; i < 160; i++ {
+		s.Increment(hash(1))
+	}
+	if n := s.Estimate(hash(1)); n != MaxCount/2 {
+		t.Errorf("%v != %v", n, MaxCount/2)
+	}
+}
+
+func TestSketchAccuracy(t *testing.T) {
+	s := New(1 << 12)
+	for i := 0; i < 1<<12; i++ {
+		s.Increment(hash(i))
+	}
+	errors := 0
+	for i := 0; i < 1<<12; i++ {
+		if n := s.Estimate(hash(i)); n < 1 {
+			t.Fatalf("%v: %v < 1", i, n)
+		} else if n > 1 {
+			errors++
+		}
+	}
+	if errors > 1<<12/100 {
+		t.Errorf("%v estimates are too high", errors)
+	}
+}
+
+func BenchmarkSketchIncrement(b *testing.B) {
+	s := New(1 << 16)
+	for i := 0; i < b.N; i++ {
+		s.Increment(hash(i & 0xffff))
+	}
+}
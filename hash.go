@@ -0,0 +1,69 @@
+package xcache
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// HashKey returns the hash that xcache computes for key, for example to look
+// the key up in a freq.Sketch. See hashAny for how keys are hashed.
+func HashKey(key interface{}) uint64 {
+	return hashAny(key)
+}
+
+// hashAny hashes key with xxhash. Strings and integers are hashed directly,
+// keys that implement encoding.BinaryMarshaler are hashed in their binary form,
+// and all other keys are formatted with fmt first.
+func hashAny(key interface{}) uint64 {
+	if h, ok := hashBasic(key); ok {
+		return h
+	}
+	if m, ok := key.(encoding.BinaryMarshaler); ok {
+		if b, err := m.MarshalBinary(); err == nil {
+			return xxhash.Sum64(b)
+		}
+	}
+	return xxhash.Sum64String(fmt.Sprintf("%v", key))
+}
+
+// hashBasic hashes strings and integers. It does not retain key, so that
+// converting a key to an interface for it does not allocate.
+func hashBasic(key interface{}) (uint64, bool) {
+	switch k := key.(type) {
+	case string:
+		return xxhash.Sum64String(k), true
+	case int:
+		return hashUint64(uint64(k)), true
+	case int8:
+		return hashUint64(uint64(k)), true
+	case int16:
+		return hashUint64(uint64(k)), true
+	case int32:
+		return hashUint64(uint64(k)), true
+	case int64:
+		return hashUint64(uint64(k)), true
+	case uint:
+		return hashUint64(uint64(k)), true
+	case uint8:
+		return hashUint64(uint64(k)), true
+	case uint16:
+		return hashUint64(uint64(k)), true
+	case uint32:
+		return hashUint64(uint64(k)), true
+	case uint64:
+		return hashUint64(k), true
+	case uintptr:
+		return hashUint64(uint64(k)), true
+	}
+	return 0, false
+}
+
+// hashUint64 hashes the little endian bytes of v with xxhash.
+func hashUint64(v uint64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return xxhash.Sum64(b[:])
+}
@@ -0,0 +1,60 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHashAny(t *testing.T) {
+	type point struct{ x, y int }
+	keys := []interface{}{"a", "b", 1, 2, point{1, 2}, point{2, 1}}
+	seen := map[uint64]interface{}{}
+	for _, key := range keys {
+		h := hashAny(key)
+		if h != hashAny(key) {
+			t.Errorf("hash of %v is not stable", key)
+		}
+		if other, ok := seen[h]; ok && other != key {
+			t.Errorf("%v and %v have the same hash", key, other)
+		}
+		seen[h] = key
+	}
+	// Integers of different types with the same value hash alike.
+	if hashAny(1) != hashAny(int8(1)) || hashAny(1) != hashAny(uint64(1)) {
+		t.Error("integers with the same value should hash alike")
+	}
+	// BinaryMarshaler keys are hashed in their binary form.
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if hashAny(ts) != hashAny(ts) || hashAny(ts) == hashAny(ts.Add(time.Second)) {
+		t.Error("time keys should be hashed by value")
+	}
+}
+
+func TestHashAnyAllocs(t *testing.T) {
+	xs := NewXCache[string, int](8).Build()
+	xi := NewXCache[int, int](8).Build()
+	key := "some-key"
+	if n := testing.AllocsPerRun(100, func() { xs.hashKey(key) }); n != 0 {
+		t.Errorf("hashing a string key allocates %v times", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { xi.hashKey(123456789) }); n != 0 {
+		t.Errorf("hashing an int key allocates %v times", n)
+	}
+}
+
+func BenchmarkXCacheHashKey(b *testing.B) {
+	b.Run("string", func(b *testing.B) {
+		xc := NewXCache[string, int](8).Build()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			xc.hashKey("some-key")
+		}
+	})
+	b.Run("int", func(b *testing.B) {
+		xc := NewXCache[int, int](8).Build()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			xc.hashKey(i)
+		}
+	})
+}
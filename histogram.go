@@ -0,0 +1,92 @@
+package xcache
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLoadLatencyBuckets are the upper bounds of the buckets of the load latency histogram.
+var DefaultLoadLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// LatencyHistogram is a snapshot of a histogram of durations.
+type LatencyHistogram struct {
+	// Bounds are the inclusive upper bounds of the buckets in ascending order.
+	Bounds []time.Duration
+	// Counts are the number of durations in each bucket. The last count is the
+	// number of durations above the last bound, so there is one more count than bounds.
+	Counts []uint64
+	// Count is the total number of durations.
+	Count uint64
+	// Sum is the total of all durations.
+	Sum time.Duration
+}
+
+// Mean returns the mean duration, or zero if the histogram is empty.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// merge adds the counts of o to h. Both histograms must have the same bounds.
+func (h *LatencyHistogram) merge(o LatencyHistogram) {
+	if h.Counts == nil {
+		h.Bounds = o.Bounds
+		h.Counts = make([]uint64, len(o.Counts))
+	}
+	for i, n := range o.Counts {
+		h.Counts[i] += n
+	}
+	h.Count += o.Count
+	h.Sum += o.Sum
+}
+
+// latencyHistogram counts durations in fixed buckets without locking.
+type latencyHistogram struct {
+	bounds []time.Duration
+	counts []uint64
+	sum    int64
+}
+
+func newLatencyHistogram(bounds []time.Duration) *latencyHistogram {
+	sorted := make([]time.Duration, len(bounds))
+	copy(sorted, bounds)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return &latencyHistogram{
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+// observe records d.
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return d <= h.bounds[i] })
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// snapshot returns the current counts of the histogram.
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	s := LatencyHistogram{
+		Bounds: make([]time.Duration, len(h.bounds)),
+		Counts: make([]uint64, len(h.counts)),
+		Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	copy(s.Bounds, h.bounds)
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.Count += s.Counts[i]
+	}
+	return s
+}
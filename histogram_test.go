@@ -0,0 +1,75 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := newLatencyHistogram([]time.Duration{10 * time.Millisecond, time.Millisecond})
+	for _, d := range []time.Duration{0, time.Millisecond, 2 * time.Millisecond, 10 * time.Millisecond, time.Second} {
+		h.observe(d)
+	}
+	s := h.snapshot()
+	if len(s.Bounds) != 2 || s.Bounds[0] != time.Millisecond || s.Bounds[1] != 10*time.Millisecond {
+		t.Fatalf("bounds should be sorted: %v", s.Bounds)
+	}
+	want := []uint64{2, 2, 1}
+	for i, n := range want {
+		if s.Counts[i] != n {
+			t.Errorf("%v != %v", s.Counts, want)
+			break
+		}
+	}
+	if s.Count != 5 {
+		t.Errorf("%v != %v", s.Count, 5)
+	}
+	if sum := 1013 * time.Millisecond; s.Sum != sum {
+		t.Errorf("%v != %v", s.Sum, sum)
+	}
+	if mean := s.Sum / 5; s.Mean() != mean {
+		t.Errorf("%v != %v", s.Mean(), mean)
+	}
+}
+
+func TestLoadLatency(t *testing.T) {
+	cc := New(8).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return key, nil
+		}).
+		LoadLatencyBuckets(time.Millisecond, time.Minute).
+		Build()
+	cc.Get(1)
+	cc.Get(2)
+	cc.Get(1)
+
+	s := cc.LoadLatency()
+	if s.Count != 2 || s.Counts[0] != 0 || s.Counts[1] != 2 {
+		t.Errorf("unexpected histogram: %+v", s)
+	}
+	if s.Mean() < 5*time.Millisecond {
+		t.Errorf("mean %v should be at least %v", s.Mean(), 5*time.Millisecond)
+	}
+}
+
+func TestXCacheLoadLatency(t *testing.T) {
+	xc := NewXCache[int, int](8).
+		BucketCount(4).
+		LoaderFunc(func(key int) (int, error) {
+			return key, nil
+		}).
+		LoadLatencyBuckets(time.Minute).
+		Build()
+	for i := 0; i < 8; i++ {
+		xc.Get(i)
+	}
+	s := xc.Stats().LoadLatency
+	if s.Count != 8 || len(s.Counts) != 2 || s.Counts[0] != 8 {
+		t.Errorf("unexpected histogram: %+v", s)
+	}
+	if xc.LoadLatency().Count != 8 {
+		t.Errorf("%v != %v", xc.LoadLatency().Count, 8)
+	}
+}
@@ -0,0 +1,99 @@
+package xcache
+
+// Iterator walks the unexpired entries of an XCache one bucket at a time.
+// It does not hold any lock between calls, so the cache may be used while iterating.
+//
+//	it := cache.Iterator(false)
+//	for it.Next() {
+//		fmt.Println(it.Key(), it.Value())
+//	}
+type Iterator[K comparable, V any] struct {
+	buckets []Cache
+	// deserialize is the DeserializeFunc of the cache, if any.
+	deserialize DeserializeFunc
+	// snapshots holds the entries of every bucket if they have been copied up front.
+	snapshots [][]cacheEntry
+	bucket    int
+	entries   []cacheEntry
+	pos       int
+	key       K
+	value     V
+}
+
+// Iterator returns an iterator over the unexpired entries of the cache.
+//
+// Without snapshot, the entries of each bucket are copied under the read lock of
+// the bucket when the iterator reaches it, so only one bucket is locked at a time
+// and only one bucket's entries are held in memory. Changes of buckets that have
+// not been reached yet are visible to the iterator.
+//
+// With snapshot, the entries of all buckets are copied when the iterator is created,
+// each bucket under its own read lock, so later changes are not visible.
+// This holds a copy of the whole cache in memory.
+//
+// Entries may be missed or repeated if Rebucket runs while iterating.
+func (xc *XCache[K, V]) Iterator(snapshot bool) *Iterator[K, V] {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	buckets := xc.allBuckets()
+	it := &Iterator[K, V]{buckets: make([]Cache, len(buckets)), deserialize: xc.builder.deserializeFunc}
+	copy(it.buckets, buckets)
+	if snapshot {
+		it.snapshots = make([][]cacheEntry, len(buckets))
+		for i, bucket := range buckets {
+			it.snapshots[i] = bucket.entries()
+		}
+	}
+	return it
+}
+
+// Next advances the iterator to the next entry and reports whether there is one.
+// Values are deserialized with the DeserializeFunc of the cache, if any, like Get;
+// entries whose values cannot be deserialized are skipped.
+func (it *Iterator[K, V]) Next() bool {
+	for {
+		for it.pos < len(it.entries) {
+			e := it.entries[it.pos]
+			it.pos++
+			key, ok := e.key.(K)
+			if !ok {
+				continue
+			}
+			v := e.value
+			if it.deserialize != nil {
+				var err error
+				if v, err = it.deserialize(e.key, v); err != nil {
+					continue
+				}
+			}
+			value, ok := v.(V)
+			if !ok {
+				continue
+			}
+			it.key, it.value = key, value
+			return true
+		}
+		if it.bucket >= len(it.buckets) {
+			it.entries = nil
+			return false
+		}
+		if it.snapshots != nil {
+			it.entries = it.snapshots[it.bucket]
+			it.snapshots[it.bucket] = nil
+		} else {
+			it.entries = it.buckets[it.bucket].entries()
+		}
+		it.bucket++
+		it.pos = 0
+	}
+}
+
+// Key returns the key of the current entry.
+func (it *Iterator[K, V]) Key() K {
+	return it.key
+}
+
+// Value returns the value of the current entry.
+func (it *Iterator[K, V]) Value() V {
+	return it.value
+}
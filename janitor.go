@@ -0,0 +1,59 @@
+package xcache
+
+import (
+	"sync"
+	"time"
+)
+
+// ExpirationMode controls when expired entries are removed from a cache.
+type ExpirationMode int
+
+const (
+	// ExpirationLazy removes expired entries when they are looked up or
+	// DeleteExpired is called. This is the default.
+	ExpirationLazy ExpirationMode = iota
+	// ExpirationEager removes expired entries only from a background janitor,
+	// so ExpiredFunc is called within one janitor interval after an entry expires.
+	// Expired entries are never returned, but stay in the cache until the janitor runs.
+	ExpirationEager
+	// ExpirationHybrid removes expired entries both when they are looked up
+	// and from a background janitor.
+	ExpirationHybrid
+)
+
+// DefaultJanitorInterval is the interval at which the janitor removes
+// expired entries if no interval is given.
+const DefaultJanitorInterval = time.Second
+
+// janitor periodically removes the expired entries of a cache in the background.
+type janitor struct {
+	interval time.Duration
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newJanitor(interval time.Duration) *janitor {
+	return &janitor{
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+func (j *janitor) run(deleteExpired func() int) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deleteExpired()
+		case <-j.done:
+			return
+		}
+	}
+}
+
+func (j *janitor) stop() {
+	j.once.Do(func() {
+		close(j.done)
+	})
+}
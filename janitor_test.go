@@ -0,0 +1,115 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEagerExpiration(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			expired := make(chan interface{}, 1)
+			clock := NewFakeClock()
+			cc := New(8).
+				EvictType(tp).
+				Clock(clock).
+				ExpirationMode(ExpirationEager, 10*time.Millisecond).
+				ExpiredFunc(func(key, value interface{}) {
+					expired <- key
+				}).
+				Build()
+			defer cc.Close()
+			cc.SetWithExpire(1, 1, time.Second)
+			clock.Advance(2 * time.Second)
+
+			if _, err := cc.Get(1); err != ErrKeyNotFoundError {
+				t.Fatalf("expired entry should not be returned: %v", err)
+			}
+			select {
+			case key := <-expired:
+				if key != 1 {
+					t.Errorf("%v != %v", key, 1)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("janitor should remove the expired entry")
+			}
+			if l := cc.Len(false); l != 0 {
+				t.Errorf("%v != %v", l, 0)
+			}
+		})
+	}
+}
+
+func TestEagerExpirationKeepsExpiredEntriesOnLookup(t *testing.T) {
+	clock := NewFakeClock()
+	cc := New(8).
+		LRU().
+		Clock(clock).
+		ExpirationMode(ExpirationEager, time.Hour).
+		Build()
+	defer cc.Close()
+	cc.SetWithExpire(1, 1, time.Second)
+	clock.Advance(2 * time.Second)
+
+	if _, err := cc.Get(1); err != ErrKeyNotFoundError {
+		t.Fatalf("expired entry should not be returned: %v", err)
+	}
+	if l := cc.Len(false); l != 1 {
+		t.Errorf("%v != %v", l, 1)
+	}
+	if n := cc.DeleteExpired(); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+}
+
+func TestHybridExpiration(t *testing.T) {
+	expired := make(chan interface{}, 2)
+	clock := NewFakeClock()
+	cc := New(8).
+		LRU().
+		Clock(clock).
+		ExpirationMode(ExpirationHybrid, 10*time.Millisecond).
+		ExpiredFunc(func(key, value interface{}) {
+			expired <- key
+		}).
+		Build()
+	defer cc.Close()
+	cc.SetWithExpire(1, 1, time.Second)
+	cc.SetWithExpire(2, 2, time.Second)
+	clock.Advance(2 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-expired:
+		case <-time.After(time.Second):
+			t.Fatal("janitor should remove the expired entries")
+		}
+	}
+	if l := cc.Len(false); l != 0 {
+		t.Errorf("%v != %v", l, 0)
+	}
+}
+
+func TestJanitorClose(t *testing.T) {
+	expired := make(chan interface{}, 1)
+	clock := NewFakeClock()
+	cc := New(8).
+		LRU().
+		Clock(clock).
+		ExpirationMode(ExpirationEager, 10*time.Millisecond).
+		ExpiredFunc(func(key, value interface{}) {
+			expired <- key
+		}).
+		Build()
+	cc.Close()
+	cc.Close()
+	cc.SetWithExpire(1, 1, time.Second)
+	clock.Advance(2 * time.Second)
+
+	select {
+	case <-expired:
+		t.Fatal("closed janitor should not remove entries")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,90 @@
+package xcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// jsonEntry is a line written by ExportJSON.
+type jsonEntry[K, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+	// Expires is the time at which the entry expires, omitted if it does not expire.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// ExportJSON writes the entries of the cache to w as JSON Lines, one object
+// {"key": ..., "value": ..., "expires": ...} per line, so that they can be
+// inspected with tools such as jq, diffed, or moved to another environment with
+// ImportJSON. Expires is the RFC 3339 time at which the entry expires and is
+// omitted for entries that do not expire. Keys and values are encoded with
+// encoding/json and written as returned by Get. The entries are copied one bucket
+// after another, so entries written concurrently may be missed, and they are
+// encoded and written after the lock of the cache has been released.
+func (xc *XCache[K, V]) ExportJSON(w io.Writer) error {
+	xc.rlock()
+	entries := xc.copyEntries()
+	xc.mu.RUnlock()
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := visitEntries(entries, xc.builder.clock.Now(), xc.builder.deserializeFunc, func(key K, value V, expiration *time.Time) error {
+		return enc.Encode(jsonEntry[K, V]{Key: key, Value: value, Expires: expiration})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportJSON adds the entries written by ExportJSON to the cache like LoadFrom,
+// replacing the values of keys that are present. Entries that have expired are
+// skipped, and blank lines are ignored. The lines are decoded one at a time and
+// added in batches, so that r need not fit in memory. If a line cannot be
+// decoded, ImportJSON returns an error that wraps ErrUnknownFormat and names the
+// line; the entries of the lines before it have been added, as they have if r
+// fails.
+func (xc *XCache[K, V]) ImportJSON(r io.Reader) error {
+	br := bufio.NewReader(r)
+	batch := make([]persistedEntry[K, V], 0, warmBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := xc.loadEntries(batch)
+		batch = batch[:0]
+		return err
+	}
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			if ferr := flush(); ferr != nil {
+				return ferr
+			}
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var e jsonEntry[K, V]
+			if jerr := json.Unmarshal(line, &e); jerr != nil {
+				if ferr := flush(); ferr != nil {
+					return ferr
+				}
+				return fmt.Errorf("%w: line %d: %v", ErrUnknownFormat, n, jerr)
+			}
+			if ttl, ok := remainingTTL(e.Expires, xc.builder.clock.Now()); ok {
+				batch = append(batch, persistedEntry[K, V]{Key: e.Key, Value: e.Value, TTL: ttl})
+			}
+		}
+		if len(batch) == warmBatchSize {
+			if ferr := flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return flush()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package xcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type jsonUser struct {
+	Name string
+	Age  int
+}
+
+func TestExportImportJSON(t *testing.T) {
+	clock := NewFakeClock()
+	xc := NewXCache[string, jsonUser](100).BucketCount(4).Clock(clock).Build()
+	defer xc.Close()
+	xc.Set("a", jsonUser{Name: "a", Age: 1})
+	xc.SetWithExpire("short", jsonUser{Name: "short"}, time.Second)
+	xc.SetWithExpire("long", jsonUser{Name: "long"}, time.Hour)
+
+	var buf bytes.Buffer
+	if err := xc.ExportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("%v != 3: %s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := e["expires"]; ok != (e["key"] != "a") {
+			t.Errorf("%s", line)
+		}
+	}
+
+	clock.Advance(time.Minute)
+	imported := NewXCache[string, jsonUser](100).Clock(clock).Build()
+	defer imported.Close()
+	if err := imported.ImportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := imported.GetIFPresent("a"); err != nil || v != (jsonUser{Name: "a", Age: 1}) {
+		t.Errorf("%v, %v", v, err)
+	}
+	// expired entries are skipped and the others keep their expiration time
+	if _, err := imported.GetIFPresent("short"); err != ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+	}
+	if _, expiration, err := imported.GetWithExpiration("long"); err != nil || expiration == nil || !expiration.Equal(clock.Now().Add(59*time.Minute)) {
+		t.Errorf("%v, %v", expiration, err)
+	}
+	if n := imported.Len(false); n != 2 {
+		t.Errorf("%v != 2", n)
+	}
+}
+
+func TestImportJSONInvalid(t *testing.T) {
+	xc := NewXCache[int, string](10).Build()
+	defer xc.Close()
+	input := "{\"key\": 1, \"value\": \"a\"}\n\n{\"key\": \"x\", \"value\": \"b\"}\n"
+	err := xc.ImportJSON(strings.NewReader(input))
+	if !errors.Is(err, ErrUnknownFormat) || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("%v", err)
+	}
+	// the lines before the invalid one have been added
+	if n := xc.Len(false); n != 1 {
+		t.Errorf("%v != 1", n)
+	}
+	if err := xc.ImportJSON(strings.NewReader("{\"key\": 2, \"value\": \"b\"}")); err != nil || xc.Len(false) != 2 {
+		t.Errorf("%v, %v", err, xc.Len(false))
+	}
+}
+
+func TestImportJSONBatches(t *testing.T) {
+	xc := NewXCache[int, int](10 * warmBatchSize).BucketCount(4).Build()
+	defer xc.Close()
+	var input strings.Builder
+	for i := 0; i < 2*warmBatchSize+1; i++ {
+		fmt.Fprintf(&input, "{\"key\": %d, \"value\": %d}\n", i, i)
+	}
+	if err := xc.ImportJSON(strings.NewReader(input.String())); err != nil {
+		t.Fatal(err)
+	}
+	if n := xc.Len(false); n != 2*warmBatchSize+1 {
+		t.Errorf("%v != %v", n, 2*warmBatchSize+1)
+	}
+}
+
+func TestExportJSONUnlocked(t *testing.T) {
+	xc := NewXCache[int, int](100).BucketCount(4).Build()
+	defer xc.Close()
+	for i := 0; i < 10; i++ {
+		xc.Set(i, i)
+	}
+	w := &unlockedWriter[int, int]{t: t, xc: xc}
+	if err := xc.ExportJSON(w); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(w.String(), "\n"); n != 10 {
+		t.Errorf("%v != 10", n)
+	}
+}
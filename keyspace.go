@@ -0,0 +1,125 @@
+package xcache
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrKeyspaceNotificationsDisabled is returned when subscribing to a cache
+// that has not been built with KeyspaceNotifications.
+var ErrKeyspaceNotificationsDisabled = errors.New("keyspace notifications are disabled")
+
+// Keyspace notification events, named as in Redis.
+const (
+	NotifySet     = "set"
+	NotifyDel     = "del"
+	NotifyExpired = "expired"
+	NotifyEvicted = "evicted"
+)
+
+// KeyspaceNotification reports a change of a key that matches the pattern of a subscription.
+type KeyspaceNotification struct {
+	// Event is one of NotifySet, NotifyDel, NotifyExpired and NotifyEvicted.
+	Event string
+	Key   interface{}
+	Value interface{}
+}
+
+// keyspace dispatches keyspace notifications to the subscriptions whose
+// pattern matches the key. Keys that are not strings are matched in their
+// fmt representation.
+type keyspace struct {
+	mu      sync.RWMutex
+	subs    map[int]*subscription
+	nextID  int
+	dropped uint64
+}
+
+type subscription struct {
+	pattern *regexp.Regexp
+	fn      func(KeyspaceNotification)
+	ch      chan KeyspaceNotification
+}
+
+func newKeyspace() *keyspace {
+	return &keyspace{subs: make(map[int]*subscription)}
+}
+
+// subscribe adds sub and returns a function that removes it again.
+func (k *keyspace) subscribe(sub *subscription) func() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	id := k.nextID
+	k.nextID++
+	k.subs[id] = sub
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			delete(k.subs, id)
+		})
+	}
+}
+
+// notify delivers the notification for an event to the matching subscriptions.
+// Channels that are full drop the notification, and panics of callbacks are recovered.
+func (k *keyspace) notify(tp EventType, key, value interface{}, logger Logger) {
+	var event string
+	switch tp {
+	case EventAdded, EventUpdated:
+		event = NotifySet
+	case EventRemoved:
+		event = NotifyDel
+	case EventExpired:
+		event = NotifyExpired
+	case EventEvicted:
+		event = NotifyEvicted
+	default:
+		return
+	}
+
+	k.mu.RLock()
+	if len(k.subs) == 0 {
+		k.mu.RUnlock()
+		return
+	}
+	s, ok := keyString(key)
+	if !ok {
+		s = fmt.Sprint(key)
+	}
+	var matched []*subscription
+	for _, sub := range k.subs {
+		if sub.pattern.MatchString(s) {
+			matched = append(matched, sub)
+		}
+	}
+	k.mu.RUnlock()
+
+	n := KeyspaceNotification{Event: event, Key: key, Value: value}
+	for _, sub := range matched {
+		if sub.ch != nil {
+			select {
+			case sub.ch <- n:
+			default:
+				atomic.AddUint64(&k.dropped, 1)
+			}
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logWarn(logger, "xcache: recovered keyspace callback panic", "key", key, "panic", r)
+				}
+			}()
+			sub.fn(n)
+		}()
+	}
+}
+
+func (k *keyspace) droppedCount() uint64 {
+	return atomic.LoadUint64(&k.dropped)
+}
@@ -0,0 +1,115 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyspaceNotifications(t *testing.T) {
+	clock := NewFakeClock()
+	cc := New(2).
+		LRU().
+		Clock(clock).
+		KeyspaceNotifications().
+		Build()
+
+	var users []KeyspaceNotification
+	unsubscribe, err := cc.Subscribe("user:*", func(n KeyspaceNotification) {
+		users = append(users, n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, cancel, err := cc.SubscribeChan("*", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	cc.Set("user:1", "a")
+	cc.Set("user:1", "b")
+	cc.Set("order:1", "c")
+	cc.Remove("order:1")
+	cc.SetWithExpire("user:2", "d", time.Second)
+	clock.Advance(2 * time.Second)
+	cc.DeleteExpired()
+	cc.Set("user:3", "e")
+	cc.Set("user:4", "f")
+
+	want := []KeyspaceNotification{
+		{NotifySet, "user:1", "a"},
+		{NotifySet, "user:1", "b"},
+		{NotifySet, "user:2", "d"},
+		{NotifyExpired, "user:2", "d"},
+		{NotifySet, "user:3", "e"},
+		{NotifyEvicted, "user:1", "b"},
+		{NotifySet, "user:4", "f"},
+	}
+	if len(users) != len(want) {
+		t.Fatalf("%v != %v", users, want)
+	}
+	for i := range want {
+		if users[i] != want[i] {
+			t.Errorf("%v != %v", users[i], want[i])
+		}
+	}
+	if n := len(all); n != len(want)+2 {
+		t.Errorf("%v != %v", n, len(want)+2)
+	}
+
+	unsubscribe()
+	cc.Set("user:5", "g")
+	if len(users) != len(want) {
+		t.Errorf("unsubscribed callback should not be called: %v", users[len(want):])
+	}
+}
+
+func TestKeyspaceNotificationsDropped(t *testing.T) {
+	cc := New(8).LRU().KeyspaceNotifications().Build()
+	ch, cancel, _ := cc.SubscribeChan("*", 1)
+	defer cancel()
+	cc.Set(1, 1)
+	cc.Set(2, 2)
+	if n := cc.DroppedNotificationCount(); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+	if n := <-ch; n.Key != 1 {
+		t.Errorf("%v != %v", n.Key, 1)
+	}
+}
+
+func TestKeyspaceNotificationsDisabled(t *testing.T) {
+	cc := New(8).LRU().Build()
+	if _, err := cc.Subscribe("*", func(KeyspaceNotification) {}); err != ErrKeyspaceNotificationsDisabled {
+		t.Errorf("%v != %v", err, ErrKeyspaceNotificationsDisabled)
+	}
+	if _, _, err := cc.SubscribeChan("*", 1); err != ErrKeyspaceNotificationsDisabled {
+		t.Errorf("%v != %v", err, ErrKeyspaceNotificationsDisabled)
+	}
+}
+
+func TestXCacheKeyspaceNotifications(t *testing.T) {
+	xc := NewXCache[string, int](8).
+		BucketCount(4).
+		KeyspaceNotifications().
+		Build()
+	ch, cancel, err := xc.SubscribeChan("session:*", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	for _, key := range []string{"session:a", "user:a", "session:b"} {
+		xc.Set(key, 1)
+	}
+	xc.Remove("session:a")
+	if n := len(ch); n != 3 {
+		t.Fatalf("%v != %v", n, 3)
+	}
+	events := map[string]int{}
+	for len(ch) > 0 {
+		events[(<-ch).Event]++
+	}
+	if events[NotifySet] != 2 || events[NotifyDel] != 1 {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
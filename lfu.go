@@ -2,6 +2,7 @@ package xcache
 
 import (
 	"container/list"
+	"io"
 	"time"
 )
 
@@ -10,6 +11,9 @@ type LFUCache struct {
 	baseCache
 	items    map[interface{}]*lfuItem
 	freqList *list.List // list for freqEntry
+
+	decayInterval time.Duration
+	lastDecay     time.Time
 }
 
 var _ Cache = (*LFUCache)(nil)
@@ -20,6 +24,16 @@ type lfuItem struct {
 	value       interface{}
 	freqElement *list.Element
 	expiration  *time.Time
+	pinned      bool
+	version     uint64
+	accessInfo
+}
+
+// LFUState describes the access frequencies of the entries of an LFU cache.
+type LFUState struct {
+	// Frequencies maps each access frequency to the number of entries that have it.
+	// Frequencies without entries are omitted.
+	Frequencies map[uint]int
 }
 
 type freqEntry struct {
@@ -28,17 +42,30 @@ type freqEntry struct {
 }
 
 func newLFUCache(cb *CacheBuilder) *LFUCache {
-	c := &LFUCache{}
+	c := &LFUCache{
+		decayInterval: cb.lfuDecay,
+	}
 	buildCache(&c.baseCache, cb)
+	c.eventExpiration = c.expirationOf
+	c.lastDecay = c.clock.Now()
 
 	c.init()
 	c.loadGroup.cache = c
+	c.startJanitor(c.DeleteExpired)
+	c.startTrimmer(c.shrink)
+	c.watchMemory(c.shrink)
 	return c
 }
 
 func (c *LFUCache) init() {
 	c.freqList = list.New()
-	c.items = make(map[interface{}]*lfuItem, c.size)
+	if c.items != nil {
+		for k := range c.items {
+			delete(c.items, k)
+		}
+	} else {
+		c.items = make(map[interface{}]*lfuItem, c.size)
+	}
 	c.freqList.PushFront(&freqEntry{
 		freq:  0,
 		items: make(map[*lfuItem]struct{}),
@@ -48,7 +75,7 @@ func (c *LFUCache) init() {
 // Set a new key-value pair
 func (c *LFUCache) Set(key, value interface{}) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 	_, err := c.set(key, value)
 	return err
 }
@@ -56,7 +83,7 @@ func (c *LFUCache) Set(key, value interface{}) error {
 // Set a new key-value pair with an expiration time
 func (c *LFUCache) SetWithExpire(key, value interface{}, expiration time.Duration) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 	item, err := c.set(key, value)
 	if err != nil {
 		return err
@@ -64,32 +91,124 @@ func (c *LFUCache) SetWithExpire(key, value interface{}, expiration time.Duratio
 
 	t := c.clock.Now().Add(expiration)
 	item.(*lfuItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return nil
+}
+
+// SetWithExpireAndIdle sets a new key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (c *LFUCache) SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	item, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	it := item.(*lfuItem)
+	if expiration > 0 {
+		t := c.clock.Now().Add(expiration)
+		it.expiration = &t
+		c.scheduleExpiration(key, t)
+	} else {
+		it.expiration = nil
+	}
+	c.setMaxIdle(key, &it.accessInfo, maxIdle)
+	return nil
+}
+
+// SetIfAbsent sets a new key-value pair only if the key is not present in the cache.
+func (c *LFUCache) SetIfAbsent(key, value interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfAbsentWithExpire sets a new key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (c *LFUCache) SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	item, err := c.set(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	item.(*lfuItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return true, nil
+}
+
+// setMulti sets the specified key-value pairs, acquiring the lock only once.
+// If expiration is not nil, it is applied to every pair.
+func (c *LFUCache) setMulti(items map[interface{}]interface{}, expiration *time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, value := range items {
+		item, err := c.set(key, value)
+		if err == ErrNotAdmitted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			item.(*lfuItem).expiration = &t
+			c.scheduleExpiration(key, t)
+		}
+	}
 	return nil
 }
 
 func (c *LFUCache) set(key, value interface{}) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	c.removeStale(key, c.deadlineOf, c.remove)
+	if err := c.admit(key, c.has(key, nil)); err != nil {
+		return nil, err
+	}
 	var err error
 	if c.serializeFunc != nil {
-		value, err = c.serializeFunc(key, value)
+		value, err = c.serialize(key, value)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if c.maxCost > 0 {
+		c.fitCost(key, value, func() { c.evict(1) })
+	}
+
+	c.decay()
 
 	// Check for existing item
 	item, ok := c.items[key]
 	if ok {
+		c.notifyReplaced(key, item.value, value)
 		item.value = value
 	} else {
 		// Verify size not exceeded
-		if len(c.items) >= c.size {
-			c.evict(1)
+		if c.full(len(c.items)) {
+			c.evict(c.evictionBatch())
 		}
 		item = &lfuItem{
 			clock:       c.clock,
 			key:         key,
 			value:       value,
 			freqElement: nil,
+			accessInfo:  newAccessInfo(c.clock.Now()),
 		}
 		el := c.freqList.Front()
 		fe := el.Value.(*freqEntry)
@@ -97,16 +216,18 @@ func (c *LFUCache) set(key, value interface{}) (interface{}, error) {
 
 		item.freqElement = el
 		c.items[key] = item
+		c.notifyAdded(key, value)
 	}
 
+	item.version = c.nextVersion()
+	c.recordWrite(key, &item.accessInfo)
 	if c.expiration != nil {
 		t := c.clock.Now().Add(*c.expiration)
 		item.expiration = &t
+		c.scheduleExpiration(key, t)
 	}
 
-	if c.addedFunc != nil {
-		c.addedFunc(key, value)
-	}
+	c.callAdded(key, value)
 
 	return item, nil
 }
@@ -133,6 +254,107 @@ func (c *LFUCache) GetIFPresent(key interface{}) (interface{}, error) {
 	return v, err
 }
 
+// GetWithExpiration gets a value from cache pool using key if it exists,
+// together with the time at which it expires.
+// The returned time is nil if the value never expires.
+// LoaderFunc is not invoked if the key does not exist.
+func (c *LFUCache) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, nil, err
+	}
+	var expiration *time.Time
+	if exp := c.items[key].expiration; exp != nil {
+		t := *exp
+		expiration = &t
+	}
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v, expiration, nil
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet.
+// It neither resurrects expired values nor updates eviction state or statistics.
+func (c *LFUCache) GetStale(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	item, ok := c.items[key]
+	if !ok {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	value := item.value
+	c.mu.RUnlock()
+
+	if c.deserializeFunc != nil {
+		v, err := c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+		return v, true
+	}
+	return value, true
+}
+
+// Info returns the metadata of the specified key without updating
+// any eviction algorithm statistics or positions.
+func (c *LFUCache) Info(key interface{}) (EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.has(key, nil) {
+		return EntryInfo{}, false
+	}
+	item := c.items[key]
+	return newEntryInfo(item.accessInfo, item.expiration, item.pinned, ""), true
+}
+
+// GetVersioned gets a value from cache pool using key if it exists, together with its version.
+// The version is 0 if the key does not exist. LoaderFunc is not invoked.
+func (c *LFUCache) GetVersioned(key interface{}) (interface{}, uint64) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, 0
+	}
+	version := c.items[key].version
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, 0
+		}
+	}
+	return v, version
+}
+
+// SetIfVersion sets a new key-value pair only if the current version of the key equals version.
+// A version of 0 means the key must not exist.
+func (c *LFUCache) SetIfVersion(key, value interface{}, version uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var current uint64
+	if c.has(key, nil) {
+		current = c.items[key].version
+	}
+	if current != version {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Peek returns the value for the specified key if it is present in the cache
 // without updating any eviction algorithm statistics or positions.
 // This is a pure read operation that does not affect cache state.
@@ -171,21 +393,47 @@ func (c *LFUCache) get(key interface{}, onLoad bool) (interface{}, error) {
 }
 
 func (c *LFUCache) getValue(key interface{}, onLoad bool) (interface{}, error) {
+	if v, ok := c.readUnlocked(key, onLoad, c.lookup); ok {
+		return v, nil
+	}
 	c.mu.Lock()
+	defer c.unlock()
+	return c.readLocked(key, onLoad, c.lookup, c.deadlineOf)
+}
+
+// getMulti returns the values of the specified keys that are present in the cache
+// and the keys that are not, acquiring the lock only once.
+func (c *LFUCache) getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{}) {
+	return c.lookupMulti(keys, c.lookup)
+}
+
+// lookup returns the value for the specified key and updates the eviction state.
+// The caller must hold the lock.
+func (c *LFUCache) lookup(key interface{}, onLoad bool) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	c.decay()
 	item, ok := c.items[key]
 	if ok {
 		if !item.IsExpired(nil) {
 			c.increment(item)
-			v := item.value
-			c.mu.Unlock()
 			if !onLoad {
 				c.stats.IncrHitCount()
+				item.recordAccess(c.clock.Now())
+				if c.sliding && item.expiration != nil {
+					t := c.clock.Now().Add(*c.expiration)
+					item.expiration = &t
+					c.scheduleExpiration(key, t)
+				}
+				if c.shouldRefresh(&item.accessInfo) {
+					c.refresh(key)
+				}
 			}
-			return v, nil
+			return item.value, nil
 		}
-		c.removeItem(item)
+		c.expireOnAccess(key, c.remove)
 	}
-	c.mu.Unlock()
 	if !onLoad {
 		c.stats.IncrMissCount()
 	}
@@ -193,6 +441,9 @@ func (c *LFUCache) getValue(key interface{}, onLoad bool) (interface{}, error) {
 }
 
 func (c *LFUCache) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
+	if v, ok := c.recallVictim(key, c); ok {
+		return v, nil
+	}
 	if c.loaderExpireFunc == nil {
 		return nil, ErrKeyNotFoundError
 	}
@@ -201,7 +452,7 @@ func (c *LFUCache) getWithLoader(key interface{}, isWait bool) (interface{}, err
 			return nil, e
 		}
 		c.mu.Lock()
-		defer c.mu.Unlock()
+		defer c.unlock()
 		item, err := c.set(key, v)
 		if err != nil {
 			return nil, err
@@ -209,11 +460,13 @@ func (c *LFUCache) getWithLoader(key interface{}, isWait bool) (interface{}, err
 		if expiration != nil {
 			t := c.clock.Now().Add(*expiration)
 			item.(*lfuItem).expiration = &t
+			c.scheduleExpiration(key, t)
 		}
 		return v, nil
 	}, isWait)
 	if err != nil {
-		return nil, err
+		// value is the stale value, if any.
+		return value, err
 	}
 	return value, nil
 }
@@ -251,25 +504,156 @@ func (c *LFUCache) increment(item *lfuItem) {
 	item.freqElement = nextFreqElement
 }
 
-// evict removes the least frequence item from the cache.
+// decay halves the frequency of every item once for each decay interval
+// that has elapsed since the last decay. The caller must hold the lock.
+func (c *LFUCache) decay() {
+	if c.decayInterval <= 0 {
+		return
+	}
+	elapsed := c.clock.Now().Sub(c.lastDecay)
+	if elapsed < c.decayInterval {
+		return
+	}
+	periods := elapsed / c.decayInterval
+	c.lastDecay = c.lastDecay.Add(periods * c.decayInterval)
+
+	// Halving keeps the list sorted, but adjacent entries may end up
+	// with the same frequency and have to be merged.
+	var prev *list.Element
+	for e := c.freqList.Front(); e != nil; {
+		next := e.Next()
+		entry := e.Value.(*freqEntry)
+		if periods >= 64 {
+			entry.freq = 0
+		} else {
+			entry.freq >>= uint(periods)
+		}
+		if prev != nil && prev.Value.(*freqEntry).freq == entry.freq {
+			target := prev.Value.(*freqEntry)
+			for item := range entry.items {
+				target.items[item] = struct{}{}
+				item.freqElement = prev
+			}
+			c.freqList.Remove(e)
+		} else {
+			prev = e
+		}
+		e = next
+	}
+}
+
+// evict removes the least frequence unpinned item from the cache.
 func (c *LFUCache) evict(count int) {
+	defer c.beginEviction()()
 	entry := c.freqList.Front()
-	for i := 0; i < count; {
-		if entry == nil {
-			return
-		} else {
-			for item := range entry.Value.(*freqEntry).items {
-				if i >= count {
-					return
-				}
-				c.removeItem(item)
-				i++
+	for i := 0; i < count && entry != nil; {
+		next := entry.Next()
+		for item := range entry.Value.(*freqEntry).items {
+			if i >= count {
+				return
+			}
+			if item.pinned {
+				continue
 			}
-			entry = entry.Next()
+			c.removeItem(item)
+			i++
 		}
+		entry = next
 	}
 }
 
+// compute atomically replaces the value for the specified key with the result of fn.
+// fn receives the current value and whether the key is present in the cache.
+func (c *LFUCache) compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var (
+		old interface{}
+		err error
+	)
+	found := c.has(key, nil)
+	if found {
+		old = c.items[key].value
+		if c.deserializeFunc != nil {
+			old, err = c.deserializeFunc(key, old)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, err := fn(old, found)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.set(key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Touch resets the expiration of the provided key to the default expiration
+// without updating any eviction algorithm statistics or positions.
+// If the cache has no default expiration, the key will never expire.
+func (c *LFUCache) Touch(key interface{}) bool {
+	return c.setExpiration(key, c.expiration)
+}
+
+// TouchWithExpire resets the expiration of the provided key to the given duration
+// without updating any eviction algorithm statistics or positions.
+func (c *LFUCache) TouchWithExpire(key interface{}, expiration time.Duration) bool {
+	return c.setExpiration(key, &expiration)
+}
+
+// SetExpiration changes the expiration of the provided key in place
+// without updating any eviction algorithm statistics or positions.
+// A non-positive duration removes the expiration so that the key never expires.
+func (c *LFUCache) SetExpiration(key interface{}, expiration time.Duration) bool {
+	if expiration <= 0 {
+		return c.setExpiration(key, nil)
+	}
+	return c.setExpiration(key, &expiration)
+}
+
+func (c *LFUCache) setExpiration(key interface{}, expiration *time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	item := c.items[key]
+	if expiration == nil {
+		item.expiration = nil
+	} else {
+		t := c.clock.Now().Add(*expiration)
+		item.expiration = &t
+		c.scheduleExpiration(key, t)
+	}
+	return true
+}
+
+// Pin prevents the provided key from being evicted.
+// A pinned key is still removed by Remove and on expiration.
+func (c *LFUCache) Pin(key interface{}) bool {
+	return c.setPinned(key, true)
+}
+
+// Unpin makes the provided key eligible for eviction again.
+func (c *LFUCache) Unpin(key interface{}) bool {
+	return c.setPinned(key, false)
+}
+
+func (c *LFUCache) setPinned(key interface{}, pinned bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	c.items[key].pinned = pinned
+	return true
+}
+
 // Has checks if key exists in cache
 func (c *LFUCache) Has(key interface{}) bool {
 	c.mu.RLock()
@@ -286,10 +670,59 @@ func (c *LFUCache) has(key interface{}, now *time.Time) bool {
 	return !item.IsExpired(now)
 }
 
+// storedKey returns the key of the entry of key, which the cache owns, without retaining key.
+func (c *LFUCache) storedKey(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if item, ok := c.items[key]; ok {
+		return item.key, true
+	}
+	return nil, false
+}
+
+// deadlineOf returns the time at which key expires if it is present in the cache and expires.
+func (c *LFUCache) deadlineOf(key interface{}) (time.Time, bool) {
+	item, ok := c.items[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return item.deadline(item.expiration)
+}
+
+// expirationOf returns the time at which key expires, or nil if it does not
+// expire or is not present. The caller must hold the lock.
+func (c *LFUCache) expirationOf(key interface{}) *time.Time {
+	if item, ok := c.items[key]; ok {
+		return item.expiration
+	}
+	return nil
+}
+
+// GetAndRemove removes the provided key from the cache and returns its value.
+// Returns false if the key is not present in the cache.
+func (c *LFUCache) GetAndRemove(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if !c.has(key, nil) {
+		return nil, false
+	}
+	value := c.items[key].value
+	if c.deserializeFunc != nil {
+		var err error
+		value, err = c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+	}
+	c.remove(key)
+	return value, true
+}
+
 // Remove removes the provided key from the cache.
 func (c *LFUCache) Remove(key interface{}) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	return c.remove(key)
 }
@@ -310,9 +743,7 @@ func (c *LFUCache) removeItem(item *lfuItem) {
 	if isRemovableFreqEntry(entry) {
 		c.freqList.Remove(item.freqElement)
 	}
-	if c.evictedFunc != nil {
-		c.evictedFunc(item.key, item.value)
-	}
+	c.notifyEvicted(item.key, item.value)
 }
 
 func (c *LFUCache) keys() []interface{} {
@@ -327,6 +758,112 @@ func (c *LFUCache) keys() []interface{} {
 	return keys
 }
 
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+func (c *LFUCache) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.deleteExpired(c.deadlineOf, c.remove)
+}
+
+// sample returns up to n unexpired entries, chosen uniformly at random, with their
+// values deserialized.
+func (c *LFUCache) sample(n int) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := reservoir[interface{}, interface{}]{n: n}
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		r.offer(key, item.value)
+	}
+	return c.sampled(&r)
+}
+
+// entries returns a point-in-time copy of all unexpired entries.
+func (c *LFUCache) entries() []cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]cacheEntry, 0, len(c.items))
+	now := c.clock.Now()
+	for _, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		entries = append(entries, newCacheEntry(item.key, item.value, item.expiration))
+	}
+	return entries
+}
+
+// restore inserts entries, as returned by entries, with their expiration times.
+func (c *LFUCache) restore(entries []cacheEntry) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.beginRestore()()
+	for _, e := range entries {
+		item, err := c.set(e.key, e.value)
+		if err != nil {
+			continue
+		}
+		if e.expiration != nil {
+			item.(*lfuItem).expiration = e.expiration
+			c.scheduleExpiration(e.key, *e.expiration)
+		}
+	}
+}
+
+// shrink evicts up to n entries and returns the number of evicted entries.
+func (c *LFUCache) shrink(n int) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := c.entryCount
+	c.evict(n)
+	return int(count - c.entryCount)
+}
+
+// walk calls fn for each entry, with its value deserialized, while holding the read
+// lock and skips expired entries if checkExpired is true. It stops and returns false
+// as soon as fn returns false.
+func (c *LFUCache) walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool {
+	fn = c.deserializing(fn, true)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if checkExpired && item.IsExpired(&now) {
+			continue
+		}
+		if !fn(key, item.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeMulti removes the specified keys, acquiring the lock only once.
+func (c *LFUCache) removeMulti(keys []interface{}) int {
+	return c.removeKeys(keys, c.remove)
+}
+
+// removeIf removes all entries that satisfy fn, which is called with the deserialized
+// values, and returns the number of removed entries.
+func (c *LFUCache) removeIf(fn func(interface{}, interface{}) bool) int {
+	fn = c.deserializing(fn, false)
+	c.mu.Lock()
+	defer c.unlock()
+	var keys []interface{}
+	for key, item := range c.items {
+		if fn(key, item.value) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.remove(key)
+	}
+	return len(keys)
+}
+
 // GetALL returns all key-value pairs in the cache.
 func (c *LFUCache) GetALL(checkExpired bool) map[interface{}]interface{} {
 	c.mu.RLock()
@@ -362,40 +899,70 @@ func (c *LFUCache) Len(checkExpired bool) int {
 	if !checkExpired {
 		return len(c.items)
 	}
-	var length int
-	now := time.Now()
-	for k := range c.items {
-		if c.has(k, &now) {
-			length++
-		}
-	}
-	return length
+	return len(c.items) - c.countExpired(c.deadlineOf)
 }
 
 // Completely clear the cache
 func (c *LFUCache) Purge() {
+	c.purge(c.purgeVisitorFunc)
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live to w.
+func (c *LFUCache) SaveTo(w io.Writer) error {
+	return c.saveTo(w, c.entries())
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache.
+func (c *LFUCache) LoadFrom(r io.Reader) error {
+	entries, err := c.loadFrom(r)
+	if err != nil {
+		return err
+	}
+	c.restore(entries)
+	return nil
+}
+
+// purge clears the cache and calls visit, if not nil, for each entry.
+func (c *LFUCache) purge(visit PurgeVisitorFunc) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if c.purgeVisitorFunc != nil {
+	if visit != nil {
 		for key, item := range c.items {
-			c.purgeVisitorFunc(key, item.value)
+			visit(key, item.value)
 		}
 	}
 
+	c.resetExpirations()
+	c.resetSize()
 	c.init()
 }
 
+// DebugState returns the number of entries of the cache and how often they have been accessed.
+func (c *LFUCache) DebugState() DebugState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	state := &LFUState{Frequencies: make(map[uint]int)}
+	for e := c.freqList.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*freqEntry)
+		if len(entry.items) > 0 {
+			state.Frequencies[entry.freq] = len(entry.items)
+		}
+	}
+	return DebugState{Policy: TYPE_LFU, Entries: len(c.items), LFU: state}
+}
+
 // IsExpired returns boolean value whether this item is expired or not.
 func (it *lfuItem) IsExpired(now *time.Time) bool {
-	if it.expiration == nil {
+	deadline, ok := it.deadline(it.expiration)
+	if !ok {
 		return false
 	}
 	if now == nil {
 		t := it.clock.Now()
 		now = &t
 	}
-	return it.expiration.Before(*now)
+	return deadline.Before(*now)
 }
 
 func isRemovableFreqEntry(entry *freqEntry) bool {
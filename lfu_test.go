@@ -194,3 +194,82 @@ func TestLFUFreqListLength(t *testing.T) {
 		}
 	}
 }
+
+func TestLFUDecay(t *testing.T) {
+	fc := NewFakeClock()
+	gc := New(2).LFU().LFUDecay(time.Minute).Clock(fc).Build()
+
+	// "old" becomes hot, then popularity shifts to "new".
+	gc.Set("old", 1)
+	for i := 0; i < 8; i++ {
+		gc.Get("old")
+	}
+	fc.Advance(3 * time.Minute)
+	gc.Set("new", 2)
+	for i := 0; i < 2; i++ {
+		gc.Get("new")
+	}
+
+	// After three halvings "old" has a count of 1 and is evicted first.
+	gc.Set("next", 3)
+	if _, err := gc.Get("old"); err != ErrKeyNotFoundError {
+		t.Error("decayed entry should be evicted")
+	}
+	if _, err := gc.Get("new"); err != nil {
+		t.Errorf("recently popular entry should be kept: %v", err)
+	}
+
+	var prev uint
+	for e := gc.(*LFUCache).freqList.Front(); e != nil; e = e.Next() {
+		freq := e.Value.(*freqEntry).freq
+		if e != gc.(*LFUCache).freqList.Front() && freq <= prev {
+			t.Fatalf("frequency list is not strictly increasing: %v after %v", freq, prev)
+		}
+		prev = freq
+	}
+}
+
+func TestLFUDecayMergesEntries(t *testing.T) {
+	fc := NewFakeClock()
+	gc := New(5).LFU().LFUDecay(time.Minute).Clock(fc).Build()
+	for i := 0; i < 4; i++ {
+		gc.Set(i, i)
+		for j := 0; j < i; j++ {
+			gc.Get(i)
+		}
+	}
+	// Frequencies 0, 1, 2, 3 become 0, 0, 1, 1.
+	fc.Advance(time.Minute)
+	gc.Set(4, 4)
+	if l := gc.(*LFUCache).freqList.Len(); l != 2 {
+		t.Fatalf("%v != 2", l)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := gc.Get(i); err != nil {
+			t.Errorf("key %v should be cached: %v", i, err)
+		}
+	}
+}
+
+func TestLFUDebugState(t *testing.T) {
+	gc := New(5).LFU().Build()
+	for i := 0; i < 4; i++ {
+		gc.Set(i, i)
+	}
+	gc.Get(2)
+	gc.Get(3)
+	gc.Get(3)
+	s := gc.DebugState()
+	if s.Policy != TYPE_LFU || s.Entries != 4 || s.LFU == nil {
+		t.Fatalf("unexpected state: %+v", s)
+	}
+	want := map[uint]int{0: 2, 1: 1, 2: 1}
+	if len(s.LFU.Frequencies) != len(want) {
+		t.Fatalf("%v != %v", s.LFU.Frequencies, want)
+	}
+	for freq, n := range want {
+		if s.LFU.Frequencies[freq] != n {
+			t.Errorf("%v != %v", s.LFU.Frequencies, want)
+		}
+	}
+}
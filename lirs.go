@@ -1,42 +1,158 @@
 package xcache
 
 import (
-	"container/list"
+	"io"
 	"time"
 )
 
 // LIRS implements Low Inter-reference Recency Set cache replacement algorithm
 type LIRSCache struct {
 	baseCache
-	stackS      *list.List                // LIRS stack for managing access history
-	queueQ      *list.List                // Queue for resident HIR blocks
+	stackS      lirsList                  // LIRS stack for managing access history
+	queueQ      lirsList                  // Queue for resident HIR blocks
 	items       map[interface{}]*lirsItem // Map of all cached items
 	lirCount    int                       // Current count of LIR blocks
 	maxLirCount int                       // Maximum allowed LIR blocks (typically 99% of cache size)
 	maxHirCount int                       // Maximum allowed HIR blocks (typically 1% of cache size)
 }
 
+// LIRSState describes the stack and queue of a LIRS cache.
+type LIRSState struct {
+	// Stack is the number of entries in the LIRS stack S, including non-resident ones.
+	Stack int
+	// Queue is the number of resident HIR entries in the queue Q.
+	Queue int
+	// LIR is the number of LIR entries.
+	LIR int
+	// MaxLIR is the maximum number of LIR entries.
+	MaxLIR int
+	// NonResident is the number of HIR entries whose values have been evicted
+	// but whose recency is still tracked.
+	NonResident int
+}
+
 // lirsItem represents a cache item in LIRS
 type lirsItem struct {
 	clock      Clock
 	key        interface{}
 	value      interface{}
 	expiration *time.Time
-	isLIR      bool          // true if Low Inter-reference Recency, false if High
-	isResident bool          // true if the block is in cache
-	stackElem  *list.Element // Element in stack S
-	queueElem  *list.Element // Element in queue Q (for HIR blocks only)
+	isLIR      bool     // true if Low Inter-reference Recency, false if High
+	isResident bool     // true if the block is in cache
+	stack      lirsLink // Links in stack S
+	queue      lirsLink // Links in queue Q (for HIR blocks only)
+	pinned     bool     // true if the block must not be evicted
+	version    uint64   // version assigned by the last write
+	accessInfo
+}
+
+// lirsLink holds the neighbours of an item in one of the LIRS lists.
+// Both are nil if the item is not in the list.
+type lirsLink struct {
+	prev, next *lirsItem
+}
+
+// lirsList is a doubly linked list whose links are embedded in the items, so
+// that an item can be in the stack and the queue without allocating elements.
+type lirsList struct {
+	root  lirsItem // sentinel: the front follows it, the back precedes it
+	n     int
+	queue bool // whether the list uses the queue links instead of the stack links
+}
+
+func (l *lirsList) Init(queue bool) {
+	l.queue = queue
+	l.link(&l.root).prev = &l.root
+	l.link(&l.root).next = &l.root
+	l.n = 0
+}
+
+func (l *lirsList) link(it *lirsItem) *lirsLink {
+	if l.queue {
+		return &it.queue
+	}
+	return &it.stack
+}
+
+func (l *lirsList) Len() int {
+	return l.n
+}
+
+// Contains reports whether it is in the list.
+func (l *lirsList) Contains(it *lirsItem) bool {
+	return l.link(it).next != nil
+}
+
+func (l *lirsList) Front() *lirsItem {
+	return l.Next(&l.root)
+}
+
+func (l *lirsList) Back() *lirsItem {
+	return l.Prev(&l.root)
+}
+
+// Next returns the item after it, or nil if it is the back.
+func (l *lirsList) Next(it *lirsItem) *lirsItem {
+	if next := l.link(it).next; next != &l.root {
+		return next
+	}
+	return nil
+}
+
+// Prev returns the item before it, or nil if it is the front.
+func (l *lirsList) Prev(it *lirsItem) *lirsItem {
+	if prev := l.link(it).prev; prev != &l.root {
+		return prev
+	}
+	return nil
+}
+
+func (l *lirsList) insertAfter(it, at *lirsItem) {
+	next := l.link(at).next
+	l.link(it).prev = at
+	l.link(it).next = next
+	l.link(next).prev = it
+	l.link(at).next = it
+	l.n++
+}
+
+func (l *lirsList) PushFront(it *lirsItem) {
+	l.insertAfter(it, &l.root)
+}
+
+func (l *lirsList) PushBack(it *lirsItem) {
+	l.insertAfter(it, l.link(&l.root).prev)
+}
+
+func (l *lirsList) Remove(it *lirsItem) {
+	link := l.link(it)
+	l.link(link.prev).next = link.next
+	l.link(link.next).prev = link.prev
+	link.prev = nil
+	link.next = nil
+	l.n--
+}
+
+func (l *lirsList) MoveToFront(it *lirsItem) {
+	l.Remove(it)
+	l.PushFront(it)
+}
+
+func (l *lirsList) MoveToBack(it *lirsItem) {
+	l.Remove(it)
+	l.PushBack(it)
 }
 
 // newLIRSCache creates a new LIRS cache
 func newLIRSCache(cb *CacheBuilder) *LIRSCache {
 	c := &LIRSCache{}
 	buildCache(&c.baseCache, cb)
+	c.eventExpiration = c.expirationOf
 
 	// Initialize data structures
-	c.stackS = list.New()
-	c.queueQ = list.New()
-	c.items = make(map[interface{}]*lirsItem)
+	c.stackS.Init(false)
+	c.queueQ.Init(true)
+	c.items = make(map[interface{}]*lirsItem, c.size)
 
 	// Set LIR and HIR block limits (99% LIR, 1% HIR)
 	c.maxLirCount = int(float64(c.size) * 0.99)
@@ -50,25 +166,36 @@ func newLIRSCache(cb *CacheBuilder) *LIRSCache {
 
 	c.lirCount = 0
 	c.loadGroup.cache = c
+	c.startJanitor(c.DeleteExpired)
+	c.startTrimmer(c.shrink)
 	return c
 }
 
+// segmentOf returns the block status of an item
+func segmentOf(item *lirsItem) string {
+	if item.isLIR {
+		return SegmentLIRSLIR
+	}
+	return SegmentLIRSHIR
+}
+
 // IsExpired checks if an item is expired
 func (it *lirsItem) IsExpired(now *time.Time) bool {
-	if it.expiration == nil {
+	deadline, ok := it.deadline(it.expiration)
+	if !ok {
 		return false
 	}
 	if now == nil {
 		t := it.clock.Now()
 		now = &t
 	}
-	return it.expiration.Before(*now)
+	return deadline.Before(*now)
 }
 
 // Set a new key-value pair
 func (c *LIRSCache) Set(key, value interface{}) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 	_, err := c.set(key, value)
 	return err
 }
@@ -76,7 +203,7 @@ func (c *LIRSCache) Set(key, value interface{}) error {
 // SetWithExpire sets a key-value pair with expiration
 func (c *LIRSCache) SetWithExpire(key, value interface{}, expiration time.Duration) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 	item, err := c.set(key, value)
 	if err != nil {
 		return err
@@ -84,31 +211,125 @@ func (c *LIRSCache) SetWithExpire(key, value interface{}, expiration time.Durati
 
 	t := c.clock.Now().Add(expiration)
 	item.(*lirsItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return nil
+}
+
+// SetWithExpireAndIdle sets a new key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (c *LIRSCache) SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	item, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	it := item.(*lirsItem)
+	if expiration > 0 {
+		t := c.clock.Now().Add(expiration)
+		it.expiration = &t
+		c.scheduleExpiration(key, t)
+	} else {
+		it.expiration = nil
+	}
+	c.setMaxIdle(key, &it.accessInfo, maxIdle)
+	return nil
+}
+
+// SetIfAbsent sets a new key-value pair only if the key is not present in the cache.
+func (c *LIRSCache) SetIfAbsent(key, value interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfAbsentWithExpire sets a new key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (c *LIRSCache) SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	item, err := c.set(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	item.(*lirsItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return true, nil
+}
+
+// setMulti sets the specified key-value pairs, acquiring the lock only once.
+// If expiration is not nil, it is applied to every pair.
+func (c *LIRSCache) setMulti(items map[interface{}]interface{}, expiration *time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, value := range items {
+		item, err := c.set(key, value)
+		if err == ErrNotAdmitted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			item.(*lirsItem).expiration = &t
+			c.scheduleExpiration(key, t)
+		}
+	}
 	return nil
 }
 
 // set internal method for setting values
 func (c *LIRSCache) set(key, value interface{}) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	c.removeStale(key, c.deadlineOf, c.remove)
+	if err := c.admit(key, c.has(key, nil)); err != nil {
+		return nil, err
+	}
 	var err error
 	if c.serializeFunc != nil {
-		value, err = c.serializeFunc(key, value)
+		value, err = c.serialize(key, value)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if c.maxCost > 0 {
+		c.fitCost(key, value, c.evictLeastRecentItem)
+	}
 
 	// Check if item already exists
 	if item, exists := c.items[key]; exists {
 		// Update existing item
+		if item.isResident {
+			c.notifyReplaced(key, item.value, value)
+		} else {
+			c.notifyAdded(key, value)
+		}
 		item.value = value
+		item.version = c.nextVersion()
+		c.recordWrite(key, &item.accessInfo)
 		if c.expiration != nil {
 			t := c.clock.Now().Add(*c.expiration)
 			item.expiration = &t
+			c.scheduleExpiration(key, t)
 		}
 		c.accessItem(item)
-		if c.addedFunc != nil {
-			c.addedFunc(key, value)
-		}
+		c.callAdded(key, value)
 		return item, nil
 	}
 
@@ -125,11 +346,15 @@ func (c *LIRSCache) set(key, value interface{}) (interface{}, error) {
 		key:        key,
 		value:      value,
 		isResident: true,
+		version:    c.nextVersion(),
+		accessInfo: newAccessInfo(c.clock.Now()),
 	}
+	c.recordWrite(key, &item.accessInfo)
 
 	if c.expiration != nil {
 		t := c.clock.Now().Add(*c.expiration)
 		item.expiration = &t
+		c.scheduleExpiration(key, t)
 	}
 
 	// Determine if this should be LIR or HIR
@@ -143,15 +368,14 @@ func (c *LIRSCache) set(key, value interface{}) (interface{}, error) {
 	}
 
 	c.items[key] = item
+	c.notifyAdded(key, value)
 	c.insertIntoStack(item)
 
 	if !item.isLIR {
 		c.insertIntoQueue(item)
 	}
 
-	if c.addedFunc != nil {
-		c.addedFunc(key, value)
-	}
+	c.callAdded(key, value)
 
 	return item, nil
 }
@@ -167,7 +391,7 @@ func (c *LIRSCache) accessItem(item *lirsItem) {
 	} else {
 		// HIR block access
 		if item.isResident {
-			if item.stackElem != nil {
+			if c.stackS.Contains(item) {
 				// HIR block in stack - convert to LIR
 				c.convertToLIR(item)
 			} else {
@@ -176,7 +400,7 @@ func (c *LIRSCache) accessItem(item *lirsItem) {
 			}
 		} else {
 			// Non-resident HIR block - this is critical for cache size control
-			if item.stackElem != nil {
+			if c.stackS.Contains(item) {
 				// In stack - convert to LIR
 				// But first ensure we have space
 				residentCount := c.getResidentCount()
@@ -218,9 +442,8 @@ func (c *LIRSCache) convertToLIR(item *lirsItem) {
 	c.lirCount++
 
 	// Remove from queue
-	if item.queueElem != nil {
-		c.queueQ.Remove(item.queueElem)
-		item.queueElem = nil
+	if c.queueQ.Contains(item) {
+		c.queueQ.Remove(item)
 	}
 
 	// Move to top of stack
@@ -241,8 +464,7 @@ func (c *LIRSCache) convertToHIR(item *lirsItem) {
 
 	// Remove from stack if it's at bottom
 	if c.isStackBottom(item) {
-		c.stackS.Remove(item.stackElem)
-		item.stackElem = nil
+		c.stackS.Remove(item)
 	}
 
 	// Add to queue if resident
@@ -253,16 +475,16 @@ func (c *LIRSCache) convertToHIR(item *lirsItem) {
 
 // insertIntoStack inserts item at top of stack
 func (c *LIRSCache) insertIntoStack(item *lirsItem) {
-	if item.stackElem != nil {
-		c.stackS.Remove(item.stackElem)
+	if c.stackS.Contains(item) {
+		c.stackS.Remove(item)
 	}
-	item.stackElem = c.stackS.PushFront(item)
+	c.stackS.PushFront(item)
 }
 
 // moveToStackTop moves item to top of stack
 func (c *LIRSCache) moveToStackTop(item *lirsItem) {
-	if item.stackElem != nil {
-		c.stackS.MoveToFront(item.stackElem)
+	if c.stackS.Contains(item) {
+		c.stackS.MoveToFront(item)
 	} else {
 		c.insertIntoStack(item)
 	}
@@ -270,70 +492,66 @@ func (c *LIRSCache) moveToStackTop(item *lirsItem) {
 
 // insertIntoQueue inserts item at end of queue
 func (c *LIRSCache) insertIntoQueue(item *lirsItem) {
-	if item.queueElem != nil {
-		c.queueQ.Remove(item.queueElem)
+	if c.queueQ.Contains(item) {
+		c.queueQ.Remove(item)
 	}
-	item.queueElem = c.queueQ.PushBack(item)
+	c.queueQ.PushBack(item)
 }
 
 // moveToQueueEnd moves item to end of queue
 func (c *LIRSCache) moveToQueueEnd(item *lirsItem) {
-	if item.queueElem != nil {
-		c.queueQ.MoveToBack(item.queueElem)
+	if c.queueQ.Contains(item) {
+		c.queueQ.MoveToBack(item)
 	} else {
 		c.insertIntoQueue(item)
 	}
 }
 
-// evictFromQ evicts the HIR block at front of queue
-func (c *LIRSCache) evictFromQ() {
-	if c.queueQ.Len() == 0 {
-		return
+// evictFromQ evicts the unpinned HIR block closest to the front of queue.
+// Returns false if there is no such block.
+func (c *LIRSCache) evictFromQ() bool {
+	defer c.beginEviction()()
+	item := c.queueQ.Front()
+	for item != nil && item.pinned {
+		item = c.queueQ.Next(item)
+	}
+	if item == nil {
+		return false
 	}
-
-	front := c.queueQ.Front()
-	item := front.Value.(*lirsItem)
 
 	// Remove from queue
-	c.queueQ.Remove(front)
-	item.queueElem = nil
+	c.queueQ.Remove(item)
 	item.isResident = false
 
 	// Call evicted function if set
-	if c.evictedFunc != nil {
-		c.evictedFunc(item.key, item.value)
-	}
+	c.notifyEvicted(item.key, item.value)
+	return true
 }
 
 // getStackBottom returns the bottom item of stack
 func (c *LIRSCache) getStackBottom() *lirsItem {
-	if c.stackS.Len() == 0 {
-		return nil
-	}
-	return c.stackS.Back().Value.(*lirsItem)
+	return c.stackS.Back()
 }
 
 // isStackBottom checks if item is at bottom of stack
 func (c *LIRSCache) isStackBottom(item *lirsItem) bool {
-	if c.stackS.Len() == 0 || item.stackElem == nil {
+	if !c.stackS.Contains(item) {
 		return false
 	}
-	return c.stackS.Back() == item.stackElem
+	return c.stackS.Back() == item
 }
 
 // pruneStack removes HIR blocks from bottom of stack
 func (c *LIRSCache) pruneStack() {
 	for c.stackS.Len() > 0 {
-		bottom := c.stackS.Back()
-		item := bottom.Value.(*lirsItem)
+		item := c.stackS.Back()
 
 		if item.isLIR {
 			break // Stop when we reach an LIR block
 		}
 
 		// Remove HIR block from stack
-		c.stackS.Remove(bottom)
-		item.stackElem = nil
+		c.stackS.Remove(item)
 	}
 }
 
@@ -355,6 +573,107 @@ func (c *LIRSCache) GetIFPresent(key interface{}) (interface{}, error) {
 	return v, err
 }
 
+// GetWithExpiration gets a value from cache pool using key if it exists,
+// together with the time at which it expires.
+// The returned time is nil if the value never expires.
+// LoaderFunc is not invoked if the key does not exist.
+func (c *LIRSCache) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, nil, err
+	}
+	var expiration *time.Time
+	if exp := c.items[key].expiration; exp != nil {
+		t := *exp
+		expiration = &t
+	}
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v, expiration, nil
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet.
+// It neither resurrects expired values nor updates eviction state or statistics.
+func (c *LIRSCache) GetStale(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	item, ok := c.items[key]
+	if !ok || !item.isResident {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	value := item.value
+	c.mu.RUnlock()
+
+	if c.deserializeFunc != nil {
+		v, err := c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+		return v, true
+	}
+	return value, true
+}
+
+// Info returns the metadata of the specified key without updating
+// any eviction algorithm statistics or positions.
+func (c *LIRSCache) Info(key interface{}) (EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.has(key, nil) {
+		return EntryInfo{}, false
+	}
+	item := c.items[key]
+	return newEntryInfo(item.accessInfo, item.expiration, item.pinned, segmentOf(item)), true
+}
+
+// GetVersioned gets a value from cache pool using key if it exists, together with its version.
+// The version is 0 if the key does not exist. LoaderFunc is not invoked.
+func (c *LIRSCache) GetVersioned(key interface{}) (interface{}, uint64) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, 0
+	}
+	version := c.items[key].version
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, 0
+		}
+	}
+	return v, version
+}
+
+// SetIfVersion sets a new key-value pair only if the current version of the key equals version.
+// A version of 0 means the key must not exist.
+func (c *LIRSCache) SetIfVersion(key, value interface{}, version uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var current uint64
+	if c.has(key, nil) {
+		current = c.items[key].version
+	}
+	if current != version {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Peek returns the value for the specified key if it is present in the cache
 // without updating any eviction algorithm statistics or positions.
 // This is a pure read operation that does not affect cache state.
@@ -394,9 +713,26 @@ func (c *LIRSCache) get(key interface{}, onLoad bool) (interface{}, error) {
 
 // getValue internal method
 func (c *LIRSCache) getValue(key interface{}, onLoad bool) (interface{}, error) {
+	if v, ok := c.readUnlocked(key, onLoad, c.lookup); ok {
+		return v, nil
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+	return c.readLocked(key, onLoad, c.lookup, c.deadlineOf)
+}
 
+// getMulti returns the values of the specified keys that are present in the cache
+// and the keys that are not, acquiring the lock only once.
+func (c *LIRSCache) getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{}) {
+	return c.lookupMulti(keys, c.lookup)
+}
+
+// lookup returns the value for the specified key and updates the eviction state.
+// The caller must hold the lock.
+func (c *LIRSCache) lookup(key interface{}, onLoad bool) (interface{}, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
 	item, exists := c.items[key]
 	if !exists {
 		if !onLoad {
@@ -409,13 +745,22 @@ func (c *LIRSCache) getValue(key interface{}, onLoad bool) (interface{}, error)
 		c.accessItem(item)
 		if !onLoad {
 			c.stats.IncrHitCount()
+			item.recordAccess(c.clock.Now())
+			if c.sliding && item.expiration != nil {
+				t := c.clock.Now().Add(*c.expiration)
+				item.expiration = &t
+				c.scheduleExpiration(key, t)
+			}
+			if c.shouldRefresh(&item.accessInfo) {
+				c.refresh(key)
+			}
 		}
 		return item.value, nil
 	}
 
 	// Item expired or not resident
 	if item.IsExpired(nil) {
-		c.removeItem(item)
+		c.expireOnAccess(key, c.remove)
 	}
 
 	if !onLoad {
@@ -426,6 +771,9 @@ func (c *LIRSCache) getValue(key interface{}, onLoad bool) (interface{}, error)
 
 // getWithLoader loads value using loader function
 func (c *LIRSCache) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
+	if v, ok := c.recallVictim(key, c); ok {
+		return v, nil
+	}
 	if c.loaderExpireFunc == nil {
 		return nil, ErrKeyNotFoundError
 	}
@@ -435,7 +783,7 @@ func (c *LIRSCache) getWithLoader(key interface{}, isWait bool) (interface{}, er
 			return nil, e
 		}
 		c.mu.Lock()
-		defer c.mu.Unlock()
+		defer c.unlock()
 		item, err := c.set(key, v)
 		if err != nil {
 			return nil, err
@@ -443,12 +791,14 @@ func (c *LIRSCache) getWithLoader(key interface{}, isWait bool) (interface{}, er
 		if expiration != nil {
 			t := c.clock.Now().Add(*expiration)
 			item.(*lirsItem).expiration = &t
+			c.scheduleExpiration(key, t)
 		}
 		return v, nil
 	}, isWait)
 
 	if err != nil {
-		return nil, err
+		// value is the stale value, if any.
+		return value, err
 	}
 	return value, nil
 }
@@ -456,15 +806,13 @@ func (c *LIRSCache) getWithLoader(key interface{}, isWait bool) (interface{}, er
 // removeItem removes an item from cache
 func (c *LIRSCache) removeItem(item *lirsItem) {
 	// Remove from stack
-	if item.stackElem != nil {
-		c.stackS.Remove(item.stackElem)
-		item.stackElem = nil
+	if c.stackS.Contains(item) {
+		c.stackS.Remove(item)
 	}
 
 	// Remove from queue
-	if item.queueElem != nil {
-		c.queueQ.Remove(item.queueElem)
-		item.queueElem = nil
+	if c.queueQ.Contains(item) {
+		c.queueQ.Remove(item)
 	}
 
 	// Update LIR count
@@ -476,11 +824,103 @@ func (c *LIRSCache) removeItem(item *lirsItem) {
 	delete(c.items, item.key)
 
 	// Call evicted function
-	if c.evictedFunc != nil && item.isResident {
-		c.evictedFunc(item.key, item.value)
+	if item.isResident {
+		c.notifyEvicted(item.key, item.value)
 	}
 }
 
+// compute atomically replaces the value for the specified key with the result of fn.
+// fn receives the current value and whether the key is present in the cache.
+func (c *LIRSCache) compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var (
+		old interface{}
+		err error
+	)
+	found := c.has(key, nil)
+	if found {
+		old = c.items[key].value
+		if c.deserializeFunc != nil {
+			old, err = c.deserializeFunc(key, old)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, err := fn(old, found)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.set(key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Touch resets the expiration of the provided key to the default expiration
+// without updating any eviction algorithm statistics or positions.
+// If the cache has no default expiration, the key will never expire.
+func (c *LIRSCache) Touch(key interface{}) bool {
+	return c.setExpiration(key, c.expiration)
+}
+
+// TouchWithExpire resets the expiration of the provided key to the given duration
+// without updating any eviction algorithm statistics or positions.
+func (c *LIRSCache) TouchWithExpire(key interface{}, expiration time.Duration) bool {
+	return c.setExpiration(key, &expiration)
+}
+
+// SetExpiration changes the expiration of the provided key in place
+// without updating any eviction algorithm statistics or positions.
+// A non-positive duration removes the expiration so that the key never expires.
+func (c *LIRSCache) SetExpiration(key interface{}, expiration time.Duration) bool {
+	if expiration <= 0 {
+		return c.setExpiration(key, nil)
+	}
+	return c.setExpiration(key, &expiration)
+}
+
+func (c *LIRSCache) setExpiration(key interface{}, expiration *time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	item := c.items[key]
+	if expiration == nil {
+		item.expiration = nil
+	} else {
+		t := c.clock.Now().Add(*expiration)
+		item.expiration = &t
+		c.scheduleExpiration(key, t)
+	}
+	return true
+}
+
+// Pin prevents the provided key from being evicted.
+// A pinned key is still removed by Remove and on expiration.
+func (c *LIRSCache) Pin(key interface{}) bool {
+	return c.setPinned(key, true)
+}
+
+// Unpin makes the provided key eligible for eviction again.
+func (c *LIRSCache) Unpin(key interface{}) bool {
+	return c.setPinned(key, false)
+}
+
+func (c *LIRSCache) setPinned(key interface{}, pinned bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	c.items[key].pinned = pinned
+	return true
+}
+
 // Has checks if key exists
 func (c *LIRSCache) Has(key interface{}) bool {
 	c.mu.RLock()
@@ -498,11 +938,65 @@ func (c *LIRSCache) has(key interface{}, now *time.Time) bool {
 	return !item.IsExpired(now) && item.isResident
 }
 
+// storedKey returns the key of the entry of key, which the cache owns, without retaining key.
+func (c *LIRSCache) storedKey(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if item, ok := c.items[key]; ok {
+		return item.key, true
+	}
+	return nil, false
+}
+
+// deadlineOf returns the time at which key expires if it is present in the cache and expires.
+func (c *LIRSCache) deadlineOf(key interface{}) (time.Time, bool) {
+	item, ok := c.items[key]
+	if !ok || !item.isResident {
+		return time.Time{}, false
+	}
+	return item.deadline(item.expiration)
+}
+
+// expirationOf returns the time at which key expires, or nil if it does not
+// expire or is not present. The caller must hold the lock.
+func (c *LIRSCache) expirationOf(key interface{}) *time.Time {
+	if item, ok := c.items[key]; ok && item.isResident {
+		return item.expiration
+	}
+	return nil
+}
+
+// GetAndRemove removes the provided key from the cache and returns its value.
+// Returns false if the key is not present in the cache.
+func (c *LIRSCache) GetAndRemove(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if !c.has(key, nil) {
+		return nil, false
+	}
+	value := c.items[key].value
+	if c.deserializeFunc != nil {
+		var err error
+		value, err = c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+	}
+	c.removeItem(c.items[key])
+	return value, true
+}
+
 // Remove removes a key from cache
 func (c *LIRSCache) Remove(key interface{}) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+
+	return c.remove(key)
+}
 
+// remove internal method for removing a key
+func (c *LIRSCache) remove(key interface{}) bool {
 	item, exists := c.items[key]
 	if !exists {
 		return false
@@ -512,6 +1006,126 @@ func (c *LIRSCache) Remove(key interface{}) bool {
 	return true
 }
 
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+func (c *LIRSCache) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.deleteExpired(c.deadlineOf, c.remove)
+}
+
+// sample returns up to n unexpired entries, chosen uniformly at random, with their
+// values deserialized.
+func (c *LIRSCache) sample(n int) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := reservoir[interface{}, interface{}]{n: n}
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if !item.isResident {
+			continue
+		}
+		if item.IsExpired(&now) {
+			continue
+		}
+		r.offer(key, item.value)
+	}
+	return c.sampled(&r)
+}
+
+// entries returns a point-in-time copy of all unexpired entries.
+func (c *LIRSCache) entries() []cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]cacheEntry, 0, len(c.items))
+	now := c.clock.Now()
+	for _, item := range c.items {
+		if !item.isResident {
+			continue
+		}
+		if item.IsExpired(&now) {
+			continue
+		}
+		entries = append(entries, newCacheEntry(item.key, item.value, item.expiration))
+	}
+	return entries
+}
+
+// restore inserts entries, as returned by entries, with their expiration times.
+func (c *LIRSCache) restore(entries []cacheEntry) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.beginRestore()()
+	for _, e := range entries {
+		item, err := c.set(e.key, e.value)
+		if err != nil {
+			continue
+		}
+		if e.expiration != nil {
+			item.(*lirsItem).expiration = e.expiration
+			c.scheduleExpiration(e.key, *e.expiration)
+		}
+	}
+}
+
+// shrink evicts up to n entries and returns the number of evicted entries.
+func (c *LIRSCache) shrink(n int) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := c.entryCount
+	for i := 0; i < n; i++ {
+		c.evictLeastRecentItem()
+	}
+	return int(count - c.entryCount)
+}
+
+// walk calls fn for each entry, with its value deserialized, while holding the read
+// lock and skips expired entries if checkExpired is true. It stops and returns false
+// as soon as fn returns false.
+func (c *LIRSCache) walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool {
+	fn = c.deserializing(fn, true)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if !item.isResident {
+			continue
+		}
+		if checkExpired && item.IsExpired(&now) {
+			continue
+		}
+		if !fn(key, item.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeMulti removes the specified keys, acquiring the lock only once.
+func (c *LIRSCache) removeMulti(keys []interface{}) int {
+	return c.removeKeys(keys, c.remove)
+}
+
+// removeIf removes all entries that satisfy fn, which is called with the deserialized
+// values, and returns the number of removed entries.
+func (c *LIRSCache) removeIf(fn func(interface{}, interface{}) bool) int {
+	fn = c.deserializing(fn, false)
+	c.mu.Lock()
+	defer c.unlock()
+	var keys []interface{}
+	for key, item := range c.items {
+		if !item.isResident {
+			continue
+		}
+		if fn(key, item.value) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.removeItem(c.items[key])
+	}
+	return len(keys)
+}
+
 // GetALL returns all key-value pairs
 func (c *LIRSCache) GetALL(checkExpired bool) map[interface{}]interface{} {
 	c.mu.RLock()
@@ -551,45 +1165,78 @@ func (c *LIRSCache) Len(checkExpired bool) int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if !checkExpired {
-		count := 0
-		for _, item := range c.items {
-			if item.isResident {
-				count++
-			}
+	count := 0
+	for _, item := range c.items {
+		if item.isResident {
+			count++
 		}
-		return count
 	}
-
-	var length int
-	now := time.Now()
-	for k := range c.items {
-		if c.has(k, &now) {
-			length++
-		}
+	if checkExpired {
+		count -= c.countExpired(c.deadlineOf)
 	}
-
-	return length
+	return count
 }
 
 // Purge removes all items
 func (c *LIRSCache) Purge() {
+	c.purge(c.purgeVisitorFunc)
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live to w.
+func (c *LIRSCache) SaveTo(w io.Writer) error {
+	return c.saveTo(w, c.entries())
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache.
+func (c *LIRSCache) LoadFrom(r io.Reader) error {
+	entries, err := c.loadFrom(r)
+	if err != nil {
+		return err
+	}
+	c.restore(entries)
+	return nil
+}
+
+// purge clears the cache and calls visit, if not nil, for each entry.
+func (c *LIRSCache) purge(visit PurgeVisitorFunc) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if c.purgeVisitorFunc != nil {
+	if visit != nil {
 		for _, item := range c.items {
 			if item.isResident {
-				c.purgeVisitorFunc(item.key, item.value)
+				visit(item.key, item.value)
 			}
 		}
 	}
 
 	// Clear all data structures
-	c.stackS = list.New()
-	c.queueQ = list.New()
-	c.items = make(map[interface{}]*lirsItem)
+	c.stackS.Init(false)
+	c.queueQ.Init(true)
+	for k := range c.items {
+		delete(c.items, k)
+	}
 	c.lirCount = 0
+	c.resetExpirations()
+	c.resetSize()
+}
+
+// DebugState returns the sizes of the LIRS stack and queue and the number of LIR entries.
+func (c *LIRSCache) DebugState() DebugState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	state := &LIRSState{
+		Stack:  c.stackS.Len(),
+		Queue:  c.queueQ.Len(),
+		LIR:    c.lirCount,
+		MaxLIR: c.maxLirCount,
+	}
+	for _, item := range c.items {
+		if !item.isResident {
+			state.NonResident++
+		}
+	}
+	return DebugState{Policy: TYPE_LIRS, Entries: len(c.items) - state.NonResident, LIRS: state}
 }
 
 // getResidentCount returns the number of resident items
@@ -605,14 +1252,17 @@ func (c *LIRSCache) getResidentCount() int {
 
 // evictLeastRecentItem evicts the least recent item
 func (c *LIRSCache) evictLeastRecentItem() {
+	defer c.beginEviction()()
 	// First try to evict from HIR queue
-	if c.queueQ.Len() > 0 {
-		c.evictFromQ()
+	if c.evictFromQ() {
 		return
 	}
 
-	// If no HIR items, evict LIR item from bottom of stack
-	if bottom := c.getStackBottom(); bottom != nil && bottom.isLIR {
-		c.removeItem(bottom)
+	// If no HIR items, evict the unpinned LIR item closest to the bottom of stack
+	for item := c.stackS.Back(); item != nil; item = c.stackS.Prev(item) {
+		if item.isLIR && !item.pinned {
+			c.removeItem(item)
+			return
+		}
 	}
 }
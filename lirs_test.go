@@ -367,3 +367,23 @@ func BenchmarkLIRSMixed(b *testing.B) {
 		}
 	}
 }
+
+func TestLIRSDebugState(t *testing.T) {
+	gc := New(10).LIRS().Build()
+	for i := 0; i < 20; i++ {
+		gc.Set(i, i)
+	}
+	s := gc.DebugState()
+	if s.Policy != TYPE_LIRS || s.LIRS == nil {
+		t.Fatalf("unexpected state: %+v", s)
+	}
+	if s.Entries != gc.Len(false) {
+		t.Errorf("entries: %v != %v", s.Entries, gc.Len(false))
+	}
+	if s.LIRS.LIR > s.LIRS.MaxLIR || s.LIRS.LIR+s.LIRS.Queue != s.Entries {
+		t.Errorf("unexpected state: %+v", s.LIRS)
+	}
+	if s.LIRS.Stack < s.LIRS.LIR {
+		t.Errorf("stack should hold all LIR entries: %+v", s.LIRS)
+	}
+}
@@ -0,0 +1,79 @@
+package xcache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// loadBatcher collects the keys that are loaded within a window and loads
+// them together with a single call of a bulk loader.
+type loadBatcher struct {
+	window time.Duration
+	loader BulkLoaderFunc
+
+	mu      sync.Mutex
+	pending map[interface{}]*batchCall // keys of the current window
+}
+
+type batchCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newLoadBatcher(window time.Duration, loader BulkLoaderFunc) *loadBatcher {
+	return &loadBatcher{window: window, loader: loader}
+}
+
+// load adds key to the current window and waits until the window has been loaded.
+// Keys that the bulk loader does not return are reported with ErrKeyNotFoundError.
+func (b *loadBatcher) load(key interface{}) (interface{}, error) {
+	b.mu.Lock()
+	if b.pending == nil {
+		b.pending = make(map[interface{}]*batchCall)
+		time.AfterFunc(b.window, b.flush)
+	}
+	call, ok := b.pending[key]
+	if !ok {
+		call = &batchCall{done: make(chan struct{})}
+		b.pending[key] = call
+	}
+	b.mu.Unlock()
+
+	<-call.done
+	return call.value, call.err
+}
+
+// flush loads the keys of the current window and starts a new window.
+func (b *loadBatcher) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	keys := make([]interface{}, 0, len(batch))
+	for key := range batch {
+		keys = append(keys, key)
+	}
+	values, err := b.callLoader(keys)
+	for key, call := range batch {
+		if err != nil {
+			call.err = err
+		} else if v, ok := values[key]; ok {
+			call.value = v
+		} else {
+			call.err = ErrKeyNotFoundError
+		}
+		close(call.done)
+	}
+}
+
+func (b *loadBatcher) callLoader(keys []interface{}) (values map[interface{}]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			values, err = nil, fmt.Errorf("%w: %v", ErrLoaderPanic, r)
+		}
+	}()
+	return b.loader(keys)
+}
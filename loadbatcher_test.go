@@ -0,0 +1,77 @@
+package xcache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceLoads(t *testing.T) {
+	var calls int32
+	cc := New(100).
+		LRU().
+		CoalesceLoads(50*time.Millisecond, func(keys []interface{}) (map[interface{}]interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			values := make(map[interface{}]interface{}, len(keys))
+			for _, key := range keys {
+				if key.(int) >= 0 {
+					values[key] = key.(int) * 10
+				}
+			}
+			return values, nil
+		}).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := -1; i < 20; i++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			v, err := cc.Get(key)
+			if key < 0 {
+				if err != ErrKeyNotFoundError {
+					t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+				}
+				return
+			}
+			if err != nil || v != key*10 {
+				t.Errorf("%v, %v != %v", v, err, key*10)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("misses should be loaded together: %v", n)
+	}
+	if v, err := cc.Get(5); err != nil || v != 50 {
+		t.Errorf("%v, %v != 50", v, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+}
+
+func TestCoalesceLoadsError(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	cc := New(100).
+		LRU().
+		CoalesceLoads(time.Millisecond, func(keys []interface{}) (map[interface{}]interface{}, error) {
+			return nil, errUnavailable
+		}).
+		Build()
+	if _, err := cc.Get(1); err != errUnavailable {
+		t.Errorf("%v != %v", err, errUnavailable)
+	}
+
+	cc = New(100).
+		LRU().
+		CoalesceLoads(time.Millisecond, func(keys []interface{}) (map[interface{}]interface{}, error) {
+			panic("boom")
+		}).
+		Build()
+	if _, err := cc.Get(1); !errors.Is(err, ErrLoaderPanic) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
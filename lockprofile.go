@@ -0,0 +1,70 @@
+package xcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// profiledMutex is the lock of a cache. If stats is set by LockProfiling, it
+// counts how often the lock is acquired and measures how long the callers wait
+// for it when it is held by another goroutine. Otherwise it is a plain RWMutex.
+type profiledMutex struct {
+	sync.RWMutex
+	stats *stats
+}
+
+func (m *profiledMutex) Lock() {
+	if m.stats == nil {
+		m.RWMutex.Lock()
+		return
+	}
+	if m.RWMutex.TryLock() {
+		m.stats.addLockWait(0, false)
+		return
+	}
+	start := time.Now()
+	m.RWMutex.Lock()
+	m.stats.addLockWait(time.Since(start), true)
+}
+
+func (m *profiledMutex) RLock() {
+	if m.stats == nil {
+		m.RWMutex.RLock()
+		return
+	}
+	if m.RWMutex.TryRLock() {
+		m.stats.addLockWait(0, false)
+		return
+	}
+	start := time.Now()
+	m.RWMutex.RLock()
+	m.stats.addLockWait(time.Since(start), true)
+}
+
+// record an acquisition of the lock of the cache
+func (st *stats) addLockWait(d time.Duration, contended bool) {
+	st.lockCount.add(1)
+	if contended {
+		atomic.AddUint64(&st.lockContentionCount, 1)
+		atomic.AddInt64(&st.lockWaitTime, int64(d))
+	}
+}
+
+// LockCount returns the number of times the lock of the cache has been acquired,
+// if LockProfiling is enabled
+func (st *stats) LockCount() uint64 {
+	return st.lockCount.load()
+}
+
+// LockContentionCount returns the number of times the lock of the cache has been
+// held by another goroutine when it was acquired, if LockProfiling is enabled
+func (st *stats) LockContentionCount() uint64 {
+	return atomic.LoadUint64(&st.lockContentionCount)
+}
+
+// LockWaitTime returns the total time spent waiting for the lock of the cache,
+// if LockProfiling is enabled
+func (st *stats) LockWaitTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&st.lockWaitTime))
+}
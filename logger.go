@@ -0,0 +1,23 @@
+package xcache
+
+// Logger receives the internal diagnostics of a cache, such as recovered panics
+// of loaders and callbacks, which the cache otherwise handles silently.
+// The arguments after msg are alternating keys and values, as in log/slog.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+// logWarn logs a warning to logger, if any.
+func logWarn(logger Logger, msg string, args ...interface{}) {
+	if logger != nil {
+		logger.Warn(msg, args...)
+	}
+}
+
+// logDebug logs a debug message to logger, if any.
+func logDebug(logger Logger, msg string, args ...interface{}) {
+	if logger != nil {
+		logger.Debug(msg, args...)
+	}
+}
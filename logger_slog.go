@@ -0,0 +1,17 @@
+//go:build go1.21
+
+package xcache
+
+import (
+	"log/slog"
+)
+
+var _ Logger = (*slog.Logger)(nil)
+
+// SlogLogger returns a Logger that logs to l, or to the default slog logger if l is nil.
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
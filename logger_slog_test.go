@@ -0,0 +1,31 @@
+//go:build go1.21
+
+package xcache
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := SlogLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	cc := New(8).
+		LRU().
+		EvictedFunc(func(key, value interface{}) {
+			panic("boom")
+		}).
+		Logger(logger).
+		Build()
+	cc.Set("key", "value")
+	cc.Remove("key")
+	if out := buf.String(); !strings.Contains(out, `level=WARN msg="xcache: recovered callback panic" key=key panic=boom`) {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	if SlogLogger(nil) != slog.Default() {
+		t.Error("nil should log to the default logger")
+	}
+}
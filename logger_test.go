@@ -0,0 +1,128 @@
+package xcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLogger records the messages logged to it.
+type testLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) {
+	l.log("DEBUG", msg, args)
+}
+
+func (l *testLogger) Warn(msg string, args ...interface{}) {
+	l.log("WARN", msg, args)
+}
+
+func (l *testLogger) log(level, msg string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprint(level, " ", msg, " ", args))
+}
+
+func (l *testLogger) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, msg := range l.messages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoggerLoaderPanic(t *testing.T) {
+	logger := &testLogger{}
+	cc := New(8).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			panic("boom")
+		}).
+		Logger(logger).
+		Build()
+	if _, err := cc.Get("key"); !errors.Is(err, ErrLoaderPanic) {
+		t.Fatalf("%v should be %v", err, ErrLoaderPanic)
+	}
+	if !logger.contains("WARN xcache: recovered loader panic") || !logger.contains("boom") {
+		t.Errorf("loader panic should be logged: %v", logger.messages)
+	}
+}
+
+func TestLoggerCallbackPanic(t *testing.T) {
+	logger := &testLogger{}
+	cc := New(8).
+		LRU().
+		EvictedFunc(func(key, value interface{}) {
+			panic("boom")
+		}).
+		Logger(logger).
+		Build()
+	cc.Set("key", "value")
+	cc.Remove("key")
+	if !logger.contains("WARN xcache: recovered callback panic [key key panic boom]") {
+		t.Errorf("callback panic should be logged: %v", logger.messages)
+	}
+}
+
+func TestLoggerDroppedEvent(t *testing.T) {
+	logger := &testLogger{}
+	cc := New(8).LRU().EventBuffer(1).Logger(logger).Build()
+	cc.Set(1, 1)
+	if logger.contains("dropped event") {
+		t.Fatalf("no event should be dropped: %v", logger.messages)
+	}
+	cc.Set(2, 2)
+	if !logger.contains("WARN xcache: dropped event because the event buffer is full [type added key 2]") {
+		t.Errorf("dropped event should be logged: %v", logger.messages)
+	}
+}
+
+func TestLoggerJanitor(t *testing.T) {
+	logger := &testLogger{}
+	cc := New(8).
+		LRU().
+		ExpirationMode(ExpirationEager, 5*time.Millisecond).
+		Logger(logger).
+		Build()
+	defer cc.Close()
+	cc.SetWithExpire("key", "value", time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for !logger.contains("DEBUG xcache: janitor removed expired entries [count 1]") {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor activity should be logged: %v", logger.messages)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoggerSlowCallback(t *testing.T) {
+	logger := &testLogger{}
+	cc := New(8).
+		LRU().
+		AddedFunc(func(key, value interface{}) {
+			if key == "slow" {
+				time.Sleep(20 * time.Millisecond)
+			}
+		}).
+		SlowCallbackThreshold(10 * time.Millisecond).
+		Logger(logger).
+		Build()
+	cc.Set("fast", 1)
+	if logger.contains("slow callback") {
+		t.Fatalf("fast callback should not be logged: %v", logger.messages)
+	}
+	cc.Set("slow", 1)
+	if !logger.contains("WARN xcache: slow callback [callback added key slow duration") {
+		t.Errorf("slow callback should be logged: %v", logger.messages)
+	}
+}
@@ -1,67 +1,104 @@
 package xcache
 
 import (
-	"container/list"
+	"io"
+	"sync/atomic"
 	"time"
 )
 
+// promotionQueueSize is the number of hits an LRU cache with DeferredPromotion
+// queues before a reader has to take the write lock.
+const promotionQueueSize = 128
+
 // Discards the least recently used items first.
 type LRUCache struct {
 	baseCache
-	items     map[interface{}]*list.Element
-	evictList *list.List
+	items      map[interface{}]*lruItem
+	evictList  lruList
+	promotions *lruPromotions // hits served under the read lock, if DeferredPromotion is set
 }
 
 func newLRUCache(cb *CacheBuilder) *LRUCache {
 	c := &LRUCache{}
 	buildCache(&c.baseCache, cb)
+	c.eventExpiration = c.expirationOf
+	if cb.deferPromotion {
+		c.promotions = &lruPromotions{}
+	}
 
 	c.init()
 	c.loadGroup.cache = c
+	c.startJanitor(c.DeleteExpired)
+	c.startTrimmer(c.shrink)
+	c.watchMemory(c.shrink)
 	return c
 }
 
 func (c *LRUCache) init() {
-	c.evictList = list.New()
-	c.items = make(map[interface{}]*list.Element, c.size+1)
+	c.evictList.Init()
+	if c.items != nil {
+		for k := range c.items {
+			delete(c.items, k)
+		}
+	} else {
+		c.items = make(map[interface{}]*lruItem, c.size+1)
+	}
+	if c.promotions != nil {
+		c.promotions.reset()
+	}
 }
 
 func (c *LRUCache) set(key, value interface{}) (interface{}, error) {
+	c.applyPromotions()
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	c.removeStale(key, c.deadlineOf, c.remove)
+	if err := c.admit(key, c.has(key, nil)); err != nil {
+		return nil, err
+	}
 	var err error
 	if c.serializeFunc != nil {
-		value, err = c.serializeFunc(key, value)
+		value, err = c.serialize(key, value)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if c.maxCost > 0 {
+		c.fitCost(key, value, func() { c.evict(1) })
+	}
 
 	// Check for existing item
 	var item *lruItem
 	if it, ok := c.items[key]; ok {
 		c.evictList.MoveToFront(it)
-		item = it.Value.(*lruItem)
+		item = it
+		c.notifyReplaced(key, item.value, value)
 		item.value = value
 	} else {
 		// Verify size not exceeded
-		if c.evictList.Len() >= c.size {
-			c.evict(1)
+		if c.full(c.evictList.Len()) {
+			c.evict(c.evictionBatch())
 		}
 		item = &lruItem{
-			clock: c.clock,
-			key:   key,
-			value: value,
+			clock:      c.clock,
+			key:        key,
+			value:      value,
+			accessInfo: newAccessInfo(c.clock.Now()),
 		}
 		c.items[key] = c.evictList.PushFront(item)
+		c.notifyAdded(key, value)
 	}
 
+	item.version = c.nextVersion()
+	c.recordWrite(key, &item.accessInfo)
 	if c.expiration != nil {
 		t := c.clock.Now().Add(*c.expiration)
 		item.expiration = &t
+		c.scheduleExpiration(key, t)
 	}
 
-	if c.addedFunc != nil {
-		c.addedFunc(key, value)
-	}
+	c.callAdded(key, value)
 
 	return item, nil
 }
@@ -69,7 +106,7 @@ func (c *LRUCache) set(key, value interface{}) (interface{}, error) {
 // set a new key-value pair
 func (c *LRUCache) Set(key, value interface{}) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 	_, err := c.set(key, value)
 	return err
 }
@@ -77,7 +114,7 @@ func (c *LRUCache) Set(key, value interface{}) error {
 // Set a new key-value pair with an expiration time
 func (c *LRUCache) SetWithExpire(key, value interface{}, expiration time.Duration) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 	item, err := c.set(key, value)
 	if err != nil {
 		return err
@@ -85,6 +122,84 @@ func (c *LRUCache) SetWithExpire(key, value interface{}, expiration time.Duratio
 
 	t := c.clock.Now().Add(expiration)
 	item.(*lruItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return nil
+}
+
+// SetWithExpireAndIdle sets a new key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (c *LRUCache) SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	item, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	it := item.(*lruItem)
+	if expiration > 0 {
+		t := c.clock.Now().Add(expiration)
+		it.expiration = &t
+		c.scheduleExpiration(key, t)
+	} else {
+		it.expiration = nil
+	}
+	c.setMaxIdle(key, &it.accessInfo, maxIdle)
+	return nil
+}
+
+// SetIfAbsent sets a new key-value pair only if the key is not present in the cache.
+func (c *LRUCache) SetIfAbsent(key, value interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfAbsentWithExpire sets a new key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (c *LRUCache) SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(key, nil) {
+		return false, nil
+	}
+	item, err := c.set(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	t := c.clock.Now().Add(expiration)
+	item.(*lruItem).expiration = &t
+	c.scheduleExpiration(key, t)
+	return true, nil
+}
+
+// setMulti sets the specified key-value pairs, acquiring the lock only once.
+// If expiration is not nil, it is applied to every pair.
+func (c *LRUCache) setMulti(items map[interface{}]interface{}, expiration *time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, value := range items {
+		item, err := c.set(key, value)
+		if err == ErrNotAdmitted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if expiration != nil {
+			t := c.clock.Now().Add(*expiration)
+			item.(*lruItem).expiration = &t
+			c.scheduleExpiration(key, t)
+		}
+	}
 	return nil
 }
 
@@ -110,6 +225,107 @@ func (c *LRUCache) GetIFPresent(key interface{}) (interface{}, error) {
 	return v, err
 }
 
+// GetWithExpiration gets a value from cache pool using key if it exists,
+// together with the time at which it expires.
+// The returned time is nil if the value never expires.
+// LoaderFunc is not invoked if the key does not exist.
+func (c *LRUCache) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, nil, err
+	}
+	var expiration *time.Time
+	if exp := c.items[key].expiration; exp != nil {
+		t := *exp
+		expiration = &t
+	}
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v, expiration, nil
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet.
+// It neither resurrects expired values nor updates eviction state or statistics.
+func (c *LRUCache) GetStale(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	item, ok := c.items[key]
+	if !ok {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	value := item.value
+	c.mu.RUnlock()
+
+	if c.deserializeFunc != nil {
+		v, err := c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+		return v, true
+	}
+	return value, true
+}
+
+// Info returns the metadata of the specified key without updating
+// any eviction algorithm statistics or positions.
+func (c *LRUCache) Info(key interface{}) (EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.has(key, nil) {
+		return EntryInfo{}, false
+	}
+	item := c.items[key]
+	return newEntryInfo(item.accessInfo, item.expiration, item.pinned, ""), true
+}
+
+// GetVersioned gets a value from cache pool using key if it exists, together with its version.
+// The version is 0 if the key does not exist. LoaderFunc is not invoked.
+func (c *LRUCache) GetVersioned(key interface{}) (interface{}, uint64) {
+	c.mu.Lock()
+	v, err := c.lookup(key, false)
+	if err != nil {
+		c.unlock()
+		return nil, 0
+	}
+	version := c.items[key].version
+	c.unlock()
+
+	if c.deserializeFunc != nil {
+		v, err = c.deserializeFunc(key, v)
+		if err != nil {
+			return nil, 0
+		}
+	}
+	return v, version
+}
+
+// SetIfVersion sets a new key-value pair only if the current version of the key equals version.
+// A version of 0 means the key must not exist.
+func (c *LRUCache) SetIfVersion(key, value interface{}, version uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var current uint64
+	if c.has(key, nil) {
+		current = c.items[key].version
+	}
+	if current != version {
+		return false, nil
+	}
+	if _, err := c.set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Peek returns the value for the specified key if it is present in the cache
 // without updating any eviction algorithm statistics or positions.
 // This is a pure read operation that does not affect cache state.
@@ -117,12 +333,11 @@ func (c *LRUCache) Peek(key interface{}) (interface{}, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	item, ok := c.items[key]
+	it, ok := c.items[key]
 	if !ok {
 		return nil, ErrKeyNotFoundError
 	}
 
-	it := item.Value.(*lruItem)
 	if it.IsExpired(nil) {
 		return nil, ErrKeyNotFoundError
 	}
@@ -149,22 +364,85 @@ func (c *LRUCache) get(key interface{}, onLoad bool) (interface{}, error) {
 }
 
 func (c *LRUCache) getValue(key interface{}, onLoad bool) (interface{}, error) {
+	if v, ok := c.readUnlocked(key, onLoad, c.lookup); ok {
+		return v, nil
+	}
+	if v, ok := c.readShared(key, onLoad); ok {
+		return v, nil
+	}
 	c.mu.Lock()
-	item, ok := c.items[key]
+	defer c.unlock()
+	return c.readLocked(key, onLoad, c.lookup, c.deadlineOf)
+}
+
+// readShared serves a hit under the read lock and queues the promotion of the
+// entry, if the cache has been built with DeferredPromotion. Returns false if
+// the key must be looked up under the write lock instead.
+func (c *LRUCache) readShared(key interface{}, onLoad bool) (interface{}, bool) {
+	if c.promotions == nil || onLoad || (c.wheel != nil && c.expiresOnAccess()) {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	it, ok := c.items[key]
+	if !ok || it.maxIdle > 0 || it.IsExpired(nil) {
+		return nil, false
+	}
+	if !c.promotions.push(it, c.clock.Now()) {
+		return nil, false
+	}
+	c.stats.IncrHitCount()
+	return it.value, true
+}
+
+// applyPromotions moves the entries of the queued hits to the front and
+// records their accesses. The caller must hold the write lock.
+func (c *LRUCache) applyPromotions() {
+	if c.promotions == nil {
+		return
+	}
+	c.promotions.drain(func(p lruPromotion) {
+		// the entry may have been removed or replaced since it was hit
+		if c.items[p.item.key] == p.item {
+			c.evictList.MoveToFront(p.item)
+			p.item.recordAccess(p.at)
+		}
+	})
+}
+
+// getMulti returns the values of the specified keys that are present in the cache
+// and the keys that are not, acquiring the lock only once.
+func (c *LRUCache) getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{}) {
+	return c.lookupMulti(keys, c.lookup)
+}
+
+// lookup returns the value for the specified key and updates the eviction state.
+// The caller must hold the lock.
+func (c *LRUCache) lookup(key interface{}, onLoad bool) (interface{}, error) {
+	c.applyPromotions()
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	it, ok := c.items[key]
 	if ok {
-		it := item.Value.(*lruItem)
 		if !it.IsExpired(nil) {
-			c.evictList.MoveToFront(item)
-			v := it.value
-			c.mu.Unlock()
+			c.evictList.MoveToFront(it)
 			if !onLoad {
 				c.stats.IncrHitCount()
+				it.recordAccess(c.clock.Now())
+				if c.sliding && it.expiration != nil {
+					t := c.clock.Now().Add(*c.expiration)
+					it.expiration = &t
+					c.scheduleExpiration(key, t)
+				}
+				if c.shouldRefresh(&it.accessInfo) {
+					c.refresh(key)
+				}
 			}
-			return v, nil
+			return it.value, nil
 		}
-		c.removeElement(item)
+		c.expireOnAccess(key, c.remove)
 	}
-	c.mu.Unlock()
 	if !onLoad {
 		c.stats.IncrMissCount()
 	}
@@ -172,6 +450,9 @@ func (c *LRUCache) getValue(key interface{}, onLoad bool) (interface{}, error) {
 }
 
 func (c *LRUCache) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
+	if v, ok := c.recallVictim(key, c); ok {
+		return v, nil
+	}
 	if c.loaderExpireFunc == nil {
 		return nil, ErrKeyNotFoundError
 	}
@@ -180,7 +461,7 @@ func (c *LRUCache) getWithLoader(key interface{}, isWait bool) (interface{}, err
 			return nil, e
 		}
 		c.mu.Lock()
-		defer c.mu.Unlock()
+		defer c.unlock()
 		item, err := c.set(key, v)
 		if err != nil {
 			return nil, err
@@ -188,27 +469,124 @@ func (c *LRUCache) getWithLoader(key interface{}, isWait bool) (interface{}, err
 		if expiration != nil {
 			t := c.clock.Now().Add(*expiration)
 			item.(*lruItem).expiration = &t
+			c.scheduleExpiration(key, t)
 		}
 		return v, nil
 	}, isWait)
 	if err != nil {
-		return nil, err
+		// value is the stale value, if any.
+		return value, err
 	}
 	return value, nil
 }
 
-// evict removes the oldest item from the cache.
+// evict removes the oldest unpinned item from the cache.
 func (c *LRUCache) evict(count int) {
-	for i := 0; i < count; i++ {
-		ent := c.evictList.Back()
-		if ent == nil {
-			return
-		} else {
+	defer c.beginEviction()()
+	c.applyPromotions()
+	ent := c.evictList.Back()
+	for i := 0; i < count && ent != nil; {
+		prev := c.evictList.Prev(ent)
+		if !ent.pinned {
 			c.removeElement(ent)
+			i++
 		}
+		ent = prev
 	}
 }
 
+// compute atomically replaces the value for the specified key with the result of fn.
+// fn receives the current value and whether the key is present in the cache.
+func (c *LRUCache) compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var (
+		old interface{}
+		err error
+	)
+	found := c.has(key, nil)
+	if found {
+		old = c.items[key].value
+		if c.deserializeFunc != nil {
+			old, err = c.deserializeFunc(key, old)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, err := fn(old, found)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.set(key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Touch resets the expiration of the provided key to the default expiration
+// without updating any eviction algorithm statistics or positions.
+// If the cache has no default expiration, the key will never expire.
+func (c *LRUCache) Touch(key interface{}) bool {
+	return c.setExpiration(key, c.expiration)
+}
+
+// TouchWithExpire resets the expiration of the provided key to the given duration
+// without updating any eviction algorithm statistics or positions.
+func (c *LRUCache) TouchWithExpire(key interface{}, expiration time.Duration) bool {
+	return c.setExpiration(key, &expiration)
+}
+
+// SetExpiration changes the expiration of the provided key in place
+// without updating any eviction algorithm statistics or positions.
+// A non-positive duration removes the expiration so that the key never expires.
+func (c *LRUCache) SetExpiration(key interface{}, expiration time.Duration) bool {
+	if expiration <= 0 {
+		return c.setExpiration(key, nil)
+	}
+	return c.setExpiration(key, &expiration)
+}
+
+func (c *LRUCache) setExpiration(key interface{}, expiration *time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	item := c.items[key]
+	if expiration == nil {
+		item.expiration = nil
+	} else {
+		t := c.clock.Now().Add(*expiration)
+		item.expiration = &t
+		c.scheduleExpiration(key, t)
+	}
+	return true
+}
+
+// Pin prevents the provided key from being evicted.
+// A pinned key is still removed by Remove and on expiration.
+func (c *LRUCache) Pin(key interface{}) bool {
+	return c.setPinned(key, true)
+}
+
+// Unpin makes the provided key eligible for eviction again.
+func (c *LRUCache) Unpin(key interface{}) bool {
+	return c.setPinned(key, false)
+}
+
+func (c *LRUCache) setPinned(key interface{}, pinned bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(key, nil) {
+		return false
+	}
+	c.items[key].pinned = pinned
+	return true
+}
+
 // Has checks if key exists in cache
 func (c *LRUCache) Has(key interface{}) bool {
 	c.mu.RLock()
@@ -222,13 +600,62 @@ func (c *LRUCache) has(key interface{}, now *time.Time) bool {
 	if !ok {
 		return false
 	}
-	return !item.Value.(*lruItem).IsExpired(now)
+	return !item.IsExpired(now)
+}
+
+// storedKey returns the key of the entry of key, which the cache owns, without retaining key.
+func (c *LRUCache) storedKey(key interface{}) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if it, ok := c.items[key]; ok {
+		return it.key, true
+	}
+	return nil, false
+}
+
+// deadlineOf returns the time at which key expires if it is present in the cache and expires.
+func (c *LRUCache) deadlineOf(key interface{}) (time.Time, bool) {
+	it, ok := c.items[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return it.deadline(it.expiration)
+}
+
+// expirationOf returns the time at which key expires, or nil if it does not
+// expire or is not present. The caller must hold the lock.
+func (c *LRUCache) expirationOf(key interface{}) *time.Time {
+	if it, ok := c.items[key]; ok {
+		return it.expiration
+	}
+	return nil
+}
+
+// GetAndRemove removes the provided key from the cache and returns its value.
+// Returns false if the key is not present in the cache.
+func (c *LRUCache) GetAndRemove(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if !c.has(key, nil) {
+		return nil, false
+	}
+	value := c.items[key].value
+	if c.deserializeFunc != nil {
+		var err error
+		value, err = c.deserializeFunc(key, value)
+		if err != nil {
+			return nil, false
+		}
+	}
+	c.remove(key)
+	return value, true
 }
 
 // Remove removes the provided key from the cache.
 func (c *LRUCache) Remove(key interface{}) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	return c.remove(key)
 }
@@ -241,14 +668,10 @@ func (c *LRUCache) remove(key interface{}) bool {
 	return false
 }
 
-func (c *LRUCache) removeElement(e *list.Element) {
-	c.evictList.Remove(e)
-	entry := e.Value.(*lruItem)
+func (c *LRUCache) removeElement(entry *lruItem) {
+	c.evictList.Remove(entry)
 	delete(c.items, entry.key)
-	if c.evictedFunc != nil {
-		entry := e.Value.(*lruItem)
-		c.evictedFunc(entry.key, entry.value)
-	}
+	c.notifyEvicted(entry.key, entry.value)
 }
 
 func (c *LRUCache) keys() []interface{} {
@@ -263,6 +686,113 @@ func (c *LRUCache) keys() []interface{} {
 	return keys
 }
 
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+func (c *LRUCache) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.deleteExpired(c.deadlineOf, c.remove)
+}
+
+// sample returns up to n unexpired entries, chosen uniformly at random, with their
+// values deserialized.
+func (c *LRUCache) sample(n int) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := reservoir[interface{}, interface{}]{n: n}
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		r.offer(key, item.value)
+	}
+	return c.sampled(&r)
+}
+
+// entries returns a point-in-time copy of all unexpired entries.
+func (c *LRUCache) entries() []cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]cacheEntry, 0, len(c.items))
+	now := c.clock.Now()
+	// oldest first, so that re-inserting the entries in order restores recency
+	for item := c.evictList.Back(); item != nil; item = c.evictList.Prev(item) {
+		if item.IsExpired(&now) {
+			continue
+		}
+		entries = append(entries, newCacheEntry(item.key, item.value, item.expiration))
+	}
+	return entries
+}
+
+// restore inserts entries, as returned by entries, with their expiration times.
+func (c *LRUCache) restore(entries []cacheEntry) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.beginRestore()()
+	for _, e := range entries {
+		item, err := c.set(e.key, e.value)
+		if err != nil {
+			continue
+		}
+		if e.expiration != nil {
+			item.(*lruItem).expiration = e.expiration
+			c.scheduleExpiration(e.key, *e.expiration)
+		}
+	}
+}
+
+// shrink evicts up to n entries and returns the number of evicted entries.
+func (c *LRUCache) shrink(n int) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := c.entryCount
+	c.evict(n)
+	return int(count - c.entryCount)
+}
+
+// walk calls fn for each entry, with its value deserialized, while holding the read
+// lock and skips expired entries if checkExpired is true. It stops and returns false
+// as soon as fn returns false.
+func (c *LRUCache) walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool {
+	fn = c.deserializing(fn, true)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if checkExpired && item.IsExpired(&now) {
+			continue
+		}
+		if !fn(key, item.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeMulti removes the specified keys, acquiring the lock only once.
+func (c *LRUCache) removeMulti(keys []interface{}) int {
+	return c.removeKeys(keys, c.remove)
+}
+
+// removeIf removes all entries that satisfy fn, which is called with the deserialized
+// values, and returns the number of removed entries.
+func (c *LRUCache) removeIf(fn func(interface{}, interface{}) bool) int {
+	fn = c.deserializing(fn, false)
+	c.mu.Lock()
+	defer c.unlock()
+	var keys []interface{}
+	for key, item := range c.items {
+		if fn(key, item.value) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.remove(key)
+	}
+	return len(keys)
+}
+
 // GetALL returns all key-value pairs in the cache.
 func (c *LRUCache) GetALL(checkExpired bool) map[interface{}]interface{} {
 	c.mu.RLock()
@@ -271,7 +801,7 @@ func (c *LRUCache) GetALL(checkExpired bool) map[interface{}]interface{} {
 	now := time.Now()
 	for k, item := range c.items {
 		if !checkExpired || c.has(k, &now) {
-			items[k] = item.Value.(*lruItem).value
+			items[k] = item.value
 		}
 	}
 	return items
@@ -298,47 +828,226 @@ func (c *LRUCache) Len(checkExpired bool) int {
 	if !checkExpired {
 		return len(c.items)
 	}
-	var length int
-	now := time.Now()
-	for k := range c.items {
-		if c.has(k, &now) {
-			length++
-		}
-	}
-	return length
+	return len(c.items) - c.countExpired(c.deadlineOf)
 }
 
 // Completely clear the cache
 func (c *LRUCache) Purge() {
+	c.purge(c.purgeVisitorFunc)
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live to w.
+func (c *LRUCache) SaveTo(w io.Writer) error {
+	return c.saveTo(w, c.entries())
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache.
+func (c *LRUCache) LoadFrom(r io.Reader) error {
+	entries, err := c.loadFrom(r)
+	if err != nil {
+		return err
+	}
+	c.restore(entries)
+	return nil
+}
+
+// purge clears the cache and calls visit, if not nil, for each entry.
+func (c *LRUCache) purge(visit PurgeVisitorFunc) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if c.purgeVisitorFunc != nil {
-		for key, item := range c.items {
-			it := item.Value.(*lruItem)
-			v := it.value
-			c.purgeVisitorFunc(key, v)
+	if visit != nil {
+		for key, it := range c.items {
+			visit(key, it.value)
 		}
 	}
 
+	c.resetExpirations()
+	c.resetSize()
 	c.init()
 }
 
-type lruItem struct {
+// DebugState returns the number of entries of the cache.
+func (c *LRUCache) DebugState() DebugState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return DebugState{Policy: TYPE_LRU, Entries: len(c.items)}
+}
+
+// Oldest returns the least recently used entry, which is the next to be evicted,
+// without updating its position.
+// Returns false if the cache is empty.
+func (c *LRUCache) Oldest() (interface{}, interface{}, *time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.entryOf(c.evictList.Back())
+}
+
+// Newest returns the most recently used entry without updating its position.
+// Returns false if the cache is empty.
+func (c *LRUCache) Newest() (interface{}, interface{}, *time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.entryOf(c.evictList.Front())
+}
+
+func (c *LRUCache) entryOf(it *lruItem) (interface{}, interface{}, *time.Time, bool) {
+	if it == nil {
+		return nil, nil, nil, false
+	}
+	var expiration *time.Time
+	if it.expiration != nil {
+		t := *it.expiration
+		expiration = &t
+	}
+	return it.key, it.value, expiration, true
+}
+
+// lruItem is an entry of an LRUCache.
+type lruItem = lruNode[interface{}, interface{}]
+
+// lruNode is an entry of an LRU cache, which LRUCache stores with interface{} keys
+// and values and typedLRUCache with the key and value types of its XCache.
+type lruNode[K, V any] struct {
 	clock      Clock
-	key        interface{}
-	value      interface{}
+	key        K
+	value      V
 	expiration *time.Time
+	pinned     bool
+	version    uint64
+	accessInfo
+
+	prev, next *lruNode[K, V]
+}
+
+// lruPromotion is a hit on item at the given time that has not been applied yet.
+type lruPromotion struct {
+	item *lruItem
+	at   time.Time
+}
+
+// lruPromotions queues the hits that an LRU cache has served under the read lock.
+// Each reader claims a distinct slot with an atomic increment and fills it
+// while it holds the read lock, so the queue is complete whenever the write
+// lock is held.
+type lruPromotions struct {
+	n     uint32
+	queue [promotionQueueSize]lruPromotion
+}
+
+// push queues a hit on it. Returns false if the queue is full.
+// The caller must hold the read lock.
+func (q *lruPromotions) push(it *lruItem, at time.Time) bool {
+	n := atomic.AddUint32(&q.n, 1)
+	if n > promotionQueueSize {
+		return false
+	}
+	q.queue[n-1] = lruPromotion{item: it, at: at}
+	return true
+}
+
+// drain calls fn for each queued hit in the order of the hits and empties the
+// queue. The caller must hold the write lock.
+func (q *lruPromotions) drain(fn func(lruPromotion)) {
+	n := atomic.LoadUint32(&q.n)
+	if n == 0 {
+		return
+	}
+	if n > promotionQueueSize {
+		n = promotionQueueSize
+	}
+	for i := range q.queue[:n] {
+		fn(q.queue[i])
+		q.queue[i] = lruPromotion{}
+	}
+	atomic.StoreUint32(&q.n, 0)
+}
+
+// reset discards the queued hits. The caller must hold the write lock.
+func (q *lruPromotions) reset() {
+	q.drain(func(lruPromotion) {})
+}
+
+// lruList is the list of the entries of an LRUCache.
+type lruList = lruNodeList[interface{}, interface{}]
+
+// lruNodeList is a doubly linked list whose links live in the items themselves,
+// so adding an entry does not allocate a separate list element.
+type lruNodeList[K, V any] struct {
+	root lruNode[K, V] // sentinel: root.next is the front, root.prev the back
+	n    int
+}
+
+func (l *lruNodeList[K, V]) Init() {
+	l.root.prev = &l.root
+	l.root.next = &l.root
+	l.n = 0
+}
+
+func (l *lruNodeList[K, V]) Len() int {
+	return l.n
+}
+
+func (l *lruNodeList[K, V]) Front() *lruNode[K, V] {
+	if l.n == 0 {
+		return nil
+	}
+	return l.root.next
+}
+
+func (l *lruNodeList[K, V]) Back() *lruNode[K, V] {
+	if l.n == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// Prev returns the item before it, or nil if it is the front.
+func (l *lruNodeList[K, V]) Prev(it *lruNode[K, V]) *lruNode[K, V] {
+	if it.prev == &l.root {
+		return nil
+	}
+	return it.prev
+}
+
+func (l *lruNodeList[K, V]) insertAfter(it, at *lruNode[K, V]) {
+	it.prev = at
+	it.next = at.next
+	at.next.prev = it
+	at.next = it
+	l.n++
+}
+
+func (l *lruNodeList[K, V]) PushFront(it *lruNode[K, V]) *lruNode[K, V] {
+	l.insertAfter(it, &l.root)
+	return it
+}
+
+func (l *lruNodeList[K, V]) Remove(it *lruNode[K, V]) {
+	it.prev.next = it.next
+	it.next.prev = it.prev
+	it.prev = nil
+	it.next = nil
+	l.n--
+}
+
+func (l *lruNodeList[K, V]) MoveToFront(it *lruNode[K, V]) {
+	if l.root.next == it {
+		return
+	}
+	l.Remove(it)
+	l.insertAfter(it, &l.root)
 }
 
 // IsExpired returns boolean value whether this item is expired or not.
-func (it *lruItem) IsExpired(now *time.Time) bool {
-	if it.expiration == nil {
+func (it *lruNode[K, V]) IsExpired(now *time.Time) bool {
+	deadline, ok := it.deadline(it.expiration)
+	if !ok {
 		return false
 	}
 	if now == nil {
 		t := it.clock.Now()
 		now = &t
 	}
-	return it.expiration.Before(*now)
+	return deadline.Before(*now)
 }
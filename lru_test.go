@@ -1,7 +1,9 @@
 package xcache
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -79,3 +81,115 @@ func TestLRUHas(t *testing.T) {
 		})
 	}
 }
+
+func TestLRUOldestNewest(t *testing.T) {
+	cc := New(3).LRU().Build().(OrderedCache)
+	if _, _, _, ok := cc.Oldest(); ok {
+		t.Fatal("Oldest should return false for an empty cache")
+	}
+
+	cc.Set(1, "a")
+	cc.SetWithExpire(2, "b", time.Minute)
+	cc.Set(3, "c")
+	cc.Get(1)
+
+	k, v, exp, ok := cc.Oldest()
+	if !ok || k != 2 || v != "b" || exp == nil {
+		t.Errorf("unexpected oldest entry: %v, %v, %v, %v", k, v, exp, ok)
+	}
+	k, v, exp, ok = cc.Newest()
+	if !ok || k != 1 || v != "a" || exp != nil {
+		t.Errorf("unexpected newest entry: %v, %v, %v, %v", k, v, exp, ok)
+	}
+
+	// Inspection must not change the eviction order.
+	cc.Set(4, "d")
+	if cc.Has(2) {
+		t.Error("key 2 should be evicted")
+	}
+}
+
+func TestOrderedPolicySetAllocs(t *testing.T) {
+	for _, tp := range []string{TYPE_LRU, TYPE_FIFO, TYPE_ARC, TYPE_LIRS} {
+		gc := New(100).EvictType(tp).Build()
+		for i := 0; i < 1000; i++ {
+			gc.Set(i, i)
+		}
+		i := 1000
+		// the item and the boxed key and value; the lists and rings allocate nothing
+		if n := testing.AllocsPerRun(100, func() { gc.Set(i, i); i++ }); n > 3 {
+			t.Errorf("%v: setting a new key allocates %v times", tp, n)
+		}
+	}
+}
+
+func TestLRUDeferredPromotion(t *testing.T) {
+	gc := New(3).LRU().DeferredPromotion().Build()
+	for i := 1; i <= 3; i++ {
+		gc.Set(i, i)
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := gc.Get(1); err != nil || v != 1 {
+			t.Errorf("%v, %v", v, err)
+		}
+	}
+	if n := gc.HitCount(); n != 3 {
+		t.Errorf("%v != %v", n, 3)
+	}
+	// the queued hits are applied before the eviction
+	gc.Set(4, 4)
+	if !gc.Has(1) {
+		t.Error("key 1 should not be evicted")
+	}
+	if gc.Has(2) {
+		t.Error("key 2 should be evicted")
+	}
+	if info, _ := gc.Info(1); info.AccessCount != 3 {
+		t.Errorf("%v != %v", info.AccessCount, 3)
+	}
+
+	// a full queue falls back to the write lock
+	for i := 0; i < 2*promotionQueueSize; i++ {
+		gc.Get(3)
+	}
+	if n := gc.HitCount(); n != 3+2*promotionQueueSize {
+		t.Errorf("%v != %v", n, 3+2*promotionQueueSize)
+	}
+	gc.Remove(3)
+	gc.Purge()
+	if _, err := gc.Get(3); err != ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+	}
+
+	for _, builder := range []*CacheBuilder{
+		New(3).ARC().DeferredPromotion(),
+		New(3).LRU().LockFreeReads().DeferredPromotion(),
+		New(3).LRU().RefreshAfter(time.Second).DeferredPromotion(),
+	} {
+		if _, err := builder.BuildE(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%v != %v", err, ErrInvalidConfig)
+		}
+	}
+}
+
+func TestXCacheDeferredPromotionConcurrent(t *testing.T) {
+	xc := NewXCache[int, int](64).BucketCount(2).EvictType(TYPE_LRU).DeferredPromotion().Build()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := (g + i) % 100
+				if i%20 == 0 {
+					xc.Set(key, key)
+					continue
+				}
+				if v, err := xc.Get(key); err == nil && v != key {
+					t.Errorf("%v != %v", v, key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,48 @@
+package xcache
+
+import (
+	"fmt"
+)
+
+// Number is a constraint that permits any integer or floating-point type.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Increment atomically adds delta to the value stored for the specified key
+// and returns the new value. If the key is not present in the cache,
+// it is created with delta as its value.
+func Increment[K comparable, V Number](xc *XCache[K, V], key K, delta V) (V, error) {
+	return addNumber(xc, key, func(n V) V { return n + delta }, delta)
+}
+
+// Decrement atomically subtracts delta from the value stored for the specified key
+// and returns the new value. If the key is not present in the cache,
+// it is created with -delta as its value.
+func Decrement[K comparable, V Number](xc *XCache[K, V], key K, delta V) (V, error) {
+	var zero V
+	return addNumber(xc, key, func(n V) V { return n - delta }, zero-delta)
+}
+
+func addNumber[K comparable, V Number](xc *XCache[K, V], key K, op func(V) V, initial V) (V, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, err := bucket.compute(key, func(old interface{}, found bool) (interface{}, error) {
+		if !found {
+			return initial, nil
+		}
+		n, ok := old.(V)
+		if !ok {
+			return nil, fmt.Errorf("type assertion failed")
+		}
+		return op(n), nil
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return value.(V), nil
+}
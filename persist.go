@@ -0,0 +1,229 @@
+package xcache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// persistVersion is the version of the format written by SaveTo.
+const persistVersion = 1
+
+// ErrUnknownFormat is returned by LoadFrom if the input has not been written by SaveTo.
+var ErrUnknownFormat = errors.New("unknown cache snapshot format")
+
+// persistHeader precedes the entries written by SaveTo.
+type persistHeader struct {
+	Version int
+	Count   int
+}
+
+// persistedEntry is an entry written by SaveTo.
+type persistedEntry[K, V any] struct {
+	Key   K
+	Value V
+	// TTL is the time the entry had left to live, or 0 if it does not expire.
+	TTL time.Duration
+}
+
+// writeEntries writes entries to w as a gob stream.
+func writeEntries[K, V any](w io.Writer, entries []persistedEntry[K, V]) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(persistHeader{Version: persistVersion, Count: len(entries)}); err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEntries reads the entries written by writeEntries from r.
+func readEntries[K, V any](r io.Reader) ([]persistedEntry[K, V], error) {
+	dec := gob.NewDecoder(r)
+	var header persistHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	if header.Version != persistVersion || header.Count < 0 {
+		return nil, fmt.Errorf("%w: version %d", ErrUnknownFormat, header.Version)
+	}
+	entries := make([]persistedEntry[K, V], 0, minInt(header.Count, 1<<16))
+	for i := 0; i < header.Count; i++ {
+		var e persistedEntry[K, V]
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// remainingTTL returns the time an entry that expires at expiration has left to
+// live at now, or 0 if it does not expire. Returns false if it has expired.
+func remainingTTL(expiration *time.Time, now time.Time) (time.Duration, bool) {
+	if expiration == nil {
+		return 0, true
+	}
+	ttl := expiration.Sub(now)
+	return ttl, ttl > 0
+}
+
+// deadline returns the expiration time of an entry that has ttl left to live at now.
+func deadline(ttl time.Duration, now time.Time) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	t := now.Add(ttl)
+	return &t
+}
+
+// saveTo writes entries, as returned by the entries method of the cache, to w.
+func (c *baseCache) saveTo(w io.Writer, entries []cacheEntry) error {
+	now := c.clock.Now()
+	persisted := make([]persistedEntry[interface{}, interface{}], 0, len(entries))
+	for _, e := range entries {
+		ttl, ok := remainingTTL(e.expiration, now)
+		if !ok {
+			continue
+		}
+		value := e.value
+		if c.deserializeFunc != nil {
+			var err error
+			if value, err = c.deserializeFunc(e.key, value); err != nil {
+				return err
+			}
+		}
+		persisted = append(persisted, persistedEntry[interface{}, interface{}]{Key: e.key, Value: value, TTL: ttl})
+	}
+	return writeEntries(w, persisted)
+}
+
+// loadFrom reads the entries written by saveTo from r and returns them as
+// entries for the restore method of the cache.
+func (c *baseCache) loadFrom(r io.Reader) ([]cacheEntry, error) {
+	persisted, err := readEntries[interface{}, interface{}](r)
+	if err != nil {
+		return nil, err
+	}
+	now := c.clock.Now()
+	entries := make([]cacheEntry, 0, len(persisted))
+	for _, e := range persisted {
+		value := e.Value
+		if c.serializeFunc != nil {
+			if value, err = c.serializeFunc(e.Key, value); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, cacheEntry{key: e.Key, value: value, expiration: deadline(e.TTL, now)})
+	}
+	return entries, nil
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live
+// to w as a gob stream, so that they can be restored by LoadFrom, for example
+// after a restart. Keys and values are encoded as K and V, so they need no
+// registration with gob unless they contain interface values. Values are written
+// as returned by Get, not as stored with SerializeFunc. The entries are copied
+// one bucket after another, so entries written concurrently may be missed, and
+// they are encoded and written after the lock of the cache has been released.
+func (xc *XCache[K, V]) SaveTo(w io.Writer) error {
+	xc.rlock()
+	entries := xc.copyEntries()
+	xc.mu.RUnlock()
+	var persisted []persistedEntry[K, V]
+	now := xc.builder.clock.Now()
+	err := visitEntries(entries, now, xc.builder.deserializeFunc, func(key K, value V, expiration *time.Time) error {
+		ttl, _ := remainingTTL(expiration, now)
+		persisted = append(persisted, persistedEntry[K, V]{Key: key, Value: value, TTL: ttl})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeEntries(w, persisted)
+}
+
+// copyEntries returns a copy of the entries of all buckets, taken one bucket
+// after another. The caller must hold xc.mu for reading.
+func (xc *XCache[K, V]) copyEntries() []cacheEntry {
+	var entries []cacheEntry
+	for _, bucket := range xc.allBuckets() {
+		entries = append(entries, bucket.entries()...)
+	}
+	return entries
+}
+
+// visitEntries calls fn for the entries that have not expired at now, with their
+// values deserialized with deserialize, if any, as returned by Get, until fn
+// returns an error.
+func visitEntries[K comparable, V any](entries []cacheEntry, now time.Time, deserialize DeserializeFunc, fn func(key K, value V, expiration *time.Time) error) error {
+	for _, e := range entries {
+		if _, ok := remainingTTL(e.expiration, now); !ok {
+			continue
+		}
+		value := e.value
+		if deserialize != nil {
+			var err error
+			if value, err = deserialize(e.key, value); err != nil {
+				return err
+			}
+		}
+		key, ok := e.key.(K)
+		if !ok {
+			continue
+		}
+		v, ok := value.(V)
+		if !ok {
+			continue
+		}
+		if err := fn(key, v, e.expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache, replacing the values
+// of keys that are present, without calling AddedFunc or consulting the admission
+// policy. The entries expire after the time they had left to live when they were
+// written. Nothing is added if r cannot be read; ErrUnknownFormat is returned if
+// r has not been written by SaveTo.
+func (xc *XCache[K, V]) LoadFrom(r io.Reader) error {
+	persisted, err := readEntries[K, V](r)
+	if err != nil {
+		return err
+	}
+	return xc.loadEntries(persisted)
+}
+
+// loadEntries adds persisted entries to the cache as LoadFrom does.
+func (xc *XCache[K, V]) loadEntries(persisted []persistedEntry[K, V]) error {
+	used := make(map[Cache]*int64)
+	defer releaseAll(used)
+	now := xc.builder.clock.Now()
+	groups := make(map[Cache][]cacheEntry)
+	for _, e := range persisted {
+		var value interface{} = e.Value
+		if xc.builder.serializeFunc != nil {
+			var err error
+			if value, err = xc.builder.serializeFunc(e.Key, value); err != nil {
+				return err
+			}
+		}
+		bucket := xc.useBucketIn(e.Key, used)
+		groups[bucket] = append(groups[bucket], cacheEntry{key: e.Key, value: value, expiration: deadline(e.TTL, now)})
+	}
+	for bucket, entries := range groups {
+		bucket.restore(entries)
+	}
+	xc.enforceCapacity()
+	return nil
+}
@@ -0,0 +1,124 @@
+package xcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSaveToLoadFrom(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL} {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			gc := New(100).EvictType(tp).Clock(clock).Build()
+			for i := 0; i < 10; i++ {
+				gc.Set(i, fmt.Sprint(i))
+			}
+			gc.SetWithExpire("short", 1, time.Second)
+			gc.SetWithExpire("long", 2, time.Hour)
+			var buf bytes.Buffer
+			if err := gc.SaveTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(time.Minute)
+			restored := New(100).EvictType(tp).Clock(clock).Build()
+			if err := restored.LoadFrom(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if l := restored.Len(false); l != 12 {
+				t.Errorf("%v != %v", l, 12)
+			}
+			for i := 0; i < 10; i++ {
+				if v, err := restored.Get(i); err != nil || v != fmt.Sprint(i) {
+					t.Errorf("%v, %v != %v", v, err, i)
+				}
+			}
+			// the remaining time to live is kept
+			clock.Advance(2 * time.Second)
+			if _, err := restored.GetIFPresent("short"); err != ErrKeyNotFoundError {
+				t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+			}
+			if v, err := restored.GetIFPresent("long"); err != nil || v != 2 {
+				t.Errorf("%v, %v != %v", v, err, 2)
+			}
+		})
+	}
+}
+
+func TestLoadFromInvalid(t *testing.T) {
+	gc := New(10).LRU().Build()
+	if err := gc.LoadFrom(bytes.NewBufferString("not a snapshot")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("%v != %v", err, ErrUnknownFormat)
+	}
+	var buf bytes.Buffer
+	gc.Set(1, 1)
+	gc.SaveTo(&buf)
+	if err := gc.LoadFrom(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("a truncated snapshot should fail")
+	}
+}
+
+type persistedValue struct {
+	Name  string
+	Count int
+}
+
+func TestXCacheSaveToLoadFrom(t *testing.T) {
+	xc := NewXCache[string, persistedValue](100).BucketCount(4).Build()
+	for i := 0; i < 50; i++ {
+		xc.Set(fmt.Sprint(i), persistedValue{Name: fmt.Sprint(i), Count: i})
+	}
+	var buf bytes.Buffer
+	if err := xc.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewXCache[string, persistedValue](100).BucketCount(8).Build()
+	if err := restored.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if l := restored.Len(false); l != 50 {
+		t.Errorf("%v != %v", l, 50)
+	}
+	for i := 0; i < 50; i++ {
+		if v, err := restored.Get(fmt.Sprint(i)); err != nil || v.Count != i {
+			t.Errorf("%v, %v != %v", v, err, i)
+		}
+	}
+}
+
+// unlockedWriter fails the test if the lock of xc is held while it is written.
+type unlockedWriter[K comparable, V any] struct {
+	t  *testing.T
+	xc *XCache[K, V]
+	bytes.Buffer
+}
+
+func (w *unlockedWriter[K, V]) Write(p []byte) (int, error) {
+	if !w.xc.mu.TryLock() {
+		w.t.Error("written while the lock of the cache is held")
+	} else {
+		w.xc.mu.Unlock()
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestXCacheSaveToUnlocked(t *testing.T) {
+	xc := NewXCache[int, int](100).BucketCount(4).Build()
+	defer xc.Close()
+	for i := 0; i < 10; i++ {
+		xc.Set(i, i)
+	}
+	w := &unlockedWriter[int, int]{t: t, xc: xc}
+	if err := xc.SaveTo(w); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewXCache[int, int](100).Build()
+	defer restored.Close()
+	if err := restored.LoadFrom(&w.Buffer); err != nil || restored.Len(false) != 10 {
+		t.Errorf("%v, %v != 10", err, restored.Len(false))
+	}
+}
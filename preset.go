@@ -0,0 +1,133 @@
+package xcache
+
+import "fmt"
+
+// Preset is a configuration for a typical workload, see CacheBuilder.Preset.
+type Preset int
+
+const (
+	// ReadHeavy suits caches that are read much more often than written: an LRU
+	// cache that serves hits without taking the write lock, see LockFreeReads.
+	ReadHeavy Preset = iota + 1
+	// WriteHeavy suits caches with many writes and inserts: a FIFO cache, which
+	// does not reorder entries on hits, that evicts entries in the background
+	// between the watermarks 0.85 and 0.95 and removes expired entries with a janitor.
+	// An XCache gets four times as many buckets as by default, to spread the writers,
+	// which share the capacity of the whole cache.
+	WriteHeavy
+	// ScanResistant suits caches whose working set must survive scans of keys that
+	// are used once: an ARC cache that only admits keys written twice, see Doorkeeper.
+	//
+	// The first write of a key is therefore rejected: Set returns ErrNotAdmitted and
+	// the key is stored only when it is written again. The Doorkeeper is sized for the
+	// capacity of the cache when Preset is called, so the size and bucket count should
+	// not be changed afterwards. Call Admission(nil) after Preset to admit every key.
+	ScanResistant
+	// MemoryTight suits processes that run close to their memory limit: a FIFO cache,
+	// whose entries have the least overhead, that is trimmed by a quarter when the heap
+	// exceeds the soft memory limit of the runtime, see MemoryPressure, and removes
+	// expired entries with a janitor. An XCache gets one bucket per GOMAXPROCS, which
+	// share the capacity of the whole cache.
+	MemoryTight
+)
+
+// String returns the name of the preset.
+func (p Preset) String() string {
+	switch p {
+	case ReadHeavy:
+		return "ReadHeavy"
+	case WriteHeavy:
+		return "WriteHeavy"
+	case ScanResistant:
+		return "ScanResistant"
+	case MemoryTight:
+		return "MemoryTight"
+	default:
+		return fmt.Sprintf("Preset(%d)", int(p))
+	}
+}
+
+// validatePreset returns an error wrapping ErrInvalidConfig for an unknown preset.
+func validatePreset(p Preset) error {
+	if p < 0 || p > MemoryTight {
+		return fmt.Errorf("%w: unknown preset %v", ErrInvalidConfig, p)
+	}
+	return nil
+}
+
+// presetDoorkeeper returns the admission policy of ScanResistant for a cache
+// of size entries in total, which remembers about twice as many keys.
+func presetDoorkeeper(size int) AdmissionPolicy {
+	return Doorkeeper(8*size, 3)
+}
+
+// presetMemoryFraction is the fraction of the entries that MemoryTight trims.
+const presetMemoryFraction = 0.25
+
+// Preset configures the eviction policy, admission, background eviction and janitor
+// of the cache for a typical workload, for users who do not know which policy suits
+// them. Options set after Preset override its choices, so it should be called right
+// after New. See the constants of Preset for what each one selects; note that
+// ScanResistant rejects the first write of every key.
+func (cb *CacheBuilder) Preset(preset Preset) *CacheBuilder {
+	cb.preset = preset
+	switch preset {
+	case ReadHeavy:
+		cb.LRU().LockFreeReads()
+	case WriteHeavy:
+		cb.FIFO().Watermarks(0.85, 0.95).ExpirationMode(ExpirationHybrid, DefaultJanitorInterval)
+	case ScanResistant:
+		cb.ARC().Admission(presetDoorkeeper(cb.size))
+	case MemoryTight:
+		cb.FIFO().MemoryPressure(0, presetMemoryFraction, DefaultMemoryCheckInterval).
+			ExpirationMode(ExpirationHybrid, DefaultJanitorInterval)
+	}
+	return cb
+}
+
+// Preset configures the eviction policy, admission, background eviction and janitor
+// of the buckets and the bucket count for a typical workload. A preset that changes
+// the bucket count keeps the capacity of the whole cache by setting TotalSize to the
+// capacity of the buckets it replaces. Options set after Preset override its choices,
+// so it should be called right after NewXCache. See the constants of Preset for what
+// each one selects; note that ScanResistant rejects the first write of every key.
+func (cb *XCacheBuilder[K, V]) Preset(preset Preset) *XCacheBuilder[K, V] {
+	cb.preset = preset
+	switch preset {
+	case ReadHeavy:
+		cb.LRU().LockFreeReads()
+	case WriteHeavy:
+		cb.FIFO().Watermarks(0.85, 0.95).ExpirationMode(ExpirationHybrid, DefaultJanitorInterval)
+		cb.presetBucketCount(4 * AutoBucketCount())
+	case ScanResistant:
+		cb.ARC().Admission(presetDoorkeeper(cb.presetSize()))
+	case MemoryTight:
+		cb.FIFO().MemoryPressure(0, presetMemoryFraction, DefaultMemoryCheckInterval).
+			ExpirationMode(ExpirationHybrid, DefaultJanitorInterval)
+		cb.presetBucketCount(AutoBucketCount() / 4)
+	}
+	return cb
+}
+
+// presetSize returns the capacity of the whole cache as configured so far, or zero
+// if the buckets are unbounded.
+func (cb *XCacheBuilder[K, V]) presetSize() int {
+	if cb.totalSize > 0 {
+		return cb.totalSize
+	}
+	return cb.bucketSize * cb.bucketCount
+}
+
+// presetBucketCount sets the bucket count, but no more buckets than the cache has
+// entries, and spreads the capacity of the whole cache over the new buckets.
+func (cb *XCacheBuilder[K, V]) presetBucketCount(count int) {
+	size := cb.presetSize()
+	count = nextPowerOfTwo(maxInt(count, 1))
+	for size > 0 && count > size {
+		count /= 2
+	}
+	cb.BucketCount(count)
+	if size > 0 {
+		cb.TotalSize(size)
+	}
+}
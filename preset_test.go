@@ -0,0 +1,99 @@
+package xcache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPreset(t *testing.T) {
+	for preset, tp := range map[Preset]string{
+		ReadHeavy:     TYPE_LRU,
+		WriteHeavy:    TYPE_FIFO,
+		ScanResistant: TYPE_ARC,
+		MemoryTight:   TYPE_FIFO,
+	} {
+		t.Run(preset.String(), func(t *testing.T) {
+			gc := New(100).Preset(preset).Build()
+			defer gc.Close()
+			if s := gc.DebugState(); s.Policy != tp {
+				t.Errorf("%v != %v", s.Policy, tp)
+			}
+			for i := 0; i < 3; i++ {
+				gc.Set(i, i)
+				gc.Set(i, i)
+			}
+			for i := 0; i < 3; i++ {
+				if v, err := gc.Get(i); err != nil || v != i {
+					t.Errorf("%v, %v != %v", v, err, i)
+				}
+			}
+
+			xc := NewXCache[int, int](100).Preset(preset).Build()
+			defer xc.Close()
+			xc.Set(1, 1)
+			xc.Set(1, 1)
+			if v, err := xc.Get(1); err != nil || v != 1 {
+				t.Errorf("%v, %v != %v", v, err, 1)
+			}
+		})
+	}
+}
+
+func TestPresetOverride(t *testing.T) {
+	gc := New(100).Preset(ScanResistant).LRU().Build()
+	if s := gc.DebugState(); s.Policy != TYPE_LRU {
+		t.Errorf("%v != %v", s.Policy, TYPE_LRU)
+	}
+	if n := NewXCache[int, int](100).Preset(WriteHeavy).BucketCount(2).Build().GetBucketCount(); n != 2 {
+		t.Errorf("%v != %v", n, 2)
+	}
+	if _, err := New(100).Preset(Preset(42)).BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+	if _, err := NewXCache[int, int](100).Preset(Preset(42)).BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+}
+
+func TestPresetCapacity(t *testing.T) {
+	for _, preset := range []Preset{WriteHeavy, MemoryTight} {
+		t.Run(preset.String(), func(t *testing.T) {
+			// the capacity of the whole cache stays that of 8 buckets of 100 entries
+			for _, cb := range []*XCacheBuilder[int, int]{
+				NewXCache[int, int](100).BucketCount(8).Preset(preset),
+				NewXCache[int, int](100).BucketCount(8).TotalSize(800).Preset(preset),
+			} {
+				xc := cb.Build()
+				total := 0
+				for _, size := range xc.builder.bucketSizes() {
+					total += size
+				}
+				if total != 800 {
+					t.Errorf("%v != %v", total, 800)
+				}
+				xc.Close()
+			}
+
+			// a tiny cache does not get more buckets than entries
+			xc := NewXCache[int, int](1).BucketCount(2).Preset(preset).Build()
+			defer xc.Close()
+			if n := xc.GetBucketCount(); n > 2 {
+				t.Errorf("%v > %v", n, 2)
+			}
+		})
+	}
+}
+
+func TestPresetScanResistantAdmission(t *testing.T) {
+	xc := NewXCache[int, int](100).Preset(ScanResistant).Build()
+	if err := xc.Set(1, 1); !errors.Is(err, ErrNotAdmitted) {
+		t.Errorf("%v != %v", err, ErrNotAdmitted)
+	}
+	if err := xc.Set(1, 1); err != nil {
+		t.Error(err)
+	}
+	xc = NewXCache[int, int](100).Preset(ScanResistant).Admission(nil).Build()
+	if err := xc.Set(1, 1); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,166 @@
+package xcache
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryCheckInterval is the interval at which the heap is checked
+// for MemoryPressure if no interval is given.
+const DefaultMemoryCheckInterval = time.Second
+
+// memoryWatcher trims the caches it watches while the heap in use exceeds a limit.
+// The buckets of an XCache share a watcher, so the heap is read once per interval.
+type memoryWatcher struct {
+	limit    uint64
+	fraction float64
+	interval time.Duration
+	// readMemory returns the bytes of heap in use and the number of completed GC cycles.
+	readMemory func() (uint64, uint32)
+
+	mu      sync.Mutex
+	caches  map[*baseCache]func(int) int
+	done    chan struct{}
+	trimmed bool
+	gcs     uint32 // the number of GC cycles at the last trim
+}
+
+func newMemoryWatcher(limit uint64, fraction float64, interval time.Duration) *memoryWatcher {
+	if interval <= 0 {
+		interval = DefaultMemoryCheckInterval
+	}
+	return &memoryWatcher{
+		limit:      limit,
+		fraction:   fraction,
+		interval:   interval,
+		readMemory: readMemStats,
+		caches:     make(map[*baseCache]func(int) int),
+	}
+}
+
+// readMemStats reads the heap in use from runtime.MemStats.
+func readMemStats() (uint64, uint32) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc, ms.NumGC
+}
+
+// softLimit returns the limit of the watcher, or the soft memory limit of the
+// runtime if it is zero. Returns zero if neither is set.
+func (w *memoryWatcher) softLimit() uint64 {
+	if w.limit > 0 {
+		return w.limit
+	}
+	return runtimeMemoryLimit()
+}
+
+// watch starts trimming c with shrink, which evicts up to the given number of entries.
+// The watcher runs in the background while it watches at least one cache.
+func (w *memoryWatcher) watch(c *baseCache, shrink func(int) int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.caches[c] = shrink
+	if w.done == nil {
+		w.done = make(chan struct{})
+		go w.run(w.done)
+	}
+}
+
+// unwatch stops trimming c.
+func (w *memoryWatcher) unwatch(c *baseCache) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.caches, c)
+	if len(w.caches) == 0 && w.done != nil {
+		close(w.done)
+		w.done = nil
+	}
+}
+
+func (w *memoryWatcher) run(done chan struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-done:
+			return
+		}
+	}
+}
+
+// check trims the caches if the heap in use exceeds the limit and the memory
+// freed by the last trim has been collected, and restores their capacity once
+// the heap has dropped by fraction below the limit.
+func (w *memoryWatcher) check() {
+	limit := w.softLimit()
+	if limit == 0 {
+		return
+	}
+	heap, gcs := w.readMemory()
+
+	w.mu.Lock()
+	var trim, restore bool
+	switch {
+	case heap > limit:
+		trim = !w.trimmed || gcs != w.gcs
+		w.trimmed, w.gcs = true, gcs
+	case w.trimmed && float64(heap) <= float64(limit)*(1-w.fraction):
+		restore = true
+		w.trimmed = false
+	}
+	caches := make(map[*baseCache]func(int) int, len(w.caches))
+	for c, shrink := range w.caches {
+		caches[c] = shrink
+	}
+	w.mu.Unlock()
+
+	for c, shrink := range caches {
+		if trim {
+			c.trim(w.fraction, shrink)
+		} else if restore {
+			c.restoreCapacity()
+		}
+	}
+}
+
+// watchMemory makes the memory watcher of the cache, if any, trim it with shrink.
+func (c *baseCache) watchMemory(shrink func(int) int) {
+	if c.pressure != nil {
+		c.pressure.watch(c, shrink)
+	}
+}
+
+// trim evicts fraction of the entries with shrink and lowers the capacity of
+// the cache to the number of remaining entries.
+func (c *baseCache) trim(fraction float64, shrink func(int) int) {
+	c.mu.RLock()
+	n := int(c.entryCount)
+	c.mu.RUnlock()
+	evicted := shrink(int(math.Ceil(float64(n) * fraction)))
+	logDebug(c.logger, "xcache: trimmed cache under memory pressure", "count", evicted)
+
+	c.mu.Lock()
+	defer c.unlock()
+	c.trimLimit = maxInt(int(c.entryCount), 1)
+}
+
+// restoreCapacity restores the capacity of the cache after a trim.
+func (c *baseCache) restoreCapacity() {
+	c.mu.Lock()
+	defer c.unlock()
+	c.trimLimit = 0
+}
+
+// full reports whether a cache holding n entries must evict before it adds
+// another one, because of its size or because it has been trimmed.
+// The caller must hold the lock.
+func (c *baseCache) full(n int) bool {
+	if c.trimLimit > 0 && n >= c.trimLimit {
+		return true
+	}
+	return c.size > 0 && n >= c.size
+}
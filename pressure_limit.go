@@ -0,0 +1,16 @@
+//go:build go1.19
+
+package xcache
+
+import (
+	"math"
+	"runtime/debug"
+)
+
+// runtimeMemoryLimit returns the soft memory limit of the runtime, or zero if it is not set.
+func runtimeMemoryLimit() uint64 {
+	if limit := debug.SetMemoryLimit(-1); limit < math.MaxInt64 {
+		return uint64(limit)
+	}
+	return 0
+}
@@ -0,0 +1,8 @@
+//go:build !go1.19
+
+package xcache
+
+// runtimeMemoryLimit returns zero, as the runtime has no soft memory limit before Go 1.19.
+func runtimeMemoryLimit() uint64 {
+	return 0
+}
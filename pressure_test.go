@@ -0,0 +1,99 @@
+package xcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeMemory replaces the heap reading of w.
+func fakeMemory(w *memoryWatcher) (setHeap func(heap uint64, gcs uint32)) {
+	var heap uint64
+	var gcs uint32
+	w.readMemory = func() (uint64, uint32) { return heap, gcs }
+	return func(h uint64, g uint32) { heap, gcs = h, g }
+}
+
+func TestMemoryPressure(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL} {
+		t.Run(tp, func(t *testing.T) {
+			cb := New(100).EvictType(tp).MemoryPressure(1000, 0.5, time.Hour)
+			setHeap := fakeMemory(cb.pressure)
+			gc := cb.Build()
+			defer gc.Close()
+			for i := 0; i < 100; i++ {
+				gc.Set(i, i)
+			}
+
+			setHeap(2000, 1)
+			cb.pressure.check()
+			if l := gc.Len(false); l != 50 {
+				t.Errorf("%v != %v", l, 50)
+			}
+			// the capacity stays lowered
+			for i := 100; i < 200; i++ {
+				gc.Set(i, i)
+			}
+			if l := gc.Len(false); l != 50 {
+				t.Errorf("%v != %v", l, 50)
+			}
+			// no trim before the next GC cycle
+			cb.pressure.check()
+			if l := gc.Len(false); l != 50 {
+				t.Errorf("%v != %v", l, 50)
+			}
+			setHeap(2000, 2)
+			cb.pressure.check()
+			if l := gc.Len(false); l != 25 {
+				t.Errorf("%v != %v", l, 25)
+			}
+
+			// the capacity is restored once the pressure subsides
+			setHeap(800, 3)
+			cb.pressure.check()
+			setHeap(400, 3)
+			cb.pressure.check()
+			for i := 200; i < 400; i++ {
+				gc.Set(i, i)
+			}
+			if l := gc.Len(false); l != 100 {
+				t.Errorf("%v != %v", l, 100)
+			}
+		})
+	}
+}
+
+func TestMemoryPressureConfig(t *testing.T) {
+	for _, cb := range []*CacheBuilder{
+		New(10).LRU().MemoryPressure(0, 0, 0),
+		New(10).LRU().MemoryPressure(0, 1.5, 0),
+		New(10).ARC().MemoryPressure(0, 0.5, 0),
+	} {
+		if _, err := cb.BuildE(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%v != %v", err, ErrInvalidConfig)
+		}
+	}
+}
+
+func TestXCacheMemoryPressure(t *testing.T) {
+	xb := NewXCache[int, int](100).BucketCount(4).MemoryPressure(1000, 0.5, time.Hour)
+	setHeap := fakeMemory(xb.pressure)
+	xc := xb.Build()
+	for i := 0; i < 200; i++ {
+		xc.Set(i, i)
+	}
+	if n := len(xb.pressure.caches); n != 4 {
+		t.Errorf("%v != %v", n, 4)
+	}
+
+	setHeap(2000, 1)
+	xb.pressure.check()
+	if l := xc.Len(false); l < 90 || l > 110 {
+		t.Errorf("%v should be about %v", l, 100)
+	}
+
+	xc.Close()
+	if xb.pressure.done != nil {
+		t.Error("the watcher should stop once all buckets are closed")
+	}
+}
@@ -0,0 +1,91 @@
+package xcache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRandomGet(t *testing.T) {
+	size := 1000
+	gc := buildTestCache(t, TYPE_RANDOM, size)
+	testSetCache(t, gc, size)
+	testGetCache(t, gc, size)
+}
+
+func TestLoadingRandomGet(t *testing.T) {
+	size := 1000
+	gc := buildTestLoadingCache(t, TYPE_RANDOM, size, loader)
+	testGetCache(t, gc, size)
+}
+
+func TestRandomLength(t *testing.T) {
+	gc := buildTestLoadingCache(t, TYPE_RANDOM, 1000, loader)
+	gc.Get("test1")
+	gc.Get("test2")
+	length := gc.Len(true)
+	expectedLength := 2
+	if length != expectedLength {
+		t.Errorf("Expected length is %v, not %v", length, expectedLength)
+	}
+}
+
+func TestRandomEvictItem(t *testing.T) {
+	cacheSize := 10
+	numbers := 100
+	gc := buildTestLoadingCache(t, TYPE_RANDOM, cacheSize, loader)
+
+	for i := 0; i < numbers; i++ {
+		_, err := gc.Get(fmt.Sprintf("Key-%d", i))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if gc.Len(false) != cacheSize {
+		t.Errorf("Expected length is %v, not %v", cacheSize, gc.Len(false))
+	}
+	for _, key := range gc.Keys(false) {
+		v, err := gc.Get(key)
+		if err != nil || v != fmt.Sprintf("valueFor%s", key) {
+			t.Errorf("unexpected value for %v: %v, %v", key, v, err)
+		}
+	}
+}
+
+func TestRandomGetIFPresent(t *testing.T) {
+	testGetIFPresent(t, TYPE_RANDOM)
+}
+
+func TestRandomEvictionDistribution(t *testing.T) {
+	evicted := make(map[interface{}]int)
+	for i := 0; i < 200; i++ {
+		cc := New(4).Random().EvictedFunc(func(key, value interface{}) {
+			evicted[key]++
+		}).Build()
+		for j := 0; j < 5; j++ {
+			cc.Set(j, j)
+		}
+	}
+	// Every resident entry should be a candidate for eviction.
+	for j := 0; j < 4; j++ {
+		if evicted[j] == 0 {
+			t.Errorf("key %v was never evicted", j)
+		}
+	}
+	if evicted[4] != 0 {
+		t.Errorf("newly added key should not be evicted")
+	}
+}
+
+func TestRandomEvictSkipsPinned(t *testing.T) {
+	cc := New(2).Random().Build()
+	cc.Set(1, 1)
+	cc.Set(2, 2)
+	cc.Pin(1)
+	cc.Set(3, 3)
+	if _, err := cc.Get(1); err != nil {
+		t.Error("pinned key should not be evicted")
+	}
+	if _, err := cc.Get(2); err != ErrKeyNotFoundError {
+		t.Error("unpinned key should be evicted")
+	}
+}
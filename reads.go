@@ -0,0 +1,129 @@
+package xcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readBufferSize is the number of hits a readIndex buffers before it tries to
+// apply them to the eviction policy.
+const readBufferSize = 64
+
+// readIndex lets a cache built with LockFreeReads serve read hits without its lock.
+//
+// Every value returned by a locked lookup is published in entries, together with
+// the time at which it expires. Anything that may change the value or shorten
+// its lifetime forgets the published entry under the lock, so a published entry
+// is valid until it expires. A hit on a published entry is recorded in a lossy
+// buffer and applied to the eviction policy later, by a locked lookup or by the
+// reader that fills the buffer if the lock happens to be free. Hits that are
+// overwritten before they are applied do not change the eviction order.
+type readIndex struct {
+	entries sync.Map // key -> *readEntry
+	buffer  [readBufferSize]atomic.Value
+	next    uint64
+	// idle holds the keys with a max idle time. Their hits must be recorded
+	// under the lock, so they are never published. Guarded by the cache lock.
+	idle map[interface{}]struct{}
+}
+
+// readEntry is a published value. It is never modified once published.
+type readEntry struct {
+	key      interface{}
+	value    interface{}
+	deadline int64 // unix nanoseconds after which the entry is expired, or 0
+}
+
+func newReadIndex() *readIndex {
+	return &readIndex{idle: make(map[interface{}]struct{})}
+}
+
+// record buffers a hit on e and reports whether the buffer has been filled.
+func (r *readIndex) record(e *readEntry) bool {
+	n := atomic.AddUint64(&r.next, 1)
+	r.buffer[(n-1)%readBufferSize].Store(e)
+	return n%readBufferSize == 0
+}
+
+// drain calls fn for each buffered hit and empties the buffer.
+func (r *readIndex) drain(fn func(key interface{})) {
+	for i := range r.buffer {
+		if e, _ := r.buffer[i].Load().(*readEntry); e != nil {
+			r.buffer[i].Store((*readEntry)(nil))
+			fn(e.key)
+		}
+	}
+}
+
+// readUnlocked returns the published value of key, counting the hit.
+// Returns false if key has no valid published value, in which case the caller
+// must look it up under the lock with readLocked.
+func (c *baseCache) readUnlocked(key interface{}, onLoad bool, lookup func(interface{}, bool) (interface{}, error)) (interface{}, bool) {
+	if c.reads == nil || onLoad {
+		return nil, false
+	}
+	v, ok := c.reads.entries.Load(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*readEntry)
+	if e.deadline != 0 && c.clock.Now().UnixNano() > e.deadline {
+		return nil, false
+	}
+	c.stats.IncrHitCount()
+	if c.reads.record(e) && c.mu.TryLock() {
+		c.applyReads(lookup)
+		c.unlock()
+	}
+	return e.value, true
+}
+
+// readLocked looks key up with the lookup function of the cache and publishes
+// the value it returns, if the cache serves reads without its lock.
+// The caller must hold the lock.
+func (c *baseCache) readLocked(key interface{}, onLoad bool, lookup func(interface{}, bool) (interface{}, error), deadlineOf func(interface{}) (time.Time, bool)) (interface{}, error) {
+	if c.reads == nil {
+		return lookup(key, onLoad)
+	}
+	c.applyReads(lookup)
+	v, err := lookup(key, onLoad)
+	if err != nil {
+		return nil, err
+	}
+	if _, idle := c.reads.idle[key]; !idle {
+		e := &readEntry{key: key, value: v}
+		if deadline, ok := deadlineOf(key); ok {
+			e.deadline = deadline.UnixNano()
+		}
+		c.reads.entries.Store(key, e)
+	}
+	return v, nil
+}
+
+// applyReads replays the buffered hits as lookups that do not count as hits,
+// so that the eviction policy sees them. The caller must hold the lock.
+func (c *baseCache) applyReads(lookup func(interface{}, bool) (interface{}, error)) {
+	c.reads.drain(func(key interface{}) {
+		lookup(key, true)
+	})
+}
+
+// forgetRead forgets the published value of key. The caller must hold the lock.
+func (c *baseCache) forgetRead(key interface{}) {
+	if c.reads != nil {
+		c.reads.entries.Delete(key)
+	}
+}
+
+// forgetReads forgets all published values. The caller must hold the lock.
+func (c *baseCache) forgetReads() {
+	if c.reads == nil {
+		return
+	}
+	c.reads.entries.Range(func(key, _ interface{}) bool {
+		c.reads.entries.Delete(key)
+		return true
+	})
+	c.reads.idle = make(map[interface{}]struct{})
+}
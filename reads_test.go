@@ -0,0 +1,134 @@
+package xcache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFreeReads(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			gc := New(10).EvictType(tp).Clock(clock).LockFreeReads().Build()
+			gc.Set(1, "a")
+			gc.SetWithExpire(2, "b", time.Second)
+			for i := 0; i < 3; i++ {
+				if v, err := gc.Get(1); err != nil || v != "a" {
+					t.Errorf("%v, %v", v, err)
+				}
+				if v, err := gc.Get(2); err != nil || v != "b" {
+					t.Errorf("%v, %v", v, err)
+				}
+			}
+			if n := gc.HitCount(); n != 6 {
+				t.Errorf("%v != %v", n, 6)
+			}
+
+			gc.Set(1, "A")
+			if v, err := gc.Get(1); err != nil || v != "A" {
+				t.Errorf("%v, %v", v, err)
+			}
+			gc.Remove(1)
+			if _, err := gc.Get(1); err != ErrKeyNotFoundError {
+				t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+			}
+			clock.Advance(2 * time.Second)
+			if _, err := gc.Get(2); err != ErrKeyNotFoundError {
+				t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+			}
+
+			gc.Set(3, "c")
+			gc.Get(3)
+			gc.Purge()
+			if _, err := gc.Get(3); err != ErrKeyNotFoundError {
+				t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+			}
+		})
+	}
+}
+
+func TestLockFreeReadsWithoutLock(t *testing.T) {
+	gc := New(10).LRU().LockFreeReads().Build()
+	gc.Set(1, "a")
+	gc.Get(1)
+
+	c := gc.(*LRUCache)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if v, err := gc.Get(1); err != nil || v != "a" {
+			t.Errorf("%v, %v", v, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a hit should not wait for the lock")
+	}
+}
+
+func TestLockFreeReadsEvictionOrder(t *testing.T) {
+	gc := New(3).LRU().LockFreeReads().Build()
+	for i := 1; i <= 3; i++ {
+		gc.Set(i, i)
+		gc.Get(i)
+	}
+	// a lock-free hit that is applied by the next locked lookup
+	gc.Get(1)
+	gc.Get(4)
+
+	gc.Set(4, 4)
+	if !gc.Has(1) {
+		t.Error("key 1 should not be evicted")
+	}
+	if gc.Has(2) {
+		t.Error("key 2 should be evicted")
+	}
+}
+
+func TestLockFreeReadsMaxIdle(t *testing.T) {
+	clock := NewFakeClock()
+	gc := New(10).LRU().Clock(clock).LockFreeReads().Build()
+	gc.SetWithExpireAndIdle(1, "a", 0, 2*time.Second)
+	for i := 0; i < 5; i++ {
+		clock.Advance(time.Second)
+		if _, err := gc.Get(1); err != nil {
+			t.Fatalf("%v: %v", i, err)
+		}
+	}
+
+	if _, err := New(10).MaxIdle(time.Second).LockFreeReads().BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+	if _, err := NewXCache[int, int](10).Expiration(time.Second).SlidingExpiration().LockFreeReads().BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+}
+
+func TestXCacheLockFreeReadsConcurrent(t *testing.T) {
+	xc := NewXCache[int, string](100).BucketCount(2).EvictType(TYPE_LRU).LockFreeReads().Build()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := (g + i) % 50
+				if i%10 == 0 {
+					xc.Set(key, fmt.Sprint(key))
+					continue
+				}
+				if v, err := xc.Get(key); err == nil && v != fmt.Sprint(key) {
+					t.Errorf("%v != %v", v, key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+package xcache
+
+import (
+	"time"
+)
+
+// RetryPolicy configures how failed loader calls are retried.
+// Retries happen inside the load of a key, so concurrent callers waiting
+// for the same key share a single retrying goroutine.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of loader calls per load, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the time to wait between retries, unless it is zero.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the backoff grows after each retry.
+	// Values below 1 are treated as 2.
+	Multiplier float64
+	// Retryable reports whether a loader error should be retried.
+	// If it is nil, all errors are retried.
+	Retryable func(error) bool
+}
+
+// retryable reports whether err should be retried after the given number of attempts.
+func (p *RetryPolicy) retryable(err error, attempts int) bool {
+	if attempts >= p.MaxAttempts {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// backoff returns the time to wait before the given retry, starting at 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
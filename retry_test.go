@@ -0,0 +1,107 @@
+package xcache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+	expected := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		160 * time.Millisecond,
+		320 * time.Millisecond,
+		640 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, want := range expected {
+		if got := p.backoff(i + 1); got != want {
+			t.Errorf("backoff(%v): %v != %v", i+1, got, want)
+		}
+	}
+
+	p.Multiplier = 3
+	if got := p.backoff(3); got != 90*time.Millisecond {
+		t.Errorf("%v != %v", got, 90*time.Millisecond)
+	}
+}
+
+func TestLoaderRetry(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	var calls int32
+	cc := New(8).
+		LRU().
+		LoaderRetry(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+		}).
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return nil, errUnavailable
+			}
+			return key, nil
+		}).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := cc.Get("key"); err != nil || v != "key" {
+				t.Errorf("%v, %v != key", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("%v != %v", n, 3)
+	}
+}
+
+func TestLoaderRetryGivesUp(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	errNotFound := errors.New("not found")
+	var calls int32
+	cc := New(8).
+		LRU().
+		LoaderRetry(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Retryable: func(err error) bool {
+				return err != errNotFound
+			},
+		}).
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			if key == "missing" {
+				return nil, errNotFound
+			}
+			return nil, errUnavailable
+		}).
+		Build()
+
+	if _, err := cc.Get("key"); err != errUnavailable {
+		t.Errorf("%v != %v", err, errUnavailable)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("%v != %v", n, 3)
+	}
+	if _, err := cc.Get("missing"); err != errNotFound {
+		t.Errorf("%v != %v", err, errNotFound)
+	}
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Errorf("non-retryable errors should not be retried: %v", n)
+	}
+}
@@ -0,0 +1,121 @@
+package xcache
+
+// ringMinSize is the initial number of slots of a ring.
+const ringMinSize = 8
+
+// ring is a growable ring buffer of values in insertion order.
+// Every value is addressed by the position it was pushed at, which the ring
+// reports through setPos and updates whenever it moves values.
+// Removing a value leaves a hole, which is skipped when walking the ring and
+// reclaimed once the ring wraps around it or grows.
+// The zero value of T marks a hole and must not be pushed.
+type ring[T comparable] struct {
+	slots  []T
+	first  uint64 // position of the oldest slot
+	next   uint64 // position of the next push
+	live   int
+	setPos func(v T, pos uint64)
+}
+
+// newRing returns a ring with room for at least size values before it grows.
+func newRing[T comparable](size int, setPos func(v T, pos uint64)) *ring[T] {
+	return &ring[T]{
+		slots:  make([]T, nextPowerOfTwo(maxInt(size, ringMinSize))),
+		setPos: setPos,
+	}
+}
+
+// Len returns the number of values in the ring.
+func (r *ring[T]) Len() int {
+	return r.live
+}
+
+func (r *ring[T]) at(pos uint64) *T {
+	return &r.slots[pos&uint64(len(r.slots)-1)]
+}
+
+// Push adds v as the newest value.
+func (r *ring[T]) Push(v T) {
+	if r.next-r.first == uint64(len(r.slots)) {
+		r.resize()
+	}
+	*r.at(r.next) = v
+	r.setPos(v, r.next)
+	r.next++
+	r.live++
+}
+
+// resize moves the values of a full ring to the front of a new slice, dropping
+// the holes, and doubles the slice unless at least half of it was holes.
+func (r *ring[T]) resize() {
+	size := len(r.slots)
+	if r.live > size/2 {
+		size *= 2
+	}
+	slots := make([]T, size)
+	var zero T
+	n := 0
+	for pos := r.first; pos < r.next; pos++ {
+		if v := *r.at(pos); v != zero {
+			slots[n] = v
+			r.setPos(v, uint64(n))
+			n++
+		}
+	}
+	r.slots = slots
+	r.first = 0
+	r.next = uint64(n)
+}
+
+// Remove removes the value at pos.
+func (r *ring[T]) Remove(pos uint64) {
+	var zero T
+	*r.at(pos) = zero
+	r.live--
+	for r.first < r.next && *r.at(r.first) == zero {
+		r.first++
+	}
+	for r.next > r.first && *r.at(r.next - 1) == zero {
+		r.next--
+	}
+}
+
+// Oldest returns the oldest value, or the zero value if the ring is empty.
+func (r *ring[T]) Oldest() T {
+	var zero T
+	if r.live == 0 {
+		return zero
+	}
+	return *r.at(r.first)
+}
+
+// Newest returns the newest value, or the zero value if the ring is empty.
+func (r *ring[T]) Newest() T {
+	var zero T
+	if r.live == 0 {
+		return zero
+	}
+	return *r.at(r.next - 1)
+}
+
+// Walk calls fn for each value from the oldest to the newest until fn returns false.
+// fn may remove the value it is called with.
+func (r *ring[T]) Walk(fn func(v T) bool) {
+	var zero T
+	for pos := r.first; pos < r.next; pos++ {
+		if v := *r.at(pos); v != zero && !fn(v) {
+			return
+		}
+	}
+}
+
+// Reset removes all values and keeps the slots for reuse.
+func (r *ring[T]) Reset() {
+	var zero T
+	for pos := r.first; pos < r.next; pos++ {
+		*r.at(pos) = zero
+	}
+	r.first = 0
+	r.next = 0
+	r.live = 0
+}
@@ -0,0 +1,92 @@
+package xcache
+
+import (
+	"reflect"
+	"testing"
+)
+
+type ringNode struct {
+	v   int
+	pos uint64
+}
+
+func ringValues(r *ring[*ringNode]) []int {
+	var vs []int
+	r.Walk(func(n *ringNode) bool {
+		vs = append(vs, n.v)
+		return true
+	})
+	return vs
+}
+
+func TestRing(t *testing.T) {
+	r := newRing(0, func(n *ringNode, pos uint64) { n.pos = pos })
+	if r.Oldest() != nil || r.Newest() != nil {
+		t.Fatal("an empty ring has no oldest or newest value")
+	}
+	nodes := make([]*ringNode, 100)
+	var want []int
+	for i := range nodes {
+		nodes[i] = &ringNode{v: i}
+		r.Push(nodes[i])
+		// remove every other value so that the ring both compacts and grows
+		if i%2 == 1 {
+			r.Remove(nodes[i-1].pos)
+			want = append(want, i)
+		}
+	}
+	if got := ringValues(r); !reflect.DeepEqual(got, want) {
+		t.Fatalf("%v != %v", got, want)
+	}
+	if n := r.Len(); n != 50 {
+		t.Errorf("%v != %v", n, 50)
+	}
+	if n := len(r.slots); n > 4*r.Len() {
+		t.Errorf("%v slots for %v values", n, r.Len())
+	}
+
+	r.Remove(nodes[1].pos)
+	r.Remove(nodes[99].pos)
+	if v := r.Oldest().v; v != 3 {
+		t.Errorf("%v != %v", v, 3)
+	}
+	if v := r.Newest().v; v != 97 {
+		t.Errorf("%v != %v", v, 97)
+	}
+
+	// values may be removed while walking
+	r.Walk(func(n *ringNode) bool {
+		r.Remove(n.pos)
+		return true
+	})
+	if n := r.Len(); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+	r.Push(nodes[0])
+	if got := ringValues(r); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("%v != %v", got, []int{0})
+	}
+}
+
+func TestRingReset(t *testing.T) {
+	r := newRing(100, func(n *ringNode, pos uint64) { n.pos = pos })
+	if n := len(r.slots); n != 128 {
+		t.Errorf("%v != %v", n, 128)
+	}
+	for i := 0; i < 10; i++ {
+		r.Push(&ringNode{v: i})
+	}
+	r.Reset()
+	if r.Len() != 0 || r.Oldest() != nil || len(r.slots) != 128 {
+		t.Errorf("%v values and %v slots after Reset", r.Len(), len(r.slots))
+	}
+	for _, slot := range r.slots {
+		if slot != nil {
+			t.Fatal("Reset should release the values")
+		}
+	}
+	r.Push(&ringNode{v: 1})
+	if got := ringValues(r); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("%v != %v", got, []int{1})
+	}
+}
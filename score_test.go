@@ -0,0 +1,108 @@
+package xcache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func recencyScore(key, value interface{}, meta EntryMeta) float64 {
+	if meta.LastAccess.IsZero() {
+		return float64(meta.Created.UnixNano())
+	}
+	return float64(meta.LastAccess.UnixNano())
+}
+
+func TestScoreGet(t *testing.T) {
+	size := 1000
+	gc := New(size).
+		ScoreFunc(recencyScore).
+		EvictedFunc(getSimpleEvictedFunc(t)).
+		Build()
+	testSetCache(t, gc, size)
+	testGetCache(t, gc, size)
+}
+
+func TestScoreEvictItem(t *testing.T) {
+	cacheSize := 10
+	numbers := 100
+	gc := New(cacheSize).
+		ScoreFunc(recencyScore).
+		LoaderFunc(loader).
+		Build()
+
+	for i := 0; i < numbers; i++ {
+		_, err := gc.Get(fmt.Sprintf("Key-%d", i))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if gc.Len(false) != cacheSize {
+		t.Errorf("Expected length is %v, not %v", cacheSize, gc.Len(false))
+	}
+}
+
+func TestScoreEvictsLowestScore(t *testing.T) {
+	gc := New(3).ScoreFunc(func(key, value interface{}, meta EntryMeta) float64 {
+		return float64(value.(int))
+	}).Build()
+	gc.Set("a", 5)
+	gc.Set("b", 1)
+	gc.Set("c", 3)
+
+	gc.Set("d", 4)
+	if _, err := gc.Get("b"); err != ErrKeyNotFoundError {
+		t.Error("entry with the lowest score should be evicted")
+	}
+
+	// Updating a value updates its score.
+	gc.Set("a", 0)
+	gc.Set("e", 2)
+	if _, err := gc.Get("a"); err != ErrKeyNotFoundError {
+		t.Error("entry with the lowest score should be evicted")
+	}
+}
+
+func TestScoreUsesEntryMeta(t *testing.T) {
+	fc := NewFakeClock()
+	gc := New(2).Clock(fc).ScoreFunc(func(key, value interface{}, meta EntryMeta) float64 {
+		return float64(meta.AccessCount)
+	}).Build()
+	gc.Set(1, 1)
+	gc.Set(2, 2)
+	gc.Get(1)
+	gc.Get(1)
+	gc.Get(2)
+
+	gc.Set(3, 3)
+	if _, err := gc.Get(2); err != ErrKeyNotFoundError {
+		t.Error("least accessed entry should be evicted")
+	}
+	if _, err := gc.Get(1); err != nil {
+		t.Errorf("most accessed entry should be kept: %v", err)
+	}
+}
+
+func TestScoreEvictSkipsPinned(t *testing.T) {
+	gc := New(2).ScoreFunc(func(key, value interface{}, meta EntryMeta) float64 {
+		return float64(value.(int))
+	}).Build()
+	gc.Set(1, 1)
+	gc.Set(2, 2)
+	gc.Pin(1)
+	gc.Set(3, 3)
+	if _, err := gc.Get(1); err != nil {
+		t.Error("pinned key should not be evicted")
+	}
+	if _, err := gc.Get(2); err != ErrKeyNotFoundError {
+		t.Error("unpinned key should be evicted")
+	}
+}
+
+func TestScoreFuncRequired(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Build should panic without a ScoreFunc")
+		}
+	}()
+	New(10).EvictType(TYPE_SCORE).Build()
+}
@@ -19,7 +19,10 @@ limitations under the License.
 // This module provides a duplicate function call suppression
 // mechanism.
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+)
 
 // call is an in-flight or completed Do call
 type call struct {
@@ -32,6 +35,7 @@ type call struct {
 // units of work can be executed with duplicate suppression.
 type Group struct {
 	cache Cache
+	stats *stats                // counts started and shared loads, if set
 	mu    sync.Mutex            // protects m
 	m     map[interface{}]*call // lazily initialized
 }
@@ -55,6 +59,9 @@ func (g *Group) Do(key interface{}, fn func() (interface{}, error), isWait bool)
 		if !isWait {
 			return nil, false, ErrKeyNotFoundError
 		}
+		if g.stats != nil {
+			g.stats.IncrSharedLoadCount()
+		}
 		c.wg.Wait()
 		return c.val, false, c.err
 	}
@@ -62,6 +69,9 @@ func (g *Group) Do(key interface{}, fn func() (interface{}, error), isWait bool)
 	c.wg.Add(1)
 	g.m[key] = c
 	g.mu.Unlock()
+	if g.stats != nil {
+		g.stats.IncrLoadCount()
+	}
 	if !isWait {
 		go g.call(c, key, fn)
 		return nil, false, ErrKeyNotFoundError
@@ -70,13 +80,20 @@ func (g *Group) Do(key interface{}, fn func() (interface{}, error), isWait bool)
 	return v, true, err
 }
 
-func (g *Group) call(c *call, key interface{}, fn func() (interface{}, error)) (interface{}, error) {
-	c.val, c.err = fn()
-	c.wg.Done()
+func (g *Group) call(c *call, key interface{}, fn func() (interface{}, error)) (v interface{}, err error) {
+	defer func() {
+		// Release the waiters even if fn panics.
+		if r := recover(); r != nil {
+			c.val, c.err = nil, fmt.Errorf("%w: %v", ErrLoaderPanic, r)
+		}
+		c.wg.Done()
 
-	g.mu.Lock()
-	delete(g.m, key)
-	g.mu.Unlock()
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
 
+		v, err = c.val, c.err
+	}()
+	c.val, c.err = fn()
 	return c.val, c.err
 }
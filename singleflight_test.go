@@ -86,3 +86,20 @@ func TestDoDupSuppress(t *testing.T) {
 		t.Errorf("number of calls = %d; want 1", got)
 	}
 }
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	g.cache = New(32).Build()
+	_, _, err := g.Do("key", func() (interface{}, error) {
+		panic("boom")
+	}, true)
+	if !errors.Is(err, ErrLoaderPanic) {
+		t.Errorf("Do error = %v", err)
+	}
+	v, _, err := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	}, true)
+	if err != nil || v != "bar" {
+		t.Errorf("Do = %v, %v; the group should not be wedged", v, err)
+	}
+}
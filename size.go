@@ -0,0 +1,130 @@
+package xcache
+
+import (
+	"reflect"
+	"sync"
+)
+
+// ReflectSize estimates the number of bytes used by key and value by walking
+// them with reflection. It counts the memory reachable through pointers, slices,
+// maps, strings and interfaces once, but not the overhead of the allocator or
+// of the internal structure of maps, so it underestimates the actual usage.
+// Use a SizeFunc that knows the stored types if a better estimate is needed.
+func ReflectSize(key, value interface{}) int {
+	seen := make(map[uintptr]bool)
+	return valueSize(reflect.ValueOf(key), seen) + valueSize(reflect.ValueOf(value), seen)
+}
+
+// ShallowSize estimates the number of bytes used by key and value without walking
+// them: it counts their own size, the bytes of strings and the backing arrays of
+// slices, the entries of maps and the values that pointers point to, but not the
+// memory referenced from there. It is much cheaper than ReflectSize and exact for
+// flat values such as strings, byte slices and structs without references.
+func ShallowSize(key, value interface{}) int {
+	return shallowSize(key) + shallowSize(value)
+}
+
+var (
+	stringSize = int(reflect.TypeOf("").Size())
+	sliceSize  = int(reflect.TypeOf([]byte(nil)).Size())
+)
+
+// typeSizes caches the size of the values of a type, which is the size of the
+// value itself for most types, and also of the element for pointers.
+var typeSizes sync.Map // map[reflect.Type]int
+
+// shallowSize returns the size of x and the memory it references directly.
+func shallowSize(x interface{}) int {
+	switch v := x.(type) {
+	case nil:
+		return 0
+	case string:
+		return stringSize + len(v)
+	case []byte:
+		return sliceSize + cap(v)
+	}
+	t := reflect.TypeOf(x)
+	size, ok := typeSizes.Load(t)
+	if !ok {
+		n := int(t.Size())
+		if t.Kind() == reflect.Ptr {
+			n += int(t.Elem().Size())
+		}
+		size, _ = typeSizes.LoadOrStore(t, n)
+	}
+	n := size.(int)
+	switch v := reflect.ValueOf(x); v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			n -= int(t.Elem().Size())
+		}
+	case reflect.String:
+		n += v.Len()
+	case reflect.Slice:
+		n += v.Cap() * int(t.Elem().Size())
+	case reflect.Map:
+		n += v.Len() * int(t.Key().Size()+t.Elem().Size())
+	}
+	return n
+}
+
+// valueSize returns the size of v including the memory it references.
+func valueSize(v reflect.Value, seen map[uintptr]bool) int {
+	if !v.IsValid() {
+		return 0
+	}
+	return int(v.Type().Size()) + referencedSize(v, seen)
+}
+
+// referencedSize returns the size of the memory referenced by v that has not been seen yet.
+func referencedSize(v reflect.Value, seen map[uintptr]bool) int {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return valueSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return valueSize(v.Elem(), seen)
+	case reflect.String:
+		return v.Len()
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := v.Cap() * int(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Array:
+		size := 0
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			size += valueSize(iter.Key(), seen) + valueSize(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		size := 0
+		for i := 0; i < v.NumField(); i++ {
+			size += referencedSize(v.Field(i), seen)
+		}
+		return size
+	}
+	return 0
+}
@@ -0,0 +1,218 @@
+package xcache
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+func TestReflectSize(t *testing.T) {
+	type node struct {
+		name string
+		next *node
+	}
+	n := &node{name: "abc"}
+	n.next = n
+
+	var (
+		str   = int(unsafe.Sizeof(""))
+		iface = int(unsafe.Sizeof(interface{}(nil)))
+		ptr   = int(unsafe.Sizeof(n))
+	)
+	cases := []struct {
+		key, value interface{}
+		size       int
+	}{
+		{nil, nil, 0},
+		{1, int32(2), 8 + 4},
+		{"key", "value", 2*str + 8},
+		{1, []byte("value"), 8 + int(unsafe.Sizeof([]byte{})) + 5},
+		{1, []string{"a", "bc"}, 8 + int(unsafe.Sizeof([]string{})) + 2*str + 3},
+		{1, [2]interface{}{1, "a"}, 8 + 2*iface + 8 + str + 1},
+		// A cycle is counted once.
+		{1, n, 8 + ptr + int(unsafe.Sizeof(*n)) + 3},
+	}
+	for i, cs := range cases {
+		if size := ReflectSize(cs.key, cs.value); size != cs.size {
+			t.Errorf("case-%v: %v != %v", i, size, cs.size)
+		}
+	}
+}
+
+func TestShallowSize(t *testing.T) {
+	type point struct{ x, y int64 }
+	var (
+		str   = int(unsafe.Sizeof(""))
+		slice = int(unsafe.Sizeof([]byte{}))
+		ptr   = int(unsafe.Sizeof(&point{}))
+	)
+	cases := []struct {
+		key, value interface{}
+		size       int
+	}{
+		{nil, nil, 0},
+		{1, int32(2), 8 + 4},
+		{"key", "value", 2*str + 8},
+		{1, make([]byte, 5, 8), 8 + slice + 8},
+		{1, []int32{1, 2}, 8 + slice + 8},
+		{1, point{}, 8 + 16},
+		{1, &point{}, 8 + ptr + 16},
+		{1, (*point)(nil), 8 + ptr},
+		{1, map[int32]int32{1: 1}, 8 + ptr + 8},
+		// Only the slice headers of the strings are counted, not their bytes.
+		{1, []string{"a", "bc"}, 8 + slice + 2*str},
+	}
+	for i := 0; i < 2; i++ { // the second time with cached type sizes
+		for j, cs := range cases {
+			if size := ShallowSize(cs.key, cs.value); size != cs.size {
+				t.Errorf("case-%v: %v != %v", j, size, cs.size)
+			}
+		}
+	}
+}
+
+func TestEstimatedBytes(t *testing.T) {
+	size := func(key, value interface{}) int {
+		return len(key.(string)) + len(value.(string))
+	}
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			cc := New(2).EvictType(tp).EstimateSize(size).Build()
+			cc.Set("a", "1")
+			cc.Set("b", "22")
+			if n := cc.EstimatedBytes(); n != 5 {
+				t.Errorf("%v != %v", n, 5)
+			}
+			cc.Set("a", "333")
+			if n := cc.EstimatedBytes(); n != 7 {
+				t.Errorf("%v != %v", n, 7)
+			}
+			cc.Remove("b")
+			if n := cc.EstimatedBytes(); n != 4 {
+				t.Errorf("%v != %v", n, 4)
+			}
+			cc.Set("c", "1")
+			cc.Set("d", "1")
+			var want int64
+			for k, v := range cc.GetALL(false) {
+				want += int64(size(k, v))
+			}
+			if n := cc.EstimatedBytes(); n != want {
+				t.Errorf("%v != %v", n, want)
+			}
+			cc.Purge()
+			if n := cc.EstimatedBytes(); n != 0 {
+				t.Errorf("%v != %v", n, 0)
+			}
+		})
+	}
+
+	if n := New(2).LRU().Build().EstimatedBytes(); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+}
+
+func TestXCacheEstimatedBytes(t *testing.T) {
+	xc := NewXCache[string, string](8).
+		BucketCount(4).
+		EstimateSize(func(key, value string) int {
+			return len(key) + len(value)
+		}).
+		Build()
+	xc.Set("a", "1")
+	xc.Set("bb", "22")
+	if n := xc.EstimatedBytes(); n != 6 {
+		t.Errorf("%v != %v", n, 6)
+	}
+	if n := xc.Stats().EstimatedBytes; n != 6 {
+		t.Errorf("%v != %v", n, 6)
+	}
+}
+
+func TestMaxCost(t *testing.T) {
+	weigher := func(key, value interface{}) int64 {
+		return int64(len(value.(string)))
+	}
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			cc := New(100).EvictType(tp).Weigher(weigher).MaxCost(10).Build()
+			for i := 0; i < 5; i++ {
+				cc.Set(i, "abc")
+			}
+			if n, l := cc.Cost(), cc.Len(false); n != 9 || l != 3 {
+				t.Errorf("%v, %v != %v, %v", n, l, 9, 3)
+			}
+			cc.Set(5, "abcdefgh")
+			if n, l := cc.Cost(), cc.Len(false); n > 10 || !cc.Has(5) {
+				t.Errorf("cost %v with %v entries", n, l)
+			}
+			cc.Set(6, "abcdefghijkl")
+			if n, l := cc.Cost(), cc.Len(false); n != 12 || l != 1 {
+				t.Errorf("%v, %v != %v, %v", n, l, 12, 1)
+			}
+			cc.Purge()
+			if n := cc.Cost(); n != 0 {
+				t.Errorf("%v != %v", n, 0)
+			}
+		})
+	}
+
+	if _, err := New(10).Weigher(weigher).MaxCost(-1).BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+	if _, err := New(10).MaxCost(10).BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("%v != %v", err, ErrInvalidConfig)
+	}
+}
+
+func TestXCacheMaxCost(t *testing.T) {
+	cache := NewXCache[int, string](100).
+		BucketCount(4).
+		Weigher(func(key int, value string) int64 {
+			return int64(len(value))
+		}).
+		MaxCost(30).
+		Build()
+	for i := 0; i < 100; i++ {
+		cache.Set(i, "abc")
+	}
+	if n, l := cache.Cost(), cache.Len(false); n != 30 || l != 10 {
+		t.Errorf("%v, %v != %v, %v", n, l, 30, 10)
+	}
+	if n := cache.Stats().Cost; n != 30 {
+		t.Errorf("%v != %v", n, 30)
+	}
+	if err := cache.Rebucket(8); err != nil {
+		t.Fatal(err)
+	}
+	if n, c := cache.builder.cost.used, cache.Cost(); n != c {
+		t.Errorf("%v != %v", n, c)
+	}
+	cache.Purge()
+	if n := cache.builder.cost.used; n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	cc := New(100).LRU().MaxBytes(int64(10 * ShallowSize(0, "abc"))).Build()
+	for i := 0; i < 20; i++ {
+		cc.Set(i, "abc")
+	}
+	if n := cc.Len(false); n != 10 {
+		t.Errorf("%v != %v", n, 10)
+	}
+	if n, b := cc.Cost(), cc.EstimatedBytes(); n != b {
+		t.Errorf("%v != %v", n, b)
+	}
+
+	xc := NewXCache[int, string](100).BucketCount(4).MaxBytes(int64(10 * ShallowSize(0, "abc"))).Build()
+	for i := 0; i < 20; i++ {
+		xc.Set(i, "abc")
+	}
+	if n := xc.Len(false); n != 10 {
+		t.Errorf("%v != %v", n, 10)
+	}
+}
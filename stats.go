@@ -2,6 +2,7 @@ package xcache
 
 import (
 	"sync/atomic"
+	"time"
 )
 
 type statsAccessor interface {
@@ -9,32 +10,142 @@ type statsAccessor interface {
 	MissCount() uint64
 	LookupCount() uint64
 	HitRate() float64
+	LoadCount() uint64
+	SharedLoadCount() uint64
+	EvictionCount() uint64
+	ExpirationCount() uint64
+	RemovalCount() uint64
+	ReplacementCount() uint64
+	LoadLatency() LatencyHistogram
+	CallbackCount() uint64
+	CallbackTime() time.Duration
+	LockCount() uint64
+	LockContentionCount() uint64
+	LockWaitTime() time.Duration
+}
+
+// CacheStats is a snapshot of the statistics of an XCache.
+type CacheStats struct {
+	// Hits and Misses count the lookups of the XCache, or the lookups of its
+	// buckets with StatsFromBuckets.
+	Hits    uint64
+	Misses  uint64
+	Lookups uint64
+	HitRate float64
+	// Evictions counts the entries that have been evicted to make room for other entries.
+	Evictions uint64
+	// Expirations counts the entries that have been removed because they have expired.
+	Expirations uint64
+	// Removals counts the entries that have been removed explicitly, for example by Remove.
+	Removals uint64
+	// Replacements counts the values that have been overwritten by a new value for the same key.
+	Replacements uint64
+	// Entries is the number of entries that have not expired.
+	Entries int
+	// EstimatedBytes is the estimated memory used by the entries, if sizes are estimated.
+	EstimatedBytes int64
+	// Cost is the total weight of the entries, if a Weigher is set.
+	Cost int64
+	// CallbackTime is the total time spent in EvictedFunc, ExpiredFunc, AddedFunc and SerializeFunc.
+	CallbackTime time.Duration
+	// LoadLatency is the histogram of the durations of the loads of all buckets.
+	LoadLatency LatencyHistogram
+	// LockContentions and LockWaitTime sum up the lock contention of the buckets,
+	// if LockProfiling is enabled.
+	LockContentions uint64
+	LockWaitTime    time.Duration
+	// BucketCount is the number of buckets, and AutoBuckets reports whether
+	// it has been chosen by AutoBucketCount because no bucket count was set.
+	BucketCount int
+	AutoBuckets bool
+	Buckets     []BucketStats
+}
+
+// BucketStats is a snapshot of the statistics of a bucket of an XCache.
+type BucketStats struct {
+	Entries        int
+	Hits           uint64
+	Misses         uint64
+	HitRate        float64
+	Loads          uint64
+	SharedLoads    uint64
+	Evictions      uint64
+	Expirations    uint64
+	Removals       uint64
+	Replacements   uint64
+	EstimatedBytes int64
+	Cost           int64
+	CallbackTime   time.Duration
+	// Locks counts the acquisitions of the lock of the bucket, LockContentions
+	// those that had to wait for another goroutine, and LockWaitTime is the
+	// total time spent waiting. They are only recorded with LockProfiling.
+	Locks           uint64
+	LockContentions uint64
+	LockWaitTime    time.Duration
+}
+
+// BucketBalance describes how evenly the entries and lookups of an XCache
+// are distributed over its buckets.
+type BucketBalance struct {
+	// MinLen, MaxLen, MeanLen and StdDevLen describe the number of entries
+	// stored in the buckets, including expired entries that have not been removed yet.
+	MinLen    int
+	MaxLen    int
+	MeanLen   float64
+	StdDevLen float64
+	// HottestBucket is the index of the bucket with the most lookups.
+	HottestBucket int
+	// HottestLookups is the number of lookups of the hottest bucket.
+	HottestLookups uint64
+	// MeanLookups is the mean number of lookups per bucket.
+	MeanLookups float64
 }
 
 // statistics
 type stats struct {
-	hitCount  uint64
-	missCount uint64
+	// hitCount, missCount and lockCount are updated by every lookup, so they
+	// are striped to avoid contention between cores.
+	hitCount            stripedCounter
+	missCount           stripedCounter
+	loadCount           uint64
+	sharedLoadCount     uint64
+	evictionCount       uint64
+	expirationCount     uint64
+	removalCount        uint64
+	replacementCount    uint64
+	callbackCount       uint64
+	callbackTime        int64
+	lockCount           stripedCounter
+	lockContentionCount uint64
+	lockWaitTime        int64
+	loadLatencies       *latencyHistogram
+	telemetry           Telemetry // also records hits and misses, if set
 }
 
 // increment hit count
 func (st *stats) IncrHitCount() uint64 {
-	return atomic.AddUint64(&st.hitCount, 1)
+	if st.telemetry != nil {
+		st.telemetry.RecordHit()
+	}
+	return st.hitCount.add(1)
 }
 
 // increment miss count
 func (st *stats) IncrMissCount() uint64 {
-	return atomic.AddUint64(&st.missCount, 1)
+	if st.telemetry != nil {
+		st.telemetry.RecordMiss()
+	}
+	return st.missCount.add(1)
 }
 
 // HitCount returns hit count
 func (st *stats) HitCount() uint64 {
-	return atomic.LoadUint64(&st.hitCount)
+	return st.hitCount.load()
 }
 
 // MissCount returns miss count
 func (st *stats) MissCount() uint64 {
-	return atomic.LoadUint64(&st.missCount)
+	return st.missCount.load()
 }
 
 // LookupCount returns lookup count
@@ -51,3 +162,95 @@ func (st *stats) HitRate() float64 {
 	}
 	return float64(hc) / float64(total)
 }
+
+// increment load count
+func (st *stats) IncrLoadCount() uint64 {
+	return atomic.AddUint64(&st.loadCount, 1)
+}
+
+// increment shared load count
+func (st *stats) IncrSharedLoadCount() uint64 {
+	return atomic.AddUint64(&st.sharedLoadCount, 1)
+}
+
+// LoadCount returns the number of loads that have been started
+func (st *stats) LoadCount() uint64 {
+	return atomic.LoadUint64(&st.loadCount)
+}
+
+// SharedLoadCount returns the number of gets that have waited for a load
+// started by another get instead of starting one
+func (st *stats) SharedLoadCount() uint64 {
+	return atomic.LoadUint64(&st.sharedLoadCount)
+}
+
+// increment eviction count
+func (st *stats) IncrEvictionCount() uint64 {
+	return atomic.AddUint64(&st.evictionCount, 1)
+}
+
+// increment expiration count
+func (st *stats) IncrExpirationCount() uint64 {
+	return atomic.AddUint64(&st.expirationCount, 1)
+}
+
+// EvictionCount returns the number of entries that have been evicted
+// to make room for other entries
+func (st *stats) EvictionCount() uint64 {
+	return atomic.LoadUint64(&st.evictionCount)
+}
+
+// ExpirationCount returns the number of entries that have been removed
+// because they have expired
+func (st *stats) ExpirationCount() uint64 {
+	return atomic.LoadUint64(&st.expirationCount)
+}
+
+// increment removal count
+func (st *stats) IncrRemovalCount() uint64 {
+	return atomic.AddUint64(&st.removalCount, 1)
+}
+
+// increment replacement count
+func (st *stats) IncrReplacementCount() uint64 {
+	return atomic.AddUint64(&st.replacementCount, 1)
+}
+
+// RemovalCount returns the number of entries that have been removed explicitly,
+// for example by Remove, GetAndRemove or RemoveIf
+func (st *stats) RemovalCount() uint64 {
+	return atomic.LoadUint64(&st.removalCount)
+}
+
+// ReplacementCount returns the number of values that have been overwritten
+// by a new value for the same key
+func (st *stats) ReplacementCount() uint64 {
+	return atomic.LoadUint64(&st.replacementCount)
+}
+
+// LoadLatency returns the histogram of the durations of loader calls,
+// including their retries
+func (st *stats) LoadLatency() LatencyHistogram {
+	if st.loadLatencies == nil {
+		return LatencyHistogram{}
+	}
+	return st.loadLatencies.snapshot()
+}
+
+// record the time spent in a callback
+func (st *stats) addCallbackTime(d time.Duration) {
+	atomic.AddUint64(&st.callbackCount, 1)
+	atomic.AddInt64(&st.callbackTime, int64(d))
+}
+
+// CallbackCount returns the number of calls of EvictedFunc, ExpiredFunc,
+// AddedFunc and SerializeFunc
+func (st *stats) CallbackCount() uint64 {
+	return atomic.LoadUint64(&st.callbackCount)
+}
+
+// CallbackTime returns the total time spent in EvictedFunc, ExpiredFunc,
+// AddedFunc and SerializeFunc
+func (st *stats) CallbackTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&st.callbackTime))
+}
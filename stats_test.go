@@ -1,7 +1,9 @@
 package xcache
 
 import (
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestStats(t *testing.T) {
@@ -140,3 +142,319 @@ func TestCacheStats(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadCount(t *testing.T) {
+	release := make(chan struct{})
+	cc := New(32).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			<-release
+			return key, nil
+		}).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cc.Get("key")
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for cc.LoadCount()+cc.SharedLoadCount() < 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	cc.Get("key")
+
+	if n := cc.LoadCount(); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+	if n := cc.SharedLoadCount(); n != 9 {
+		t.Errorf("%v != %v", n, 9)
+	}
+}
+
+func TestXCacheLoadCount(t *testing.T) {
+	xc := NewXCache[int, int](32).
+		BucketCount(4).
+		LoaderFunc(func(key int) (int, error) {
+			return key, nil
+		}).
+		Build()
+	for i := 0; i < 8; i++ {
+		xc.Get(i)
+		xc.Get(i)
+	}
+	if n := xc.LoadCount(); n != 8 {
+		t.Errorf("%v != %v", n, 8)
+	}
+	var total uint64
+	for _, s := range xc.GetBucketStats() {
+		total += s["load_count"].(uint64)
+	}
+	if total != 8 {
+		t.Errorf("%v != %v", total, 8)
+	}
+}
+
+func TestEvictionAndExpirationCount(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			cc := New(4).EvictType(tp).Clock(clock).Build()
+			for i := 0; i < 10; i++ {
+				cc.Set(i, i)
+			}
+			cc.Remove(9)
+			if n := cc.EvictionCount(); n != 6 {
+				t.Errorf("evictions: %v != %v", n, 6)
+			}
+
+			cc.SetWithExpire("key", "value", time.Second)
+			evictions := cc.EvictionCount()
+			clock.Advance(2 * time.Second)
+			if cc.DeleteExpired() != 1 {
+				t.Fatal("expired entry should be deleted")
+			}
+			if n := cc.ExpirationCount(); n != 1 {
+				t.Errorf("expirations: %v != %v", n, 1)
+			}
+			if n := cc.EvictionCount(); n != evictions {
+				t.Errorf("evictions: %v != %v", n, evictions)
+			}
+		})
+	}
+}
+
+func TestXCacheStats(t *testing.T) {
+	xc := NewXCache[int, int](2).
+		BucketCount(2).
+		Build()
+	for i := 0; i < 8; i++ {
+		xc.Set(i, i)
+	}
+	xc.Get(7)
+	xc.Get(100)
+
+	cs := xc.Stats()
+	if cs.Hits != 1 || cs.Misses != 1 || cs.Lookups != 2 || cs.HitRate != 0.5 {
+		t.Errorf("lookups: %+v", cs)
+	}
+	if len(cs.Buckets) != 2 {
+		t.Fatalf("%v != %v", len(cs.Buckets), 2)
+	}
+	if cs.Entries != xc.Len(true) {
+		t.Errorf("entries: %v != %v", cs.Entries, xc.Len(true))
+	}
+	xc.Set(7, 70)
+	xc.Remove(7)
+	cs = xc.Stats()
+	if cs.Replacements != 1 || cs.Removals != 1 {
+		t.Errorf("replacements/removals: %v/%v != %v/%v", cs.Replacements, cs.Removals, 1, 1)
+	}
+	if cs.Evictions != uint64(7-cs.Entries) {
+		t.Errorf("evictions: %v != %v", cs.Evictions, 8-cs.Entries)
+	}
+	var entries int
+	var evictions uint64
+	for _, bs := range cs.Buckets {
+		entries += bs.Entries
+		evictions += bs.Evictions
+	}
+	if entries != cs.Entries || evictions != cs.Evictions {
+		t.Errorf("buckets: %v/%v != %v/%v", entries, evictions, cs.Entries, cs.Evictions)
+	}
+
+	for i, bs := range xc.BucketStats() {
+		if bs != cs.Buckets[i] {
+			t.Errorf("bucket %v: %+v != %+v", i, bs, cs.Buckets[i])
+		}
+	}
+}
+
+func TestRemovalAndReplacementCount(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		t.Run(tp, func(t *testing.T) {
+			cc := New(8).EvictType(tp).Build()
+			for i := 0; i < 4; i++ {
+				cc.Set(i, i)
+			}
+			cc.Set(0, "new")
+			cc.Set(1, "new")
+			cc.Remove(2)
+			cc.GetAndRemove(3)
+			cc.Remove("missing")
+
+			if n := cc.ReplacementCount(); n != 2 {
+				t.Errorf("replacements: %v != %v", n, 2)
+			}
+			if n := cc.RemovalCount(); n != 2 {
+				t.Errorf("removals: %v != %v", n, 2)
+			}
+			if n := cc.EvictionCount(); n != 0 {
+				t.Errorf("evictions: %v != %v", n, 0)
+			}
+			if n := cc.ExpirationCount(); n != 0 {
+				t.Errorf("expirations: %v != %v", n, 0)
+			}
+		})
+	}
+}
+
+func TestXCacheBucketBalance(t *testing.T) {
+	xc := NewXCache[int, int](64).
+		BucketCount(4).
+		Build()
+	for i := 0; i < 40; i++ {
+		xc.Set(i, i)
+	}
+	for i := 0; i < 10; i++ {
+		xc.Get(7)
+	}
+
+	b := xc.BucketBalance()
+	if b.MeanLen != 10 {
+		t.Errorf("mean: %v != %v", b.MeanLen, 10)
+	}
+	if b.MinLen > 10 || b.MaxLen < 10 || (b.MinLen == b.MaxLen) != (b.StdDevLen == 0) {
+		t.Errorf("unexpected lengths: %+v", b)
+	}
+	if b.HottestBucket != xc.GetBucketIndex(7) || b.HottestLookups != 10 || b.MeanLookups != 2.5 {
+		t.Errorf("unexpected lookups: %+v", b)
+	}
+}
+
+func TestCallbackTime(t *testing.T) {
+	sleep := func(key, value interface{}) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cc := New(8).
+		LRU().
+		AddedFunc(sleep).
+		EvictedFunc(sleep).
+		SerializeFunc(func(key, value interface{}) (interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return value, nil
+		}).
+		Build()
+	cc.Set("key", "value")
+	cc.Remove("key")
+
+	if n := cc.CallbackCount(); n != 3 {
+		t.Errorf("%v != %v", n, 3)
+	}
+	if d := cc.CallbackTime(); d < 15*time.Millisecond {
+		t.Errorf("%v should be at least %v", d, 15*time.Millisecond)
+	}
+}
+
+func TestLockProfiling(t *testing.T) {
+	cc := New(8).LRU().LockProfiling().Build()
+	cc.Set("key", "value")
+	if n := cc.LockCount(); n == 0 {
+		t.Errorf("%v should be positive", n)
+	}
+	if n := cc.LockContentionCount(); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+
+	c := cc.(*LRUCache)
+	c.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		cc.Get("key")
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.mu.Unlock()
+	<-done
+
+	if n := cc.LockContentionCount(); n != 1 {
+		t.Errorf("%v != %v", n, 1)
+	}
+	if d := cc.LockWaitTime(); d < 10*time.Millisecond {
+		t.Errorf("%v should be at least %v", d, 10*time.Millisecond)
+	}
+
+	if n := New(8).LRU().Build().LockCount(); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+}
+
+func TestXCacheLockProfiling(t *testing.T) {
+	xc := NewXCache[int, int](8).BucketCount(2).LockProfiling().Build()
+	xc.Set(1, 1)
+
+	stats := xc.Stats()
+	var locks uint64
+	for _, bs := range stats.Buckets {
+		locks += bs.Locks
+	}
+	if locks == 0 {
+		t.Errorf("%v should be positive", locks)
+	}
+	if stats.LockContentions != 0 || stats.LockWaitTime != 0 {
+		t.Errorf("%v, %v != 0, 0", stats.LockContentions, stats.LockWaitTime)
+	}
+}
+
+func TestXCacheStatsFromBuckets(t *testing.T) {
+	loader := func(key int) (int, error) {
+		return key, nil
+	}
+	for _, fromBuckets := range []bool{false, true} {
+		builder := NewXCache[int, int](8).BucketCount(2).LoaderFunc(loader)
+		if fromBuckets {
+			builder.StatsFromBuckets()
+		}
+		xc := builder.Build()
+		xc.Set(1, 1)
+		xc.Get(1)
+		xc.Get(2) // loaded
+		xc.GetIFPresent(3)
+
+		stats := xc.Stats()
+		want := [2]uint64{2, 1}
+		if fromBuckets {
+			want = [2]uint64{1, 2}
+		}
+		if stats.Hits != want[0] || stats.Misses != want[1] {
+			t.Errorf("%v, %v != %v, %v", stats.Hits, stats.Misses, want[0], want[1])
+		}
+		if xc.HitCount() != stats.Hits || xc.MissCount() != stats.Misses || xc.LookupCount() != stats.Lookups {
+			t.Errorf("%v, %v, %v != %v", xc.HitCount(), xc.MissCount(), xc.LookupCount(), stats)
+		}
+	}
+}
+
+func TestStripedCounter(t *testing.T) {
+	var c stripedCounter
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := c.load(); n != 32000 {
+		t.Errorf("%v != %v", n, 32000)
+	}
+}
+
+func BenchmarkStatsIncrHitCount(b *testing.B) {
+	st := &stats{}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			st.IncrHitCount()
+		}
+	})
+}
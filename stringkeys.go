@@ -0,0 +1,75 @@
+package xcache
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// RemoveByPrefix removes all entries whose key starts with prefix
+// and returns the number of removed entries.
+// It is intended for namespaced keys such as "user:42", where
+// RemoveByPrefix(cache, "user:") invalidates the whole namespace.
+func RemoveByPrefix[K ~string, V any](xc *XCache[K, V], prefix string) int {
+	return xc.RemoveIf(func(key K, _ V) bool {
+		return strings.HasPrefix(string(key), prefix)
+	})
+}
+
+// KeysMatching returns the unexpired keys that match the glob pattern.
+// In the pattern, '*' matches any sequence of characters and '?' matches
+// any single character, e.g. "session:*:tenant42".
+func KeysMatching[K ~string, V any](xc *XCache[K, V], pattern string) []K {
+	re := compileGlob(pattern)
+	var keys []K
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	for _, bucket := range xc.allBuckets() {
+		for _, k := range bucket.Keys(true) {
+			if key, ok := k.(K); ok && re.MatchString(string(key)) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// RemoveMatching removes all entries whose key matches the glob pattern
+// and returns the number of removed entries.
+// See KeysMatching for the pattern syntax.
+func RemoveMatching[K ~string, V any](xc *XCache[K, V], pattern string) int {
+	re := compileGlob(pattern)
+	return xc.RemoveIf(func(key K, _ V) bool {
+		return re.MatchString(string(key))
+	})
+}
+
+// compileGlob converts a glob pattern into an anchored regular expression.
+func compileGlob(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// keyString returns key as a string if its underlying type is string.
+func keyString(key interface{}) (string, bool) {
+	if s, ok := key.(string); ok {
+		return s, true
+	}
+	v := reflect.ValueOf(key)
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
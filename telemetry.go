@@ -0,0 +1,18 @@
+package xcache
+
+import "time"
+
+// Telemetry receives the hits and misses of a cache and wraps its loader calls,
+// so that they can be exported to a monitoring system, see
+// CacheBuilder.WithTelemetry. Package xotel implements it with OpenTelemetry,
+// as a module of its own, so that xcache does not depend on OpenTelemetry.
+// Its methods are called concurrently.
+type Telemetry interface {
+	// RecordHit is called for every lookup that finds its key.
+	RecordHit()
+	// RecordMiss is called for every lookup that misses its key.
+	RecordMiss()
+	// TraceLoad is called for every loader call for key. It must call load once
+	// and return its results.
+	TraceLoad(key interface{}, load func() (interface{}, *time.Duration, error)) (interface{}, *time.Duration, error)
+}
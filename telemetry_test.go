@@ -0,0 +1,78 @@
+package xcache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingTelemetry counts the hits, misses and loads it receives.
+type countingTelemetry struct {
+	mu                  sync.Mutex
+	hits, misses, loads int
+	keys                []interface{}
+}
+
+func (t *countingTelemetry) RecordHit() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hits++
+}
+
+func (t *countingTelemetry) RecordMiss() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.misses++
+}
+
+func (t *countingTelemetry) TraceLoad(key interface{}, load func() (interface{}, *time.Duration, error)) (interface{}, *time.Duration, error) {
+	t.mu.Lock()
+	t.loads++
+	t.keys = append(t.keys, key)
+	t.mu.Unlock()
+	return load()
+}
+
+func TestWithTelemetry(t *testing.T) {
+	tm := &countingTelemetry{}
+	loadErr := errors.New("load failed")
+	cc := New(32).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			if key == "bad" {
+				return nil, loadErr
+			}
+			return key, nil
+		}).
+		WithTelemetry(tm).
+		Build()
+
+	cc.Get("key")
+	cc.Get("key")
+	if _, err := cc.Get("bad"); err != loadErr {
+		t.Errorf("%v != %v", err, loadErr)
+	}
+	if tm.hits != 1 || tm.misses != 2 || tm.loads != 2 {
+		t.Errorf("%v/%v/%v != 1/2/2", tm.hits, tm.misses, tm.loads)
+	}
+	if len(tm.keys) != 2 || tm.keys[0] != "key" || tm.keys[1] != "bad" {
+		t.Errorf("%v != [key bad]", tm.keys)
+	}
+}
+
+func TestXCacheWithTelemetry(t *testing.T) {
+	tm := &countingTelemetry{}
+	xc := NewXCache[string, string](32).
+		LRU().
+		WithTelemetry(tm).
+		Build()
+	defer xc.Close()
+
+	xc.Set("a", "1")
+	xc.Get("a")
+	xc.Get("b")
+	if tm.hits != 1 || tm.misses != 1 {
+		t.Errorf("%v/%v != 1/1", tm.hits, tm.misses)
+	}
+}
@@ -0,0 +1,215 @@
+package xcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Tier is a lower tier of a cache: the cache moves the entries it evicts to the
+// tier and looks up the keys it misses in it, see CacheBuilder.VictimCache and
+// Tiered. Every Cache is a Tier, and so can be any other store, such as Redis.
+// GetWithExpiration must return ErrKeyNotFoundError if key is not present.
+type Tier interface {
+	GetWithExpiration(key interface{}) (interface{}, *time.Time, error)
+	Set(key, value interface{}) error
+	SetWithExpire(key, value interface{}, expiration time.Duration) error
+	Remove(key interface{}) bool
+}
+
+// XTier is a Tier with typed keys and values, such as an XCache.
+type XTier[K comparable, V any] interface {
+	GetWithExpiration(key K) (V, *time.Time, error)
+	Set(key K, value V) error
+	SetWithExpire(key K, value V, expiration time.Duration) error
+	Remove(key K) bool
+}
+
+// xTier adapts an XTier to a Tier.
+type xTier[K comparable, V any] struct {
+	tier XTier[K, V]
+}
+
+func (t xTier[K, V]) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, nil, ErrKeyNotFoundError
+	}
+	v, expiration, err := t.tier.GetWithExpiration(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, expiration, nil
+}
+
+func (t xTier[K, V]) Set(key, value interface{}) error {
+	return t.tier.Set(key.(K), value.(V))
+}
+
+func (t xTier[K, V]) SetWithExpire(key, value interface{}, expiration time.Duration) error {
+	return t.tier.SetWithExpire(key.(K), value.(V), expiration)
+}
+
+func (t xTier[K, V]) Remove(key interface{}) bool {
+	k, ok := key.(K)
+	return ok && t.tier.Remove(k)
+}
+
+// TierStats are the counters of a tiered cache.
+type TierStats struct {
+	// L1Hits and L1Misses count the lookups in the first tier. The misses include
+	// the lookups that have been served by the second tier.
+	L1Hits   uint64
+	L1Misses uint64
+	// L2Hits and L2Misses count the lookups in the second tier after a miss in the
+	// first one. Every hit promotes the entry to the first tier.
+	L2Hits   uint64
+	L2Misses uint64
+	// Demotions counts the entries that the first tier has evicted to the second.
+	Demotions uint64
+}
+
+// countingTier counts the lookups in and the entries moved to a second tier.
+type countingTier struct {
+	Tier
+	hits      uint64
+	misses    uint64
+	demotions uint64
+}
+
+func (t *countingTier) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	v, expiration, err := t.Tier.GetWithExpiration(key)
+	if err != nil {
+		atomic.AddUint64(&t.misses, 1)
+	} else {
+		atomic.AddUint64(&t.hits, 1)
+	}
+	return v, expiration, err
+}
+
+func (t *countingTier) Set(key, value interface{}) error {
+	atomic.AddUint64(&t.demotions, 1)
+	return t.Tier.Set(key, value)
+}
+
+func (t *countingTier) SetWithExpire(key, value interface{}, expiration time.Duration) error {
+	atomic.AddUint64(&t.demotions, 1)
+	return t.Tier.SetWithExpire(key, value, expiration)
+}
+
+// stats returns the counters of the tiers, with those of the first tier taken from l1.
+func (t *countingTier) stats(l1 interface {
+	HitCount() uint64
+	MissCount() uint64
+}) TierStats {
+	return TierStats{
+		L1Hits:    l1.HitCount(),
+		L1Misses:  l1.MissCount(),
+		L2Hits:    atomic.LoadUint64(&t.hits),
+		L2Misses:  atomic.LoadUint64(&t.misses),
+		Demotions: atomic.LoadUint64(&t.demotions),
+	}
+}
+
+// setVictim replaces the victim cache of the cache.
+func (c *baseCache) setVictim(victim Tier) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.victim = victim
+}
+
+// TieredCache combines a small, fast cache with a larger or remote second tier.
+// Each entry lives in one tier: the first tier demotes the entries it evicts to
+// the second, and Get and GetIFPresent promote the entries they find in the second
+// tier back to the first, before LoaderFunc is called. Every method that writes
+// a key to the first tier removes it from the second, once the lock of the first
+// tier has been released, so that the second tier does not serve an outdated
+// value; Remove and GetAndRemove also remove keys that are only present in the
+// second tier. The other methods only concern the first tier.
+type TieredCache struct {
+	Cache
+	l2 *countingTier
+}
+
+// Tiered returns a cache with l1 as the first tier and l2 as the second tier,
+// which replaces the VictimCache of l1, if any. l1 must not be used on its own afterwards.
+func Tiered(l1 Cache, l2 Tier) *TieredCache {
+	t := &countingTier{Tier: l2}
+	l1.setVictim(t)
+	return &TieredCache{Cache: l1, l2: t}
+}
+
+// Remove removes the specified key from both tiers.
+// Returns true if the key was present in either tier.
+func (t *TieredCache) Remove(key interface{}) bool {
+	removed := t.Cache.Remove(key)
+	return t.l2.Tier.Remove(key) || removed
+}
+
+// GetAndRemove removes the specified key from both tiers and returns its value.
+// Returns false if the key was present in neither tier.
+func (t *TieredCache) GetAndRemove(key interface{}) (interface{}, bool) {
+	if v, ok := t.Cache.GetAndRemove(key); ok {
+		t.l2.Tier.Remove(key)
+		return v, true
+	}
+	v, _, err := t.l2.Tier.GetWithExpiration(key)
+	if err != nil {
+		return nil, false
+	}
+	t.l2.Tier.Remove(key)
+	return v, true
+}
+
+// TierStats returns the counters of both tiers.
+func (t *TieredCache) TierStats() TierStats {
+	return t.l2.stats(t.Cache)
+}
+
+// TieredXCache is the TieredCache of an XCache.
+type TieredXCache[K comparable, V any] struct {
+	*XCache[K, V]
+	l2 *countingTier
+}
+
+// TieredX returns an XCache with l1 as the first tier and l2, such as another
+// XCache, as the second tier, which replaces the VictimCache of l1, if any.
+// See TieredCache. l1 must not be used on its own afterwards.
+func TieredX[K comparable, V any](l1 *XCache[K, V], l2 XTier[K, V]) *TieredXCache[K, V] {
+	t := &countingTier{Tier: xTier[K, V]{tier: l2}}
+	l1.mu.Lock()
+	defer l1.mu.Unlock()
+	// buckets created by Rebucket get the tier from the builder
+	l1.builder.victim = t
+	for _, bucket := range l1.allBuckets() {
+		bucket.setVictim(t)
+	}
+	return &TieredXCache[K, V]{XCache: l1, l2: t}
+}
+
+// Remove removes the specified key from both tiers.
+// Returns true if the key was present in either tier.
+func (t *TieredXCache[K, V]) Remove(key K) bool {
+	removed := t.XCache.Remove(key)
+	return t.l2.Tier.Remove(key) || removed
+}
+
+// GetAndRemove removes the specified key from both tiers and returns its value.
+// Returns false if the key was present in neither tier.
+func (t *TieredXCache[K, V]) GetAndRemove(key K) (V, bool) {
+	if v, ok := t.XCache.GetAndRemove(key); ok {
+		t.l2.Tier.Remove(key)
+		return v, true
+	}
+	v, _, err := t.l2.Tier.GetWithExpiration(key)
+	if err != nil {
+		var zero V
+		return zero, false
+	}
+	t.l2.Tier.Remove(key)
+	return v.(V), true
+}
+
+// TierStats returns the counters of both tiers.
+func (t *TieredXCache[K, V]) TierStats() TierStats {
+	return t.l2.stats(t.XCache)
+}
@@ -0,0 +1,141 @@
+package xcache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTiered(t *testing.T) {
+	l2 := New(100).LRU().Build()
+	tc := Tiered(New(2).LRU().Build(), l2)
+	for i := 0; i < 5; i++ {
+		tc.Set(i, i)
+	}
+	if l1, l2 := tc.Len(false), l2.Len(false); l1 != 2 || l2 != 3 {
+		t.Errorf("%v, %v != 2, 3", l1, l2)
+	}
+	// promote on hit, demote on evict
+	if v, err := tc.Get(0); err != nil || v != 0 {
+		t.Errorf("%v, %v != %v", v, err, 0)
+	}
+	if !tc.Has(0) || l2.Has(0) || !l2.Has(3) {
+		t.Errorf("%v, %v, %v != true, false, true", tc.Has(0), l2.Has(0), l2.Has(3))
+	}
+	if _, err := tc.Get(10); err != ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+	}
+	want := TierStats{L1Hits: 0, L1Misses: 2, L2Hits: 1, L2Misses: 1, Demotions: 4}
+	if s := tc.TierStats(); s != want {
+		t.Errorf("%+v != %+v", s, want)
+	}
+
+	// a write hides the outdated value of the second tier
+	tc.Set(1, "new")
+	if l2.Has(1) {
+		t.Error("the second tier should not hold a written key")
+	}
+	if !tc.Remove(2) || l2.Has(2) {
+		t.Error("the key should be removed from both tiers")
+	}
+	if v, ok := tc.GetAndRemove(3); !ok || v != 3 || l2.Has(3) {
+		t.Errorf("%v, %v != %v, true", v, ok, 3)
+	}
+}
+
+func TestTieredX(t *testing.T) {
+	l2 := NewXCache[string, int](100).BucketCount(1).Build()
+	tc := TieredX[string, int](NewXCache[string, int](1).BucketCount(2).Build(), l2)
+	for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		tc.Set(k, len(k))
+	}
+	if n := tc.Len(false) + l2.Len(false); n != 6 {
+		t.Errorf("%v != %v", n, 6)
+	}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		if v, err := tc.Get(k); err != nil || v != 1 {
+			t.Errorf("%v, %v != %v", v, err, 1)
+		}
+	}
+	if s := tc.TierStats(); s.L2Hits == 0 || s.Demotions == 0 {
+		t.Errorf("%+v", s)
+	}
+	// buckets created by Rebucket keep the second tier
+	if err := tc.Rebucket(4); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"g", "h", "i", "j", "k", "l"} {
+		tc.Set(k, 2)
+	}
+	if n := tc.Len(false) + l2.Len(false); n != 12 {
+		t.Errorf("%v != %v", n, 12)
+	}
+}
+
+func TestTieredXWrites(t *testing.T) {
+	src := NewXCache[string, int](10).Build()
+	src.Set("k", 2)
+	var saved, exported bytes.Buffer
+	if err := src.SaveTo(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.ExportJSON(&exported); err != nil {
+		t.Fatal(err)
+	}
+	for name, write := range map[string]func(tc *TieredXCache[string, int]) error{
+		"Set":           func(tc *TieredXCache[string, int]) error { return tc.Set("k", 2) },
+		"SetWithExpire": func(tc *TieredXCache[string, int]) error { return tc.SetWithExpire("k", 2, time.Hour) },
+		"SetWithExpireAndIdle": func(tc *TieredXCache[string, int]) error {
+			return tc.SetWithExpireAndIdle("k", 2, time.Hour, time.Hour)
+		},
+		"SetMulti": func(tc *TieredXCache[string, int]) error { return tc.SetMulti(map[string]int{"k": 2}) },
+		"SetIfAbsent": func(tc *TieredXCache[string, int]) error {
+			_, err := tc.SetIfAbsent("k", 2)
+			return err
+		},
+		"Swap": func(tc *TieredXCache[string, int]) error {
+			_, _, err := tc.Swap("k", 2)
+			return err
+		},
+		"SetIfVersion": func(tc *TieredXCache[string, int]) error {
+			_, err := tc.SetIfVersion("k", 2, 0)
+			return err
+		},
+		"Increment": func(tc *TieredXCache[string, int]) error {
+			_, err := Increment(tc.XCache, "k", 2)
+			return err
+		},
+		"Warm":       func(tc *TieredXCache[string, int]) error { return tc.Warm(map[string]int{"k": 2}) },
+		"LoadFrom":   func(tc *TieredXCache[string, int]) error { return tc.LoadFrom(bytes.NewReader(saved.Bytes())) },
+		"ImportJSON": func(tc *TieredXCache[string, int]) error { return tc.ImportJSON(bytes.NewReader(exported.Bytes())) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			l2 := NewXCache[string, int](100).Build()
+			tc := TieredX[string, int](NewXCache[string, int](10).Build(), l2)
+			// an outdated value that the first tier has demoted
+			l2.Set("k", 1)
+			if err := write(tc); err != nil {
+				t.Fatal(err)
+			}
+			if l2.Has("k") {
+				t.Error("k should have been removed from the second tier")
+			}
+			tc.XCache.Remove("k")
+			if v, err := tc.Get("k"); err == nil {
+				t.Errorf("%v: outdated value served", v)
+			}
+		})
+	}
+}
+
+func TestTieredXAppend(t *testing.T) {
+	l2 := NewXCache[string, []int](100).Build()
+	tc := TieredX[string, []int](NewXCache[string, []int](10).Build(), l2)
+	l2.Set("k", []int{1})
+	if _, err := Append(tc.XCache, "k", 2); err != nil {
+		t.Fatal(err)
+	}
+	if l2.Has("k") {
+		t.Error("k should have been removed from the second tier")
+	}
+}
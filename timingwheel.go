@@ -0,0 +1,130 @@
+package xcache
+
+import (
+	"time"
+)
+
+const (
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 4
+)
+
+// timingWheel is a hierarchical timing wheel that keeps track of when keys expire.
+// Level i of the wheel has wheelSlots slots spanning 64^i ticks each, so scheduling
+// a key and collecting the keys that are due both take amortized constant time.
+//
+// The wheel only records expiration times. Keys that have been removed or whose
+// expiration has changed in the meantime must be validated by the cache when they are due.
+type timingWheel struct {
+	tick      time.Duration
+	current   int64 // the last tick that has been processed
+	slots     [wheelLevels][wheelSlots][]wheelEntry
+	counts    [wheelLevels]int
+	scheduled map[interface{}]int64
+}
+
+type wheelEntry struct {
+	key  interface{}
+	tick int64
+}
+
+func newTimingWheel(tick time.Duration, now time.Time) *timingWheel {
+	tw := &timingWheel{tick: tick}
+	tw.reset(now)
+	return tw
+}
+
+// reset removes all scheduled keys.
+func (tw *timingWheel) reset(now time.Time) {
+	tw.current = tw.tickOf(now)
+	tw.slots = [wheelLevels][wheelSlots][]wheelEntry{}
+	tw.counts = [wheelLevels]int{}
+	tw.scheduled = make(map[interface{}]int64)
+}
+
+func (tw *timingWheel) tickOf(t time.Time) int64 {
+	return t.UnixNano() / int64(tw.tick)
+}
+
+// schedule records that key expires at expiration.
+// The key becomes due at the first tick that starts after expiration, or earlier
+// if it has already been scheduled for an earlier time. Keys that become due
+// too early have to be rescheduled.
+func (tw *timingWheel) schedule(key interface{}, expiration time.Time) {
+	tick := tw.tickOf(expiration) + 1
+	if tick <= tw.current {
+		tick = tw.current + 1
+	}
+	if pending, ok := tw.scheduled[key]; ok && pending <= tick {
+		return
+	}
+	tw.scheduled[key] = tick
+	tw.insert(wheelEntry{key: key, tick: tick})
+}
+
+func (tw *timingWheel) insert(e wheelEntry) {
+	delta := e.tick - tw.current
+	level := 0
+	for level < wheelLevels-1 && delta >= int64(1)<<(wheelBits*(level+1)) {
+		level++
+	}
+	slot := (e.tick >> (wheelBits * level)) & wheelMask
+	tw.slots[level][slot] = append(tw.slots[level][slot], e)
+	tw.counts[level]++
+}
+
+// advance moves the wheel forward to now and returns the keys that became due.
+func (tw *timingWheel) advance(now time.Time) []interface{} {
+	var due []interface{}
+	target := tw.tickOf(now)
+	for tw.current < target {
+		// Skip ticks at which nothing can fire or cascade.
+		level := 0
+		for level < wheelLevels && tw.counts[level] == 0 {
+			level++
+		}
+		if level == wheelLevels {
+			tw.current = target
+			break
+		}
+		if level > 0 {
+			span := int64(1) << (wheelBits * level)
+			next := (tw.current/span + 1) * span
+			if next > target {
+				tw.current = target
+				break
+			}
+			tw.current = next - 1
+		}
+
+		t := tw.current + 1
+		// Cascade the entries of higher levels whose slot starts at t.
+		for level := wheelLevels - 1; level > 0; level-- {
+			if t&(int64(1)<<(wheelBits*level)-1) != 0 {
+				continue
+			}
+			slot := (t >> (wheelBits * level)) & wheelMask
+			entries := tw.slots[level][slot]
+			tw.slots[level][slot] = nil
+			tw.counts[level] -= len(entries)
+			for _, e := range entries {
+				tw.insert(e)
+			}
+		}
+
+		slot := t & wheelMask
+		entries := tw.slots[0][slot]
+		tw.slots[0][slot] = nil
+		tw.counts[0] -= len(entries)
+		for _, e := range entries {
+			if tick, ok := tw.scheduled[e.key]; ok && tick == e.tick {
+				delete(tw.scheduled, e.key)
+				due = append(due, e.key)
+			}
+		}
+		tw.current = t
+	}
+	return due
+}
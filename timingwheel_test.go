@@ -0,0 +1,81 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimingWheelAdvance(t *testing.T) {
+	start := time.Date(1984, time.April, 4, 0, 0, 0, 0, time.UTC)
+	tw := newTimingWheel(time.Second, start)
+
+	// Delays that land on every level of the wheel and beyond.
+	delays := []time.Duration{
+		500 * time.Millisecond,
+		3 * time.Second,
+		63 * time.Second,
+		64 * time.Second,
+		100 * time.Second,
+		time.Hour,
+		30 * time.Hour,
+		200 * time.Hour,
+	}
+	for i, d := range delays {
+		tw.schedule(i, start.Add(d))
+	}
+
+	now := start
+	fired := make(map[interface{}]time.Time)
+	for step := 0; len(fired) < len(delays) && step < 1000000; step++ {
+		now = now.Add(time.Second)
+		for _, key := range tw.advance(now) {
+			if _, ok := fired[key]; ok {
+				t.Fatalf("key %v fired twice", key)
+			}
+			fired[key] = now
+		}
+	}
+	for i, d := range delays {
+		at, ok := fired[i]
+		if !ok {
+			t.Fatalf("key %v never fired", i)
+		}
+		expiration := start.Add(d)
+		if !at.After(expiration) || at.Sub(expiration) > time.Second {
+			t.Errorf("key %v expiring at %v fired at %v", i, expiration, at)
+		}
+	}
+}
+
+func TestTimingWheelReschedule(t *testing.T) {
+	start := time.Date(1984, time.April, 4, 0, 0, 0, 0, time.UTC)
+	tw := newTimingWheel(time.Second, start)
+	tw.schedule("key", start.Add(time.Minute))
+	tw.schedule("key", start.Add(5*time.Second))
+	tw.schedule("key", start.Add(time.Hour))
+
+	// The earliest schedule wins.
+	if due := tw.advance(start.Add(10 * time.Second)); len(due) != 1 || due[0] != "key" {
+		t.Fatalf("unexpected due keys: %v", due)
+	}
+	if due := tw.advance(start.Add(2 * time.Minute)); len(due) != 0 {
+		t.Fatalf("key should only be due once: %v", due)
+	}
+
+	tw.schedule("key", start.Add(time.Hour))
+	if due := tw.advance(start.Add(2 * time.Hour)); len(due) != 1 || due[0] != "key" {
+		t.Fatalf("unexpected due keys: %v", due)
+	}
+}
+
+func TestTimingWheelLargeJump(t *testing.T) {
+	start := time.Date(1984, time.April, 4, 0, 0, 0, 0, time.UTC)
+	tw := newTimingWheel(time.Millisecond, start)
+	for i := 0; i < 100; i++ {
+		tw.schedule(i, start.Add(time.Duration(i)*time.Hour))
+	}
+	due := tw.advance(start.Add(1000 * time.Hour))
+	if len(due) != 100 {
+		t.Errorf("%v != 100", len(due))
+	}
+}
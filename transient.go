@@ -0,0 +1,48 @@
+package xcache
+
+import "unsafe"
+
+// transientGetter is implemented by the caches that can look up a key that
+// lives on the stack of the caller.
+type transientGetter interface {
+	get(key interface{}, onLoad bool) (interface{}, error)
+	getWithLoader(key interface{}, isWait bool) (interface{}, error)
+	// storedKey returns the key that the entry of key was stored with. It must
+	// not retain key, which may be on the stack of the caller.
+	storedKey(key interface{}) (interface{}, bool)
+}
+
+// getTransient looks key up in the bucket without boxing it on the heap, if
+// the bucket allows it and key is present, and loads it with LoaderFunc if it
+// has expired, like Get. Returns false if the bucket must be called with a
+// boxed key instead.
+//
+// The key on the stack is only used to find the key the cache stored, which
+// is on the heap; the lookup itself, and everything it may retain the key for,
+// such as DeserializeFunc, admission, promotion queues and loads, only ever
+// sees keys on the heap.
+func getTransient[K comparable](bucket Cache, key K) (interface{}, bool, error) {
+	g, ok := bucket.(transientGetter)
+	if !ok {
+		return nil, false, nil
+	}
+	var boxed interface{} = key
+	stored, ok := g.storedKey(*(*interface{})(noescape(unsafe.Pointer(&boxed))))
+	if !ok {
+		return nil, false, nil
+	}
+	v, err := g.get(stored, false)
+	if err == ErrKeyNotFoundError {
+		v, err = g.getWithLoader(stored, true)
+	}
+	return v, true, err
+}
+
+// noescape hides p from escape analysis, so that the value it points to may
+// stay on the stack. It is only safe if the callee does not retain p.
+//
+//go:nosplit
+func noescape(p unsafe.Pointer) unsafe.Pointer {
+	x := uintptr(p)
+	return *(*unsafe.Pointer)(unsafe.Pointer(&x))
+}
@@ -0,0 +1,93 @@
+package xcache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLGet(t *testing.T) {
+	size := 1000
+	gc := buildTestCache(t, TYPE_TTL, size)
+	testSetCache(t, gc, size)
+	testGetCache(t, gc, size)
+}
+
+func TestLoadingTTLGet(t *testing.T) {
+	size := 1000
+	gc := buildTestLoadingCache(t, TYPE_TTL, size, loader)
+	testGetCache(t, gc, size)
+}
+
+func TestTTLEvictItem(t *testing.T) {
+	cacheSize := 10
+	numbers := 100
+	gc := buildTestLoadingCache(t, TYPE_TTL, cacheSize, loader)
+
+	for i := 0; i < numbers; i++ {
+		_, err := gc.Get(fmt.Sprintf("Key-%d", i))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if gc.Len(false) != cacheSize {
+		t.Errorf("Expected length is %v, not %v", cacheSize, gc.Len(false))
+	}
+}
+
+func TestTTLGetIFPresent(t *testing.T) {
+	testGetIFPresent(t, TYPE_TTL)
+}
+
+func TestTTLEvictsSoonestExpiring(t *testing.T) {
+	fc := NewFakeClock()
+	gc := New(3).TTL().Clock(fc).Build()
+	gc.Set("forever", 0)
+	gc.SetWithExpire("late", 1, 3*time.Minute)
+	gc.SetWithExpire("soon", 2, time.Minute)
+
+	gc.SetWithExpire("next", 3, 2*time.Minute)
+	if _, err := gc.Get("soon"); err != ErrKeyNotFoundError {
+		t.Error("entry expiring soonest should be evicted")
+	}
+
+	// Extending the expiration reorders the entry.
+	gc.SetExpiration("next", 10*time.Minute)
+	gc.Set("other", 4)
+	if _, err := gc.Get("late"); err != ErrKeyNotFoundError {
+		t.Error("entry expiring soonest should be evicted")
+	}
+
+	// Entries without an expiration are evicted last.
+	gc.SetWithExpire("again", 5, time.Hour)
+	if _, err := gc.Get("next"); err != ErrKeyNotFoundError {
+		t.Error("entry expiring soonest should be evicted")
+	}
+	for _, key := range []string{"forever", "other", "again"} {
+		if _, err := gc.Get(key); err != nil {
+			t.Errorf("key %v should still be cached: %v", key, err)
+		}
+	}
+}
+
+func TestTTLEvictSkipsPinned(t *testing.T) {
+	fc := NewFakeClock()
+	gc := New(2).TTL().Clock(fc).Build()
+	gc.SetWithExpire(1, 1, time.Minute)
+	gc.SetWithExpire(2, 2, time.Hour)
+	gc.Pin(1)
+	gc.SetWithExpire(3, 3, 2*time.Hour)
+	if _, err := gc.Get(1); err != nil {
+		t.Error("pinned key should not be evicted")
+	}
+	if _, err := gc.Get(2); err != ErrKeyNotFoundError {
+		t.Error("unpinned key expiring soonest should be evicted")
+	}
+
+	gc.Remove(1)
+	gc.SetWithExpire(4, 4, time.Minute)
+	gc.Set(5, 5)
+	if _, err := gc.Get(4); err != ErrKeyNotFoundError {
+		t.Error("key 4 should be evicted")
+	}
+}
@@ -0,0 +1,917 @@
+package xcache
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// typedBucket is implemented by the buckets of an XCache that store its keys and
+// values unboxed, so that the XCache reads and writes them without boxing them
+// into interface{} values and asserting their types.
+type typedBucket[K comparable, V any] interface {
+	// getTyped returns the value of key like Get.
+	getTyped(key K) (V, error)
+	// setTyped sets the value of key like Set.
+	setTyped(key K, value V) error
+	// setTypedWithExpire sets the value of key like SetWithExpire.
+	setTypedWithExpire(key K, value V, expiration time.Duration) error
+}
+
+// typedLRUCache is an LRUCache for the keys and values of an XCache, which it
+// stores unboxed in a map[K] of generic entries. The Cache methods convert the
+// keys and values they are passed to K and V, and return ErrUnsupportedKey for
+// keys of other types. The XCache builds it for LRU buckets that neither store
+// serialized values nor serve reads without the lock, see typedBuckets.
+//
+// The keys and values are boxed only for the features that keep them, such as
+// expirations, callbacks, events and the victim cache, see tracksEntries.
+type typedLRUCache[K comparable, V any] struct {
+	baseCache
+	items     map[K]*lruNode[K, V]
+	evictList lruNodeList[K, V]
+}
+
+var _ typedBucket[string, int] = (*typedLRUCache[string, int])(nil)
+
+func newTypedLRUCache[K comparable, V any](cb *CacheBuilder) *typedLRUCache[K, V] {
+	c := &typedLRUCache[K, V]{}
+	buildCache(&c.baseCache, cb)
+	c.eventExpiration = c.expirationOf
+
+	c.init()
+	c.loadGroup.cache = c
+	c.startJanitor(c.DeleteExpired)
+	c.startTrimmer(c.shrink)
+	c.watchMemory(c.shrink)
+	return c
+}
+
+// typedValue returns value as a V, which it is if it is nil and V is an interface type.
+func typedValue[V any](value interface{}) (V, bool) {
+	v, ok := value.(V)
+	if !ok && value == nil {
+		ok = reflect.TypeOf(&v).Elem().Kind() == reflect.Interface
+	}
+	return v, ok
+}
+
+func (c *typedLRUCache[K, V]) init() {
+	c.evictList.Init()
+	if c.items != nil {
+		for k := range c.items {
+			delete(c.items, k)
+		}
+	} else {
+		c.items = make(map[K]*lruNode[K, V], c.size+1)
+	}
+}
+
+// typed converts key and value to K and V.
+func (c *typedLRUCache[K, V]) typed(key, value interface{}) (K, V, error) {
+	k, ok := key.(K)
+	if !ok {
+		var v V
+		return k, v, ErrUnsupportedKey
+	}
+	v, ok := typedValue[V](value)
+	if !ok {
+		return k, v, fmt.Errorf("xcache: value of type %T is not supported by the bucket", value)
+	}
+	return k, v, nil
+}
+
+func (c *typedLRUCache[K, V]) set(key K, value V) (*lruNode[K, V], error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	if deadline, ok := c.deadline(key); ok && deadline.Before(c.clock.Now()) {
+		c.removeExpired(key, c.remove)
+	}
+	if c.admission != nil {
+		if err := c.admit(key, c.has(key, nil)); err != nil {
+			return nil, err
+		}
+	}
+	if c.maxCost > 0 {
+		c.fitCost(key, value, func() { c.evict(1) })
+	}
+
+	// Check for existing item
+	item, ok := c.items[key]
+	if ok {
+		c.evictList.MoveToFront(item)
+		if c.tracksEntries() {
+			c.notifyReplaced(key, item.value, value)
+		} else {
+			c.IncrReplacementCount()
+		}
+		item.value = value
+	} else {
+		// Verify size not exceeded
+		if c.full(c.evictList.Len()) {
+			c.evict(c.evictionBatch())
+		}
+		item = &lruNode[K, V]{
+			clock:      c.clock,
+			key:        key,
+			value:      value,
+			accessInfo: newAccessInfo(c.clock.Now()),
+		}
+		c.items[key] = c.evictList.PushFront(item)
+		if c.tracksEntries() {
+			c.notifyAdded(key, value)
+		} else {
+			c.countEntries(1)
+		}
+	}
+
+	item.version = c.nextVersion()
+	if c.restartTimers(&item.accessInfo) {
+		c.scheduleExpiration(key, item.used.Add(item.maxIdle))
+	}
+	if c.expiration != nil {
+		c.expire(item, *c.expiration)
+	}
+
+	if c.addedFunc != nil {
+		c.callAdded(key, value)
+	}
+
+	return item, nil
+}
+
+// expire makes item expire after expiration. The caller must hold the lock.
+func (c *typedLRUCache[K, V]) expire(item *lruNode[K, V], expiration time.Duration) {
+	t := c.clock.Now().Add(expiration)
+	item.expiration = &t
+	c.scheduleExpiration(item.key, t)
+}
+
+// setTyped sets the value of key.
+func (c *typedLRUCache[K, V]) setTyped(key K, value V) error {
+	c.mu.Lock()
+	defer c.unlock()
+	_, err := c.set(key, value)
+	return err
+}
+
+// setTypedWithExpire sets the value of key with an expiration time.
+func (c *typedLRUCache[K, V]) setTypedWithExpire(key K, value V, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	item, err := c.set(key, value)
+	if err != nil {
+		return err
+	}
+	c.expire(item, expiration)
+	return nil
+}
+
+// set a new key-value pair
+func (c *typedLRUCache[K, V]) Set(key, value interface{}) error {
+	k, v, err := c.typed(key, value)
+	if err != nil {
+		return err
+	}
+	return c.setTyped(k, v)
+}
+
+// Set a new key-value pair with an expiration time
+func (c *typedLRUCache[K, V]) SetWithExpire(key, value interface{}, expiration time.Duration) error {
+	k, v, err := c.typed(key, value)
+	if err != nil {
+		return err
+	}
+	return c.setTypedWithExpire(k, v, expiration)
+}
+
+// SetWithExpireAndIdle sets a new key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (c *typedLRUCache[K, V]) SetWithExpireAndIdle(key, value interface{}, expiration, maxIdle time.Duration) error {
+	k, v, err := c.typed(key, value)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	item, err := c.set(k, v)
+	if err != nil {
+		return err
+	}
+
+	if expiration > 0 {
+		c.expire(item, expiration)
+	} else {
+		item.expiration = nil
+	}
+	c.setMaxIdle(k, &item.accessInfo, maxIdle)
+	return nil
+}
+
+// SetIfAbsent sets a new key-value pair only if the key is not present in the cache.
+func (c *typedLRUCache[K, V]) SetIfAbsent(key, value interface{}) (bool, error) {
+	return c.setIfAbsent(key, value, nil)
+}
+
+// SetIfAbsentWithExpire sets a new key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (c *typedLRUCache[K, V]) SetIfAbsentWithExpire(key, value interface{}, expiration time.Duration) (bool, error) {
+	return c.setIfAbsent(key, value, &expiration)
+}
+
+func (c *typedLRUCache[K, V]) setIfAbsent(key, value interface{}, expiration *time.Duration) (bool, error) {
+	k, v, err := c.typed(key, value)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.has(k, nil) {
+		return false, nil
+	}
+	item, err := c.set(k, v)
+	if err != nil {
+		return false, err
+	}
+	if expiration != nil {
+		c.expire(item, *expiration)
+	}
+	return true, nil
+}
+
+// setMulti sets the specified key-value pairs, acquiring the lock only once.
+// If expiration is not nil, it is applied to every pair.
+func (c *typedLRUCache[K, V]) setMulti(items map[interface{}]interface{}, expiration *time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, value := range items {
+		k, v, err := c.typed(key, value)
+		if err != nil {
+			return err
+		}
+		item, err := c.set(k, v)
+		if err == ErrNotAdmitted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if expiration != nil {
+			c.expire(item, *expiration)
+		}
+	}
+	return nil
+}
+
+// getTyped returns the value of key, loading it with LoaderFunc if it is not present.
+func (c *typedLRUCache[K, V]) getTyped(key K) (V, error) {
+	c.mu.Lock()
+	v, err := c.lookupKey(key, false)
+	c.unlock()
+	if err != ErrKeyNotFoundError || (c.loaderExpireFunc == nil && c.victim == nil) {
+		return v, err
+	}
+	value, err := c.getWithLoader(key, true)
+	if err != nil {
+		if _, ok := err.(*StaleError); !ok {
+			var zero V
+			return zero, err
+		}
+	}
+	v, ok := typedValue[V](value)
+	if !ok && err == nil {
+		err = fmt.Errorf("xcache: value of type %T is not supported by the bucket", value)
+	}
+	return v, err
+}
+
+// Get a value from cache pool using key if it exists.
+// If it does not exists key and has LoaderFunc,
+// generate a value using `LoaderFunc` method returns value.
+func (c *typedLRUCache[K, V]) Get(key interface{}) (interface{}, error) {
+	v, err := c.get(key, false)
+	if err == ErrKeyNotFoundError {
+		return c.getWithLoader(key, true)
+	}
+	return v, err
+}
+
+// GetIFPresent gets a value from cache pool using key if it exists.
+// If it does not exists key, returns KeyNotFoundError.
+// And send a request which refresh value for specified key if cache object has LoaderFunc.
+func (c *typedLRUCache[K, V]) GetIFPresent(key interface{}) (interface{}, error) {
+	v, err := c.get(key, false)
+	if err == ErrKeyNotFoundError {
+		return c.getWithLoader(key, false)
+	}
+	return v, err
+}
+
+// GetWithExpiration gets a value from cache pool using key if it exists,
+// together with the time at which it expires.
+// The returned time is nil if the value never expires.
+// LoaderFunc is not invoked if the key does not exist.
+func (c *typedLRUCache[K, V]) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, nil, ErrKeyNotFoundError
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	v, err := c.lookupKey(k, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var expiration *time.Time
+	if exp := c.items[k].expiration; exp != nil {
+		t := *exp
+		expiration = &t
+	}
+	return v, expiration, nil
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet.
+// It neither resurrects expired values nor updates eviction state or statistics.
+func (c *typedLRUCache[K, V]) GetStale(key interface{}) (interface{}, bool) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, ok := c.items[k]
+	if !ok {
+		return nil, false
+	}
+	return item.value, true
+}
+
+// Info returns the metadata of the specified key without updating
+// any eviction algorithm statistics or positions.
+func (c *typedLRUCache[K, V]) Info(key interface{}) (EntryInfo, bool) {
+	k, ok := key.(K)
+	if !ok {
+		return EntryInfo{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.has(k, nil) {
+		return EntryInfo{}, false
+	}
+	item := c.items[k]
+	return newEntryInfo(item.accessInfo, item.expiration, item.pinned, ""), true
+}
+
+// GetVersioned gets a value from cache pool using key if it exists, together with its version.
+// The version is 0 if the key does not exist. LoaderFunc is not invoked.
+func (c *typedLRUCache[K, V]) GetVersioned(key interface{}) (interface{}, uint64) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, 0
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	v, err := c.lookupKey(k, false)
+	if err != nil {
+		return nil, 0
+	}
+	return v, c.items[k].version
+}
+
+// SetIfVersion sets a new key-value pair only if the current version of the key equals version.
+// A version of 0 means the key must not exist.
+func (c *typedLRUCache[K, V]) SetIfVersion(key, value interface{}, version uint64) (bool, error) {
+	k, v, err := c.typed(key, value)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	var current uint64
+	if c.has(k, nil) {
+		current = c.items[k].version
+	}
+	if current != version {
+		return false, nil
+	}
+	if _, err := c.set(k, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Peek returns the value for the specified key if it is present in the cache
+// without updating any eviction algorithm statistics or positions.
+// This is a pure read operation that does not affect cache state.
+func (c *typedLRUCache[K, V]) Peek(key interface{}) (interface{}, error) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, ErrKeyNotFoundError
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	it, ok := c.items[k]
+	if !ok || it.IsExpired(nil) {
+		return nil, ErrKeyNotFoundError
+	}
+	return it.value, nil
+}
+
+func (c *typedLRUCache[K, V]) get(key interface{}, onLoad bool) (interface{}, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.lookup(key, onLoad)
+}
+
+// getMulti returns the values of the specified keys that are present in the cache
+// and the keys that are not, acquiring the lock only once.
+func (c *typedLRUCache[K, V]) getMulti(keys []interface{}) (map[interface{}]interface{}, []interface{}) {
+	return c.lookupMulti(keys, c.lookup)
+}
+
+// lookup returns the value for the specified key like lookupKey.
+// The caller must hold the lock.
+func (c *typedLRUCache[K, V]) lookup(key interface{}, onLoad bool) (interface{}, error) {
+	k, ok := key.(K)
+	if !ok {
+		if !onLoad {
+			c.stats.IncrMissCount()
+		}
+		return nil, ErrKeyNotFoundError
+	}
+	v, err := c.lookupKey(k, onLoad)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// lookupKey returns the value for the specified key and updates the eviction state.
+// The caller must hold the lock.
+func (c *typedLRUCache[K, V]) lookupKey(key K, onLoad bool) (V, error) {
+	if c.wheel != nil && c.expiresOnAccess() {
+		c.expireDue(c.deadlineOf, c.remove)
+	}
+	it, ok := c.items[key]
+	if ok {
+		if !it.IsExpired(nil) {
+			c.evictList.MoveToFront(it)
+			if !onLoad {
+				c.stats.IncrHitCount()
+				it.recordAccess(c.clock.Now())
+				if c.sliding && it.expiration != nil {
+					c.expire(it, *c.expiration)
+				}
+				if c.shouldRefresh(&it.accessInfo) {
+					c.refresh(key)
+				}
+			}
+			return it.value, nil
+		}
+		c.expireOnAccess(key, c.remove)
+	}
+	if !onLoad {
+		c.stats.IncrMissCount()
+	}
+	var zero V
+	return zero, ErrKeyNotFoundError
+}
+
+func (c *typedLRUCache[K, V]) getWithLoader(key interface{}, isWait bool) (interface{}, error) {
+	if v, ok := c.recallVictim(key, c); ok {
+		return v, nil
+	}
+	if c.loaderExpireFunc == nil {
+		return nil, ErrKeyNotFoundError
+	}
+	value, _, err := c.load(key, func(v interface{}, expiration *time.Duration, e error) (interface{}, error) {
+		if e != nil {
+			return nil, e
+		}
+		k, tv, err := c.typed(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if expiration != nil {
+			err = c.setTypedWithExpire(k, tv, *expiration)
+		} else {
+			err = c.setTyped(k, tv)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}, isWait)
+	if err != nil {
+		// value is the stale value, if any.
+		return value, err
+	}
+	return value, nil
+}
+
+// evict removes the oldest unpinned item from the cache.
+func (c *typedLRUCache[K, V]) evict(count int) {
+	defer c.beginEviction()()
+	ent := c.evictList.Back()
+	for i := 0; i < count && ent != nil; {
+		prev := c.evictList.Prev(ent)
+		if !ent.pinned {
+			c.removeElement(ent)
+			i++
+		}
+		ent = prev
+	}
+}
+
+// compute atomically replaces the value for the specified key with the result of fn.
+// fn receives the current value and whether the key is present in the cache.
+func (c *typedLRUCache[K, V]) compute(key interface{}, fn func(interface{}, bool) (interface{}, error)) (interface{}, error) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	c.mu.Lock()
+	defer c.unlock()
+
+	var old interface{}
+	found := c.has(k, nil)
+	if found {
+		old = c.items[k].value
+	}
+
+	value, err := fn(old, found)
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.typed(k, value)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.set(k, v); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Touch resets the expiration of the provided key to the default expiration
+// without updating any eviction algorithm statistics or positions.
+// If the cache has no default expiration, the key will never expire.
+func (c *typedLRUCache[K, V]) Touch(key interface{}) bool {
+	return c.setExpiration(key, c.expiration)
+}
+
+// TouchWithExpire resets the expiration of the provided key to the given duration
+// without updating any eviction algorithm statistics or positions.
+func (c *typedLRUCache[K, V]) TouchWithExpire(key interface{}, expiration time.Duration) bool {
+	return c.setExpiration(key, &expiration)
+}
+
+// SetExpiration changes the expiration of the provided key in place
+// without updating any eviction algorithm statistics or positions.
+// A non-positive duration removes the expiration so that the key never expires.
+func (c *typedLRUCache[K, V]) SetExpiration(key interface{}, expiration time.Duration) bool {
+	if expiration <= 0 {
+		return c.setExpiration(key, nil)
+	}
+	return c.setExpiration(key, &expiration)
+}
+
+func (c *typedLRUCache[K, V]) setExpiration(key interface{}, expiration *time.Duration) bool {
+	k, ok := key.(K)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(k, nil) {
+		return false
+	}
+	item := c.items[k]
+	if expiration == nil {
+		item.expiration = nil
+	} else {
+		c.expire(item, *expiration)
+	}
+	return true
+}
+
+// Pin prevents the provided key from being evicted.
+// A pinned key is still removed by Remove and on expiration.
+func (c *typedLRUCache[K, V]) Pin(key interface{}) bool {
+	return c.setPinned(key, true)
+}
+
+// Unpin makes the provided key eligible for eviction again.
+func (c *typedLRUCache[K, V]) Unpin(key interface{}) bool {
+	return c.setPinned(key, false)
+}
+
+func (c *typedLRUCache[K, V]) setPinned(key interface{}, pinned bool) bool {
+	k, ok := key.(K)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.has(k, nil) {
+		return false
+	}
+	c.items[k].pinned = pinned
+	return true
+}
+
+// Has checks if key exists in cache
+func (c *typedLRUCache[K, V]) Has(key interface{}) bool {
+	k, ok := key.(K)
+	if !ok {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	return c.has(k, &now)
+}
+
+func (c *typedLRUCache[K, V]) has(key K, now *time.Time) bool {
+	item, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	return !item.IsExpired(now)
+}
+
+// deadline returns the time at which key expires if it is present in the cache and expires.
+func (c *typedLRUCache[K, V]) deadline(key K) (time.Time, bool) {
+	it, ok := c.items[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return it.deadline(it.expiration)
+}
+
+// deadlineOf returns the time at which key expires if it is present in the cache and expires.
+func (c *typedLRUCache[K, V]) deadlineOf(key interface{}) (time.Time, bool) {
+	k, ok := key.(K)
+	if !ok {
+		return time.Time{}, false
+	}
+	return c.deadline(k)
+}
+
+// expirationOf returns the time at which key expires, or nil if it does not
+// expire or is not present. The caller must hold the lock.
+func (c *typedLRUCache[K, V]) expirationOf(key interface{}) *time.Time {
+	k, ok := key.(K)
+	if !ok {
+		return nil
+	}
+	if it, ok := c.items[k]; ok {
+		return it.expiration
+	}
+	return nil
+}
+
+// GetAndRemove removes the provided key from the cache and returns its value.
+// Returns false if the key is not present in the cache.
+func (c *typedLRUCache[K, V]) GetAndRemove(key interface{}) (interface{}, bool) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.unlock()
+
+	if !c.has(k, nil) {
+		return nil, false
+	}
+	item := c.items[k]
+	c.removeElement(item)
+	return item.value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *typedLRUCache[K, V]) Remove(key interface{}) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	return c.remove(key)
+}
+
+func (c *typedLRUCache[K, V]) remove(key interface{}) bool {
+	k, ok := key.(K)
+	if !ok {
+		return false
+	}
+	if ent, ok := c.items[k]; ok {
+		c.removeElement(ent)
+		return true
+	}
+	return false
+}
+
+func (c *typedLRUCache[K, V]) removeElement(entry *lruNode[K, V]) {
+	c.evictList.Remove(entry)
+	delete(c.items, entry.key)
+	if c.tracksEntries() {
+		c.notifyEvicted(entry.key, entry.value)
+	} else {
+		c.countRemoved()
+	}
+}
+
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+func (c *typedLRUCache[K, V]) DeleteExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.deleteExpired(c.deadlineOf, c.remove)
+}
+
+// sample returns up to n unexpired entries, chosen uniformly at random.
+func (c *typedLRUCache[K, V]) sample(n int) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := reservoir[K, V]{n: n}
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if item.IsExpired(&now) {
+			continue
+		}
+		r.offer(key, item.value)
+	}
+	items := make(map[interface{}]interface{}, len(r.keys))
+	for i, key := range r.keys {
+		items[key] = r.values[i]
+	}
+	return items
+}
+
+// entries returns a point-in-time copy of all unexpired entries.
+func (c *typedLRUCache[K, V]) entries() []cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]cacheEntry, 0, len(c.items))
+	now := c.clock.Now()
+	// oldest first, so that re-inserting the entries in order restores recency
+	for item := c.evictList.Back(); item != nil; item = c.evictList.Prev(item) {
+		if item.IsExpired(&now) {
+			continue
+		}
+		entries = append(entries, newCacheEntry(item.key, item.value, item.expiration))
+	}
+	return entries
+}
+
+// restore inserts entries, as returned by entries, with their expiration times.
+func (c *typedLRUCache[K, V]) restore(entries []cacheEntry) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.beginRestore()()
+	for _, e := range entries {
+		k, v, err := c.typed(e.key, e.value)
+		if err != nil {
+			continue
+		}
+		item, err := c.set(k, v)
+		if err != nil {
+			continue
+		}
+		if e.expiration != nil {
+			item.expiration = e.expiration
+			c.scheduleExpiration(k, *e.expiration)
+		}
+	}
+}
+
+// shrink evicts up to n entries and returns the number of evicted entries.
+func (c *typedLRUCache[K, V]) shrink(n int) int {
+	c.mu.Lock()
+	defer c.unlock()
+	count := c.entryCount
+	c.evict(n)
+	return int(count - c.entryCount)
+}
+
+// walk calls fn for each entry while holding the read lock and skips expired
+// entries if checkExpired is true. It stops and returns false as soon as fn
+// returns false.
+func (c *typedLRUCache[K, V]) walk(checkExpired bool, fn func(interface{}, interface{}) bool) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if checkExpired && item.IsExpired(&now) {
+			continue
+		}
+		if !fn(key, item.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeMulti removes the specified keys, acquiring the lock only once.
+func (c *typedLRUCache[K, V]) removeMulti(keys []interface{}) int {
+	return c.removeKeys(keys, c.remove)
+}
+
+// removeIf removes all entries that satisfy fn and returns the number of removed entries.
+func (c *typedLRUCache[K, V]) removeIf(fn func(interface{}, interface{}) bool) int {
+	c.mu.Lock()
+	defer c.unlock()
+	var items []*lruNode[K, V]
+	for key, item := range c.items {
+		if fn(key, item.value) {
+			items = append(items, item)
+		}
+	}
+	for _, item := range items {
+		c.removeElement(item)
+	}
+	return len(items)
+}
+
+// GetALL returns all key-value pairs in the cache.
+func (c *typedLRUCache[K, V]) GetALL(checkExpired bool) map[interface{}]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make(map[interface{}]interface{}, len(c.items))
+	now := time.Now()
+	for k, item := range c.items {
+		if !checkExpired || !item.IsExpired(&now) {
+			items[k] = item.value
+		}
+	}
+	return items
+}
+
+// Keys returns a slice of the keys in the cache.
+func (c *typedLRUCache[K, V]) Keys(checkExpired bool) []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([]interface{}, 0, len(c.items))
+	now := time.Now()
+	for k, item := range c.items {
+		if !checkExpired || !item.IsExpired(&now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of items in the cache.
+func (c *typedLRUCache[K, V]) Len(checkExpired bool) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !checkExpired {
+		return len(c.items)
+	}
+	return len(c.items) - c.countExpired(c.deadlineOf)
+}
+
+// Completely clear the cache
+func (c *typedLRUCache[K, V]) Purge() {
+	c.purge(c.purgeVisitorFunc)
+}
+
+// SaveTo writes the entries of the cache with the time they have left to live to w.
+func (c *typedLRUCache[K, V]) SaveTo(w io.Writer) error {
+	return c.saveTo(w, c.entries())
+}
+
+// LoadFrom adds the entries written by SaveTo to the cache.
+func (c *typedLRUCache[K, V]) LoadFrom(r io.Reader) error {
+	entries, err := c.loadFrom(r)
+	if err != nil {
+		return err
+	}
+	c.restore(entries)
+	return nil
+}
+
+// purge clears the cache and calls visit, if not nil, for each entry.
+func (c *typedLRUCache[K, V]) purge(visit PurgeVisitorFunc) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if visit != nil {
+		for key, it := range c.items {
+			visit(key, it.value)
+		}
+	}
+
+	c.resetExpirations()
+	c.resetSize()
+	c.init()
+}
+
+// DebugState returns the number of entries of the cache.
+func (c *typedLRUCache[K, V]) DebugState() DebugState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return DebugState{Policy: TYPE_LRU, Entries: len(c.items)}
+}
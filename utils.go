@@ -1,5 +1,7 @@
 package xcache
 
+import "math/rand"
+
 func minInt(x, y int) int {
 	if x < y {
 		return x
@@ -13,3 +15,45 @@ func maxInt(x, y int) int {
 	}
 	return y
 }
+
+// nextPowerOfTwo returns the smallest power of two that is at least x, or 1 if x < 1.
+func nextPowerOfTwo(x int) int {
+	n := 1
+	for n < x {
+		n <<= 1
+	}
+	return n
+}
+
+// clearSlice zeroes the elements of s, so that they can be collected, and
+// returns s truncated to length zero with its capacity.
+func clearSlice[S ~[]E, E any](s S) S {
+	var zero E
+	for i := range s {
+		s[i] = zero
+	}
+	return s[:0]
+}
+
+// reservoir keeps a uniformly random sample of up to n of the pairs it is
+// offered, by reservoir sampling, so that every pair is kept with the same
+// probability however many pairs are offered.
+type reservoir[K, V any] struct {
+	n      int
+	seen   int
+	keys   []K
+	values []V
+}
+
+func (r *reservoir[K, V]) offer(key K, value V) {
+	r.seen++
+	if len(r.keys) < r.n {
+		r.keys = append(r.keys, key)
+		r.values = append(r.values, value)
+		return
+	}
+	if i := rand.Intn(r.seen); i < r.n {
+		r.keys[i] = key
+		r.values[i] = value
+	}
+}
@@ -0,0 +1,108 @@
+package xcache
+
+import "time"
+
+// tierOp is a change of the victim cache made while the lock was held, which
+// unlock applies to it: an entry that has been evicted to it, or a key that has
+// been written to the cache and must be removed from it.
+type tierOp struct {
+	key, value interface{}
+	ttl        time.Duration
+	remove     bool
+}
+
+// pushVictim queues an entry that has been evicted to make room for others,
+// to be stored in the victim cache, if any, with the remaining time until it
+// expires, once the lock has been released.
+// The caller must hold the lock, before the expiration of key is unscheduled.
+func (c *baseCache) pushVictim(key, value interface{}) {
+	if c.victim == nil {
+		return
+	}
+	var ttl time.Duration
+	if node, ok := c.expirations.index[key]; ok {
+		if ttl = node.deadline.Sub(c.clock.Now()); ttl <= 0 {
+			return
+		}
+	}
+	c.tierOps = append(c.tierOps, tierOp{key: key, value: value, ttl: ttl})
+}
+
+// invalidateVictim queues the removal of key from the victim cache, if any, once
+// the lock has been released, so that the victim cache does not keep a value of
+// key older than the one that has been written to the cache.
+// The caller must hold the lock.
+func (c *baseCache) invalidateVictim(key interface{}) {
+	if c.victim != nil {
+		c.tierOps = append(c.tierOps, tierOp{key: key, remove: true})
+	}
+}
+
+// unlock publishes the events held by publish, releases the lock of the cache and
+// then stores the entries that have been evicted while it was held in the victim
+// cache, and removes the keys that have been written from it, so that a slow
+// victim cache does not block the cache. The changes are applied in the order in
+// which they were made, also across concurrent calls.
+func (c *baseCache) unlock() {
+	if len(c.heldEvents) > 0 {
+		c.publishHeld()
+	}
+	if len(c.tierOps) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	ops, victim := c.tierOps, c.victim
+	c.tierOps = nil
+	c.tierMu.Lock()
+	defer c.tierMu.Unlock()
+	c.mu.Unlock()
+	for _, op := range ops {
+		if op.remove {
+			victim.Remove(op.key)
+			continue
+		}
+		value := op.value
+		if c.deserializeFunc != nil {
+			var err error
+			if value, err = c.deserializeFunc(op.key, value); err != nil {
+				continue
+			}
+		}
+		if op.ttl > 0 {
+			victim.SetWithExpire(op.key, value, op.ttl)
+		} else {
+			victim.Set(op.key, value)
+		}
+	}
+}
+
+// recallVictim looks key up in the victim cache, if any, after it has been
+// missed, and moves it back to cache with its remaining expiration. The entry
+// is only added if key is still missing from cache, so that a value that has
+// been set concurrently is not replaced by the older one of the victim cache.
+// Returns false if the victim cache does not hold the key either.
+func (c *baseCache) recallVictim(key interface{}, cache Cache) (interface{}, bool) {
+	if c.victim == nil {
+		return nil, false
+	}
+	v, expiration, err := c.victim.GetWithExpiration(key)
+	if err != nil {
+		return nil, false
+	}
+	// adding key to cache removes it from the victim cache
+	var added bool
+	if expiration == nil {
+		added, err = cache.SetIfAbsent(key, v)
+	} else if ttl := expiration.Sub(c.clock.Now()); ttl > 0 {
+		added, err = cache.SetIfAbsentWithExpire(key, v, ttl)
+	} else {
+		return nil, false
+	}
+	if !added && err == nil {
+		// key has been set since it was missed
+		if v, err = cache.get(key, true); err != nil {
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,124 @@
+package xcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVictimCache(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL} {
+		t.Run(tp, func(t *testing.T) {
+			victim := New(100).LRU().Build()
+			gc := New(10).EvictType(tp).VictimCache(victim).Build()
+			for i := 0; i < 20; i++ {
+				gc.Set(i, i)
+			}
+			if n := gc.Len(false) + victim.Len(false); n != 20 {
+				t.Errorf("%v != %v", n, 20)
+			}
+			for i := 0; i < 20; i++ {
+				if v, err := gc.Get(i); err != nil || v != i {
+					t.Errorf("%v, %v != %v", v, err, i)
+				}
+			}
+			// removed entries are not moved to the victim cache
+			for i := 0; i < 20; i++ {
+				gc.Remove(i)
+			}
+			if n := gc.Len(false) + victim.Len(false); n > 10 {
+				t.Errorf("%v > %v", n, 10)
+			}
+		})
+	}
+}
+
+func TestVictimCacheRecall(t *testing.T) {
+	victim := New(100).LRU().Build()
+	gc := New(1).LRU().VictimCache(victim).Build()
+	gc.Set(1, "a")
+	gc.Set(2, "b")
+	if !victim.Has(1) || victim.Has(2) {
+		t.Errorf("%v, %v != true, false", victim.Has(1), victim.Has(2))
+	}
+	if v, err := gc.GetIFPresent(1); err != nil || v != "a" {
+		t.Errorf("%v, %v != a", v, err)
+	}
+	// the recalled entry has been moved back and has evicted the other one
+	if !gc.Has(1) || victim.Has(1) || !victim.Has(2) {
+		t.Errorf("%v, %v, %v != true, false, true", gc.Has(1), victim.Has(1), victim.Has(2))
+	}
+}
+
+func TestVictimCacheExpiration(t *testing.T) {
+	clock := NewFakeClock()
+	victim := New(100).LRU().Clock(clock).Build()
+	gc := New(1).LRU().Clock(clock).VictimCache(victim).Build()
+	gc.SetWithExpire(1, "a", 2*time.Second)
+	clock.Advance(time.Second)
+	gc.Set(2, "b")
+	if _, expiration, err := victim.GetWithExpiration(1); err != nil || !expiration.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("%v, %v != %v", expiration, err, clock.Now().Add(time.Second))
+	}
+	clock.Advance(2 * time.Second)
+	if _, err := gc.Get(1); err != ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+	}
+}
+
+// hookTier is a Tier that calls onGet after it has been read and onSet before
+// it is written.
+type hookTier struct {
+	Cache
+	onGet func(key interface{})
+	onSet func(key interface{})
+}
+
+func (t *hookTier) GetWithExpiration(key interface{}) (interface{}, *time.Time, error) {
+	v, expiration, err := t.Cache.GetWithExpiration(key)
+	if t.onGet != nil {
+		t.onGet(key)
+	}
+	return v, expiration, err
+}
+
+func (t *hookTier) Set(key, value interface{}) error {
+	if t.onSet != nil {
+		t.onSet(key)
+	}
+	return t.Cache.Set(key, value)
+}
+
+func TestVictimCacheUnlocked(t *testing.T) {
+	victim := &hookTier{Cache: New(100).LRU().Build()}
+	gc := New(1).LRU().VictimCache(victim).Build()
+	victim.onSet = func(key interface{}) {
+		// the victim cache is written after the lock has been released
+		if !gc.(*LRUCache).mu.TryLock() {
+			t.Errorf("%v: lock held", key)
+			return
+		}
+		gc.(*LRUCache).mu.Unlock()
+	}
+	gc.Set(1, "a")
+	gc.Set(2, "b")
+	if !victim.Has(1) {
+		t.Error("1 should have been moved to the victim cache")
+	}
+}
+
+func TestVictimCacheRecallConcurrentSet(t *testing.T) {
+	victim := &hookTier{Cache: New(100).LRU().Build()}
+	gc := New(1).LRU().VictimCache(victim).Build()
+	gc.Set(1, "a")
+	gc.Set(2, "b")
+	// the key is set while it is recalled, the older value of the victim is dropped
+	victim.onGet = func(key interface{}) {
+		gc.Set(key, "new")
+	}
+	if v, err := gc.Get(1); err != nil || v != "new" {
+		t.Errorf("%v, %v != new", v, err)
+	}
+	if v, err := gc.GetIFPresent(1); err != nil || v != "new" {
+		t.Errorf("%v, %v != new", v, err)
+	}
+}
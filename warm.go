@@ -0,0 +1,61 @@
+package xcache
+
+// warmBatchSize is the number of entries Warm adds to a bucket per lock acquisition.
+const warmBatchSize = 1024
+
+// Warm adds entries to the cache, for example to prime it from a database dump at
+// startup. It is faster than Set for many entries, as it adds them to each bucket
+// in batches, and it neither counts hits and misses nor calls AddedFunc, publishes
+// events or consults the admission policy; use Set for entries that should.
+// The entries get the expiration of their TTL rule or the default expiration, if any.
+// Present keys are replaced. Returns the first error of SerializeFunc, if any,
+// after adding the entries up to it.
+func (xc *XCache[K, V]) Warm(entries map[K]V) error {
+	return xc.WarmSeq(func(yield func(K, V) bool) {
+		for key, value := range entries {
+			if !yield(key, value) {
+				return
+			}
+		}
+	})
+}
+
+// WarmSeq adds the entries that seq yields to the cache, like Warm, without
+// holding all of them in memory. seq must stop once yield returns false.
+// Rebucket does not migrate the buckets that entries have been added to until
+// WarmSeq returns.
+func (xc *XCache[K, V]) WarmSeq(seq func(yield func(K, V) bool)) error {
+	defer xc.enforceCapacity()
+	used := make(map[Cache]*int64)
+	defer releaseAll(used)
+	now := xc.builder.clock.Now()
+	batches := make(map[Cache][]cacheEntry)
+	var err error
+	seq(func(key K, value V) bool {
+		e := cacheEntry{key: key, value: value}
+		if xc.builder.serializeFunc != nil {
+			if e.value, err = xc.builder.serializeFunc(key, value); err != nil {
+				return false
+			}
+		}
+		if ttl, ok := xc.ruleTTL(key); ok {
+			e.expiration = deadline(ttl, now)
+		} else if xc.builder.expiration != nil {
+			e.expiration = deadline(*xc.builder.expiration, now)
+		}
+		bucket := xc.useBucketIn(key, used)
+		batch := append(batches[bucket], e)
+		if len(batch) == warmBatchSize {
+			bucket.restore(batch)
+			batch = batch[:0]
+		}
+		batches[bucket] = batch
+		return true
+	})
+	for bucket, batch := range batches {
+		if len(batch) > 0 {
+			bucket.restore(batch)
+		}
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package xcache
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestXCacheWarm(t *testing.T) {
+	clock := NewFakeClock()
+	var added int32
+	xc := NewXCache[int, int](1000).
+		BucketCount(4).
+		Clock(clock).
+		Expiration(time.Minute).
+		AddedFunc(func(int, int) { atomic.AddInt32(&added, 1) }).
+		Build()
+	entries := make(map[int]int)
+	for i := 0; i < 3000; i++ {
+		entries[i] = i * 10
+	}
+	if err := xc.Warm(entries); err != nil {
+		t.Fatal(err)
+	}
+	if l := xc.Len(false); l != 3000 {
+		t.Errorf("%v != %v", l, 3000)
+	}
+	if n := atomic.LoadInt32(&added); n != 0 {
+		t.Errorf("%v != %v", n, 0)
+	}
+	if hits, misses := xc.HitCount(), xc.MissCount(); hits != 0 || misses != 0 {
+		t.Errorf("%v, %v != 0, 0", hits, misses)
+	}
+	for i := 0; i < 3000; i++ {
+		if v, err := xc.Get(i); err != nil || v != i*10 {
+			t.Errorf("%v, %v != %v", v, err, i*10)
+		}
+	}
+	// the entries get the default expiration
+	clock.Advance(2 * time.Minute)
+	if _, err := xc.Get(0); err != ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, ErrKeyNotFoundError)
+	}
+}
+
+func TestXCacheWarmSeq(t *testing.T) {
+	errSerialize := errors.New("serialize")
+	xc := NewXCache[int, int](100).
+		BucketCount(4).
+		SerializeFunc(func(k, v int) ([]byte, error) {
+			if k == 5 {
+				return nil, errSerialize
+			}
+			return []byte(strconv.Itoa(v)), nil
+		}).
+		DeserializeFunc(func(k int, b []byte) (int, error) { return strconv.Atoi(string(b)) }).
+		Build()
+	err := xc.WarmSeq(func(yield func(int, int) bool) {
+		for i := 0; i < 10; i++ {
+			if !yield(i, i) {
+				return
+			}
+		}
+	})
+	if err != errSerialize {
+		t.Errorf("%v != %v", err, errSerialize)
+	}
+	if l := xc.Len(false); l != 5 {
+		t.Errorf("%v != %v", l, 5)
+	}
+	if v, err := xc.Get(4); err != nil || v != 4 {
+		t.Errorf("%v, %v != %v", v, err, 4)
+	}
+}
@@ -0,0 +1,70 @@
+package xcache
+
+import "sync"
+
+// trimBatch is the number of entries the trimmer evicts per lock acquisition,
+// so that writers do not wait for a whole trim.
+const trimBatch = 64
+
+// trimmer evicts entries in the background once a cache holds more than high
+// entries, until it holds low entries, see CacheBuilder.Watermarks.
+type trimmer struct {
+	low  int
+	high int
+	wake chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newTrimmer(low, high int) *trimmer {
+	return &trimmer{
+		low:  low,
+		high: high,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// signal wakes the trimmer up without waiting for it.
+func (t *trimmer) signal() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run calls shrink, which evicts up to the given number of entries, while
+// excess returns a positive number of entries beyond the low watermark.
+func (t *trimmer) run(excess func() int, shrink func(int) int) {
+	for {
+		select {
+		case <-t.wake:
+			for n := excess(); n > 0; n = excess() {
+				if shrink(minInt(n, trimBatch)) == 0 {
+					// every entry is pinned
+					break
+				}
+			}
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *trimmer) stop() {
+	t.once.Do(func() {
+		close(t.done)
+	})
+}
+
+// startTrimmer starts the background trimmer, if any, with the shrink method of the cache.
+func (c *baseCache) startTrimmer(shrink func(int) int) {
+	if c.trimmer == nil {
+		return
+	}
+	go c.trimmer.run(func() int {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return int(c.entryCount) - c.trimmer.low
+	}, shrink)
+}
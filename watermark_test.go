@@ -0,0 +1,76 @@
+package xcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitLen waits until gc holds n entries and reports whether it did.
+func waitLen(gc interface{ Len(bool) int }, n int) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if gc.Len(false) == n {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestWatermarks(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL} {
+		t.Run(tp, func(t *testing.T) {
+			gc := New(1000).EvictType(tp).Watermarks(0.5, 0.8).Build()
+			defer gc.Close()
+			for i := 0; i < 800; i++ {
+				gc.Set(i, i)
+			}
+			if l := gc.Len(false); l != 800 {
+				t.Errorf("%v != %v", l, 800)
+			}
+			gc.Set(800, 800)
+			if !waitLen(gc, 500) {
+				t.Errorf("%v != %v", gc.Len(false), 500)
+			}
+			if n := gc.EvictionCount(); n != 301 {
+				t.Errorf("%v != %v", n, 301)
+			}
+			// the size is still a hard limit
+			for i := 0; i < 5000; i++ {
+				gc.Set(i, i)
+				if l := gc.Len(false); l > 1000 {
+					t.Fatalf("%v > %v", l, 1000)
+				}
+			}
+		})
+	}
+}
+
+func TestWatermarksConfig(t *testing.T) {
+	for _, cb := range []*CacheBuilder{
+		New(10).LRU().Watermarks(0.5, 0.5),
+		New(10).LRU().Watermarks(-0.1, 0.5),
+		New(10).LRU().Watermarks(0.5, 1),
+		New(0).Watermarks(0.5, 0.8),
+	} {
+		if _, err := cb.BuildE(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%v != %v", err, ErrInvalidConfig)
+		}
+	}
+}
+
+func TestXCacheWatermarks(t *testing.T) {
+	xc := NewXCache[int, int](100).BucketCount(4).Watermarks(0.5, 0.8).Build()
+	defer xc.Close()
+	for i := 0; i < 400; i++ {
+		xc.Set(i, i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && xc.Len(false) > 4*80 {
+		time.Sleep(time.Millisecond)
+	}
+	if l := xc.Len(false); l > 4*80 {
+		t.Errorf("%v > %v", l, 4*80)
+	}
+}
@@ -1,60 +1,340 @@
 package xcache
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+)
 
-	"github.com/cespare/xxhash/v2"
+const (
+	// rebucketDrainTimeout is how long Rebucket waits for the operations that use
+	// a bucket to return while it keeps new operations from starting.
+	rebucketDrainTimeout = 100 * time.Microsecond
+	// rebucketPollInterval is how long Rebucket lets operations run before it
+	// waits for a bucket that has been in use for longer than rebucketDrainTimeout.
+	rebucketPollInterval = time.Millisecond
 )
 
 const (
+	// Deprecated: DefaultBucketCount was the default number of buckets before
+	// it was derived from GOMAXPROCS; see AutoBucketCount.
 	DefaultBucketCount = 32
 )
 
+// AutoBucketCount returns the number of buckets that is used if no bucket count
+// is set: the smallest power of two that is at least 4 × GOMAXPROCS, so that
+// small containers do not waste memory on buckets and big machines get enough
+// buckets to keep lock contention low.
+func AutoBucketCount() int {
+	return nextPowerOfTwo(4 * runtime.GOMAXPROCS(0))
+}
+
 // XCache is a bucket-based cache that supports generics
 type XCache[K comparable, V any] struct {
-	buckets     []Cache
+	buckets []Cache
+	// busy counts, for each bucket, the operations that use it, see useBucket.
+	busy        []int64
 	bucketCount int
+	bucketMask  uint64 // bucketCount - 1, as bucketCount is a power of two
 	bucketSize  int
-	mu          sync.RWMutex
-	stats       *stats
+	// old holds the buckets that Rebucket has not migrated yet, if it is running.
+	old *oldBuckets
+	// retired and retiredLatency hold the counters of the buckets replaced by Rebucket.
+	retired        BucketStats
+	retiredLatency LatencyHistogram
+	// mu guards the bucket layout above. Operations hold it for reading while
+	// they look up their buckets, and Rebucket for writing while it changes the layout.
+	mu         sync.RWMutex
+	rebucketMu sync.Mutex
+	stats      *stats
+	builder    XCacheBuilder[K, V]
+}
+
+// oldBuckets are the buckets of the layout that Rebucket is migrating from.
+// The buckets before next have been migrated; keys of the others still live there.
+// While moving is set, the bucket at next is being migrated, and operations that
+// use it wait until moved is closed.
+type oldBuckets struct {
+	buckets []Cache
+	busy    []int64
+	mask    uint64
+	next    int
+	moving  bool
+	moved   chan struct{}
 }
 
 // XCacheBuilder is the builder for XCache
 type XCacheBuilder[K comparable, V any] struct {
 	bucketCount      int
+	autoBucketCount  bool
 	bucketSize       int
+	totalSize        int
+	capacity         *globalCapacity
+	weigher          WeigherFunc
+	cost             *globalCapacity
 	tp               string
 	loaderExpireFunc LoaderExpireFunc
 	evictedFunc      EvictedFunc
+	expiredFunc      ExpiredFunc
 	purgeVisitorFunc PurgeVisitorFunc
 	addedFunc        AddedFunc
 	expiration       *time.Duration
 	deserializeFunc  DeserializeFunc
 	serializeFunc    SerializeFunc
+	storage          StorageType
 	clock            Clock
+	lfuDecay         time.Duration
+	sampleSize       int
+	arcGhostLimit    int
+	scoreFunc        ScoreFunc
+	wheelTick        time.Duration
+	sliding          bool
+	maxIdle          time.Duration
+	expirationMode   ExpirationMode
+	janitorInterval  time.Duration
+	refreshAfter     time.Duration
+	ttlRules         []ttlRule
+	routes           []routeRule
+	router           func(K) (int, bool)
+	callbackBurst    int
+	callbackInterval time.Duration
+	loaderTimeout    time.Duration
+	retryPolicy      *RetryPolicy
+	serveStale       bool
+	telemetry        Telemetry
+	latencyBuckets   []time.Duration
+	events           *eventStream
+	logger           Logger
+	sizeFunc         SizeFunc
+	middlewares      []Middleware
+	slowCallback     time.Duration
+	keyspace         *keyspace
+	lockProfiling    bool
+	lockFreeReads    bool
+	deferPromotion   bool
+	evictBatch       int
+	admission        AdmissionPolicy
+	pressure         *memoryWatcher
+	victim           Tier
+	lowWatermark     float64
+	highWatermark    float64
+	preset           Preset
+	hasher           func(K) uint64
+	multiWorkers     int
+	swapOnPurge      bool
+	statsFromBuckets bool
+}
+
+// ttlRule is the expiration of the entries whose key starts with prefix.
+type ttlRule struct {
+	prefix string
+	ttl    time.Duration
 }
 
-// NewXCache creates a new XCacheBuilder
+// routeRule routes the keys that start with prefix to a bucket.
+type routeRule struct {
+	prefix string
+	bucket int
+}
+
+// NewXCache creates a new XCacheBuilder for a cache of buckets that hold up to
+// bucketSize entries each. Use TotalSize to bound the whole cache instead.
 func NewXCache[K comparable, V any](bucketSize int) *XCacheBuilder[K, V] {
 	return &XCacheBuilder[K, V]{
-		bucketCount: DefaultBucketCount,
-		bucketSize:  bucketSize,
-		tp:          TYPE_LRU, // Default to use LRU
-		clock:       NewRealClock(),
+		bucketCount:     AutoBucketCount(),
+		autoBucketCount: true,
+		bucketSize:      bucketSize,
+		tp:              TYPE_LRU, // Default to use LRU
+		clock:           NewRealClock(),
 	}
 }
 
-// BucketCount sets the number of buckets
+// Hasher sets the function that hashes keys to select their bucket.
+// By default keys are formatted with fmt and hashed with xxhash, which allocates
+// for keys that are not strings; a hasher specific to the key type avoids that.
+// The hasher should distribute the keys evenly, see XCache.BucketBalance.
+func (cb *XCacheBuilder[K, V]) Hasher(hasher func(K) uint64) *XCacheBuilder[K, V] {
+	cb.hasher = hasher
+	return cb
+}
+
+// ParallelMulti makes GetMulti, SetMulti, SetMultiWithExpire, RemoveMulti and GetAll
+// work on the buckets in parallel on up to workers goroutines, instead of one bucket
+// after another. It pays off for large batches spread over many buckets.
+// A count below 2 disables parallel execution, which is the default.
+// Purge and PurgeWithVisitor always work in parallel, on up to workers or
+// GOMAXPROCS goroutines, whichever is more.
+func (cb *XCacheBuilder[K, V]) ParallelMulti(workers int) *XCacheBuilder[K, V] {
+	cb.multiWorkers = workers
+	return cb
+}
+
+// SwapOnPurge makes Purge and PurgeWithVisitor replace the buckets with new, empty
+// buckets before the old ones are purged, so that the other operations only wait
+// while the buckets are swapped rather than while every entry is visited.
+// The old buckets are purged and closed before Purge returns, and their counters
+// are kept, as by Rebucket. Purge waits for a running Rebucket to finish.
+func (cb *XCacheBuilder[K, V]) SwapOnPurge() *XCacheBuilder[K, V] {
+	cb.swapOnPurge = true
+	return cb
+}
+
+// BucketCount sets the number of buckets. The count is rounded up to a power
+// of two, so that the bucket of a key is selected with a bit mask instead of a
+// division; e.g. BucketCount(10) creates 16 buckets. A count that is not positive
+// selects AutoBucketCount, which is the default.
 func (cb *XCacheBuilder[K, V]) BucketCount(count int) *XCacheBuilder[K, V] {
-	if count <= 0 {
-		count = DefaultBucketCount
+	cb.autoBucketCount = count <= 0
+	if cb.autoBucketCount {
+		count = AutoBucketCount()
+	}
+	cb.bucketCount = nextPowerOfTwo(count)
+	return cb
+}
+
+// TotalSize makes size the capacity of the whole cache instead of the per-bucket
+// size passed to NewXCache. The capacity is divided evenly across the buckets, and
+// the remainder is given to the first buckets, one entry each; e.g. TotalSize(50)
+// with 8 buckets creates 2 buckets of 7 entries and 6 of 6. Since every bucket
+// evicts on its own, the cache may evict before it holds size entries in total.
+// Build panics if size is less than the number of buckets.
+func (cb *XCacheBuilder[K, V]) TotalSize(size int) *XCacheBuilder[K, V] {
+	cb.totalSize = size
+	return cb
+}
+
+// GlobalCapacity bounds the number of entries of the whole cache to capacity,
+// while each bucket may hold up to capacity entries itself. A bucket that receives
+// more keys than the others thereby uses the capacity that the other buckets leave
+// unused, instead of evicting entries while the cache is not full. Once the cache
+// holds more than capacity entries, entries are evicted from the buckets that hold
+// the most entries, according to their eviction policy. Since the bucket sizes are
+// compared on every insertion into a full cache, this costs more than per-bucket sizes.
+// It takes precedence over the bucket size passed to NewXCache and TotalSize.
+func (cb *XCacheBuilder[K, V]) GlobalCapacity(capacity int) *XCacheBuilder[K, V] {
+	cb.capacity = nil
+	if capacity > 0 {
+		cb.capacity = newGlobalCapacity(int64(capacity))
+	}
+	return cb
+}
+
+// SerializeFunc makes all buckets store the bytes returned by serializeFunc instead of
+// the values, which are decoded by the DeserializeFunc when they are read. The callbacks
+// and the Weigher are passed the decoded values, too.
+func (cb *XCacheBuilder[K, V]) SerializeFunc(serializeFunc func(K, V) ([]byte, error)) *XCacheBuilder[K, V] {
+	cb.serializeFunc = func(key, value interface{}) (interface{}, error) {
+		return serializeFunc(key.(K), value.(V))
+	}
+	return cb
+}
+
+// DeserializeFunc decodes the bytes stored by SerializeFunc into values
+func (cb *XCacheBuilder[K, V]) DeserializeFunc(deserializeFunc func(K, []byte) (V, error)) *XCacheBuilder[K, V] {
+	cb.deserializeFunc = func(key, value interface{}) (interface{}, error) {
+		b, ok := value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("xcache: cannot deserialize %T", value)
+		}
+		return deserializeFunc(key.(K), b)
+	}
+	return cb
+}
+
+// typed returns key and value as K and V for the typed callbacks, decoding values
+// that have been serialized by SerializeFunc with the DeserializeFunc.
+// ok is false if they are of other types or cannot be decoded.
+func (cb *XCacheBuilder[K, V]) typed(key, value interface{}) (k K, v V, ok bool) {
+	if k, ok = key.(K); !ok {
+		return k, v, false
+	}
+	if b, serialized := value.([]byte); serialized && cb.serializeFunc != nil && cb.deserializeFunc != nil {
+		decoded, err := cb.deserializeFunc(key, b)
+		if err != nil {
+			return k, v, false
+		}
+		value = decoded
+	}
+	v, ok = value.(V)
+	return k, v, ok
+}
+
+// Storage selects how all buckets store their entries, see CacheBuilder.Storage.
+// BytesArena requires SerializeFunc and DeserializeFunc, and K to be a string or
+// integer type.
+func (cb *XCacheBuilder[K, V]) Storage(storage StorageType) *XCacheBuilder[K, V] {
+	cb.storage = storage
+	return cb
+}
+
+// Weigher makes all buckets weigh their entries with weigher in units of the caller's
+// choice, such as bytes or rows, as reported by Cost. Together with MaxCost, the capacity
+// of the cache is enforced in these units. Values that have been serialized by
+// SerializeFunc are weighed as decoded by the DeserializeFunc.
+func (cb *XCacheBuilder[K, V]) Weigher(weigher func(K, V) int64) *XCacheBuilder[K, V] {
+	cb.weigher = nil
+	if weigher == nil {
+		return cb
+	}
+	cb.weigher = func(key, value interface{}) int64 {
+		k, v, ok := cb.typed(key, value)
+		if !ok {
+			return 1
+		}
+		return weigher(k, v)
+	}
+	return cb
+}
+
+// MaxCost bounds the total weight of the entries of the whole cache, as computed by
+// the Weigher, to cost. Like with GlobalCapacity, the cost is shared across the
+// buckets: a bucket evicts entries before a write only if the entry would not fit
+// into cost next to its own entries, and once the whole cache weighs more than
+// cost, entries are evicted from the buckets that weigh the most, according to their
+// eviction policy. The bucket sizes still bound the number of entries.
+func (cb *XCacheBuilder[K, V]) MaxCost(cost int64) *XCacheBuilder[K, V] {
+	cb.cost = nil
+	if cost > 0 {
+		cb.cost = newGlobalCapacity(cost)
 	}
-	cb.bucketCount = count
 	return cb
 }
 
+// MaxBytes bounds the memory used by the entries of the whole cache to about n bytes,
+// as estimated by ShallowSize. It is MaxCost with ShallowSize as the Weigher, and makes
+// EstimatedBytes use ShallowSize unless EstimateSize is set.
+func (cb *XCacheBuilder[K, V]) MaxBytes(n int64) *XCacheBuilder[K, V] {
+	cb.weigher = shallowWeigher
+	if cb.sizeFunc == nil {
+		cb.sizeFunc = ShallowSize
+	}
+	return cb.MaxCost(n)
+}
+
+// bucketSizes returns the capacity of each bucket.
+func (cb *XCacheBuilder[K, V]) bucketSizes() []int {
+	sizes := make([]int, cb.bucketCount)
+	for i := range sizes {
+		if cb.capacity != nil {
+			sizes[i] = int(cb.capacity.limit)
+		} else if cb.totalSize > 0 {
+			sizes[i] = cb.totalSize / cb.bucketCount
+			if i < cb.totalSize%cb.bucketCount {
+				sizes[i]++
+			}
+		} else {
+			sizes[i] = cb.bucketSize
+		}
+	}
+	return sizes
+}
+
 // EvictType sets the eviction type for each bucket
 func (cb *XCacheBuilder[K, V]) EvictType(tp string) *XCacheBuilder[K, V] {
 	cb.tp = tp
@@ -86,6 +366,38 @@ func (cb *XCacheBuilder[K, V]) LIRS() *XCacheBuilder[K, V] {
 	return cb.EvictType(TYPE_LIRS)
 }
 
+// FIFO sets eviction type to FIFO
+func (cb *XCacheBuilder[K, V]) FIFO() *XCacheBuilder[K, V] {
+	return cb.EvictType(TYPE_FIFO)
+}
+
+// Random sets eviction type to Random
+func (cb *XCacheBuilder[K, V]) Random() *XCacheBuilder[K, V] {
+	return cb.EvictType(TYPE_RANDOM)
+}
+
+// ApproxLRU sets eviction type to a sampled approximation of LRU
+// that evicts the least recently used of sampleSize random entries
+func (cb *XCacheBuilder[K, V]) ApproxLRU(sampleSize int) *XCacheBuilder[K, V] {
+	cb.sampleSize = sampleSize
+	return cb.EvictType(TYPE_APPROX_LRU)
+}
+
+// TTL sets eviction type to evict the items expiring soonest first
+func (cb *XCacheBuilder[K, V]) TTL() *XCacheBuilder[K, V] {
+	return cb.EvictType(TYPE_TTL)
+}
+
+// ScoreFunc sets eviction type to evict the entries with the lowest score first
+func (cb *XCacheBuilder[K, V]) ScoreFunc(scoreFunc func(K, V, EntryMeta) float64) *XCacheBuilder[K, V] {
+	cb.scoreFunc = func(key, value interface{}, meta EntryMeta) float64 {
+		k, _ := key.(K)
+		v, _ := value.(V)
+		return scoreFunc(k, v, meta)
+	}
+	return cb.EvictType(TYPE_SCORE)
+}
+
 // LoaderFunc sets a loader function
 func (cb *XCacheBuilder[K, V]) LoaderFunc(loaderFunc func(K) (V, error)) *XCacheBuilder[K, V] {
 	cb.loaderExpireFunc = func(k interface{}) (interface{}, *time.Duration, error) {
@@ -111,18 +423,172 @@ func (cb *XCacheBuilder[K, V]) LoaderExpireFunc(loaderExpireFunc func(K) (V, *ti
 	return cb
 }
 
+// CoalesceLoads sets a loader function that loads all the keys missed within window, in any bucket, with a single call
+func (cb *XCacheBuilder[K, V]) CoalesceLoads(window time.Duration, bulkLoader func([]K) (map[K]V, error)) *XCacheBuilder[K, V] {
+	batcher := newLoadBatcher(window, func(keys []interface{}) (map[interface{}]interface{}, error) {
+		typed := make([]K, 0, len(keys))
+		for _, k := range keys {
+			if key, ok := k.(K); ok {
+				typed = append(typed, key)
+			}
+		}
+		values, err := bulkLoader(typed)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[interface{}]interface{}, len(values))
+		for k, v := range values {
+			result[k] = v
+		}
+		return result, nil
+	})
+	cb.loaderExpireFunc = func(k interface{}) (interface{}, *time.Duration, error) {
+		v, err := batcher.load(k)
+		return v, nil, err
+	}
+	return cb
+}
+
 // EvictedFunc sets an evicted function
 func (cb *XCacheBuilder[K, V]) EvictedFunc(evictedFunc func(K, V)) *XCacheBuilder[K, V] {
 	cb.evictedFunc = func(key, value interface{}) {
+		if k, v, ok := cb.typed(key, value); ok {
+			evictedFunc(k, v)
+		}
+	}
+	return cb
+}
+
+// SlowCallbackThreshold makes all buckets log a warning whenever a callback runs longer than threshold
+func (cb *XCacheBuilder[K, V]) SlowCallbackThreshold(threshold time.Duration) *XCacheBuilder[K, V] {
+	cb.slowCallback = threshold
+	return cb
+}
+
+// StatsFromBuckets makes the XCache sum up the hit and miss counters of its buckets
+// for HitCount, MissCount, HitRate and Stats instead of counting its lookups a second
+// time, so that the totals always match BucketStats. Without it, the XCache counters
+// are authoritative for its own lookups, and the bucket counters may differ: a Get
+// that loads a missing value is a hit of the XCache but a miss of its bucket.
+func (cb *XCacheBuilder[K, V]) StatsFromBuckets() *XCacheBuilder[K, V] {
+	cb.statsFromBuckets = true
+	return cb
+}
+
+// LockProfiling makes all buckets measure how long operations wait for their locks,
+// which is reported by Stats and BucketStats. Lock contention that is spread over
+// all buckets suggests that more buckets will help, while contention on a few hot
+// buckets does not go away with more buckets.
+func (cb *XCacheBuilder[K, V]) LockProfiling() *XCacheBuilder[K, V] {
+	cb.lockProfiling = true
+	return cb
+}
+
+// LockFreeReads makes all buckets serve hits on entries that have been read
+// before without taking their locks, for workloads in which many goroutines
+// read the same hot buckets. See CacheBuilder.LockFreeReads for its limits.
+func (cb *XCacheBuilder[K, V]) LockFreeReads() *XCacheBuilder[K, V] {
+	cb.lockFreeReads = true
+	return cb
+}
+
+// DeferredPromotion makes LRU buckets serve hits under their read locks and
+// queue the promotion of the hit entries. See CacheBuilder.DeferredPromotion for its limits.
+func (cb *XCacheBuilder[K, V]) DeferredPromotion() *XCacheBuilder[K, V] {
+	cb.deferPromotion = true
+	return cb
+}
+
+// EvictionBatch makes each full bucket evict n entries at once when a new key
+// is added. See CacheBuilder.EvictionBatch.
+func (cb *XCacheBuilder[K, V]) EvictionBatch(n int) *XCacheBuilder[K, V] {
+	cb.evictBatch = n
+	return cb
+}
+
+// Admission makes the buckets consult policy before a new key is added to them.
+// The buckets share the policy. See CacheBuilder.Admission.
+func (cb *XCacheBuilder[K, V]) Admission(policy AdmissionPolicy) *XCacheBuilder[K, V] {
+	cb.admission = policy
+	return cb
+}
+
+// MemoryPressure makes every bucket evict fraction of its entries when the heap
+// in use exceeds limit bytes. The buckets share a single watcher, which reads the
+// heap once per interval. See CacheBuilder.MemoryPressure.
+func (cb *XCacheBuilder[K, V]) MemoryPressure(limit uint64, fraction float64, interval time.Duration) *XCacheBuilder[K, V] {
+	cb.pressure = newMemoryWatcher(limit, fraction, interval)
+	return cb
+}
+
+// VictimCache makes the buckets move the entries they evict to victim and look up
+// the keys they miss in it. The buckets share victim. See CacheBuilder.VictimCache.
+func (cb *XCacheBuilder[K, V]) VictimCache(victim Tier) *XCacheBuilder[K, V] {
+	cb.victim = victim
+	return cb
+}
+
+// Watermarks makes every bucket evict entries in the background, down to low times
+// its size, once it holds more than high times its size. See CacheBuilder.Watermarks.
+func (cb *XCacheBuilder[K, V]) Watermarks(low, high float64) *XCacheBuilder[K, V] {
+	cb.lowWatermark = low
+	cb.highWatermark = high
+	return cb
+}
+
+// Use wraps each bucket with middlewares, so that they can intercept the operations of the buckets
+func (cb *XCacheBuilder[K, V]) Use(middlewares ...Middleware) *XCacheBuilder[K, V] {
+	cb.middlewares = append(cb.middlewares, middlewares...)
+	return cb
+}
+
+// EstimateSize makes all buckets estimate the memory used by their entries with sizeFunc,
+// or with ReflectSize if sizeFunc is nil
+func (cb *XCacheBuilder[K, V]) EstimateSize(sizeFunc func(K, V) int) *XCacheBuilder[K, V] {
+	if sizeFunc == nil {
+		cb.sizeFunc = ReflectSize
+		return cb
+	}
+	cb.sizeFunc = func(key, value interface{}) int {
 		k, ok := key.(K)
 		if !ok {
-			return
+			return ReflectSize(key, value)
 		}
 		v, ok := value.(V)
 		if !ok {
-			return
+			// The value has been serialized.
+			return ReflectSize(key, value)
+		}
+		return sizeFunc(k, v)
+	}
+	return cb
+}
+
+// Logger makes all buckets report recovered panics, dropped events and janitor activity to logger
+func (cb *XCacheBuilder[K, V]) Logger(logger Logger) *XCacheBuilder[K, V] {
+	cb.logger = logger
+	return cb
+}
+
+// KeyspaceNotifications enables Redis style keyspace notifications for all buckets
+func (cb *XCacheBuilder[K, V]) KeyspaceNotifications() *XCacheBuilder[K, V] {
+	cb.keyspace = newKeyspace()
+	return cb
+}
+
+// EventBuffer publishes the changes of the entries of all buckets as Events on the channel
+// returned by Events, which buffers up to size events. Events that do not fit are dropped.
+func (cb *XCacheBuilder[K, V]) EventBuffer(size int) *XCacheBuilder[K, V] {
+	cb.events = newEventStream(size)
+	return cb
+}
+
+// ExpiredFunc sets a function that is called for entries that are removed because they have expired
+func (cb *XCacheBuilder[K, V]) ExpiredFunc(expiredFunc func(K, V)) *XCacheBuilder[K, V] {
+	cb.expiredFunc = func(key, value interface{}) {
+		if k, v, ok := cb.typed(key, value); ok {
+			expiredFunc(k, v)
 		}
-		evictedFunc(k, v)
 	}
 	return cb
 }
@@ -130,15 +596,9 @@ func (cb *XCacheBuilder[K, V]) EvictedFunc(evictedFunc func(K, V)) *XCacheBuilde
 // PurgeVisitorFunc sets a purge visitor function
 func (cb *XCacheBuilder[K, V]) PurgeVisitorFunc(purgeVisitorFunc func(K, V)) *XCacheBuilder[K, V] {
 	cb.purgeVisitorFunc = func(key, value interface{}) {
-		k, ok := key.(K)
-		if !ok {
-			return
-		}
-		v, ok := value.(V)
-		if !ok {
-			return
+		if k, v, ok := cb.typed(key, value); ok {
+			purgeVisitorFunc(k, v)
 		}
-		purgeVisitorFunc(k, v)
 	}
 	return cb
 }
@@ -146,15 +606,9 @@ func (cb *XCacheBuilder[K, V]) PurgeVisitorFunc(purgeVisitorFunc func(K, V)) *XC
 // AddedFunc sets an added function
 func (cb *XCacheBuilder[K, V]) AddedFunc(addedFunc func(K, V)) *XCacheBuilder[K, V] {
 	cb.addedFunc = func(key, value interface{}) {
-		k, ok := key.(K)
-		if !ok {
-			return
-		}
-		v, ok := value.(V)
-		if !ok {
-			return
+		if k, v, ok := cb.typed(key, value); ok {
+			addedFunc(k, v)
 		}
-		addedFunc(k, v)
 	}
 	return cb
 }
@@ -165,154 +619,943 @@ func (cb *XCacheBuilder[K, V]) Expiration(expiration time.Duration) *XCacheBuild
 	return cb
 }
 
-// Clock sets the clock
-func (cb *XCacheBuilder[K, V]) Clock(clock Clock) *XCacheBuilder[K, V] {
-	cb.clock = clock
+// TTLRule sets the expiration of entries whose key starts with prefix when they are
+// written by Set, SetIfAbsent or SetMulti, instead of the default expiration.
+// If several rules match a key, the rule with the longest prefix applies.
+// Rules only apply to keys whose underlying type is string.
+func (cb *XCacheBuilder[K, V]) TTLRule(prefix string, ttl time.Duration) *XCacheBuilder[K, V] {
+	cb.ttlRules = append(cb.ttlRules, ttlRule{prefix: prefix, ttl: ttl})
 	return cb
 }
 
-// Build creates the XCache instance
-func (cb *XCacheBuilder[K, V]) Build() *XCache[K, V] {
-	if cb.bucketSize <= 0 && cb.tp != TYPE_SIMPLE {
-		panic("xcache: bucket size <= 0")
+// RoutePrefix routes the keys that start with prefix to the bucket with the given
+// index, and reserves the bucket for them: other keys are not hashed to it. This
+// isolates a group of keys, such as the keys of one tenant, in a bucket with its
+// own capacity. If several rules match a key, the rule with the longest prefix applies.
+// Rules only apply to keys whose underlying type is string.
+func (cb *XCacheBuilder[K, V]) RoutePrefix(prefix string, bucket int) *XCacheBuilder[K, V] {
+	cb.routes = append(cb.routes, routeRule{prefix: prefix, bucket: bucket})
+	return cb
+}
+
+// Router sets a function that selects the bucket of a key. If it returns true,
+// the key is stored in the bucket with the returned index, modulo the number of
+// buckets; otherwise the key is routed by RoutePrefix rules or by its hash.
+// Unlike RoutePrefix, Router does not reserve buckets.
+func (cb *XCacheBuilder[K, V]) Router(router func(K) (int, bool)) *XCacheBuilder[K, V] {
+	cb.router = router
+	return cb
+}
+
+// reserves reports whether a RoutePrefix rule routes keys to the bucket with index i.
+func (cb *XCacheBuilder[K, V]) reserves(i int) bool {
+	for _, rule := range cb.routes {
+		if rule.bucket == i {
+			return true
+		}
 	}
+	return false
+}
 
-	xcache := &XCache[K, V]{
-		buckets:     make([]Cache, cb.bucketCount),
-		bucketCount: cb.bucketCount,
-		bucketSize:  cb.bucketSize,
-		stats:       &stats{},
+// validateRoutes returns an error if a RoutePrefix rule refers to a bucket
+// that does not exist among count buckets or reserves every bucket.
+func (cb *XCacheBuilder[K, V]) validateRoutes(count int) error {
+	reserved := make(map[int]bool)
+	for _, rule := range cb.routes {
+		if rule.bucket < 0 || rule.bucket >= count {
+			return fmt.Errorf("%w: route to bucket %d of %d", ErrInvalidConfig, rule.bucket, count)
+		}
+		reserved[rule.bucket] = true
 	}
+	if len(reserved) > 0 && len(reserved) == count {
+		return fmt.Errorf("%w: every bucket is reserved by a route", ErrInvalidConfig)
+	}
+	return nil
+}
 
-	// Create cache instance for each bucket
-	for i := 0; i < cb.bucketCount; i++ {
-		cacheBuilder := New(cb.bucketSize).
-			EvictType(cb.tp).
-			Clock(cb.clock)
+// MaxIdle makes entries expire once they have not been used for maxIdle
+func (cb *XCacheBuilder[K, V]) MaxIdle(maxIdle time.Duration) *XCacheBuilder[K, V] {
+	cb.maxIdle = maxIdle
+	return cb
+}
 
-		if cb.loaderExpireFunc != nil {
-			cacheBuilder = cacheBuilder.LoaderExpireFunc(cb.loaderExpireFunc)
-		}
-		if cb.evictedFunc != nil {
-			cacheBuilder = cacheBuilder.EvictedFunc(cb.evictedFunc)
-		}
-		if cb.purgeVisitorFunc != nil {
-			cacheBuilder = cacheBuilder.PurgeVisitorFunc(cb.purgeVisitorFunc)
-		}
-		if cb.addedFunc != nil {
-			cacheBuilder = cacheBuilder.AddedFunc(cb.addedFunc)
-		}
-		if cb.expiration != nil {
-			cacheBuilder = cacheBuilder.Expiration(*cb.expiration)
-		}
-		if cb.deserializeFunc != nil {
-			cacheBuilder = cacheBuilder.DeserializeFunc(cb.deserializeFunc)
-		}
-		if cb.serializeFunc != nil {
-			cacheBuilder = cacheBuilder.SerializeFunc(cb.serializeFunc)
-		}
+// ExpirationMode sets when expired entries are removed, with a janitor running every interval in each bucket
+func (cb *XCacheBuilder[K, V]) ExpirationMode(mode ExpirationMode, interval time.Duration) *XCacheBuilder[K, V] {
+	cb.expirationMode = mode
+	cb.janitorInterval = interval
+	return cb
+}
 
-		xcache.buckets[i] = cacheBuilder.Build()
-	}
+// LoaderTimeout makes loads fail with ErrLoaderTimeout if the loader does not return within loaderTimeout
+func (cb *XCacheBuilder[K, V]) LoaderTimeout(loaderTimeout time.Duration) *XCacheBuilder[K, V] {
+	cb.loaderTimeout = loaderTimeout
+	return cb
+}
 
-	return xcache
+// LoaderRetry retries failed loader calls according to policy
+func (cb *XCacheBuilder[K, V]) LoaderRetry(policy RetryPolicy) *XCacheBuilder[K, V] {
+	cb.retryPolicy = &policy
+	return cb
 }
 
-// hashKey uses xxhash to hash the key for better performance and distribution
-func (xc *XCache[K, V]) hashKey(key K) uint64 {
-	keyStr := fmt.Sprintf("%v", key)
-	return xxhash.Sum64String(keyStr)
+// LoadLatencyBuckets sets the upper bounds of the buckets of the load latency histogram
+func (cb *XCacheBuilder[K, V]) LoadLatencyBuckets(bounds ...time.Duration) *XCacheBuilder[K, V] {
+	cb.latencyBuckets = bounds
+	return cb
 }
 
-// getBucket returns the bucket for the given key
-func (xc *XCache[K, V]) getBucket(key K) Cache {
-	hash := xc.hashKey(key)
-	bucketIndex := hash % uint64(xc.bucketCount)
-	return xc.buckets[bucketIndex]
+// WithTelemetry reports the hits and misses and the loader calls of all buckets to
+// telemetry, see CacheBuilder.WithTelemetry.
+func (cb *XCacheBuilder[K, V]) WithTelemetry(telemetry Telemetry) *XCacheBuilder[K, V] {
+	cb.telemetry = telemetry
+	return cb
 }
 
-// Set inserts or updates the specified key-value pair
-func (xc *XCache[K, V]) Set(key K, value V) error {
-	bucket := xc.getBucket(key)
-	return bucket.Set(key, value)
+// ServeStale makes Get return the previous value of a key together with a *StaleError if loading a new value fails
+func (cb *XCacheBuilder[K, V]) ServeStale() *XCacheBuilder[K, V] {
+	cb.serveStale = true
+	return cb
 }
 
-// SetWithExpire inserts or updates the specified key-value pair with an expiration time
-func (xc *XCache[K, V]) SetWithExpire(key K, value V, expiration time.Duration) error {
-	bucket := xc.getBucket(key)
-	return bucket.SetWithExpire(key, value, expiration)
+// BatchCallbacks delivers eviction and expiration callbacks in the background, at most maxBurst per interval in each bucket
+func (cb *XCacheBuilder[K, V]) BatchCallbacks(maxBurst int, interval time.Duration) *XCacheBuilder[K, V] {
+	cb.callbackBurst = maxBurst
+	cb.callbackInterval = interval
+	return cb
 }
 
-// Get returns the value for the specified key if it is present in the cache
-func (xc *XCache[K, V]) Get(key K) (V, error) {
-	bucket := xc.getBucket(key)
-	value, err := bucket.Get(key)
-	if err != nil {
-		var zero V
-		if err == ErrKeyNotFoundError {
-			xc.stats.IncrMissCount()
-		}
-		return zero, err
-	}
+// RefreshAfter makes reads of entries older than refreshAfter reload them in the background
+func (cb *XCacheBuilder[K, V]) RefreshAfter(refreshAfter time.Duration) *XCacheBuilder[K, V] {
+	cb.refreshAfter = refreshAfter
+	return cb
+}
 
-	xc.stats.IncrHitCount()
-	if v, ok := value.(V); ok {
-		return v, nil
-	}
+// SlidingExpiration makes every successful read extend the expiration of the entry by the default expiration
+func (cb *XCacheBuilder[K, V]) SlidingExpiration() *XCacheBuilder[K, V] {
+	cb.sliding = true
+	return cb
+}
 
-	var zero V
-	return zero, fmt.Errorf("type assertion failed")
+// TimingWheel makes each bucket track expirations in a hierarchical timing wheel with the given tick
+func (cb *XCacheBuilder[K, V]) TimingWheel(tick time.Duration) *XCacheBuilder[K, V] {
+	cb.wheelTick = tick
+	return cb
 }
 
-// GetIFPresent returns the value for the specified key if it is present in the cache
-func (xc *XCache[K, V]) GetIFPresent(key K) (V, error) {
-	bucket := xc.getBucket(key)
-	value, err := bucket.GetIFPresent(key)
-	if err != nil {
-		var zero V
-		if err == ErrKeyNotFoundError {
-			xc.stats.IncrMissCount()
-		}
-		return zero, err
-	}
+// LFUDecay sets the interval at which LFU frequency counts are halved
+func (cb *XCacheBuilder[K, V]) LFUDecay(interval time.Duration) *XCacheBuilder[K, V] {
+	cb.lfuDecay = interval
+	return cb
+}
 
-	xc.stats.IncrHitCount()
-	if v, ok := value.(V); ok {
-		return v, nil
-	}
+// ARCGhostLimit caps the number of ghost keys each ARC bucket remembers
+func (cb *XCacheBuilder[K, V]) ARCGhostLimit(limit int) *XCacheBuilder[K, V] {
+	cb.arcGhostLimit = limit
+	return cb
+}
 
-	var zero V
-	return zero, fmt.Errorf("type assertion failed")
+// Clock sets the clock
+func (cb *XCacheBuilder[K, V]) Clock(clock Clock) *XCacheBuilder[K, V] {
+	cb.clock = clock
+	return cb
 }
 
-// Peek returns the value for the specified key if it is present in the cache
-// without updating any eviction algorithm statistics or positions.
-// This is a pure read operation that does not affect cache state.
-// Note: This method does not update hit/miss statistics.
-func (xc *XCache[K, V]) Peek(key K) (V, error) {
-	bucket := xc.getBucket(key)
-	value, err := bucket.Peek(key)
+// Build creates the XCache instance. It panics if the configuration is invalid, see BuildE.
+func (cb *XCacheBuilder[K, V]) Build() *XCache[K, V] {
+	xc, err := cb.BuildE()
 	if err != nil {
-		var zero V
-		return zero, err
+		panic("xcache: " + err.Error())
 	}
+	return xc
+}
 
-	if v, ok := value.(V); ok {
-		return v, nil
+// BuildE creates the XCache instance, or returns an error wrapping ErrInvalidConfig
+// if the configuration of the cache or of its buckets is invalid.
+func (cb *XCacheBuilder[K, V]) BuildE() (*XCache[K, V], error) {
+	if cb.bucketCount <= 0 {
+		return nil, fmt.Errorf("%w: bucket count <= 0", ErrInvalidConfig)
 	}
-
-	var zero V
-	return zero, fmt.Errorf("type assertion failed")
+	if cb.capacity == nil && cb.totalSize > 0 && cb.totalSize < cb.bucketCount {
+		return nil, fmt.Errorf("%w: total size < bucket count", ErrInvalidConfig)
+	}
+	if cb.capacity == nil && cb.totalSize <= 0 && cb.bucketSize <= 0 && cb.tp != TYPE_SIMPLE {
+		return nil, fmt.Errorf("%w: bucket size <= 0", ErrInvalidConfig)
+	}
+	if err := validatePreset(cb.preset); err != nil {
+		return nil, err
+	}
+	if err := cb.validateRoutes(cb.bucketCount); err != nil {
+		return nil, err
+	}
+	sizes := cb.bucketSizes()
+	if err := cb.bucketBuilder(sizes[0]).validate(); err != nil {
+		return nil, err
+	}
+
+	xcache := &XCache[K, V]{
+		buckets:     make([]Cache, cb.bucketCount),
+		busy:        make([]int64, cb.bucketCount),
+		bucketCount: cb.bucketCount,
+		bucketMask:  uint64(cb.bucketCount - 1),
+		bucketSize:  cb.bucketSize,
+		stats:       &stats{},
+		builder:     *cb,
+	}
+
+	for i := 0; i < cb.bucketCount; i++ {
+		xcache.buckets[i] = cb.buildBucket(sizes[i])
+	}
+
+	return xcache, nil
+}
+
+// buildBucket creates a bucket that holds up to size entries.
+func (cb *XCacheBuilder[K, V]) buildBucket(size int) Cache {
+	return cb.bucketBuilder(size).Build()
+}
+
+// bucketBuilder returns the builder of a bucket that holds up to size entries.
+func (cb *XCacheBuilder[K, V]) bucketBuilder(size int) *CacheBuilder {
+	cacheBuilder := New(size).
+		EvictType(cb.tp).
+		Clock(cb.clock)
+	cacheBuilder.sampleSize = cb.sampleSize
+	cacheBuilder.scoreFunc = cb.scoreFunc
+	cacheBuilder.telemetry = cb.telemetry
+	cacheBuilder.events = cb.events
+	cacheBuilder.logger = cb.logger
+	cacheBuilder.sizeFunc = cb.sizeFunc
+	cacheBuilder.middlewares = cb.middlewares
+	cacheBuilder.slowCallback = cb.slowCallback
+	cacheBuilder.lockProfiling = cb.lockProfiling
+	cacheBuilder.lockFreeReads = cb.lockFreeReads
+	cacheBuilder.deferPromotion = cb.deferPromotion
+	cacheBuilder.evictBatch = cb.evictBatch
+	cacheBuilder.admission = cb.admission
+	cacheBuilder.pressure = cb.pressure
+	cacheBuilder.victim = cb.victim
+	cacheBuilder.lowWatermark = cb.lowWatermark
+	cacheBuilder.highWatermark = cb.highWatermark
+	cacheBuilder.keyspace = cb.keyspace
+	cacheBuilder.capacity = cb.capacity
+	cacheBuilder.weigher = cb.weigher
+	cacheBuilder.storage = cb.storage
+	if cb.cost != nil {
+		cacheBuilder.maxCost = cb.cost.limit
+		cacheBuilder.sharedCost = cb.cost
+	}
+
+	if cb.loaderExpireFunc != nil {
+		cacheBuilder = cacheBuilder.LoaderExpireFunc(cb.loaderExpireFunc)
+	}
+	if cb.evictedFunc != nil {
+		cacheBuilder = cacheBuilder.EvictedFunc(cb.evictedFunc)
+	}
+	if cb.expiredFunc != nil {
+		cacheBuilder = cacheBuilder.ExpiredFunc(cb.expiredFunc)
+	}
+	if cb.purgeVisitorFunc != nil {
+		cacheBuilder = cacheBuilder.PurgeVisitorFunc(cb.purgeVisitorFunc)
+	}
+	if cb.addedFunc != nil {
+		cacheBuilder = cacheBuilder.AddedFunc(cb.addedFunc)
+	}
+	if cb.expiration != nil {
+		cacheBuilder = cacheBuilder.Expiration(*cb.expiration)
+	}
+	if cb.sliding {
+		cacheBuilder = cacheBuilder.SlidingExpiration()
+	}
+	if cb.maxIdle > 0 {
+		cacheBuilder = cacheBuilder.MaxIdle(cb.maxIdle)
+	}
+	if cb.serveStale {
+		cacheBuilder = cacheBuilder.ServeStale()
+	}
+	if cb.retryPolicy != nil {
+		cacheBuilder = cacheBuilder.LoaderRetry(*cb.retryPolicy)
+	}
+	if cb.loaderTimeout > 0 {
+		cacheBuilder = cacheBuilder.LoaderTimeout(cb.loaderTimeout)
+	}
+	if cb.latencyBuckets != nil {
+		cacheBuilder = cacheBuilder.LoadLatencyBuckets(cb.latencyBuckets...)
+	}
+	if cb.callbackBurst > 0 && cb.callbackInterval > 0 {
+		cacheBuilder = cacheBuilder.BatchCallbacks(cb.callbackBurst, cb.callbackInterval)
+	}
+	if cb.refreshAfter > 0 {
+		cacheBuilder = cacheBuilder.RefreshAfter(cb.refreshAfter)
+	}
+	if cb.expirationMode != ExpirationLazy {
+		cacheBuilder = cacheBuilder.ExpirationMode(cb.expirationMode, cb.janitorInterval)
+	}
+	if cb.deserializeFunc != nil {
+		cacheBuilder = cacheBuilder.DeserializeFunc(cb.deserializeFunc)
+	}
+	if cb.serializeFunc != nil {
+		cacheBuilder = cacheBuilder.SerializeFunc(cb.serializeFunc)
+	}
+	if cb.lfuDecay > 0 {
+		cacheBuilder = cacheBuilder.LFUDecay(cb.lfuDecay)
+	}
+	if cb.arcGhostLimit > 0 {
+		cacheBuilder = cacheBuilder.ARCGhostLimit(cb.arcGhostLimit)
+	}
+	if cb.wheelTick > 0 {
+		cacheBuilder = cacheBuilder.TimingWheel(cb.wheelTick)
+	}
+	if cb.typedBuckets() {
+		cacheBuilder.newLRU = func(cb *CacheBuilder) Cache { return newTypedLRUCache[K, V](cb) }
+	}
+
+	return cacheBuilder
+}
+
+// typedBuckets reports whether the buckets store the keys and values unboxed,
+// which the LRU buckets do unless they store serialized values or serve reads
+// without the lock.
+func (cb *XCacheBuilder[K, V]) typedBuckets() bool {
+	return cb.tp == TYPE_LRU && cb.storage == HeapStorage &&
+		cb.serializeFunc == nil && cb.deserializeFunc == nil &&
+		!cb.lockFreeReads && !cb.deferPromotion
+}
+
+// hashKey hashes the key with the custom hasher, if any, or otherwise
+// with hashAny. String and integer keys are hashed without allocating.
+func (xc *XCache[K, V]) hashKey(key K) uint64 {
+	if xc.builder.hasher != nil {
+		return xc.builder.hasher(key)
+	}
+	if h, ok := hashBasic(key); ok {
+		return h
+	}
+	return hashAny(key)
+}
+
+// fanOut calls fn for every i in [0, n), on up to the configured number of workers
+// if parallel multi-key operations are enabled, and returns once all calls have returned.
+func (xc *XCache[K, V]) fanOut(n int, fn func(i int)) {
+	parallel(xc.builder.multiWorkers, n, fn)
+}
+
+// parallel calls fn for every i in [0, n) on up to workers goroutines,
+// or one after another if workers is below 2, and returns once all calls have returned.
+func parallel(workers, n int, fn func(i int)) {
+	workers = minInt(workers, n)
+	if workers < 2 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	var (
+		next int64 = -1
+		wg   sync.WaitGroup
+	)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// getBucket returns the bucket for the given key.
+// The caller must hold xc.mu for reading.
+func (xc *XCache[K, V]) getBucket(key K) Cache {
+	bucket, _ := xc.bucketOf(key)
+	return bucket
+}
+
+// bucketOf returns the bucket for the given key and the counter of its users.
+// The caller must hold xc.mu for reading.
+func (xc *XCache[K, V]) bucketOf(key K) (Cache, *int64) {
+	if xc.old != nil {
+		if i := xc.bucketIndex(key, xc.old.mask); i >= xc.old.next {
+			return xc.old.buckets[i], &xc.old.busy[i]
+		}
+	}
+	i := xc.bucketIndex(key, xc.bucketMask)
+	return xc.buckets[i], &xc.busy[i]
+}
+
+// useBucket returns the bucket for the given key and counts the caller as a user
+// of it until the caller passes the returned counter to release. xc.mu is only
+// held while the bucket is looked up, so loaders and callbacks run without it,
+// and Rebucket migrates a bucket only once it has no users.
+func (xc *XCache[K, V]) useBucket(key K) (Cache, *int64) {
+	for {
+		xc.mu.RLock()
+		if old := xc.old; old != nil && old.moving && xc.bucketIndex(key, old.mask) == old.next {
+			moved := old.moved
+			xc.mu.RUnlock()
+			<-moved
+			continue
+		}
+		bucket, busy := xc.bucketOf(key)
+		atomic.AddInt64(busy, 1)
+		xc.mu.RUnlock()
+		return bucket, busy
+	}
+}
+
+// useBuckets returns the buckets that hold entries, like allBuckets, and counts
+// the caller as a user of each of them until it calls the returned function.
+func (xc *XCache[K, V]) useBuckets() ([]Cache, func()) {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	busy := [][]int64{xc.busy}
+	if xc.old != nil {
+		busy = append(busy, xc.old.busy[xc.old.next:])
+	}
+	for _, counters := range busy {
+		for i := range counters {
+			atomic.AddInt64(&counters[i], 1)
+		}
+	}
+	return xc.allBuckets(), func() {
+		for _, counters := range busy {
+			for i := range counters {
+				atomic.AddInt64(&counters[i], -1)
+			}
+		}
+	}
+}
+
+// useBucketsOf groups keys by their buckets and counts the caller as a user of
+// each of these buckets until it calls the returned function.
+func (xc *XCache[K, V]) useBucketsOf(keys []K) (map[Cache][]interface{}, func()) {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	groups := make(map[Cache][]interface{})
+	var busy []*int64
+	for _, key := range keys {
+		bucket, n := xc.bucketOf(key)
+		group, ok := groups[bucket]
+		if !ok {
+			atomic.AddInt64(n, 1)
+			busy = append(busy, n)
+		}
+		groups[bucket] = append(group, key)
+	}
+	return groups, func() {
+		for _, n := range busy {
+			release(n)
+		}
+	}
+}
+
+// useBucketIn returns the bucket for the given key like useBucket, counting the
+// caller as a user of every bucket only once per used, which the caller must pass
+// to releaseAll once it is done.
+func (xc *XCache[K, V]) useBucketIn(key K, used map[Cache]*int64) Cache {
+	bucket, busy := xc.useBucket(key)
+	if _, ok := used[bucket]; ok {
+		release(busy)
+	} else {
+		used[bucket] = busy
+	}
+	return bucket
+}
+
+// releaseAll counts the caller as gone from the buckets in used, see useBucketIn.
+func releaseAll(used map[Cache]*int64) {
+	for _, busy := range used {
+		release(busy)
+	}
+}
+
+// release counts a user of a bucket as gone, see useBucket.
+func release(busy *int64) {
+	atomic.AddInt64(busy, -1)
+}
+
+// rlock locks xc.mu for reading once no bucket is being migrated by Rebucket.
+func (xc *XCache[K, V]) rlock() {
+	for {
+		xc.mu.RLock()
+		if xc.old == nil || !xc.old.moving {
+			return
+		}
+		moved := xc.old.moved
+		xc.mu.RUnlock()
+		<-moved
+	}
+}
+
+// bucketIndex returns the index of the bucket of key among mask+1 buckets.
+// Keys that are not routed by Router or RoutePrefix are hashed to the buckets
+// that are not reserved by RoutePrefix rules.
+func (xc *XCache[K, V]) bucketIndex(key K, mask uint64) int {
+	b := &xc.builder
+	if b.router != nil {
+		if i, ok := b.router(key); ok {
+			return int(uint64(i) & mask)
+		}
+	}
+	if len(b.routes) == 0 {
+		return int(xc.hashKey(key) & mask)
+	}
+	if s, ok := keyString(key); ok {
+		match := -1
+		for i, rule := range b.routes {
+			if strings.HasPrefix(s, rule.prefix) && (match < 0 || len(rule.prefix) > len(b.routes[match].prefix)) {
+				match = i
+			}
+		}
+		if match >= 0 {
+			return b.routes[match].bucket
+		}
+	}
+	hash := xc.hashKey(key)
+	for {
+		i := int(hash & mask)
+		if !b.reserves(i) {
+			return i
+		}
+		hash = hashUint64(hash)
+	}
+}
+
+// allBuckets returns the buckets that hold entries: while Rebucket runs,
+// these are the new buckets followed by the old buckets not migrated yet.
+// The caller must hold xc.mu for reading.
+func (xc *XCache[K, V]) allBuckets() []Cache {
+	if xc.old == nil {
+		return xc.buckets
+	}
+	buckets := make([]Cache, 0, len(xc.buckets)+len(xc.old.buckets)-xc.old.next)
+	buckets = append(buckets, xc.buckets...)
+	return append(buckets, xc.old.buckets[xc.old.next:]...)
+}
+
+// enforceCapacity evicts entries while the cache holds more entries than its
+// global capacity, each from the bucket that holds the most entries, and while
+// it weighs more than its MaxCost, each from the bucket that weighs the most.
+func (xc *XCache[K, V]) enforceCapacity() {
+	capacity, cost := xc.builder.capacity, xc.builder.cost
+	if (capacity == nil || capacity.excess() <= 0) && (cost == nil || cost.excess() <= 0) {
+		return
+	}
+	buckets, done := xc.useBuckets()
+	defer done()
+	if capacity != nil {
+		shrinkBuckets(buckets, capacity, func(bucket Cache) int64 {
+			return int64(bucket.Len(false))
+		})
+	}
+	if cost != nil {
+		shrinkBuckets(buckets, cost, Cache.Cost)
+	}
+}
+
+// shrinkBuckets evicts entries from buckets while limit is exceeded, each from
+// the bucket for which usage returns the most.
+func shrinkBuckets(buckets []Cache, limit *globalCapacity, usage func(Cache) int64) {
+	for limit.excess() > 0 {
+		var (
+			victim Cache
+			most   int64 = -1
+		)
+		for _, bucket := range buckets {
+			if n := usage(bucket); n > most {
+				victim, most = bucket, n
+			}
+		}
+		if victim == nil || victim.shrink(1) == 0 {
+			// every entry of the victim is pinned
+			return
+		}
+	}
+}
+
+// ruleTTL returns the expiration of the TTL rule that applies to key, if any.
+func (xc *XCache[K, V]) ruleTTL(key K) (time.Duration, bool) {
+	if len(xc.builder.ttlRules) == 0 {
+		return 0, false
+	}
+	s, ok := keyString(key)
+	if !ok {
+		return 0, false
+	}
+	var match *ttlRule
+	for i, rule := range xc.builder.ttlRules {
+		if strings.HasPrefix(s, rule.prefix) && (match == nil || len(rule.prefix) > len(match.prefix)) {
+			match = &xc.builder.ttlRules[i]
+		}
+	}
+	if match == nil {
+		return 0, false
+	}
+	return match.ttl, true
+}
+
+// Set inserts or updates the specified key-value pair.
+// The LRU buckets store the key and value unboxed, see Get, so that replacing
+// a value does not allocate unless callbacks, events or expirations keep it.
+func (xc *XCache[K, V]) Set(key K, value V) error {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	if ttl, ok := xc.ruleTTL(key); ok {
+		if typed, ok := bucket.(typedBucket[K, V]); ok {
+			return typed.setTypedWithExpire(key, value, ttl)
+		}
+		return bucket.SetWithExpire(key, value, ttl)
+	}
+	if typed, ok := bucket.(typedBucket[K, V]); ok {
+		return typed.setTyped(key, value)
+	}
+	return bucket.Set(key, value)
+}
+
+// SetWithExpire inserts or updates the specified key-value pair with an expiration time
+func (xc *XCache[K, V]) SetWithExpire(key K, value V, expiration time.Duration) error {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	if typed, ok := bucket.(typedBucket[K, V]); ok {
+		return typed.setTypedWithExpire(key, value, expiration)
+	}
+	return bucket.SetWithExpire(key, value, expiration)
+}
+
+// SetWithExpireAndIdle sets a key-value pair that expires after expiration
+// or once it has not been used for maxIdle, whichever comes first.
+// A non-positive duration disables the respective limit.
+func (xc *XCache[K, V]) SetWithExpireAndIdle(key K, value V, expiration, maxIdle time.Duration) error {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.SetWithExpireAndIdle(key, value, expiration, maxIdle)
+}
+
+// SetIfAbsent inserts the specified key-value pair only if the key is not present in the cache.
+// Returns true if the pair has been inserted.
+func (xc *XCache[K, V]) SetIfAbsent(key K, value V) (bool, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	if ttl, ok := xc.ruleTTL(key); ok {
+		return bucket.SetIfAbsentWithExpire(key, value, ttl)
+	}
+	return bucket.SetIfAbsent(key, value)
+}
+
+// SetIfAbsentWithExpire inserts the specified key-value pair with an expiration time
+// only if the key is not present in the cache.
+func (xc *XCache[K, V]) SetIfAbsentWithExpire(key K, value V, expiration time.Duration) (bool, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.SetIfAbsentWithExpire(key, value, expiration)
+}
+
+// Swap inserts or updates the specified key-value pair and returns the value it replaced.
+// existed reports whether the key was present in the cache before the call.
+func (xc *XCache[K, V]) Swap(key K, value V) (old V, existed bool, err error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	_, err = bucket.compute(key, func(v interface{}, found bool) (interface{}, error) {
+		if found {
+			old, existed = v.(V)
+		}
+		return value, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, false, err
+	}
+	return old, existed, nil
+}
+
+// SetMulti inserts or updates the specified key-value pairs.
+// Pairs are grouped by bucket so that each bucket lock is acquired only once.
+func (xc *XCache[K, V]) SetMulti(items map[K]V) error {
+	return xc.setMulti(items, nil)
+}
+
+// SetMultiWithExpire inserts or updates the specified key-value pairs with an expiration time.
+// Pairs are grouped by bucket so that each bucket lock is acquired only once.
+func (xc *XCache[K, V]) SetMultiWithExpire(items map[K]V, expiration time.Duration) error {
+	return xc.setMulti(items, &expiration)
+}
+
+func (xc *XCache[K, V]) setMulti(items map[K]V, expiration *time.Duration) error {
+	defer xc.enforceCapacity()
+	keys := make([]K, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	keyGroups, done := xc.useBucketsOf(keys)
+	defer done()
+	groups := make(map[Cache]map[interface{}]interface{}, len(keyGroups))
+	for bucket, keys := range keyGroups {
+		group := make(map[interface{}]interface{}, len(keys))
+		for _, k := range keys {
+			key := k.(K)
+			if expiration == nil {
+				if ttl, ok := xc.ruleTTL(key); ok {
+					if err := bucket.SetWithExpire(key, items[key], ttl); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			group[key] = items[key]
+		}
+		groups[bucket] = group
+	}
+
+	buckets := make([]Cache, 0, len(groups))
+	for bucket := range groups {
+		buckets = append(buckets, bucket)
+	}
+	errs := make([]error, len(buckets))
+	xc.fanOut(len(buckets), func(i int) {
+		errs[i] = buckets[i].setMulti(groups[buckets[i]], expiration)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the value for the specified key if it is present in the cache.
+// A hit does not allocate for string and integer keys with the LRU, LFU, ARC,
+// LIRS, FIFO, Score and TTL policies, unless middlewares are used, the Hasher
+// allocates or DeserializeFunc does. The LRU buckets store the keys and values
+// unboxed, unless SerializeFunc, LockFreeReads or DeferredPromotion is used, so
+// that neither a hit nor a miss boxes them.
+func (xc *XCache[K, V]) Get(key K) (V, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	if typed, ok := bucket.(typedBucket[K, V]); ok {
+		v, err := typed.getTyped(key)
+		if err == nil {
+			xc.recordHit()
+		} else if err == ErrKeyNotFoundError {
+			xc.recordMiss()
+		}
+		return v, err
+	}
+	value, ok, err := getTransient(bucket, key)
+	if !ok {
+		value, err = bucket.Get(key)
+	}
+	if err != nil {
+		var zero V
+		if err == ErrKeyNotFoundError {
+			xc.recordMiss()
+		}
+		if _, ok := err.(*StaleError); ok {
+			if v, ok := value.(V); ok {
+				return v, err
+			}
+		}
+		return zero, err
+	}
+
+	xc.recordHit()
+	if v, ok := value.(V); ok {
+		return v, nil
+	}
+
+	var zero V
+	return zero, fmt.Errorf("type assertion failed")
+}
+
+// GetIFPresent returns the value for the specified key if it is present in the cache
+func (xc *XCache[K, V]) GetIFPresent(key K) (V, error) {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, err := bucket.GetIFPresent(key)
+	if err != nil {
+		var zero V
+		if err == ErrKeyNotFoundError {
+			xc.recordMiss()
+		}
+		return zero, err
+	}
+
+	xc.recordHit()
+	if v, ok := value.(V); ok {
+		return v, nil
+	}
+
+	var zero V
+	return zero, fmt.Errorf("type assertion failed")
+}
+
+// GetWithExpiration returns the value for the specified key if it is present in the cache,
+// together with its expiration time. The expiration time is nil if the value never expires.
+func (xc *XCache[K, V]) GetWithExpiration(key K) (V, *time.Time, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, expiration, err := bucket.GetWithExpiration(key)
+	if err != nil {
+		var zero V
+		if err == ErrKeyNotFoundError {
+			xc.recordMiss()
+		}
+		return zero, nil, err
+	}
+
+	xc.recordHit()
+	if v, ok := value.(V); ok {
+		return v, expiration, nil
+	}
+
+	var zero V
+	return zero, nil, fmt.Errorf("type assertion failed")
+}
+
+// GetStale returns the value for the specified key even if it has expired,
+// as long as it has not been removed from the cache yet. Expired values are
+// removed lazily by Get and eagerly by DeleteExpired.
+// It does not update eviction state or hit/miss statistics.
+func (xc *XCache[K, V]) GetStale(key K) (V, bool) {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, ok := bucket.GetStale(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	v, ok := value.(V)
+	return v, ok
+}
+
+// GetVersioned returns the value for the specified key together with its version.
+// Every write assigns the entry a new version that is greater than all versions
+// previously assigned within its bucket. The version is 0 if the key is not present.
+// Use it with SetIfVersion for optimistic concurrency control.
+func (xc *XCache[K, V]) GetVersioned(key K) (V, uint64) {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, version := bucket.GetVersioned(key)
+	if version == 0 {
+		xc.recordMiss()
+		var zero V
+		return zero, 0
+	}
+
+	xc.recordHit()
+	v, ok := value.(V)
+	if !ok {
+		return v, 0
+	}
+	return v, version
+}
+
+// SetIfVersion inserts or updates the specified key-value pair only if the current
+// version of the key equals version, as returned by GetVersioned.
+// A version of 0 means the key must not be present.
+// Returns true if the pair has been written.
+func (xc *XCache[K, V]) SetIfVersion(key K, value V, version uint64) (bool, error) {
+	defer xc.enforceCapacity()
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.SetIfVersion(key, value, version)
+}
+
+// Info returns the metadata of the specified key, such as its creation time,
+// last access time, access count, expiration and eviction segment.
+// It does not update eviction state or hit/miss statistics.
+func (xc *XCache[K, V]) Info(key K) (EntryInfo, bool) {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.Info(key)
+}
+
+// Peek returns the value for the specified key if it is present in the cache
+// without updating any eviction algorithm statistics or positions.
+// This is a pure read operation that does not affect cache state.
+// Note: This method does not update hit/miss statistics.
+func (xc *XCache[K, V]) Peek(key K) (V, error) {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, err := bucket.Peek(key)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+
+	if v, ok := value.(V); ok {
+		return v, nil
+	}
+
+	var zero V
+	return zero, fmt.Errorf("type assertion failed")
+}
+
+// GetMulti returns the values for the specified keys that are present in the cache
+// and the keys that are missing. Keys are grouped by bucket so that each bucket
+// lock is acquired only once. LoaderFunc is not invoked for missing keys.
+func (xc *XCache[K, V]) GetMulti(keys []K) (map[K]V, []K) {
+	groups, done := xc.useBucketsOf(keys)
+	defer done()
+
+	type lookup struct {
+		found    map[interface{}]interface{}
+		notFound []interface{}
+	}
+	buckets := make([]Cache, 0, len(groups))
+	for bucket := range groups {
+		buckets = append(buckets, bucket)
+	}
+	lookups := make([]lookup, len(buckets))
+	xc.fanOut(len(buckets), func(i int) {
+		lookups[i].found, lookups[i].notFound = buckets[i].getMulti(groups[buckets[i]])
+	})
+
+	result := make(map[K]V, len(keys))
+	var missing []K
+	for _, l := range lookups {
+		found, notFound := l.found, l.notFound
+		for k, v := range found {
+			key := k.(K)
+			if value, ok := v.(V); ok {
+				result[key] = value
+				xc.recordHit()
+			} else {
+				missing = append(missing, key)
+				xc.recordMiss()
+			}
+		}
+		for _, k := range notFound {
+			missing = append(missing, k.(K))
+			xc.recordMiss()
+		}
+	}
+	return result, missing
 }
 
 // GetAll returns a map containing all key-value pairs in the cache
 func (xc *XCache[K, V]) GetAll(checkExpired bool) map[K]V {
 	result := make(map[K]V)
-	xc.mu.RLock()
-	defer xc.mu.RUnlock()
+	buckets, done := xc.useBuckets()
+	defer done()
 
-	for _, bucket := range xc.buckets {
-		bucketItems := bucket.GetALL(checkExpired)
+	items := make([]map[interface{}]interface{}, len(buckets))
+	xc.fanOut(len(buckets), func(i int) {
+		items[i] = buckets[i].GetALL(checkExpired)
+	})
+	for _, bucketItems := range items {
 		for k, v := range bucketItems {
 			if key, ok := k.(K); ok {
 				if value, ok := v.(V); ok {
@@ -325,26 +1568,330 @@ func (xc *XCache[K, V]) GetAll(checkExpired bool) map[K]V {
 	return result
 }
 
+// Sample returns up to n randomly chosen unexpired entries.
+// The number of entries drawn from each bucket is proportional to its size,
+// and the entries within a bucket are drawn uniformly by reservoir sampling, so
+// every entry is about as likely to be sampled. Only the buckets that entries
+// are drawn from are scanned, each under its own lock. Values are deserialized
+// like Get.
+func (xc *XCache[K, V]) Sample(n int) map[K]V {
+	result := make(map[K]V, n)
+	if n <= 0 {
+		return result
+	}
+
+	buckets, done := xc.useBuckets()
+	defer done()
+	lens := make([]int, len(buckets))
+	total := 0
+	for i, bucket := range buckets {
+		lens[i] = bucket.Len(false)
+		total += lens[i]
+	}
+	if total == 0 {
+		return result
+	}
+
+	// Draw without replacement so that no bucket is asked for more entries than it holds.
+	counts := make([]int, len(buckets))
+	for draws := minInt(n, total); draws > 0; draws-- {
+		r := rand.Intn(total)
+		for j, l := range lens {
+			if r < l {
+				counts[j]++
+				lens[j]--
+				total--
+				break
+			}
+			r -= l
+		}
+	}
+
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		for k, v := range buckets[i].sample(count) {
+			key, ok := k.(K)
+			if !ok {
+				continue
+			}
+			if value, ok := v.(V); ok {
+				result[key] = value
+			}
+		}
+	}
+	return result
+}
+
+// GetAllFunc calls fn for up to limit unexpired entries, visiting buckets one at a time,
+// and stops early if fn returns false. A non-positive limit visits every entry.
+// Unlike GetAll, it does not copy the entries into a map. Values are deserialized like Get.
+// fn is called while a bucket lock is held, so it must not access the cache.
+func (xc *XCache[K, V]) GetAllFunc(limit int, fn func(K, V) bool) {
+	buckets, done := xc.useBuckets()
+	defer done()
+	visited := 0
+	for _, bucket := range buckets {
+		more := bucket.walk(true, func(k, v interface{}) bool {
+			key, ok := k.(K)
+			if !ok {
+				return true
+			}
+			value, ok := v.(V)
+			if !ok {
+				return true
+			}
+			visited++
+			return fn(key, value) && (limit <= 0 || visited < limit)
+		})
+		if !more {
+			return
+		}
+	}
+}
+
 // Remove removes the specified key from the cache
 func (xc *XCache[K, V]) Remove(key K) bool {
-	bucket := xc.getBucket(key)
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
 	return bucket.Remove(key)
 }
 
-// Purge removes all key-value pairs from the cache
+// RemoveMulti removes the specified keys from the cache and returns the number of keys removed.
+// Keys are grouped by bucket so that each bucket lock is acquired only once.
+func (xc *XCache[K, V]) RemoveMulti(keys []K) int {
+	groups, done := xc.useBucketsOf(keys)
+	defer done()
+
+	buckets := make([]Cache, 0, len(groups))
+	for bucket := range groups {
+		buckets = append(buckets, bucket)
+	}
+	counts := make([]int, len(buckets))
+	xc.fanOut(len(buckets), func(i int) {
+		counts[i] = buckets[i].removeMulti(groups[buckets[i]])
+	})
+	removed := 0
+	for _, n := range counts {
+		removed += n
+	}
+	return removed
+}
+
+// GetAndRemove removes the specified key from the cache and returns its value.
+// Returns false if the key was not present.
+func (xc *XCache[K, V]) GetAndRemove(key K) (V, bool) {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	value, ok := bucket.GetAndRemove(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	v, ok := value.(V)
+	return v, ok
+}
+
+// DeleteExpired removes all expired entries from the cache and returns the number of removed entries.
+// ExpiredFunc is invoked for each removed entry.
+func (xc *XCache[K, V]) DeleteExpired() int {
+	buckets, done := xc.useBuckets()
+	defer done()
+	removed := 0
+	for _, bucket := range buckets {
+		removed += bucket.DeleteExpired()
+	}
+	return removed
+}
+
+// RemoveIf removes all entries for which fn returns true and returns the number of removed entries.
+// Values are deserialized like Get.
+// Buckets are scanned one at a time, and fn is called while the bucket lock is held,
+// so it must not access the cache.
+func (xc *XCache[K, V]) RemoveIf(fn func(K, V) bool) int {
+	buckets, done := xc.useBuckets()
+	defer done()
+	removed := 0
+	for _, bucket := range buckets {
+		removed += bucket.removeIf(func(k, v interface{}) bool {
+			key, ok := k.(K)
+			if !ok {
+				return false
+			}
+			value, ok := v.(V)
+			if !ok {
+				return false
+			}
+			return fn(key, value)
+		})
+	}
+	return removed
+}
+
+// Snapshot returns a point-in-time copy of all unexpired entries in the cache.
+// Each bucket is copied under its own lock, so the copy is consistent per bucket.
+// The copy uses the same bucket layout, hasher and routing, eviction type, storage,
+// clock and expiration settings, keeps the expiration time of every entry, and has
+// no loader, callbacks, events, second tier or admission policy, whose state the
+// copy must not share with the cache. A memory pressure limit is checked by a
+// watcher of the copy's own.
+func (xc *XCache[K, V]) Snapshot() *XCache[K, V] {
+	xc.rlock()
+	builder := NewXCache[K, V](xc.bucketSize).
+		BucketCount(xc.bucketCount).
+		EvictType(xc.builder.tp).
+		LFUDecay(xc.builder.lfuDecay).
+		ARCGhostLimit(xc.builder.arcGhostLimit).
+		TimingWheel(xc.builder.wheelTick).
+		Clock(xc.builder.clock)
+	builder.totalSize = xc.builder.totalSize
+	builder.lockProfiling = xc.builder.lockProfiling
+	builder.lockFreeReads = xc.builder.lockFreeReads
+	builder.deferPromotion = xc.builder.deferPromotion
+	builder.evictBatch = xc.builder.evictBatch
+	if p := xc.builder.pressure; p != nil {
+		builder.MemoryPressure(p.limit, p.fraction, p.interval)
+	}
+	builder.lowWatermark = xc.builder.lowWatermark
+	builder.highWatermark = xc.builder.highWatermark
+	builder.statsFromBuckets = xc.builder.statsFromBuckets
+	builder.autoBucketCount = xc.builder.autoBucketCount
+	if xc.builder.capacity != nil {
+		builder.GlobalCapacity(int(xc.builder.capacity.limit))
+	}
+	if xc.builder.cost != nil {
+		builder.MaxCost(xc.builder.cost.limit)
+	}
+	builder.weigher = xc.builder.weigher
+	builder.sampleSize = xc.builder.sampleSize
+	builder.scoreFunc = xc.builder.scoreFunc
+	builder.storage = xc.builder.storage
+	builder.serializeFunc = xc.builder.serializeFunc
+	builder.deserializeFunc = xc.builder.deserializeFunc
+	builder.sizeFunc = xc.builder.sizeFunc
+	builder.hasher = xc.builder.hasher
+	builder.routes = xc.builder.routes
+	builder.router = xc.builder.router
+	builder.ttlRules = xc.builder.ttlRules
+	builder.expiration = xc.builder.expiration
+	builder.sliding = xc.builder.sliding
+	builder.maxIdle = xc.builder.maxIdle
+	builder.expirationMode = xc.builder.expirationMode
+	builder.janitorInterval = xc.builder.janitorInterval
+	builder.multiWorkers = xc.builder.multiWorkers
+	builder.swapOnPurge = xc.builder.swapOnPurge
+	xc.mu.RUnlock()
+	snapshot := builder.Build()
+
+	buckets, done := xc.useBuckets()
+	defer done()
+	for _, bucket := range buckets {
+		groups := make(map[Cache][]cacheEntry)
+		for _, e := range bucket.entries() {
+			target := snapshot.getBucket(e.key.(K))
+			groups[target] = append(groups[target], e)
+		}
+		// the values are stored as they are, already serialized if need be
+		for target, entries := range groups {
+			target.restore(entries)
+		}
+	}
+	return snapshot
+}
+
+// Purge removes all key-value pairs from the cache. The buckets are purged in
+// parallel, so PurgeVisitorFunc must be safe for concurrent use.
 func (xc *XCache[K, V]) Purge() {
-	for _, bucket := range xc.buckets {
-		bucket.Purge()
+	xc.purgeBuckets(Cache.Purge)
+}
+
+// PurgeWithVisitor removes all key-value pairs from the cache and calls fn for each
+// of them, after PurgeVisitorFunc if it is set. fn is called while the bucket lock is
+// held, so it must not access the cache, unless SwapOnPurge is set. The buckets are
+// purged in parallel, so fn must be safe for concurrent use.
+func (xc *XCache[K, V]) PurgeWithVisitor(fn func(K, V)) {
+	visit := func(k, v interface{}) {
+		if xc.builder.purgeVisitorFunc != nil {
+			xc.builder.purgeVisitorFunc(k, v)
+		}
+		if key, value, ok := xc.builder.typed(k, v); ok {
+			fn(key, value)
+		}
+	}
+	xc.purgeBuckets(func(bucket Cache) {
+		bucket.purge(visit)
+	})
+}
+
+// purgeBuckets calls purge for every bucket in parallel. With SwapOnPurge, the
+// buckets are replaced first, and purge is called for the old buckets afterwards.
+func (xc *XCache[K, V]) purgeBuckets(purge func(Cache)) {
+	workers := maxInt(xc.builder.multiWorkers, runtime.GOMAXPROCS(0))
+	if !xc.builder.swapOnPurge {
+		buckets, done := xc.useBuckets()
+		defer done()
+		parallel(workers, len(buckets), func(i int) {
+			purge(buckets[i])
+		})
+		return
+	}
+	buckets := xc.swapBuckets()
+	parallel(workers, len(buckets), func(i int) {
+		purge(buckets[i])
+		buckets[i].Close()
+	})
+}
+
+// swapBuckets replaces the buckets with new, empty buckets and returns the old ones,
+// which no longer count towards the global capacity and cost of the cache.
+// xc.mu is only held while the buckets are replaced, so that the operations that
+// still use the old buckets, and the loaders and callbacks they call, do not keep
+// the other operations waiting.
+func (xc *XCache[K, V]) swapBuckets() []Cache {
+	xc.rebucketMu.Lock()
+	defer xc.rebucketMu.Unlock()
+
+	xc.mu.RLock()
+	cb := xc.builder
+	cb.bucketCount = xc.bucketCount
+	xc.mu.RUnlock()
+	sizes := cb.bucketSizes()
+	buckets := make([]Cache, cb.bucketCount)
+	for i := range buckets {
+		buckets[i] = cb.buildBucket(sizes[i])
+	}
+
+	xc.mu.Lock()
+	old := xc.buckets
+	xc.buckets = buckets
+	xc.busy = make([]int64, len(buckets))
+	for _, bucket := range old {
+		xc.retire(bucket)
+	}
+	xc.mu.Unlock()
+	for _, bucket := range old {
+		bucket.detach()
+	}
+	return old
+}
+
+// Close stops the background janitors of the cache, if any, and delivers the pending callbacks
+func (xc *XCache[K, V]) Close() {
+	buckets, done := xc.useBuckets()
+	defer done()
+	for _, bucket := range buckets {
+		bucket.Close()
 	}
 }
 
 // Keys returns a slice containing all keys in the cache
 func (xc *XCache[K, V]) Keys(checkExpired bool) []K {
 	var keys []K
-	xc.mu.RLock()
-	defer xc.mu.RUnlock()
+	buckets, done := xc.useBuckets()
+	defer done()
 
-	for _, bucket := range xc.buckets {
+	for _, bucket := range buckets {
 		bucketKeys := bucket.Keys(checkExpired)
 		for _, k := range bucketKeys {
 			if key, ok := k.(K); ok {
@@ -356,10 +1903,54 @@ func (xc *XCache[K, V]) Keys(checkExpired bool) []K {
 	return keys
 }
 
+// KeysChan streams the keys in the cache over the returned channel.
+// Buckets are visited one at a time, each looked up under the lock of the cache
+// when it is reached, so only a single bucket's keys are held in memory and only
+// a single bucket lock is taken at any moment. Keys may be missed or repeated if
+// Rebucket runs while streaming.
+// The channel is closed once all keys have been sent or ctx is done.
+func (xc *XCache[K, V]) KeysChan(ctx context.Context, checkExpired bool) <-chan K {
+	ch := make(chan K)
+	go func() {
+		defer close(ch)
+		for i := 0; ; i++ {
+			keys, ok := xc.bucketKeys(i, checkExpired)
+			if !ok {
+				return
+			}
+			for _, k := range keys {
+				key, ok := k.(K)
+				if !ok {
+					continue
+				}
+				select {
+				case ch <- key:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// bucketKeys returns the keys of the i-th bucket of the cache as it is now, or
+// false if the cache has no more than i buckets.
+func (xc *XCache[K, V]) bucketKeys(i int, checkExpired bool) ([]interface{}, bool) {
+	buckets, done := xc.useBuckets()
+	defer done()
+	if i >= len(buckets) {
+		return nil, false
+	}
+	return buckets[i].Keys(checkExpired), true
+}
+
 // Len returns the number of items in the cache
 func (xc *XCache[K, V]) Len(checkExpired bool) int {
+	buckets, done := xc.useBuckets()
+	defer done()
 	totalLen := 0
-	for _, bucket := range xc.buckets {
+	for _, bucket := range buckets {
 		totalLen += bucket.Len(checkExpired)
 	}
 	return totalLen
@@ -367,51 +1958,588 @@ func (xc *XCache[K, V]) Len(checkExpired bool) int {
 
 // Has returns true if the key exists in the cache
 func (xc *XCache[K, V]) Has(key K) bool {
-	bucket := xc.getBucket(key)
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
 	return bucket.Has(key)
 }
 
+// Touch resets the expiration of the specified key to the default expiration
+// without returning its value or updating hit/miss statistics.
+func (xc *XCache[K, V]) Touch(key K) bool {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.Touch(key)
+}
+
+// TouchWithExpire resets the expiration of the specified key to the given duration
+// without returning its value or updating hit/miss statistics.
+func (xc *XCache[K, V]) TouchWithExpire(key K, expiration time.Duration) bool {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.TouchWithExpire(key, expiration)
+}
+
+// SetExpiration changes the expiration of the specified key in place.
+// A non-positive duration removes the expiration so that the key never expires.
+func (xc *XCache[K, V]) SetExpiration(key K, expiration time.Duration) bool {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.SetExpiration(key, expiration)
+}
+
+// Pin prevents the specified key from being evicted.
+// Pinned keys are still removed by Remove and on expiration.
+func (xc *XCache[K, V]) Pin(key K) bool {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.Pin(key)
+}
+
+// Unpin makes the specified key eligible for eviction again.
+func (xc *XCache[K, V]) Unpin(key K) bool {
+	bucket, busy := xc.useBucket(key)
+	defer release(busy)
+	return bucket.Unpin(key)
+}
+
+// recordHit counts a hit of a lookup, unless the bucket counters are used instead.
+func (xc *XCache[K, V]) recordHit() {
+	if !xc.builder.statsFromBuckets {
+		xc.stats.IncrHitCount()
+	}
+}
+
+// recordMiss counts a miss of a lookup, unless the bucket counters are used instead.
+func (xc *XCache[K, V]) recordMiss() {
+	if !xc.builder.statsFromBuckets {
+		xc.stats.IncrMissCount()
+	}
+}
+
+// lookups returns the number of hits and misses, either counted by the XCache
+// itself or summed up from its buckets with StatsFromBuckets.
+func (xc *XCache[K, V]) lookups() (hits, misses uint64) {
+	if !xc.builder.statsFromBuckets {
+		return xc.stats.HitCount(), xc.stats.MissCount()
+	}
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	hits, misses = xc.retired.Hits, xc.retired.Misses
+	for _, bucket := range xc.allBuckets() {
+		hits += bucket.HitCount()
+		misses += bucket.MissCount()
+	}
+	return hits, misses
+}
+
 // HitCount returns hit count
 func (xc *XCache[K, V]) HitCount() uint64 {
-	return xc.stats.HitCount()
+	hits, _ := xc.lookups()
+	return hits
 }
 
 // MissCount returns miss count
 func (xc *XCache[K, V]) MissCount() uint64 {
-	return xc.stats.MissCount()
+	_, misses := xc.lookups()
+	return misses
 }
 
 // LookupCount returns lookup count
 func (xc *XCache[K, V]) LookupCount() uint64 {
-	return xc.stats.LookupCount()
+	hits, misses := xc.lookups()
+	return hits + misses
 }
 
 // HitRate returns rate for cache hitting
 func (xc *XCache[K, V]) HitRate() float64 {
-	return xc.stats.HitRate()
+	hits, misses := xc.lookups()
+	if hits+misses == 0 {
+		return 0.0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// LoadCount returns the number of loads that have been started
+func (xc *XCache[K, V]) LoadCount() uint64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	count := xc.retired.Loads
+	for _, bucket := range xc.allBuckets() {
+		count += bucket.LoadCount()
+	}
+	return count
+}
+
+// SharedLoadCount returns the number of gets that have joined a load in flight instead of starting one
+func (xc *XCache[K, V]) SharedLoadCount() uint64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	count := xc.retired.SharedLoads
+	for _, bucket := range xc.allBuckets() {
+		count += bucket.SharedLoadCount()
+	}
+	return count
+}
+
+// LoadLatency returns the histogram of the durations of the loads of all buckets
+func (xc *XCache[K, V]) LoadLatency() LatencyHistogram {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	var h LatencyHistogram
+	if xc.retiredLatency.Counts != nil {
+		h.merge(xc.retiredLatency)
+	}
+	for _, bucket := range xc.allBuckets() {
+		h.merge(bucket.LoadLatency())
+	}
+	return h
+}
+
+// EvictionCount returns the number of entries that have been evicted to make room for other entries
+func (xc *XCache[K, V]) EvictionCount() uint64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	count := xc.retired.Evictions
+	for _, bucket := range xc.allBuckets() {
+		count += bucket.EvictionCount()
+	}
+	return count
+}
+
+// ExpirationCount returns the number of entries that have been removed because they have expired
+func (xc *XCache[K, V]) ExpirationCount() uint64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	count := xc.retired.Expirations
+	for _, bucket := range xc.allBuckets() {
+		count += bucket.ExpirationCount()
+	}
+	return count
+}
+
+// CallbackTime returns the total time spent in the callbacks of all buckets
+func (xc *XCache[K, V]) CallbackTime() time.Duration {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	d := xc.retired.CallbackTime
+	for _, bucket := range xc.allBuckets() {
+		d += bucket.CallbackTime()
+	}
+	return d
+}
+
+// EstimatedBytes returns the estimated number of bytes used by the entries of all buckets
+func (xc *XCache[K, V]) EstimatedBytes() int64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	var bytes int64
+	for _, bucket := range xc.allBuckets() {
+		bytes += bucket.EstimatedBytes()
+	}
+	return bytes
+}
+
+// Cost returns the total weight of the entries of all buckets as computed by
+// the Weigher, or zero if no Weigher is set
+func (xc *XCache[K, V]) Cost() int64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	var cost int64
+	for _, bucket := range xc.allBuckets() {
+		cost += bucket.Cost()
+	}
+	return cost
+}
+
+// RemovalCount returns the number of entries that have been removed explicitly
+func (xc *XCache[K, V]) RemovalCount() uint64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	count := xc.retired.Removals
+	for _, bucket := range xc.allBuckets() {
+		count += bucket.RemovalCount()
+	}
+	return count
+}
+
+// ReplacementCount returns the number of values that have been overwritten by a new value for the same key
+func (xc *XCache[K, V]) ReplacementCount() uint64 {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	count := xc.retired.Replacements
+	for _, bucket := range xc.allBuckets() {
+		count += bucket.ReplacementCount()
+	}
+	return count
+}
+
+// Stats returns a snapshot of the statistics of the cache and each of its buckets.
+// The counters are read one after another, so they may be slightly inconsistent
+// with each other while the cache is in use.
+func (xc *XCache[K, V]) Stats() CacheStats {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	buckets := xc.allBuckets()
+	cs := CacheStats{
+		Hits:            xc.stats.HitCount(),
+		Misses:          xc.stats.MissCount(),
+		Evictions:       xc.retired.Evictions,
+		Expirations:     xc.retired.Expirations,
+		Removals:        xc.retired.Removals,
+		Replacements:    xc.retired.Replacements,
+		CallbackTime:    xc.retired.CallbackTime,
+		LockContentions: xc.retired.LockContentions,
+		LockWaitTime:    xc.retired.LockWaitTime,
+		BucketCount:     xc.bucketCount,
+		AutoBuckets:     xc.builder.autoBucketCount,
+		Buckets:         make([]BucketStats, len(buckets)),
+	}
+	if xc.retiredLatency.Counts != nil {
+		cs.LoadLatency.merge(xc.retiredLatency)
+	}
+	if xc.builder.statsFromBuckets {
+		cs.Hits, cs.Misses = xc.retired.Hits, xc.retired.Misses
+	}
+	for i, bucket := range buckets {
+		bs := bucketStats(bucket)
+		if xc.builder.statsFromBuckets {
+			cs.Hits += bs.Hits
+			cs.Misses += bs.Misses
+		}
+		cs.Evictions += bs.Evictions
+		cs.Expirations += bs.Expirations
+		cs.Removals += bs.Removals
+		cs.Replacements += bs.Replacements
+		cs.LoadLatency.merge(bucket.LoadLatency())
+		cs.Entries += bs.Entries
+		cs.EstimatedBytes += bs.EstimatedBytes
+		cs.Cost += bs.Cost
+		cs.CallbackTime += bs.CallbackTime
+		cs.LockContentions += bs.LockContentions
+		cs.LockWaitTime += bs.LockWaitTime
+		cs.Buckets[i] = bs
+	}
+	cs.Lookups = cs.Hits + cs.Misses
+	if cs.Lookups > 0 {
+		cs.HitRate = float64(cs.Hits) / float64(cs.Lookups)
+	}
+	return cs
+}
+
+// BucketStats returns a snapshot of the statistics of each bucket, indexed by bucket.
+// It is the same as Stats().Buckets without computing the totals.
+func (xc *XCache[K, V]) BucketStats() []BucketStats {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	buckets := xc.allBuckets()
+	stats := make([]BucketStats, len(buckets))
+	for i, bucket := range buckets {
+		stats[i] = bucketStats(bucket)
+	}
+	return stats
+}
+
+// bucketStats returns a snapshot of the statistics of bucket.
+func bucketStats(bucket Cache) BucketStats {
+	return BucketStats{
+		Entries:         bucket.Len(true),
+		Hits:            bucket.HitCount(),
+		Misses:          bucket.MissCount(),
+		HitRate:         bucket.HitRate(),
+		Loads:           bucket.LoadCount(),
+		SharedLoads:     bucket.SharedLoadCount(),
+		Evictions:       bucket.EvictionCount(),
+		Expirations:     bucket.ExpirationCount(),
+		Removals:        bucket.RemovalCount(),
+		Replacements:    bucket.ReplacementCount(),
+		EstimatedBytes:  bucket.EstimatedBytes(),
+		Cost:            bucket.Cost(),
+		CallbackTime:    bucket.CallbackTime(),
+		Locks:           bucket.LockCount(),
+		LockContentions: bucket.LockContentionCount(),
+		LockWaitTime:    bucket.LockWaitTime(),
+	}
+}
+
+// BucketBalance reports how evenly the entries and lookups are distributed over the buckets.
+// A bucket with many more entries or lookups than the others indicates that the keys
+// are not hashed evenly, which makes the lock of that bucket a hotspot.
+func (xc *XCache[K, V]) BucketBalance() BucketBalance {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	var (
+		b       BucketBalance
+		total   int
+		lookups uint64
+	)
+	buckets := xc.allBuckets()
+	lens := make([]int, len(buckets))
+	for i, bucket := range buckets {
+		n := bucket.Len(false)
+		lens[i] = n
+		total += n
+		if i == 0 || n < b.MinLen {
+			b.MinLen = n
+		}
+		if n > b.MaxLen {
+			b.MaxLen = n
+		}
+		l := bucket.LookupCount()
+		lookups += l
+		if i == 0 || l > b.HottestLookups {
+			b.HottestBucket, b.HottestLookups = i, l
+		}
+	}
+	if len(lens) == 0 {
+		return b
+	}
+	b.MeanLen = float64(total) / float64(len(lens))
+	b.MeanLookups = float64(lookups) / float64(len(lens))
+	var variance float64
+	for _, n := range lens {
+		d := float64(n) - b.MeanLen
+		variance += d * d
+	}
+	b.StdDevLen = math.Sqrt(variance / float64(len(lens)))
+	return b
 }
 
 // GetBucketCount returns the number of buckets
 func (xc *XCache[K, V]) GetBucketCount() int {
+	xc.mu.RLock()
+	defer xc.mu.RUnlock()
 	return xc.bucketCount
 }
 
+// Rebucket changes the number of buckets of the cache to count, which is rounded
+// up to a power of two as by BucketCount, while the cache is in use. The entries
+// are migrated to their new buckets one old bucket at a time, each once no
+// operation uses it, and only operations on the keys of the bucket that is being
+// migrated wait for it. Loaders and callbacks may use the cache meanwhile.
+//
+// With TotalSize, the total capacity is divided across the new buckets; otherwise
+// every new bucket holds the per-bucket size passed to NewXCache, so the capacity
+// changes with the number of buckets, and entries that no longer fit are evicted.
+// Migrated entries keep their value and expiration time, and do not trigger
+// AddedFunc or events; their access history, pins and idle limits start over.
+func (xc *XCache[K, V]) Rebucket(count int) error {
+	xc.rebucketMu.Lock()
+	defer xc.rebucketMu.Unlock()
+
+	cb := xc.builder
+	cb.BucketCount(count)
+	if cb.bucketCount == xc.bucketCount {
+		xc.mu.Lock()
+		xc.builder.autoBucketCount = cb.autoBucketCount
+		xc.mu.Unlock()
+		return nil
+	}
+	if cb.capacity == nil && cb.totalSize > 0 && cb.totalSize < cb.bucketCount {
+		return fmt.Errorf("%w: total size %d < bucket count %d", ErrInvalidConfig, cb.totalSize, cb.bucketCount)
+	}
+	if err := cb.validateRoutes(cb.bucketCount); err != nil {
+		return err
+	}
+	sizes := cb.bucketSizes()
+	buckets := make([]Cache, cb.bucketCount)
+	for i := range buckets {
+		buckets[i] = cb.buildBucket(sizes[i])
+	}
+
+	xc.mu.Lock()
+	old := &oldBuckets{buckets: xc.buckets, busy: xc.busy, mask: xc.bucketMask}
+	xc.buckets = buckets
+	xc.busy = make([]int64, len(buckets))
+	xc.bucketCount = cb.bucketCount
+	xc.builder.autoBucketCount = cb.autoBucketCount
+	xc.bucketMask = uint64(cb.bucketCount - 1)
+	xc.old = old
+	xc.mu.Unlock()
+
+	for i, bucket := range old.buckets {
+		// Remove the expired entries first, so that ExpiredFunc is called for them.
+		bucket.DeleteExpired()
+		xc.lockUnused(&old.busy[i])
+		old.moving, old.moved = true, make(chan struct{})
+		xc.mu.Unlock()
+
+		xc.migrate(bucket)
+
+		xc.mu.Lock()
+		xc.retire(bucket)
+		old.next++
+		old.moving = false
+		close(old.moved)
+		if old.next == len(old.buckets) {
+			xc.old = nil
+		}
+		xc.mu.Unlock()
+		bucket.Close()
+	}
+	return nil
+}
+
+// lockUnused locks xc.mu for writing once no operation uses the bucket whose
+// users busy counts. As operations only start to use a bucket while they hold
+// xc.mu for reading, the bucket stays unused until xc.mu is unlocked. If the
+// bucket is still in use after rebucketDrainTimeout, for example by a load,
+// xc.mu is unlocked again for rebucketPollInterval, so that the other operations,
+// including those of the load itself, do not wait for it.
+func (xc *XCache[K, V]) lockUnused(busy *int64) {
+	for {
+		xc.mu.Lock()
+		deadline := time.Now().Add(rebucketDrainTimeout)
+		for atomic.LoadInt64(busy) > 0 && time.Now().Before(deadline) {
+			runtime.Gosched()
+		}
+		if atomic.LoadInt64(busy) == 0 {
+			return
+		}
+		xc.mu.Unlock()
+		time.Sleep(rebucketPollInterval)
+	}
+}
+
+// migrate moves the entries of an old bucket, which must not be in use, to the
+// new buckets. The caller must hold rebucketMu, so that the layout does not change.
+func (xc *XCache[K, V]) migrate(bucket Cache) {
+	groups := make(map[Cache][]cacheEntry)
+	for _, e := range bucket.entries() {
+		target := xc.buckets[xc.bucketIndex(e.key.(K), xc.bucketMask)]
+		groups[target] = append(groups[target], e)
+	}
+	for target, entries := range groups {
+		target.restore(entries)
+	}
+	if xc.builder.capacity != nil {
+		// the restored entries have been counted again by their new buckets
+		xc.builder.capacity.add(-int64(bucket.Len(false)))
+	}
+	if xc.builder.cost != nil {
+		xc.builder.cost.add(-bucket.Cost())
+	}
+}
+
+// retire adds the counters of a bucket that is replaced to the counters of the cache.
+// The caller must hold xc.mu for writing.
+func (xc *XCache[K, V]) retire(bucket Cache) {
+	xc.retired.Hits += bucket.HitCount()
+	xc.retired.Misses += bucket.MissCount()
+	xc.retired.Loads += bucket.LoadCount()
+	xc.retired.SharedLoads += bucket.SharedLoadCount()
+	xc.retired.Evictions += bucket.EvictionCount()
+	xc.retired.Expirations += bucket.ExpirationCount()
+	xc.retired.Removals += bucket.RemovalCount()
+	xc.retired.Replacements += bucket.ReplacementCount()
+	xc.retired.CallbackTime += bucket.CallbackTime()
+	xc.retired.Locks += bucket.LockCount()
+	xc.retired.LockContentions += bucket.LockContentionCount()
+	xc.retired.LockWaitTime += bucket.LockWaitTime()
+	xc.retiredLatency.merge(bucket.LoadLatency())
+}
+
 // GetBucketIndex returns the bucket index for the given key (for debugging)
 func (xc *XCache[K, V]) GetBucketIndex(key K) int {
-	hash := xc.hashKey(key)
-	return int(hash % uint64(xc.bucketCount))
+	xc.mu.RLock()
+	defer xc.mu.RUnlock()
+	return xc.bucketIndex(key, xc.bucketMask)
 }
 
 // GetBucketStats returns statistics for each bucket
+//
+// Deprecated: Use BucketStats, which returns the same statistics as typed fields.
 func (xc *XCache[K, V]) GetBucketStats() map[int]map[string]interface{} {
+	xc.rlock()
+	defer xc.mu.RUnlock()
 	result := make(map[int]map[string]interface{})
-	for i, bucket := range xc.buckets {
+	for i, bucket := range xc.allBuckets() {
 		result[i] = map[string]interface{}{
-			"len":        bucket.Len(true),
-			"hit_count":  bucket.HitCount(),
-			"miss_count": bucket.MissCount(),
-			"hit_rate":   bucket.HitRate(),
+			"len":               bucket.Len(true),
+			"hit_count":         bucket.HitCount(),
+			"miss_count":        bucket.MissCount(),
+			"hit_rate":          bucket.HitRate(),
+			"load_count":        bucket.LoadCount(),
+			"shared_load_count": bucket.SharedLoadCount(),
 		}
 	}
 	return result
 }
+
+// Clock returns the clock of the cache, see XCacheBuilder.Clock.
+func (xc *XCache[K, V]) Clock() Clock {
+	return xc.builder.clock
+}
+
+// Events returns the channel on which the changes of the entries of all buckets are published,
+// or nil if events are not enabled
+func (xc *XCache[K, V]) Events() <-chan Event {
+	if xc.builder.events == nil {
+		return nil
+	}
+	return xc.builder.events.ch
+}
+
+// DroppedEventCount returns the number of events that have been dropped because the event buffer was full
+func (xc *XCache[K, V]) DroppedEventCount() uint64 {
+	if xc.builder.events == nil {
+		return 0
+	}
+	return xc.builder.events.droppedCount()
+}
+
+// Subscribe calls fn for every keyspace notification of a key that matches the glob pattern
+// until the returned function is called. fn must not call the cache.
+func (xc *XCache[K, V]) Subscribe(pattern string, fn func(KeyspaceNotification)) (func(), error) {
+	if xc.builder.keyspace == nil {
+		return nil, ErrKeyspaceNotificationsDisabled
+	}
+	return xc.builder.keyspace.subscribe(&subscription{pattern: compileGlob(pattern), fn: fn}), nil
+}
+
+// SubscribeChan sends every keyspace notification of a key that matches the glob pattern
+// to the returned channel, which buffers up to size notifications, until the returned function is called
+func (xc *XCache[K, V]) SubscribeChan(pattern string, size int) (<-chan KeyspaceNotification, func(), error) {
+	if xc.builder.keyspace == nil {
+		return nil, nil, ErrKeyspaceNotificationsDisabled
+	}
+	ch := make(chan KeyspaceNotification, size)
+	return ch, xc.builder.keyspace.subscribe(&subscription{pattern: compileGlob(pattern), ch: ch}), nil
+}
+
+// DroppedNotificationCount returns the number of keyspace notifications that have been dropped
+func (xc *XCache[K, V]) DroppedNotificationCount() uint64 {
+	if xc.builder.keyspace == nil {
+		return 0
+	}
+	return xc.builder.keyspace.droppedCount()
+}
+
+// DebugState returns the state of the eviction policy of each bucket, indexed by bucket.
+func (xc *XCache[K, V]) DebugState() []DebugState {
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	buckets := xc.allBuckets()
+	states := make([]DebugState, len(buckets))
+	for i, bucket := range buckets {
+		states[i] = bucket.DebugState()
+	}
+	return states
+}
+
+// ARCState returns the ARC state of each bucket, indexed by bucket.
+// Returns nil if the cache does not use ARC eviction.
+func (xc *XCache[K, V]) ARCState() []ARCState {
+	if xc.builder.tp != TYPE_ARC {
+		return nil
+	}
+	xc.rlock()
+	defer xc.mu.RUnlock()
+	buckets := xc.allBuckets()
+	states := make([]ARCState, len(buckets))
+	for i, bucket := range buckets {
+		if s := bucket.DebugState(); s.ARC != nil {
+			states[i] = *s.ARC
+		}
+	}
+	return states
+}
@@ -0,0 +1,1766 @@
+package xcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestXCacheSetIfAbsent(t *testing.T) {
+	cache := NewXCache[string, int](10).
+		BucketCount(4).
+		Build()
+
+	if ok, err := cache.SetIfAbsent("key", 1); err != nil || !ok {
+		t.Fatalf("first SetIfAbsent should succeed: %v, %v", ok, err)
+	}
+	if ok, err := cache.SetIfAbsent("key", 2); err != nil || ok {
+		t.Fatalf("second SetIfAbsent should not succeed: %v, %v", ok, err)
+	}
+	if v, _ := cache.Get("key"); v != 1 {
+		t.Errorf("%v != %v", v, 1)
+	}
+}
+
+func TestXCacheIncrementDecrement(t *testing.T) {
+	cache := NewXCache[string, int64](10).
+		BucketCount(4).
+		Build()
+
+	if v, err := Increment(cache, "counter", 5); err != nil || v != 5 {
+		t.Fatalf("Increment on missing key: %v, %v", v, err)
+	}
+	if v, err := Increment(cache, "counter", 2); err != nil || v != 7 {
+		t.Fatalf("Increment: %v, %v", v, err)
+	}
+	if v, err := Decrement(cache, "counter", 10); err != nil || v != -3 {
+		t.Fatalf("Decrement: %v, %v", v, err)
+	}
+	if v, err := Decrement(cache, "other", 1); err != nil || v != -1 {
+		t.Fatalf("Decrement on missing key: %v, %v", v, err)
+	}
+
+	floats := NewXCache[string, float64](10).Build()
+	if v, err := Increment(floats, "f", 0.5); err != nil || v != 0.5 {
+		t.Fatalf("Increment float: %v, %v", v, err)
+	}
+}
+
+func TestXCacheIncrementConcurrent(t *testing.T) {
+	cache := NewXCache[string, int](10).
+		BucketCount(4).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Increment(cache, "counter", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := cache.Get("counter"); v != 100 {
+		t.Errorf("%v != %v", v, 100)
+	}
+}
+
+func TestXCacheGetMulti(t *testing.T) {
+	cache := NewXCache[int, int](100).
+		BucketCount(8).
+		Build()
+
+	for i := 0; i < 50; i++ {
+		cache.Set(i, i*10)
+	}
+
+	keys := []int{0, 10, 20, 49, 50, 99}
+	found, missing := cache.GetMulti(keys)
+	if len(found) != 4 {
+		t.Fatalf("%v != %v", len(found), 4)
+	}
+	for _, k := range []int{0, 10, 20, 49} {
+		if found[k] != k*10 {
+			t.Errorf("%v != %v", found[k], k*10)
+		}
+	}
+	if len(missing) != 2 {
+		t.Fatalf("%v != %v", len(missing), 2)
+	}
+	if cache.HitCount() != 4 || cache.MissCount() != 2 {
+		t.Errorf("unexpected stats: hit=%v miss=%v", cache.HitCount(), cache.MissCount())
+	}
+}
+
+func TestXCacheSetMulti(t *testing.T) {
+	var added int
+	var mu sync.Mutex
+	clock := NewFakeClock()
+	cache := NewXCache[int, int](100).
+		BucketCount(8).
+		Clock(clock).
+		AddedFunc(func(int, int) {
+			mu.Lock()
+			added++
+			mu.Unlock()
+		}).
+		Build()
+
+	items := make(map[int]int)
+	for i := 0; i < 50; i++ {
+		items[i] = i * 10
+	}
+	if err := cache.SetMulti(items); err != nil {
+		t.Fatal(err)
+	}
+	if added != 50 {
+		t.Errorf("AddedFunc should be called per entry: %v != %v", added, 50)
+	}
+	if l := cache.Len(true); l != 50 {
+		t.Errorf("%v != %v", l, 50)
+	}
+
+	if err := cache.SetMultiWithExpire(map[int]int{100: 1, 101: 2}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := cache.Get(101); err != nil || v != 2 {
+		t.Fatalf("unexpected value: %v, %v", v, err)
+	}
+	clock.Advance(2 * time.Second)
+	if _, err := cache.Get(100); err != ErrKeyNotFoundError {
+		t.Errorf("key should be expired: %v", err)
+	}
+}
+
+func TestXCacheGetAndRemove(t *testing.T) {
+	cache := NewXCache[string, int](10).
+		BucketCount(4).
+		Build()
+	cache.Set("key", 1)
+
+	if v, ok := cache.GetAndRemove("key"); !ok || v != 1 {
+		t.Fatalf("unexpected result: %v, %v", v, ok)
+	}
+	if _, ok := cache.GetAndRemove("key"); ok {
+		t.Error("GetAndRemove should return false for a missing key")
+	}
+}
+
+func TestXCacheSwap(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS} {
+		t.Run(tp, func(t *testing.T) {
+			cache := NewXCache[string, int](10).
+				BucketCount(4).
+				EvictType(tp).
+				Build()
+
+			old, existed, err := cache.Swap("key", 1)
+			if err != nil || existed || old != 0 {
+				t.Fatalf("unexpected result: %v, %v, %v", old, existed, err)
+			}
+			old, existed, err = cache.Swap("key", 2)
+			if err != nil || !existed || old != 1 {
+				t.Fatalf("unexpected result: %v, %v, %v", old, existed, err)
+			}
+			if v, _ := cache.Get("key"); v != 2 {
+				t.Errorf("%v != %v", v, 2)
+			}
+		})
+	}
+}
+
+func TestXCacheComputeOverExpired(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO} {
+		t.Run(tp, func(t *testing.T) {
+			clock := NewFakeClock()
+			counters := NewXCache[string, int](10).EvictType(tp).Clock(clock).Build()
+			lists := NewXCache[string, []int](10).EvictType(tp).Clock(clock).Build()
+			counters.SetWithExpire("incremented", 5, time.Second)
+			counters.SetWithExpire("swapped", 5, time.Second)
+			lists.SetWithExpire("appended", []int{5}, time.Second)
+			clock.Advance(2 * time.Second)
+
+			if v, err := Increment(counters, "incremented", 1); err != nil || v != 1 {
+				t.Fatalf("unexpected result: %v, %v", v, err)
+			}
+			if v, err := counters.Get("incremented"); err != nil || v != 1 {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+			if _, existed, err := counters.Swap("swapped", 2); err != nil || existed {
+				t.Fatalf("unexpected result: %v, %v", existed, err)
+			}
+			if v, err := counters.Get("swapped"); err != nil || v != 2 {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+			if _, err := Append(lists, "appended", 1); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := lists.Get("appended"); err != nil || len(v) != 1 || v[0] != 1 {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+		})
+	}
+}
+
+func TestXCacheKeysChan(t *testing.T) {
+	cache := NewXCache[int, int](100).
+		BucketCount(8).
+		Build()
+	for i := 0; i < 100; i++ {
+		cache.Set(i, i)
+	}
+
+	seen := make(map[int]struct{})
+	for key := range cache.KeysChan(context.Background(), true) {
+		seen[key] = struct{}{}
+	}
+	if len(seen) != 100 {
+		t.Errorf("%v != %v", len(seen), 100)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := cache.KeysChan(ctx, true)
+	<-ch
+	cancel()
+	for range ch {
+	}
+
+	// the buckets that have not been reached are those of the cache after Rebucket
+	ch = cache.KeysChan(context.Background(), true)
+	<-ch
+	if err := cache.Rebucket(4); err != nil {
+		t.Fatal(err)
+	}
+	cache.Purge()
+	n := 1
+	for range ch {
+		n++
+	}
+	if n > 50 {
+		t.Errorf("%v keys of the buckets before Rebucket", n)
+	}
+}
+
+func TestXCacheRemoveIf(t *testing.T) {
+	for _, tp := range []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS} {
+		t.Run(tp, func(t *testing.T) {
+			cache := NewXCache[int, int](100).
+				BucketCount(4).
+				EvictType(tp).
+				Build()
+			for i := 0; i < 40; i++ {
+				cache.Set(i, i)
+			}
+
+			removed := cache.RemoveIf(func(k, v int) bool {
+				return v%2 == 0
+			})
+			if removed != 20 {
+				t.Errorf("%v != %v", removed, 20)
+			}
+			if l := cache.Len(true); l != 20 {
+				t.Errorf("%v != %v", l, 20)
+			}
+			if cache.Has(2) || !cache.Has(3) {
+				t.Error("only even keys should be removed")
+			}
+		})
+	}
+}
+
+func TestXCacheRemoveIfSerialized(t *testing.T) {
+	for _, tp := range serializedTypes {
+		t.Run(tp, func(t *testing.T) {
+			cache := newSerializedXCache(tp, 20)
+			if removed := cache.RemoveIf(func(k, v int) bool { return v%2 == 0 }); removed != 10 {
+				t.Errorf("%v != %v", removed, 10)
+			}
+			if cache.Has(2) || !cache.Has(3) {
+				t.Error("only even values should be removed")
+			}
+		})
+	}
+}
+
+func TestXCacheSample(t *testing.T) {
+	cache := NewXCache[int, int](100).
+		BucketCount(8).
+		Build()
+	if s := cache.Sample(10); len(s) != 0 {
+		t.Fatalf("%v != %v", len(s), 0)
+	}
+	for i := 0; i < 200; i++ {
+		cache.Set(i, i*2)
+	}
+
+	s := cache.Sample(20)
+	if len(s) == 0 || len(s) > 20 {
+		t.Fatalf("unexpected sample size %v", len(s))
+	}
+	for k, v := range s {
+		if v != k*2 {
+			t.Errorf("%v != %v", v, k*2)
+		}
+	}
+	if s := cache.Sample(1000); len(s) != 200 {
+		t.Errorf("%v != %v", len(s), 200)
+	}
+}
+
+func TestXCacheSampleUniform(t *testing.T) {
+	for _, tp := range []string{TYPE_LRU, TYPE_FIFO} {
+		cache := NewXCache[int, int](64).BucketCount(1).EvictType(tp).Build()
+		for i := 0; i < 64; i++ {
+			cache.Set(i, i)
+		}
+		// Of 8 entries sampled out of 64, any two are sampled together with a
+		// probability of 8*7/(64*63), that is about 28 times in 2000 samples.
+		var pairs [64][64]int
+		for n := 0; n < 2000; n++ {
+			s := cache.Sample(8)
+			for a := range s {
+				for b := range s {
+					if a < b {
+						pairs[a][b]++
+					}
+				}
+			}
+		}
+		for a := range pairs {
+			for b, count := range pairs[a] {
+				if count > 80 {
+					t.Fatalf("%v: %v and %v are sampled together %v times", tp, a, b, count)
+				}
+			}
+		}
+	}
+}
+
+func TestXCacheSampleSerialized(t *testing.T) {
+	for _, tp := range serializedTypes {
+		t.Run(tp, func(t *testing.T) {
+			cache := newSerializedXCache(tp, 20)
+			s := cache.Sample(5)
+			if len(s) != 5 {
+				t.Errorf("%v != %v", len(s), 5)
+			}
+			for k, v := range s {
+				if v != k {
+					t.Errorf("%v != %v", v, k)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveByPrefix(t *testing.T) {
+	cache := NewXCache[string, int](100).
+		BucketCount(4).
+		Build()
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("user:%d", i), i)
+		cache.Set(fmt.Sprintf("order:%d", i), i)
+	}
+
+	if n := RemoveByPrefix(cache, "user:"); n != 10 {
+		t.Errorf("%v != %v", n, 10)
+	}
+	if l := cache.Len(true); l != 10 {
+		t.Errorf("%v != %v", l, 10)
+	}
+	if cache.Has("user:1") || !cache.Has("order:1") {
+		t.Error("only keys with the prefix should be removed")
+	}
+}
+
+func TestXCacheAppend(t *testing.T) {
+	events := NewXCache[string, []int](10).
+		BucketCount(4).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Append(events, "key", i); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := events.Get("key"); len(v) != 100 {
+		t.Errorf("%v != %v", len(v), 100)
+	}
+
+	logs := NewXCache[string, string](10).Build()
+	AppendString(logs, "key", "a")
+	if v, err := AppendString(logs, "key", "b"); err != nil || v != "ab" {
+		t.Errorf("unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestXCacheSnapshot(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewXCache[int, int](100).
+		BucketCount(4).
+		Clock(clock).
+		Build()
+	for i := 0; i < 20; i++ {
+		cache.Set(i, i)
+	}
+	cache.SetWithExpire(100, 100, time.Minute)
+
+	snapshot := cache.Snapshot()
+	cache.Set(0, -1)
+	cache.Remove(1)
+
+	if v, _ := snapshot.Get(0); v != 0 {
+		t.Errorf("snapshot should not observe later writes: %v", v)
+	}
+	if !snapshot.Has(1) {
+		t.Error("snapshot should not observe later removals")
+	}
+	if l := snapshot.Len(false); l != 21 {
+		t.Errorf("%v != %v", l, 21)
+	}
+	if _, exp, _ := snapshot.GetWithExpiration(100); exp == nil || !exp.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("snapshot should keep expiration: %v", exp)
+	}
+}
+
+func TestXCacheSnapshotConfig(t *testing.T) {
+	clock := NewFakeClock()
+	// the hasher sends every key that is not routed to the last bucket
+	cache := NewXCache[string, int](100).
+		BucketCount(4).
+		Clock(clock).
+		Hasher(func(string) uint64 { return 3 }).
+		RoutePrefix("t1:", 1).
+		TTLRule("s:", time.Minute).
+		Build()
+	cache.Set("a", 1)
+	cache.Set("t1:a", 2)
+	cache.Set("s:a", 3)
+
+	snapshot := cache.Snapshot()
+	for key, want := range map[string]int{"a": 1, "t1:a": 2, "s:a": 3} {
+		if v, err := snapshot.Get(key); err != nil || v != want {
+			t.Errorf("%v: %v, %v != %v", key, v, err, want)
+		}
+	}
+	buckets := snapshot.allBuckets()
+	if snapshot.getBucket("b") != buckets[3] || snapshot.getBucket("t1:b") != buckets[1] {
+		t.Error("snapshot should keep the hasher and routes")
+	}
+	snapshot.Set("s:b", 4)
+	if _, exp, _ := snapshot.GetWithExpiration("s:b"); exp == nil || !exp.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("snapshot should keep the TTL rules: %v", exp)
+	}
+}
+
+func TestXCacheSnapshotAdmissionAndPressure(t *testing.T) {
+	var asked int
+	cache := NewXCache[int, int](100).
+		BucketCount(4).
+		Admission(AdmissionFunc(func(interface{}) bool { asked++; return true })).
+		MemoryPressure(1<<40, 0.5, time.Hour).
+		Build()
+	cache.Set(1, 1)
+
+	snapshot := cache.Snapshot()
+	asked = 0
+	snapshot.Set(2, 2)
+	if asked != 0 {
+		t.Error("snapshot should not consult the admission policy of the cache")
+	}
+	p := snapshot.builder.pressure
+	if p == nil || p == cache.builder.pressure || p.limit != 1<<40 || p.fraction != 0.5 || p.interval != time.Hour {
+		t.Errorf("snapshot should watch the memory pressure with a watcher of its own: %+v", p)
+	}
+}
+
+func TestKeysMatching(t *testing.T) {
+	cache := NewXCache[string, int](100).
+		BucketCount(4).
+		Build()
+	for i := 0; i < 5; i++ {
+		cache.Set(fmt.Sprintf("session:%d:tenant42", i), i)
+		cache.Set(fmt.Sprintf("session:%d:tenant7", i), i)
+	}
+	cache.Set("session.x:tenant42", 0)
+
+	if keys := KeysMatching(cache, "session:*:tenant42"); len(keys) != 5 {
+		t.Errorf("%v != %v", len(keys), 5)
+	}
+	if keys := KeysMatching(cache, "session:?:tenant7"); len(keys) != 5 {
+		t.Errorf("%v != %v", len(keys), 5)
+	}
+	if n := RemoveMatching(cache, "session:*:tenant42"); n != 5 {
+		t.Errorf("%v != %v", n, 5)
+	}
+	if l := cache.Len(true); l != 6 {
+		t.Errorf("%v != %v", l, 6)
+	}
+}
+
+func TestXCacheGetAllFunc(t *testing.T) {
+	cache := NewXCache[int, int](100).
+		BucketCount(4).
+		Build()
+	for i := 0; i < 50; i++ {
+		cache.Set(i, i)
+	}
+
+	var visited int
+	cache.GetAllFunc(10, func(k, v int) bool {
+		visited++
+		return true
+	})
+	if visited != 10 {
+		t.Errorf("%v != %v", visited, 10)
+	}
+
+	visited = 0
+	cache.GetAllFunc(0, func(k, v int) bool {
+		visited++
+		return true
+	})
+	if visited != 50 {
+		t.Errorf("%v != %v", visited, 50)
+	}
+
+	visited = 0
+	cache.GetAllFunc(0, func(k, v int) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Errorf("%v != %v", visited, 3)
+	}
+}
+
+// serializedTypes are the eviction types that support SerializeFunc.
+var serializedTypes = []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+
+// newSerializedXCache returns a cache of type tp that stores the values i of
+// the keys 0 to n-1 serialized as "s<i>".
+func newSerializedXCache(tp string, n int) *XCache[int, int] {
+	cache := NewXCache[int, int](100).
+		BucketCount(4).
+		EvictType(tp).
+		SerializeFunc(func(k, v int) ([]byte, error) { return []byte("s" + strconv.Itoa(v)), nil }).
+		DeserializeFunc(func(k int, b []byte) (int, error) { return strconv.Atoi(string(b[1:])) }).
+		Build()
+	for i := 0; i < n; i++ {
+		cache.Set(i, i)
+	}
+	return cache
+}
+
+func TestXCacheGetAllFuncSerialized(t *testing.T) {
+	for _, tp := range serializedTypes {
+		t.Run(tp, func(t *testing.T) {
+			cache := newSerializedXCache(tp, 20)
+			visited := 0
+			cache.GetAllFunc(0, func(k, v int) bool {
+				if v != k {
+					t.Errorf("%v != %v", v, k)
+				}
+				visited++
+				return true
+			})
+			if visited != 20 {
+				t.Errorf("%v != %v", visited, 20)
+			}
+		})
+	}
+}
+
+func TestXCacheSerializedCallbacks(t *testing.T) {
+	for name, storage := range map[string]StorageType{"heap": HeapStorage, "arena": BytesArena} {
+		t.Run(name, func(t *testing.T) {
+			var added, evicted, expired, visited int
+			check := func(counter *int) func(k, v int) {
+				return func(k, v int) {
+					if v != k*10 {
+						t.Errorf("%v != %v", v, k*10)
+					}
+					*counter++
+				}
+			}
+			clock := NewFakeClock()
+			cache := NewXCache[int, int](10).
+				BucketCount(1).
+				FIFO().
+				Storage(storage).
+				Clock(clock).
+				SerializeFunc(func(k, v int) ([]byte, error) { return []byte("s" + strconv.Itoa(v)), nil }).
+				DeserializeFunc(func(k int, b []byte) (int, error) { return strconv.Atoi(string(b[1:])) }).
+				Weigher(func(k, v int) int64 { return int64(v) }).
+				AddedFunc(check(&added)).
+				EvictedFunc(check(&evicted)).
+				ExpiredFunc(check(&expired)).
+				PurgeVisitorFunc(check(&visited)).
+				Build()
+			for i := 0; i < 10; i++ {
+				cache.Set(i, i*10)
+			}
+			if cost := cache.Cost(); cost != 450 {
+				t.Errorf("the values should be weighed before they are serialized: %v != %v", cost, 450)
+			}
+			cache.Set(10, 100)
+			cache.SetWithExpire(11, 110, time.Second)
+			clock.Advance(2 * time.Second)
+			cache.DeleteExpired()
+			if added != 12 || evicted != 2 || expired != 1 {
+				t.Errorf("unexpected callback counts: added %v, evicted %v, expired %v", added, evicted, expired)
+			}
+
+			purged := 0
+			cache.PurgeWithVisitor(check(&purged))
+			if visited != 9 || purged != 9 {
+				t.Errorf("unexpected purge counts: %v, %v", visited, purged)
+			}
+		})
+	}
+}
+
+func TestXCacheRemoveMulti(t *testing.T) {
+	cache := NewXCache[int, int](100).
+		BucketCount(8).
+		Build()
+	for i := 0; i < 20; i++ {
+		cache.Set(i, i)
+	}
+
+	if n := cache.RemoveMulti([]int{0, 1, 2, 3, 100, 101}); n != 4 {
+		t.Errorf("%v != %v", n, 4)
+	}
+	if l := cache.Len(true); l != 16 {
+		t.Errorf("%v != %v", l, 16)
+	}
+}
+
+func TestXCacheARCState(t *testing.T) {
+	xc := NewXCache[int, int](10).BucketCount(4).ARC().ARCGhostLimit(2).Build()
+	for i := 0; i < 200; i++ {
+		xc.Set(i, i)
+	}
+	states := xc.ARCState()
+	if len(states) != 4 {
+		t.Fatalf("%v != 4", len(states))
+	}
+	for _, s := range states {
+		if s.B1+s.B2 > 2 {
+			t.Errorf("ghost lists exceed the limit: %+v", s)
+		}
+	}
+	if NewXCache[int, int](10).LRU().Build().ARCState() != nil {
+		t.Error("ARCState should be nil for non-ARC caches")
+	}
+}
+
+func TestXCacheScoreFunc(t *testing.T) {
+	fc := NewFakeClock()
+	xc := NewXCache[string, int](2).
+		BucketCount(1).
+		Clock(fc).
+		ScoreFunc(func(key string, value int, meta EntryMeta) float64 {
+			// Expensive values are worth more, stale ones less.
+			return float64(value) - fc.Now().Sub(meta.Created).Minutes()
+		}).
+		Build()
+	xc.Set("cheap", 1)
+	xc.Set("costly", 10)
+	fc.Advance(5 * time.Minute)
+	xc.Set("new", 2)
+	if _, err := xc.Get("cheap"); err != ErrKeyNotFoundError {
+		t.Error("entry with the lowest score should be evicted")
+	}
+	if _, err := xc.Get("costly"); err != nil {
+		t.Errorf("entry with a high score should be kept: %v", err)
+	}
+}
+
+func TestXCacheTimingWheel(t *testing.T) {
+	var expired int
+	clock := NewFakeClock()
+	xc := NewXCache[int, int](100).
+		BucketCount(4).
+		Clock(clock).
+		TimingWheel(time.Second).
+		EvictedFunc(func(key, value int) {
+			expired++
+		}).
+		Build()
+	for i := 0; i < 100; i++ {
+		xc.SetWithExpire(i, i, time.Minute)
+	}
+	clock.Advance(2 * time.Minute)
+	if n := xc.DeleteExpired(); n != 100 {
+		t.Errorf("%v != 100", n)
+	}
+	if expired != 100 {
+		t.Errorf("%v != 100", expired)
+	}
+}
+
+func TestXCacheExpiredFunc(t *testing.T) {
+	var evicted, expired int
+	clock := NewFakeClock()
+	xc := NewXCache[int, int](100).
+		BucketCount(4).
+		Clock(clock).
+		EvictedFunc(func(key, value int) {
+			evicted++
+		}).
+		ExpiredFunc(func(key, value int) {
+			expired++
+		}).
+		Build()
+	for i := 0; i < 10; i++ {
+		xc.SetWithExpire(i, i, time.Minute)
+	}
+	xc.Set(10, 10)
+	clock.Advance(2 * time.Minute)
+	if n := xc.DeleteExpired(); n != 10 {
+		t.Errorf("%v != 10", n)
+	}
+	xc.Remove(10)
+	if expired != 10 {
+		t.Errorf("%v != 10", expired)
+	}
+	if evicted != 1 {
+		t.Errorf("%v != 1", evicted)
+	}
+}
+
+func TestXCacheEagerExpiration(t *testing.T) {
+	expired := make(chan int, 10)
+	clock := NewFakeClock()
+	xc := NewXCache[int, int](100).
+		BucketCount(4).
+		Clock(clock).
+		ExpirationMode(ExpirationEager, 10*time.Millisecond).
+		ExpiredFunc(func(key, value int) {
+			expired <- key
+		}).
+		Build()
+	defer xc.Close()
+	for i := 0; i < 10; i++ {
+		xc.SetWithExpire(i, i, time.Minute)
+	}
+	clock.Advance(2 * time.Minute)
+	for i := 0; i < 10; i++ {
+		select {
+		case <-expired:
+		case <-time.After(time.Second):
+			t.Fatalf("janitors should remove all expired entries, got %v", i)
+		}
+	}
+}
+
+func TestXCacheTTLRule(t *testing.T) {
+	type key string
+	clock := NewFakeClock()
+	xc := NewXCache[key, int](100).
+		BucketCount(4).
+		Clock(clock).
+		Expiration(time.Hour).
+		TTLRule("user:", 5*time.Minute).
+		TTLRule("user:admin:", time.Minute).
+		Build()
+	xc.Set("user:42", 1)
+	xc.Set("user:admin:1", 2)
+	xc.Set("config:db", 3)
+	xc.SetIfAbsent("user:43", 4)
+	xc.SetMulti(map[key]int{"user:44": 5, "config:cache": 6})
+	xc.SetWithExpire("user:45", 7, 2*time.Hour)
+
+	expirations := map[key]time.Duration{
+		"user:42":      5 * time.Minute,
+		"user:admin:1": time.Minute,
+		"config:db":    time.Hour,
+		"user:43":      5 * time.Minute,
+		"user:44":      5 * time.Minute,
+		"config:cache": time.Hour,
+		"user:45":      2 * time.Hour,
+	}
+	for k, d := range expirations {
+		info, ok := xc.Info(k)
+		if !ok {
+			t.Fatalf("key %v should be present", k)
+		}
+		if want := clock.Now().Add(d); info.Expiration == nil || !info.Expiration.Equal(want) {
+			t.Errorf("expiration of %v: %v != %v", k, info.Expiration, want)
+		}
+	}
+}
+
+func TestXCacheBatchCallbacks(t *testing.T) {
+	var evicted int32
+	xc := NewXCache[int, int](10).
+		BucketCount(4).
+		BatchCallbacks(5, 10*time.Millisecond).
+		EvictedFunc(func(key, value int) {
+			atomic.AddInt32(&evicted, 1)
+		}).
+		Build()
+	for i := 0; i < 100; i++ {
+		xc.Set(i, i)
+	}
+	remaining := xc.Len(false)
+	xc.Close()
+	if n := atomic.LoadInt32(&evicted); n != int32(100-remaining) {
+		t.Errorf("%v != %v", n, 100-remaining)
+	}
+}
+
+func TestXCacheLoaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	xc := NewXCache[string, string](10).
+		BucketCount(4).
+		LoaderTimeout(10 * time.Millisecond).
+		LoaderFunc(func(key string) (string, error) {
+			<-release
+			return key, nil
+		}).
+		Build()
+	if _, err := xc.Get("key"); err != ErrLoaderTimeout {
+		t.Errorf("%v != %v", err, ErrLoaderTimeout)
+	}
+}
+
+func TestXCacheServeStale(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	var fail int32
+	clock := NewFakeClock()
+	xc := NewXCache[string, string](10).
+		BucketCount(4).
+		Clock(clock).
+		Expiration(time.Second).
+		ServeStale().
+		LoaderFunc(func(key string) (string, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return "", errUnavailable
+			}
+			return key + ":v1", nil
+		}).
+		Build()
+	xc.Get("key")
+	clock.Advance(2 * time.Second)
+	atomic.StoreInt32(&fail, 1)
+
+	v, err := xc.Get("key")
+	if _, ok := err.(*StaleError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != "key:v1" {
+		t.Errorf("%v != key:v1", v)
+	}
+}
+
+func TestXCacheCoalesceLoads(t *testing.T) {
+	var calls int32
+	xc := NewXCache[string, int](100).
+		BucketCount(8).
+		CoalesceLoads(50*time.Millisecond, func(keys []string) (map[string]int, error) {
+			atomic.AddInt32(&calls, 1)
+			values := make(map[string]int, len(keys))
+			for _, key := range keys {
+				values[key] = len(key)
+			}
+			return values, nil
+		}).
+		Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if v, err := xc.Get(key); err != nil || v != len(key) {
+				t.Errorf("%v, %v != %v", v, err, len(key))
+			}
+		}(fmt.Sprintf("key-%d", i))
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("misses in all buckets should be loaded together: %v", n)
+	}
+}
+
+func TestXCacheDebugState(t *testing.T) {
+	xc := NewXCache[int, int](8).
+		BucketCount(2).
+		LRU().
+		Build()
+	for i := 0; i < 6; i++ {
+		xc.Set(i, i)
+	}
+	states := xc.DebugState()
+	if len(states) != 2 {
+		t.Fatalf("%v != %v", len(states), 2)
+	}
+	entries := 0
+	for _, s := range states {
+		if s.Policy != TYPE_LRU || s.ARC != nil || s.LIRS != nil || s.LFU != nil {
+			t.Errorf("unexpected state: %+v", s)
+		}
+		entries += s.Entries
+	}
+	if entries != 6 {
+		t.Errorf("%v != %v", entries, 6)
+	}
+}
+
+func TestXCacheMiddleware(t *testing.T) {
+	var ops []string
+	xc := NewXCache[string, int](8).
+		BucketCount(2).
+		ARC().
+		Use(recording("bucket", &ops)).
+		Build()
+	xc.Set("a", 1)
+	if v, err := xc.Get("a"); err != nil || v != 1 {
+		t.Fatalf("%v, %v != %v", v, err, 1)
+	}
+	want := []string{"bucket set a", "bucket get a"}
+	if fmt.Sprint(ops) != fmt.Sprint(want) {
+		t.Errorf("%v != %v", ops, want)
+	}
+	if states := xc.ARCState(); len(states) != 2 || states[xc.GetBucketIndex("a")].T1+states[xc.GetBucketIndex("a")].T2 != 1 {
+		t.Errorf("unexpected ARC state: %+v", states)
+	}
+}
+
+func TestXCacheHasher(t *testing.T) {
+	xc := NewXCache[int, int](8).
+		BucketCount(4).
+		Hasher(func(key int) uint64 {
+			return uint64(key)
+		}).
+		Build()
+	for i := 0; i < 8; i++ {
+		xc.Set(i, i)
+		if idx := xc.GetBucketIndex(i); idx != i%4 {
+			t.Errorf("key %v: %v != %v", i, idx, i%4)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		if v, err := xc.Get(i); err != nil || v != i {
+			t.Errorf("%v, %v != %v", v, err, i)
+		}
+	}
+	for _, s := range xc.Stats().Buckets {
+		if s.Entries != 2 {
+			t.Errorf("%v != %v", s.Entries, 2)
+		}
+	}
+}
+
+func TestXCacheBucketCountPowerOfTwo(t *testing.T) {
+	cases := []struct {
+		count, buckets int
+	}{
+		{-1, AutoBucketCount()},
+		{0, AutoBucketCount()},
+		{1, 1},
+		{3, 4},
+		{8, 8},
+		{10, 16},
+	}
+	for _, cs := range cases {
+		xc := NewXCache[int, int](8).BucketCount(cs.count).Build()
+		if n := xc.GetBucketCount(); n != cs.buckets {
+			t.Errorf("BucketCount(%v): %v != %v", cs.count, n, cs.buckets)
+		}
+		for i := 0; i < 100; i++ {
+			if idx := xc.GetBucketIndex(i); idx < 0 || idx >= cs.buckets {
+				t.Fatalf("BucketCount(%v): index %v out of range", cs.count, idx)
+			}
+		}
+	}
+}
+
+func TestXCacheAutoBucketCount(t *testing.T) {
+	if n := AutoBucketCount(); n < 4*runtime.GOMAXPROCS(0) || n&(n-1) != 0 {
+		t.Fatalf("AutoBucketCount() = %v", n)
+	}
+
+	xc := NewXCache[int, int](8).Build()
+	stats := xc.Stats()
+	if stats.BucketCount != AutoBucketCount() || !stats.AutoBuckets {
+		t.Errorf("%v, %v != %v, true", stats.BucketCount, stats.AutoBuckets, AutoBucketCount())
+	}
+
+	xc = NewXCache[int, int](8).BucketCount(4).Build()
+	stats = xc.Stats()
+	if stats.BucketCount != 4 || stats.AutoBuckets {
+		t.Errorf("%v, %v != 4, false", stats.BucketCount, stats.AutoBuckets)
+	}
+
+	if err := xc.Rebucket(0); err != nil {
+		t.Fatal(err)
+	}
+	stats = xc.Stats()
+	if stats.BucketCount != AutoBucketCount() || !stats.AutoBuckets {
+		t.Errorf("%v, %v != %v, true", stats.BucketCount, stats.AutoBuckets, AutoBucketCount())
+	}
+}
+
+func TestXCacheParallelMulti(t *testing.T) {
+	cache := NewXCache[int, int](1000).
+		BucketCount(32).
+		ParallelMulti(4).
+		Build()
+
+	items := make(map[int]int)
+	keys := make([]int, 0, 600)
+	for i := 0; i < 500; i++ {
+		items[i] = i * 10
+	}
+	for i := 0; i < 600; i++ {
+		keys = append(keys, i)
+	}
+	if err := cache.SetMulti(items); err != nil {
+		t.Fatal(err)
+	}
+
+	found, missing := cache.GetMulti(keys)
+	if len(found) != 500 || len(missing) != 100 {
+		t.Fatalf("unexpected result: found=%v missing=%v", len(found), len(missing))
+	}
+	for k, v := range found {
+		if v != k*10 {
+			t.Errorf("%v != %v", v, k*10)
+		}
+	}
+	if cache.HitCount() != 500 || cache.MissCount() != 100 {
+		t.Errorf("unexpected stats: hit=%v miss=%v", cache.HitCount(), cache.MissCount())
+	}
+	if all := cache.GetAll(false); len(all) != 500 {
+		t.Errorf("%v != %v", len(all), 500)
+	}
+	if n := cache.RemoveMulti(keys[:250]); n != 250 {
+		t.Errorf("%v != %v", n, 250)
+	}
+	if l := cache.Len(true); l != 250 {
+		t.Errorf("%v != %v", l, 250)
+	}
+}
+
+func TestXCacheTotalSize(t *testing.T) {
+	cache := NewXCache[int, int](0).
+		BucketCount(8).
+		TotalSize(50).
+		Build()
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+	if l := cache.Len(false); l != 50 {
+		t.Errorf("%v != %v", l, 50)
+	}
+
+	sizes := (&XCacheBuilder[int, int]{bucketCount: 8, totalSize: 50}).bucketSizes()
+	want := []int{7, 7, 6, 6, 6, 6, 6, 6}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Errorf("%v != %v", sizes, want)
+			break
+		}
+	}
+
+	snapshot := cache.Snapshot()
+	for i := 1000; i < 2000; i++ {
+		snapshot.Set(i, i)
+	}
+	if l := snapshot.Len(false); l != 50 {
+		t.Errorf("%v != %v", l, 50)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Build should panic if the total size is less than the bucket count")
+		}
+	}()
+	NewXCache[int, int](0).BucketCount(8).TotalSize(4).Build()
+}
+
+func TestXCacheRebucket(t *testing.T) {
+	var added int32
+	clock := NewFakeClock()
+	cache := NewXCache[int, int](100).
+		BucketCount(4).
+		Clock(clock).
+		AddedFunc(func(int, int) { atomic.AddInt32(&added, 1) }).
+		Build()
+	for i := 0; i < 200; i++ {
+		cache.Set(i, i*10)
+	}
+	cache.SetWithExpire(1000, 1, time.Second)
+	for i := 200; i < 500; i++ {
+		cache.Set(i, i)
+	}
+	evictions := cache.EvictionCount()
+	if evictions == 0 {
+		t.Fatal("expected evictions before Rebucket")
+	}
+	before := cache.GetAll(false)
+
+	if err := cache.Rebucket(16); err != nil {
+		t.Fatal(err)
+	}
+	if n := cache.GetBucketCount(); n != 16 {
+		t.Errorf("%v != %v", n, 16)
+	}
+	if n := atomic.LoadInt32(&added); n != 501 {
+		t.Errorf("AddedFunc should not be called for migrated entries: %v != %v", n, 501)
+	}
+	if n := cache.EvictionCount(); n != evictions {
+		t.Errorf("%v != %v", n, evictions)
+	}
+	after := cache.GetAll(false)
+	if len(after) != len(before) {
+		t.Fatalf("%v != %v", len(after), len(before))
+	}
+	for k, v := range before {
+		if after[k] != v {
+			t.Errorf("%v != %v", after[k], v)
+		}
+	}
+	for k := range after {
+		if idx := cache.GetBucketIndex(k); idx < 0 || idx >= 16 {
+			t.Fatalf("index %v out of range", idx)
+		}
+	}
+	if _, ok := before[1000]; ok {
+		clock.Advance(2 * time.Second)
+		if _, err := cache.Get(1000); err != ErrKeyNotFoundError {
+			t.Errorf("migrated key should keep its expiration: %v", err)
+		}
+	}
+}
+
+func TestXCacheRebucketTotalSize(t *testing.T) {
+	cache := NewXCache[int, int](0).
+		BucketCount(8).
+		TotalSize(64).
+		Build()
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+	if err := cache.Rebucket(2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1000; i < 2000; i++ {
+		cache.Set(i, i)
+	}
+	if l := cache.Len(false); l != 64 {
+		t.Errorf("%v != %v", l, 64)
+	}
+	if err := cache.Rebucket(128); err == nil {
+		t.Error("Rebucket should fail if the total size is less than the bucket count")
+	}
+}
+
+func TestXCacheRebucketConcurrent(t *testing.T) {
+	cache := NewXCache[int, int](1000).
+		BucketCount(2).
+		ParallelMulti(4).
+		Build()
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				key := (i*4 + w) % 1000
+				if err := cache.Set(key, key); err != nil {
+					t.Error(err)
+				}
+				if v, err := cache.Get(key); err != nil || v != key {
+					t.Errorf("unexpected value: %v, %v", v, err)
+				}
+				cache.GetMulti([]int{key, key + 1})
+			}
+		}(w)
+	}
+	for _, n := range []int{8, 32, 4} {
+		if err := cache.Rebucket(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if l := cache.Len(false); l != 1000 {
+		t.Errorf("%v != %v", l, 1000)
+	}
+}
+
+func TestXCacheRebucketWhileLoading(t *testing.T) {
+	loading, unblock := make(chan struct{}), make(chan struct{})
+	var cache *XCache[int, int]
+	cache = NewXCache[int, int](100).
+		BucketCount(2).
+		Hasher(func(k int) uint64 { return uint64(k) }).
+		LoaderFunc(func(k int) (int, error) {
+			close(loading)
+			<-unblock
+			// loaders may use the cache, even keys of the bucket of the key they load
+			if err := cache.Set(k+2, k+2); err != nil {
+				return 0, err
+			}
+			return k, nil
+		}).
+		Build()
+	for i := 1; i < 10; i++ {
+		cache.Set(i, i)
+	}
+
+	loaded := make(chan error)
+	go func() {
+		_, err := cache.Get(0)
+		loaded <- err
+	}()
+	<-loading
+	rebucketed := make(chan error)
+	go func() { rebucketed <- cache.Rebucket(4) }()
+
+	// the other operations do not wait for the load, which keeps bucket 0 from being migrated
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i < 10; i++ {
+			if v, err := cache.Peek(i); err != nil || v != i {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+			cache.Set(i, i*10)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("operations should not wait for a load while Rebucket runs")
+	}
+
+	close(unblock)
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-rebucketed; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		want := i * 10
+		if i == 0 || i == 2 {
+			want = i
+		}
+		if v, err := cache.Peek(i); err != nil || v != want {
+			t.Errorf("%v: unexpected result: %v, %v", i, v, err)
+		}
+	}
+	if n := cache.GetBucketCount(); n != 4 {
+		t.Errorf("%v != %v", n, 4)
+	}
+}
+
+func TestXCacheBuildE(t *testing.T) {
+	invalid := map[string]*XCacheBuilder[int, int]{
+		"bucket size": NewXCache[int, int](0),
+		"total size":  NewXCache[int, int](0).BucketCount(8).TotalSize(4),
+		"bucket":      NewXCache[int, int](10).EvictType("mru"),
+	}
+	for name, cb := range invalid {
+		if _, err := cb.BuildE(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+
+	if _, err := NewXCache[int, int](10).BucketCount(4).BuildE(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestXCacheGlobalCapacity(t *testing.T) {
+	// all keys below 1000 hash to bucket 0, the others to the other buckets
+	hasher := func(k int) uint64 {
+		if k < 1000 {
+			return 0
+		}
+		return uint64(k%7) + 1
+	}
+	cache := NewXCache[int, int](0).
+		BucketCount(8).
+		GlobalCapacity(64).
+		Hasher(hasher).
+		Build()
+	for i := 0; i < 100; i++ {
+		cache.Set(i, i)
+	}
+	if l := cache.Len(false); l != 64 {
+		t.Errorf("%v != %v", l, 64)
+	}
+	for i := 1000; i < 1016; i++ {
+		cache.Set(i, i)
+	}
+	if l := cache.Len(false); l != 64 {
+		t.Errorf("%v != %v", l, 64)
+	}
+	for i := 1000; i < 1016; i++ {
+		if !cache.Has(i) {
+			t.Errorf("key %v should have been admitted by evicting from the largest bucket", i)
+		}
+	}
+	if n := cache.Stats().Buckets[0].Entries; n != 48 {
+		t.Errorf("%v != %v", n, 48)
+	}
+}
+
+func TestXCacheGlobalCapacityCount(t *testing.T) {
+	tps := []string{TYPE_SIMPLE, TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_RANDOM, TYPE_APPROX_LRU, TYPE_TTL}
+	for _, tp := range tps {
+		clock := NewFakeClock()
+		cache := NewXCache[int, int](0).
+			EvictType(tp).
+			BucketCount(4).
+			GlobalCapacity(50).
+			Clock(clock).
+			Build()
+		for i := 0; i < 200; i++ {
+			if i%3 == 0 {
+				cache.SetWithExpire(i, i, time.Second)
+			} else {
+				cache.Set(i, i)
+			}
+			if i%5 == 0 {
+				cache.Remove(i / 2)
+			}
+			cache.Get(i / 3)
+		}
+		clock.Advance(2 * time.Second)
+		cache.DeleteExpired()
+		if err := cache.Rebucket(8); err != nil {
+			t.Fatal(err)
+		}
+		if n, l := cache.builder.capacity.used, cache.Len(false); n != int64(l) {
+			t.Errorf("%v: %v != %v", tp, n, l)
+		}
+		cache.Purge()
+		if n := cache.builder.capacity.used; n != 0 {
+			t.Errorf("%v: %v != %v", tp, n, 0)
+		}
+	}
+}
+
+func TestXCachePurgeWithVisitor(t *testing.T) {
+	var purged int32
+	cache := NewXCache[int, int](100).
+		BucketCount(8).
+		ParallelMulti(4).
+		PurgeVisitorFunc(func(int, int) { atomic.AddInt32(&purged, 1) }).
+		Build()
+	for i := 0; i < 200; i++ {
+		cache.Set(i, i*10)
+	}
+
+	var mu sync.Mutex
+	visited := make(map[int]int)
+	cache.PurgeWithVisitor(func(k, v int) {
+		mu.Lock()
+		visited[k] = v
+		mu.Unlock()
+	})
+	if len(visited) != 200 {
+		t.Fatalf("%v != %v", len(visited), 200)
+	}
+	for k, v := range visited {
+		if v != k*10 {
+			t.Errorf("%v != %v", v, k*10)
+		}
+	}
+	if n := atomic.LoadInt32(&purged); n != 200 {
+		t.Errorf("PurgeVisitorFunc should still be called: %v != %v", n, 200)
+	}
+	if l := cache.Len(false); l != 0 {
+		t.Errorf("%v != %v", l, 0)
+	}
+}
+
+func TestXCacheSwapOnPurge(t *testing.T) {
+	cache := NewXCache[int, int](100).
+		BucketCount(8).
+		GlobalCapacity(300).
+		SwapOnPurge().
+		Build()
+	for i := 0; i < 200; i++ {
+		cache.Set(i, i*10)
+		cache.Get(i)
+	}
+
+	var purged int32
+	cache.PurgeWithVisitor(func(k, v int) {
+		// the cache is usable while the old buckets are visited
+		if cache.Has(k) {
+			t.Errorf("key %v should have been purged", k)
+		}
+		cache.Set(k+1000, v)
+		atomic.AddInt32(&purged, 1)
+	})
+	if n := atomic.LoadInt32(&purged); n != 200 {
+		t.Errorf("%v != %v", n, 200)
+	}
+	if l := cache.Len(false); l != 200 {
+		t.Errorf("%v != %v", l, 200)
+	}
+	if n := cache.builder.capacity.used; n != 200 {
+		t.Errorf("%v != %v", n, 200)
+	}
+	if hits := cache.HitCount(); hits != 200 {
+		t.Errorf("%v != %v", hits, 200)
+	}
+	cache.Purge()
+	if l := cache.Len(false); l != 0 {
+		t.Errorf("%v != %v", l, 0)
+	}
+}
+
+func TestXCacheSwapOnPurgeWhileLoading(t *testing.T) {
+	loading, unblock := make(chan struct{}), make(chan struct{})
+	adding, added := make(chan struct{}), make(chan struct{})
+	var cache *XCache[int, int]
+	cache = NewXCache[int, int](100).
+		BucketCount(2).
+		Hasher(func(k int) uint64 { return uint64(k) }).
+		LoaderFunc(func(k int) (int, error) {
+			close(loading)
+			<-unblock
+			return k, nil
+		}).
+		AddedFunc(func(k, v int) {
+			if k != 1 {
+				return
+			}
+			close(adding)
+			<-added
+			// callbacks may use the cache while Purge waits for their bucket
+			cache.Has(3)
+		}).
+		SwapOnPurge().
+		Build()
+
+	loaded := make(chan error)
+	go func() {
+		_, err := cache.Get(0)
+		loaded <- err
+	}()
+	<-loading
+	set := make(chan error)
+	go func() { set <- cache.Set(1, 1) }()
+	<-adding
+
+	purged := make(chan struct{})
+	go func() {
+		cache.Purge()
+		close(purged)
+	}()
+	// let Purge reach the bucket that the callback holds
+	time.Sleep(10 * time.Millisecond)
+	close(added)
+	select {
+	case <-purged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Purge should neither wait for a load nor for a callback that uses the cache")
+	}
+	if err := <-set; err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i < 10; i++ {
+		cache.Set(i, i)
+	}
+	if l := cache.Len(false); l != 8 {
+		t.Errorf("%v != %v", l, 8)
+	}
+	close(unblock)
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXCacheIterator(t *testing.T) {
+	for _, snapshot := range []bool{false, true} {
+		cache := NewXCache[int, int](100).
+			BucketCount(8).
+			Build()
+		for i := 0; i < 100; i++ {
+			cache.Set(i, i*10)
+		}
+
+		it := cache.Iterator(snapshot)
+		for i := 100; i < 200; i++ {
+			cache.Set(i, i*10)
+		}
+		seen := make(map[int]int)
+		for it.Next() {
+			if _, ok := seen[it.Key()]; ok {
+				t.Errorf("key %v visited twice", it.Key())
+			}
+			seen[it.Key()] = it.Value()
+		}
+		if it.Next() {
+			t.Error("Next should keep returning false at the end")
+		}
+		for i := 0; i < 100; i++ {
+			if seen[i] != i*10 {
+				t.Errorf("%v != %v", seen[i], i*10)
+			}
+		}
+		if snapshot && len(seen) != 100 {
+			t.Errorf("snapshot should not see later changes: %v != %v", len(seen), 100)
+		}
+		if !snapshot && len(seen) != 200 {
+			t.Errorf("%v != %v", len(seen), 200)
+		}
+	}
+}
+
+func TestXCacheIteratorSerialized(t *testing.T) {
+	for _, snapshot := range []bool{false, true} {
+		cache := NewXCache[int, string](100).
+			BucketCount(4).
+			SerializeFunc(func(k int, v string) ([]byte, error) { return []byte("s" + v), nil }).
+			DeserializeFunc(func(k int, b []byte) (string, error) { return string(b[1:]), nil }).
+			Build()
+		for i := 0; i < 10; i++ {
+			cache.Set(i, strconv.Itoa(i))
+		}
+		seen := 0
+		for it := cache.Iterator(snapshot); it.Next(); seen++ {
+			if want := strconv.Itoa(it.Key()); it.Value() != want {
+				t.Errorf("%v != %v", it.Value(), want)
+			}
+		}
+		if seen != 10 {
+			t.Errorf("%v != %v", seen, 10)
+		}
+	}
+}
+
+func TestXCacheGetAllocs(t *testing.T) {
+	tps := []string{TYPE_LRU, TYPE_LFU, TYPE_ARC, TYPE_LIRS, TYPE_FIFO, TYPE_TTL}
+	for _, tp := range tps {
+		ints := NewXCache[int, int](1024).BucketCount(8).EvictType(tp).Build()
+		strs := NewXCache[string, string](1024).BucketCount(8).EvictType(tp).Build()
+		keys := make([]string, 1024)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key-%d", i)
+			ints.Set(i, i)
+			strs.Set(keys[i], keys[i])
+		}
+		i := 0
+		if n := testing.AllocsPerRun(1000, func() { ints.Get(256 + i%512); i++ }); n != 0 {
+			t.Errorf("%v: a hit on an int key allocates %v times", tp, n)
+		}
+		if n := testing.AllocsPerRun(1000, func() { strs.Get(keys[i%1024]); i++ }); n != 0 {
+			t.Errorf("%v: a hit on a string key allocates %v times", tp, n)
+		}
+	}
+
+	// a miss stores the loaded key, which must not be on the stack
+	xc := NewXCache[string, string](10).LoaderFunc(func(k string) (string, error) { return k, nil }).Build()
+	for i := 0; i < 100; i++ {
+		xc.Get(fmt.Sprint(i))
+	}
+	runtime.GC()
+	for _, k := range xc.Keys(false) {
+		if v, err := xc.Get(k); err != nil || v != k {
+			t.Errorf("%v != %v: %v", v, k, err)
+		}
+	}
+
+	// hits pass on the stored key, so the keys that LockFreeReads publishes,
+	// DeferredPromotion queues and DeserializeFunc gets stay valid
+	for _, reads := range []func(*XCacheBuilder[string, string]) *XCacheBuilder[string, string]{
+		(*XCacheBuilder[string, string]).LockFreeReads,
+		(*XCacheBuilder[string, string]).DeferredPromotion,
+	} {
+		var seen []string
+		retaining := reads(NewXCache[string, string](100).LRU()).
+			SerializeFunc(func(k, v string) ([]byte, error) { return []byte(v), nil }).
+			DeserializeFunc(func(k string, b []byte) (string, error) {
+				seen = append(seen, k)
+				return string(b), nil
+			}).Build()
+		for i := 0; i < 50; i++ {
+			retaining.Set(fmt.Sprint(i), fmt.Sprint(i))
+		}
+		for round := 0; round < 3; round++ {
+			for i := 0; i < 50; i++ {
+				retaining.Get(fmt.Sprint(i))
+			}
+			runtime.GC()
+		}
+		for i := 0; i < 50; i++ {
+			if v, err := retaining.Get(fmt.Sprint(i)); err != nil || v != fmt.Sprint(i) {
+				t.Errorf("%v != %v: %v", v, i, err)
+			}
+		}
+		for _, k := range seen {
+			if _, err := strconv.Atoi(k); err != nil {
+				t.Errorf("DeserializeFunc got a corrupted key %q", k)
+			}
+		}
+	}
+}
+
+func TestXCacheRoutePrefix(t *testing.T) {
+	cache := NewXCache[string, int](10).
+		BucketCount(8).
+		RoutePrefix("tenant:a:", 3).
+		Build()
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("tenant:a:%d", i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("other:%d", i)
+		if idx := cache.GetBucketIndex(key); idx == 3 {
+			t.Fatalf("key %v should not be hashed to a reserved bucket", key)
+		}
+		cache.Set(key, i)
+	}
+	// the other keys have not evicted any key of the tenant
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("tenant:a:%d", i)
+		if idx := cache.GetBucketIndex(key); idx != 3 {
+			t.Errorf("%v != %v", idx, 3)
+		}
+		if v, err := cache.Get(key); err != nil || v != i {
+			t.Errorf("unexpected value: %v, %v", v, err)
+		}
+	}
+
+	if err := cache.Rebucket(2); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Rebucket should fail if a route refers to a missing bucket: %v", err)
+	}
+	if _, err := NewXCache[string, int](10).BucketCount(2).RoutePrefix("a", 0).RoutePrefix("b", 1).BuildE(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("BuildE should fail if every bucket is reserved: %v", err)
+	}
+}
+
+func TestXCacheRouter(t *testing.T) {
+	cache := NewXCache[int, int](10).
+		BucketCount(4).
+		Router(func(k int) (int, bool) { return k, k < 0 }).
+		Build()
+	if idx := cache.GetBucketIndex(-1); idx != 3 {
+		t.Errorf("%v != %v", idx, 3)
+	}
+	cache.Set(-1, 1)
+	if v, err := cache.Get(-1); err != nil || v != 1 {
+		t.Errorf("unexpected value: %v, %v", v, err)
+	}
+}
+
+func TestXCacheTypedBucketAllocs(t *testing.T) {
+	ints := NewXCache[int, int](1024).BucketCount(8).Build()
+	strs := NewXCache[string, string](1024).BucketCount(8).Build()
+	keys := make([]string, 2048)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	for i := 0; i < 512; i++ {
+		ints.Set(i, i)
+		strs.Set(keys[i], keys[i])
+	}
+	i := 0
+	if n := testing.AllocsPerRun(1000, func() { ints.Set(i%512, i); i++ }); n != 0 {
+		t.Errorf("replacing an int value allocates %v times", n)
+	}
+	if n := testing.AllocsPerRun(1000, func() { strs.Set(keys[i%512], keys[i%512]); i++ }); n != 0 {
+		t.Errorf("replacing a string value allocates %v times", n)
+	}
+	if n := testing.AllocsPerRun(1000, func() { ints.Get(4096 + i); i++ }); n != 0 {
+		t.Errorf("a miss on an int key allocates %v times", n)
+	}
+	// the entry only, the map grows rarely
+	if n := testing.AllocsPerRun(1000, func() { ints.Set(1024+i, i); i++ }); n > 1 {
+		t.Errorf("inserting an int value allocates %v times", n)
+	}
+}
+
+func TestXCacheTypedBuckets(t *testing.T) {
+	typed := func(buckets []Cache) bool {
+		_, ok := buckets[0].(*typedLRUCache[int, int])
+		return ok
+	}
+	if !typed(NewXCache[int, int](8).Build().buckets) {
+		t.Error("the LRU buckets should store the keys and values unboxed")
+	}
+	if typed(NewXCache[int, int](8).LockFreeReads().Build().buckets) {
+		t.Error("the LRU buckets that serve reads without the lock should store boxed keys and values")
+	}
+
+	clock := NewFakeClock()
+	var evicted, expired int
+	cache := NewXCache[int, int](4).
+		BucketCount(1).
+		Clock(clock).
+		LoaderFunc(func(k int) (int, error) { return k * 10, nil }).
+		EvictedFunc(func(k, v int) { evicted++ }).
+		ExpiredFunc(func(k, v int) { expired++ }).
+		Build()
+	for i := 0; i < 5; i++ {
+		cache.Set(i, i)
+	}
+	if evicted != 1 || cache.Len(false) != 4 {
+		t.Errorf("the oldest entry should be evicted: %v evictions, %v entries", evicted, cache.Len(false))
+	}
+	if v, err := cache.Get(0); err != nil || v != 0 {
+		t.Errorf("the evicted entry should be loaded: %v, %v", v, err)
+	}
+	cache.SetWithExpire(9, 9, time.Second)
+	clock.Advance(2 * time.Second)
+	if v, err := cache.Get(9); err != nil || v != 90 || expired != 1 {
+		t.Errorf("the expired entry should be loaded: %v, %v, %v expirations", v, err, expired)
+	}
+	if hits, misses := cache.HitCount(), cache.MissCount(); hits != 2 || misses != 0 {
+		t.Errorf("the loaded values should be hits: %v hits, %v misses", hits, misses)
+	}
+	if err := cache.Rebucket(2); err != nil {
+		t.Fatal(err)
+	}
+	if !typed(cache.buckets) || cache.Len(false) != 4 {
+		t.Errorf("the new buckets should store the %v entries unboxed", cache.Len(false))
+	}
+
+	errs := NewXCache[int, error](8).Build()
+	if err := errs.Set(1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := errs.Get(1); err != nil || v != nil {
+		t.Errorf("nil interface values should be stored: %v, %v", v, err)
+	}
+}
@@ -0,0 +1,299 @@
+// Package xhttp exposes an XCache over HTTP with JSON bodies, so that operators
+// can inspect and fix the entries of a running cache and administer it.
+//
+// The handler serves the following routes, relative to where it is mounted
+// (use http.StripPrefix to mount it below a prefix):
+//
+//	GET    /entries          up to ?limit=n keys of the entries that have not expired
+//	GET    /entries/{key}    the value of key and the time at which it expires
+//	PUT    /entries/{key}    sets key to {"value": ..., "ttl": "30s"}; ttl is optional
+//	DELETE /entries/{key}    removes key
+//	POST   /purge            removes all entries
+//	GET    /stats            the statistics of the cache, see xcache.CacheStats
+//	POST   /resize           changes the bucket count to {"bucket_count": n}, see XCache.Rebucket
+//	                         and Options.MaxBucketCount
+//	GET    /policy           the eviction policy and the state of every bucket
+//
+// Errors are returned as {"error": "..."} with a 4xx or 5xx status. A key that the
+// admission policy of the cache rejects is answered with 409 Conflict.
+package xhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SipengXie/xcache"
+)
+
+// maxBodySize bounds the size of request bodies.
+const maxBodySize = 1 << 20
+
+// DefaultKeysLimit is the number of keys GET /entries returns without a limit.
+const DefaultKeysLimit = 1000
+
+// DefaultMaxBucketCount is the largest bucket count POST /resize accepts without
+// a MaxBucketCount.
+const DefaultMaxBucketCount = 4096
+
+// Options configures a handler. The zero value is usable.
+type Options[K comparable] struct {
+	// ParseKey parses the key segment of an /entries/{key} path, after it has been
+	// unescaped. By default it is xcache.ParseKey, so that /entries/42 addresses
+	// the int key 42.
+	ParseKey func(string) (K, error)
+	// Authorize is called before every request. If it returns an error, the request
+	// is rejected with 401 Unauthorized and the message of the error.
+	Authorize func(*http.Request) error
+	// MaxBucketCount is the largest bucket count POST /resize accepts; larger
+	// counts are rejected with 400 Bad Request, since every bucket is allocated
+	// up front. By default it is DefaultMaxBucketCount.
+	MaxBucketCount int
+}
+
+// Entry is the body of the response to GET /entries/{key}.
+type Entry[K comparable, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+	// Expiration is the time at which the entry expires, or nil if it does not expire.
+	Expiration *time.Time `json:"expiration"`
+}
+
+// SetRequest is the body of PUT /entries/{key}.
+type SetRequest[V any] struct {
+	Value V `json:"value"`
+	// TTL is the time the entry lives as parsed by time.ParseDuration. If it is empty,
+	// the entry expires after the default expiration of the cache.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// ResizeRequest is the body of POST /resize.
+type ResizeRequest struct {
+	BucketCount int `json:"bucket_count"`
+}
+
+// Policy is the body of the response to GET /policy.
+type Policy struct {
+	Policy      string              `json:"policy"`
+	BucketCount int                 `json:"bucket_count"`
+	Buckets     []xcache.DebugState `json:"buckets"`
+}
+
+type handler[K comparable, V any] struct {
+	xc   *xcache.XCache[K, V]
+	opts Options[K]
+}
+
+// NewHandler returns a handler that serves the entries and admin operations of xc.
+func NewHandler[K comparable, V any](xc *xcache.XCache[K, V], opts Options[K]) http.Handler {
+	if opts.ParseKey == nil {
+		opts.ParseKey = xcache.ParseKey[K]
+	}
+	if opts.MaxBucketCount <= 0 {
+		opts.MaxBucketCount = DefaultMaxBucketCount
+	}
+	return &handler[K, V]{xc: xc, opts: opts}
+}
+
+func (h *handler[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Authorize != nil {
+		if err := h.opts.Authorize(r); err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+	}
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	switch {
+	case path == "entries":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.keys})
+	case strings.HasPrefix(path, "entries/"):
+		s, err := url.PathUnescape(strings.TrimPrefix(path, "entries/"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		key, err := h.opts.ParseKey(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid key %q: %v", s, err))
+			return
+		}
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { h.get(w, key) },
+			http.MethodPut:    func(w http.ResponseWriter, r *http.Request) { h.set(w, r, key) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { h.remove(w, key) },
+		})
+	case path == "purge":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodPost: h.purge})
+	case path == "stats":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.stats})
+	case path == "resize":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodPost: h.resize})
+	case path == "policy":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.policy})
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// route calls the handler of the method of r, or responds with 405 Method Not Allowed.
+func (h *handler[K, V]) route(w http.ResponseWriter, r *http.Request, methods map[string]http.HandlerFunc) {
+	if fn, ok := methods[r.Method]; ok {
+		fn(w, r)
+		return
+	}
+	allowed := make([]string, 0, len(methods))
+	for _, m := range []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete} {
+		if _, ok := methods[m]; ok {
+			allowed = append(allowed, m)
+		}
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+}
+
+// keys visits the buckets one at a time and stops after limit keys, so that the
+// keys of a large cache are neither copied nor written at once.
+func (h *handler[K, V]) keys(w http.ResponseWriter, r *http.Request) {
+	limit := DefaultKeysLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", s))
+			return
+		}
+		limit = n
+	}
+	keys := make([]K, 0)
+	h.xc.GetAllFunc(limit, func(key K, _ V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// get reads the entry with Peek, so that inspecting it neither calls the loader
+// nor changes its position in the eviction policy or the statistics.
+func (h *handler[K, V]) get(w http.ResponseWriter, key K) {
+	value, err := h.xc.Peek(key)
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	info, ok := h.xc.Info(key)
+	if !ok {
+		writeCacheError(w, xcache.ErrKeyNotFoundError)
+		return
+	}
+	writeJSON(w, http.StatusOK, Entry[K, V]{Key: key, Value: value, Expiration: info.Expiration})
+}
+
+func (h *handler[K, V]) set(w http.ResponseWriter, r *http.Request, key K) {
+	var req SetRequest[V]
+	if !readJSON(w, r, &req) {
+		return
+	}
+	var err error
+	if req.TTL == "" {
+		err = h.xc.Set(key, req.Value)
+	} else {
+		ttl, perr := time.ParseDuration(req.TTL)
+		if perr != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl %q", req.TTL))
+			return
+		}
+		err = h.xc.SetWithExpire(key, req.Value, ttl)
+	}
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler[K, V]) remove(w http.ResponseWriter, key K) {
+	if !h.xc.Remove(key) {
+		writeCacheError(w, xcache.ErrKeyNotFoundError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler[K, V]) purge(w http.ResponseWriter, r *http.Request) {
+	h.xc.Purge()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler[K, V]) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.xc.Stats())
+}
+
+func (h *handler[K, V]) resize(w http.ResponseWriter, r *http.Request) {
+	var req ResizeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.BucketCount <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid bucket count %d", req.BucketCount))
+		return
+	}
+	if req.BucketCount > h.opts.MaxBucketCount {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("bucket count %d exceeds %d", req.BucketCount, h.opts.MaxBucketCount))
+		return
+	}
+	if err := h.xc.Rebucket(req.BucketCount); err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ResizeRequest{BucketCount: h.xc.GetBucketCount()})
+}
+
+func (h *handler[K, V]) policy(w http.ResponseWriter, r *http.Request) {
+	buckets := h.xc.DebugState()
+	p := Policy{BucketCount: len(buckets), Buckets: buckets}
+	if len(buckets) > 0 {
+		p.Policy = buckets[0].Policy
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// readJSON decodes the body of r into v, or responds with 400 Bad Request and returns false.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeCacheError responds with the status that matches an error of the cache.
+func writeCacheError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, xcache.ErrKeyNotFoundError):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, xcache.ErrInvalidConfig):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, xcache.ErrNotAdmitted):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,231 @@
+package xhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SipengXie/xcache"
+)
+
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+}
+
+func TestHandlerEntries(t *testing.T) {
+	xc := xcache.NewXCache[string, int](10).BucketCount(2).Build()
+	defer xc.Close()
+	h := NewHandler(xc, Options[string]{})
+
+	if w := do(t, h, http.MethodGet, "/entries/a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("%v != %v", w.Code, http.StatusNotFound)
+	}
+	if w := do(t, h, http.MethodPut, "/entries/a", `{"value": 1}`); w.Code != http.StatusNoContent {
+		t.Errorf("%v != %v: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	if w := do(t, h, http.MethodPut, "/entries/b%2Fc", `{"value": 2, "ttl": "1m"}`); w.Code != http.StatusNoContent {
+		t.Errorf("%v != %v: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	if v, err := xc.Get("b/c"); err != nil || v != 2 {
+		t.Errorf("%v, %v != 2", v, err)
+	}
+
+	var e Entry[string, int]
+	decode(t, do(t, h, http.MethodGet, "/entries/b%2Fc", ""), &e)
+	if e.Key != "b/c" || e.Value != 2 || e.Expiration == nil || time.Until(*e.Expiration) > time.Minute {
+		t.Errorf("%+v", e)
+	}
+	e = Entry[string, int]{}
+	decode(t, do(t, h, http.MethodGet, "/entries/a", ""), &e)
+	if e.Value != 1 || e.Expiration != nil {
+		t.Errorf("%+v", e)
+	}
+
+	var keys []string
+	decode(t, do(t, h, http.MethodGet, "/entries", ""), &keys)
+	if len(keys) != 2 {
+		t.Errorf("%v", keys)
+	}
+
+	if w := do(t, h, http.MethodDelete, "/entries/a", ""); w.Code != http.StatusNoContent {
+		t.Errorf("%v != %v", w.Code, http.StatusNoContent)
+	}
+	if w := do(t, h, http.MethodDelete, "/entries/a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("%v != %v", w.Code, http.StatusNotFound)
+	}
+
+	for _, body := range []string{`{"value": "x"}`, `{"value": 1, "ttl": "soon"}`, `{"value": 1, "other": 2}`} {
+		if w := do(t, h, http.MethodPut, "/entries/a", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %v != %v", body, w.Code, http.StatusBadRequest)
+		}
+	}
+	if w := do(t, h, http.MethodPost, "/entries/a", ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, PUT, DELETE" {
+		t.Errorf("%v, %v", w.Code, w.Header().Get("Allow"))
+	}
+	if w := do(t, h, http.MethodGet, "/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("%v != %v", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerNotAdmitted(t *testing.T) {
+	xc := xcache.NewXCache[string, int](10).
+		Admission(xcache.AdmissionFunc(func(interface{}) bool { return false })).
+		Build()
+	defer xc.Close()
+	h := NewHandler(xc, Options[string]{})
+
+	if w := do(t, h, http.MethodPut, "/entries/a", `{"value": 1}`); w.Code != http.StatusConflict {
+		t.Errorf("%v != %v: %s", w.Code, http.StatusConflict, w.Body)
+	}
+}
+
+func TestHandlerKeys(t *testing.T) {
+	xc := xcache.NewXCache[int, string](10).Build()
+	defer xc.Close()
+	h := NewHandler(xc, Options[int]{})
+	do(t, h, http.MethodPut, "/entries/42", `{"value": "x"}`)
+	if v, err := xc.Get(42); err != nil || v != "x" {
+		t.Errorf("%v, %v != x", v, err)
+	}
+	if w := do(t, h, http.MethodGet, "/entries/x", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("%v != %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlerKeysLimit(t *testing.T) {
+	xc := xcache.NewXCache[int, int](100).BucketCount(4).Build()
+	defer xc.Close()
+	for i := 0; i < 20; i++ {
+		xc.Set(i, i)
+	}
+	h := NewHandler(xc, Options[int]{})
+	var keys []int
+	decode(t, do(t, h, http.MethodGet, "/entries?limit=5", ""), &keys)
+	if len(keys) != 5 {
+		t.Errorf("%v != 5", len(keys))
+	}
+	decode(t, do(t, h, http.MethodGet, "/entries", ""), &keys)
+	if len(keys) != 20 {
+		t.Errorf("%v != 20", len(keys))
+	}
+	for _, limit := range []string{"0", "-1", "x"} {
+		if w := do(t, h, http.MethodGet, "/entries?limit="+limit, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%v: %v != %v", limit, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerGetPeeks(t *testing.T) {
+	loads := 0
+	xc := xcache.NewXCache[string, int](10).
+		LoaderFunc(func(key string) (int, error) {
+			loads++
+			return 1, nil
+		}).
+		Build()
+	defer xc.Close()
+	xc.Set("a", 1)
+	h := NewHandler(xc, Options[string]{})
+	if w := do(t, h, http.MethodGet, "/entries/a", ""); w.Code != http.StatusOK {
+		t.Errorf("%v != %v", w.Code, http.StatusOK)
+	}
+	if w := do(t, h, http.MethodGet, "/entries/b", ""); w.Code != http.StatusNotFound {
+		t.Errorf("%v != %v", w.Code, http.StatusNotFound)
+	}
+	if loads != 0 || xc.HitCount() != 0 || xc.MissCount() != 0 {
+		t.Errorf("%v, %v, %v != 0, 0, 0", loads, xc.HitCount(), xc.MissCount())
+	}
+}
+
+func TestHandlerAdmin(t *testing.T) {
+	xc := xcache.NewXCache[string, int](10).BucketCount(2).LFU().Build()
+	defer xc.Close()
+	h := NewHandler(xc, Options[string]{})
+	xc.Set("a", 1)
+	xc.Get("a")
+	xc.Get("b")
+
+	var stats xcache.CacheStats
+	decode(t, do(t, h, http.MethodGet, "/stats", ""), &stats)
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("%+v", stats)
+	}
+
+	var p Policy
+	decode(t, do(t, h, http.MethodGet, "/policy", ""), &p)
+	if p.Policy != xcache.TYPE_LFU || p.BucketCount != 2 || len(p.Buckets) != 2 {
+		t.Errorf("%+v", p)
+	}
+
+	var resized ResizeRequest
+	decode(t, do(t, h, http.MethodPost, "/resize", `{"bucket_count": 4}`), &resized)
+	if resized.BucketCount != 4 || xc.GetBucketCount() != 4 {
+		t.Errorf("%v, %v != 4", resized.BucketCount, xc.GetBucketCount())
+	}
+	if w := do(t, h, http.MethodPost, "/resize", `{"bucket_count": 0}`); w.Code != http.StatusBadRequest {
+		t.Errorf("%v != %v", w.Code, http.StatusBadRequest)
+	}
+	if w := do(t, h, http.MethodPost, "/resize", `{"bucket_count": 1000000000}`); w.Code != http.StatusBadRequest {
+		t.Errorf("%v != %v", w.Code, http.StatusBadRequest)
+	}
+	limited := NewHandler(xc, Options[string]{MaxBucketCount: 8})
+	if w := do(t, limited, http.MethodPost, "/resize", `{"bucket_count": 16}`); w.Code != http.StatusBadRequest || xc.GetBucketCount() != 4 {
+		t.Errorf("%v != %v, %v != 4", w.Code, http.StatusBadRequest, xc.GetBucketCount())
+	}
+	if v, err := xc.Get("a"); err != nil || v != 1 {
+		t.Errorf("%v, %v != 1", v, err)
+	}
+
+	if w := do(t, h, http.MethodPost, "/purge", ""); w.Code != http.StatusNoContent {
+		t.Errorf("%v != %v", w.Code, http.StatusNoContent)
+	}
+	if n := xc.Len(false); n != 0 {
+		t.Errorf("%v != 0", n)
+	}
+	if w := do(t, h, http.MethodGet, "/purge", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("%v != %v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandlerAuthorize(t *testing.T) {
+	xc := xcache.NewXCache[string, int](10).Build()
+	defer xc.Close()
+	h := http.StripPrefix("/cache", NewHandler(xc, Options[string]{
+		Authorize: func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("invalid token")
+			}
+			return nil
+		},
+	}))
+
+	w := do(t, h, http.MethodGet, "/cache/stats", "")
+	var body struct{ Error string }
+	decode(t, w, &body)
+	if w.Code != http.StatusUnauthorized || body.Error != "invalid token" {
+		t.Errorf("%v, %v", w.Code, body.Error)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/cache/stats", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("%v != %v", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,18 @@
+module github.com/SipengXie/xcache/xotel
+
+go 1.19
+
+require (
+	github.com/SipengXie/xcache v0.0.0-20261016195852-c70a4ffbbd94
+	go.opentelemetry.io/otel v1.16.0
+	go.opentelemetry.io/otel/metric v1.16.0
+	go.opentelemetry.io/otel/trace v1.16.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+)
+
+replace github.com/SipengXie/xcache => ../
@@ -0,0 +1,101 @@
+// Package xotel exports the metrics of caches and traces their loader calls
+// with OpenTelemetry, see xcache.CacheBuilder.WithTelemetry.
+//
+// It is a module of its own, so that xcache does not depend on OpenTelemetry.
+package xotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/SipengXie/xcache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package as the source of telemetry.
+const instrumentationName = "github.com/SipengXie/xcache"
+
+// Options configures a Telemetry. The zero value is usable.
+type Options struct {
+	// Context returns the context that the span of the load of key starts from,
+	// so that it is a child of the span of the request that missed key. By default
+	// load spans start from context.Background(). Since the loads of a key are
+	// shared by concurrent lookups, it is the context of the first of them.
+	Context func(key interface{}) context.Context
+}
+
+// Telemetry emits the hits and misses of a cache as the counters xcache.hits
+// and xcache.misses, and the duration of loads as the histogram
+// xcache.load.duration, and traces loads with xcache.load spans.
+// It implements xcache.Telemetry.
+type Telemetry struct {
+	tracer       trace.Tracer
+	hits         metric.Int64Counter
+	misses       metric.Int64Counter
+	loadDuration metric.Float64Histogram
+	opts         Options
+}
+
+var _ xcache.Telemetry = (*Telemetry)(nil)
+
+// New returns a telemetry with the metrics of meterProvider and the spans of tracerProvider.
+func New(meterProvider metric.MeterProvider, tracerProvider trace.TracerProvider, opts Options) *Telemetry {
+	meter := meterProvider.Meter(instrumentationName)
+	t := &Telemetry{tracer: tracerProvider.Tracer(instrumentationName), opts: opts}
+	var err error
+	if t.hits, err = meter.Int64Counter("xcache.hits",
+		metric.WithDescription("Number of lookups that found the key in the cache.")); err != nil {
+		otel.Handle(err)
+	}
+	if t.misses, err = meter.Int64Counter("xcache.misses",
+		metric.WithDescription("Number of lookups that did not find the key in the cache.")); err != nil {
+		otel.Handle(err)
+	}
+	if t.loadDuration, err = meter.Float64Histogram("xcache.load.duration",
+		metric.WithDescription("Duration of loader calls."),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	return t
+}
+
+// RecordHit counts a hit.
+func (t *Telemetry) RecordHit() {
+	if t.hits != nil {
+		t.hits.Add(context.Background(), 1)
+	}
+}
+
+// RecordMiss counts a miss.
+func (t *Telemetry) RecordMiss() {
+	if t.misses != nil {
+		t.misses.Add(context.Background(), 1)
+	}
+}
+
+// TraceLoad calls load within a span and records its duration.
+func (t *Telemetry) TraceLoad(key interface{}, load func() (interface{}, *time.Duration, error)) (interface{}, *time.Duration, error) {
+	ctx := context.Background()
+	if t.opts.Context != nil {
+		if parent := t.opts.Context(key); parent != nil {
+			ctx = parent
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, "xcache.load")
+	defer span.End()
+	start := time.Now()
+	v, expiration, err := load()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if t.loadDuration != nil {
+		t.loadDuration.Record(ctx, time.Since(start).Seconds(),
+			metric.WithAttributes(attribute.Bool("error", err != nil)))
+	}
+	return v, expiration, err
+}
@@ -0,0 +1,179 @@
+package xotel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/SipengXie/xcache"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testMeterProvider counts the measurements of the instruments it creates.
+type testMeterProvider struct {
+	noop.MeterProvider
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (p *testMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return testMeter{provider: p}
+}
+
+func (p *testMeterProvider) add(name string, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.counts == nil {
+		p.counts = make(map[string]int64)
+	}
+	p.counts[name] += n
+}
+
+func (p *testMeterProvider) count(name string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[name]
+}
+
+type testMeter struct {
+	noop.Meter
+	provider *testMeterProvider
+}
+
+func (m testMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return testCounter{name: name, provider: m.provider}, nil
+}
+
+func (m testMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return testHistogram{name: name, provider: m.provider}, nil
+}
+
+type testCounter struct {
+	noop.Int64Counter
+	name     string
+	provider *testMeterProvider
+}
+
+func (c testCounter) Add(_ context.Context, n int64, _ ...metric.AddOption) {
+	c.provider.add(c.name, n)
+}
+
+type testHistogram struct {
+	noop.Float64Histogram
+	name     string
+	provider *testMeterProvider
+}
+
+func (h testHistogram) Record(context.Context, float64, ...metric.RecordOption) {
+	h.provider.add(h.name, 1)
+}
+
+func TestWithTelemetry(t *testing.T) {
+	mp := &testMeterProvider{}
+	loadErr := errors.New("load failed")
+	cc := xcache.New(32).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			if key == "bad" {
+				return nil, loadErr
+			}
+			return key, nil
+		}).
+		WithTelemetry(New(mp, trace.NewNoopTracerProvider(), Options{})).
+		Build()
+
+	cc.Get("key")
+	cc.Get("key")
+	if _, err := cc.Get("bad"); err != loadErr {
+		t.Errorf("%v != %v", err, loadErr)
+	}
+
+	if n := mp.count("xcache.hits"); n != 1 {
+		t.Errorf("hits: %v != %v", n, 1)
+	}
+	if n := mp.count("xcache.misses"); n != 2 {
+		t.Errorf("misses: %v != %v", n, 2)
+	}
+	if n := mp.count("xcache.load.duration"); n != 2 {
+		t.Errorf("loads: %v != %v", n, 2)
+	}
+	if cc.HitCount() != 1 || cc.MissCount() != 2 {
+		t.Errorf("stats: %v/%v != %v/%v", cc.HitCount(), cc.MissCount(), 1, 2)
+	}
+}
+
+func TestXCacheWithTelemetry(t *testing.T) {
+	mp := &testMeterProvider{}
+	xc := xcache.NewXCache[string, string](32).
+		LRU().
+		WithTelemetry(New(mp, trace.NewNoopTracerProvider(), Options{})).
+		Build()
+	defer xc.Close()
+
+	xc.Set("a", "1")
+	xc.Get("a")
+	xc.Get("b")
+
+	if n := mp.count("xcache.hits"); n != 1 {
+		t.Errorf("hits: %v != %v", n, 1)
+	}
+	if n := mp.count("xcache.misses"); n != 1 {
+		t.Errorf("misses: %v != %v", n, 1)
+	}
+}
+
+// testTracerProvider records the trace IDs of the contexts that spans start from.
+type testTracerProvider struct {
+	trace.TracerProvider
+	mu      sync.Mutex
+	parents []trace.TraceID
+}
+
+func (p *testTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return testTracer{Tracer: p.TracerProvider.Tracer(""), provider: p}
+}
+
+type testTracer struct {
+	trace.Tracer
+	provider *testTracerProvider
+}
+
+func (t testTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.provider.mu.Lock()
+	t.provider.parents = append(t.provider.parents, trace.SpanContextFromContext(ctx).TraceID())
+	t.provider.mu.Unlock()
+	return t.Tracer.Start(ctx, name, opts...)
+}
+
+func TestTraceLoadContext(t *testing.T) {
+	traceID := trace.TraceID{1}
+	parent := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  trace.SpanID{1},
+	}))
+	tp := &testTracerProvider{TracerProvider: trace.NewNoopTracerProvider()}
+	var keys []interface{}
+	cc := xcache.New(32).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			return key, nil
+		}).
+		WithTelemetry(New(&testMeterProvider{}, tp, Options{
+			Context: func(key interface{}) context.Context {
+				keys = append(keys, key)
+				return parent
+			},
+		})).
+		Build()
+
+	cc.Get("key")
+	if len(keys) != 1 || keys[0] != "key" {
+		t.Errorf("%v != [key]", keys)
+	}
+	if len(tp.parents) != 1 || tp.parents[0] != traceID {
+		t.Errorf("%v != [%v]", tp.parents, traceID)
+	}
+}
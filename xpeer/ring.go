@@ -0,0 +1,56 @@
+package xpeer
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/SipengXie/xcache"
+)
+
+// DefaultReplicas is the number of points of every peer on a Ring by default.
+const DefaultReplicas = 64
+
+// Ring assigns keys to peers by consistent hashing: every peer is hashed to a
+// number of points on a ring, and a key belongs to the peer of the first point at
+// or after the hash of the key. Adding or removing a peer only moves the keys of
+// the points it gains or loses. Hashes are computed with xcache.HashKey, so all
+// processes with the same peers assign keys alike.
+// A Ring is immutable and safe for concurrent use.
+type Ring struct {
+	points []uint64
+	peers  map[uint64]string
+}
+
+// NewRing returns a ring of peers with replicas points per peer, or
+// DefaultReplicas if replicas is not positive.
+func NewRing(replicas int, peers ...string) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	r := &Ring{peers: make(map[uint64]string, replicas*len(peers))}
+	for _, peer := range peers {
+		for i := 0; i < replicas; i++ {
+			h := xcache.HashKey(strconv.Itoa(i) + peer)
+			if _, ok := r.peers[h]; ok {
+				continue
+			}
+			r.points = append(r.points, h)
+			r.peers[h] = peer
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Get returns the peer that key belongs to, or "" if the ring has no peers.
+func (r *Ring) Get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := xcache.HashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.peers[r.points[i]]
+}
@@ -0,0 +1,41 @@
+package xpeer
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	if p := NewRing(0).Get("a"); p != "" {
+		t.Errorf("%q != %q", p, "")
+	}
+
+	r := NewRing(0, "a", "b", "c")
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := 0; i < 3000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = r.Get(key)
+		counts[owners[key]]++
+	}
+	for _, peer := range []string{"a", "b", "c"} {
+		if counts[peer] < 500 {
+			t.Errorf("%v owns %v keys", peer, counts[peer])
+		}
+	}
+
+	// adding a peer only moves keys to it
+	r = NewRing(0, "c", "b", "a", "d")
+	moved := 0
+	for key, owner := range owners {
+		if p := r.Get(key); p != owner {
+			if p != "d" {
+				t.Errorf("%v moved from %v to %v", key, owner, p)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 1500 {
+		t.Errorf("%v keys moved", moved)
+	}
+}
@@ -0,0 +1,333 @@
+// Package xpeer distributes an XCache across processes in the manner of groupcache.
+//
+// The processes form a ring of peers, see Ring, that assigns every key to one
+// owner. A Group serves Get for the keys it owns from its local XCache, which
+// loads missing values with its loader, and fetches the other keys from their
+// owner over HTTP, so that every value is loaded by a single process. Concurrent
+// fetches of a key are merged into one, and keys that are fetched often are
+// replicated in a small local cache of hot keys, so that they do not overload
+// their owner.
+//
+// Every process mounts its Group as an http.Handler at Options.BasePath and
+// calls SetPeers with the base URLs of all processes, including itself:
+//
+//	g := xpeer.New(xc, xpeer.Options[string, []byte]{Self: "http://10.0.0.1:8080"})
+//	http.Handle(xpeer.DefaultBasePath, g)
+//	g.SetPeers("http://10.0.0.1:8080", "http://10.0.0.2:8080")
+//
+// Values only come from the loaders: a Group has no Set, since a value set in one
+// process would not be seen by the others.
+package xpeer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SipengXie/xcache"
+	"github.com/SipengXie/xcache/freq"
+)
+
+const (
+	// DefaultBasePath is the path at which peers serve each other by default.
+	DefaultBasePath = "/_xcache/"
+	// DefaultHotSize is the number of hot keys that are replicated by default.
+	DefaultHotSize = 1024
+	// DefaultHotTTL is the time a replicated hot key lives by default.
+	DefaultHotTTL = time.Minute
+	// DefaultHotThreshold is the number of recent fetches after which a key is hot by default.
+	DefaultHotThreshold = 4
+	// DefaultTimeout bounds a fetch from a peer by default.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Options configures a Group. Only Self is required.
+type Options[K comparable, V any] struct {
+	// Self is the base URL of this process as passed to SetPeers, e.g. "http://10.0.0.1:8080".
+	Self string
+	// BasePath is the path at which the Group is mounted, DefaultBasePath if empty.
+	BasePath string
+	// Replicas is the number of points of every peer on the ring, see NewRing.
+	Replicas int
+	// Key formats keys for the ring and URLs, and ParseKey parses them back. By
+	// default keys are formatted with xcache.FormatKey and parsed with xcache.ParseKey.
+	Key      func(K) string
+	ParseKey func(string) (K, error)
+	// Marshal and Unmarshal encode and decode the values sent between peers. By default
+	// they are xcache.MarshalValue and xcache.UnmarshalValue.
+	Marshal   func(V) ([]byte, error)
+	Unmarshal func([]byte) (V, error)
+	// Fetch fetches the encoded value of a formatted key from peer, and returns an
+	// error wrapping xcache.ErrKeyNotFoundError if the peer has no value for it.
+	// By default it requests the key from the Group of the peer over HTTP; it can
+	// be replaced to use another transport, such as gRPC.
+	Fetch func(peer, key string) ([]byte, error)
+	// Client is the HTTP client of the default Fetch, with Timeout if it is nil.
+	Client  *http.Client
+	Timeout time.Duration
+	// HotSize is the number of hot keys that are replicated, DefaultHotSize if zero.
+	// Keys are not replicated if it is negative.
+	HotSize int
+	// HotTTL is the time a replicated key lives, DefaultHotTTL if zero. It bounds
+	// the time a replica may be stale.
+	HotTTL time.Duration
+	// HotThreshold is the number of recent fetches after which a key is replicated,
+	// DefaultHotThreshold if zero.
+	HotThreshold int
+}
+
+// Stats counts the lookups of a Group that did not go to its local cache.
+type Stats struct {
+	// PeerFetches counts the fetches from other peers, and PeerErrors those that
+	// failed with another error than a missing key and were loaded locally instead.
+	PeerFetches uint64
+	PeerErrors  uint64
+	// HotHits counts the lookups served by a replicated hot key, and Replications
+	// the keys that have been replicated.
+	HotHits      uint64
+	Replications uint64
+}
+
+// Group serves the keys it owns from its local cache and fetches the other keys
+// from their owners. It is safe for concurrent use.
+type Group[K comparable, V any] struct {
+	local  *xcache.XCache[K, V]
+	hot    *xcache.XCache[K, V]
+	sketch *freq.Sketch
+	opts   Options[K, V]
+	ring   atomic.Value // *Ring
+	flight flight[V]
+
+	peerFetches  uint64
+	peerErrors   uint64
+	hotHits      uint64
+	replications uint64
+}
+
+// New returns a group that serves the keys it owns from local. It owns all keys
+// until SetPeers is called.
+func New[K comparable, V any](local *xcache.XCache[K, V], opts Options[K, V]) *Group[K, V] {
+	if opts.BasePath == "" {
+		opts.BasePath = DefaultBasePath
+	}
+	if opts.Key == nil {
+		opts.Key = xcache.FormatKey[K]
+	}
+	if opts.ParseKey == nil {
+		opts.ParseKey = xcache.ParseKey[K]
+	}
+	if opts.Marshal == nil {
+		opts.Marshal = xcache.MarshalValue[V]
+	}
+	if opts.Unmarshal == nil {
+		opts.Unmarshal = xcache.UnmarshalValue[V]
+	}
+	if opts.HotSize == 0 {
+		opts.HotSize = DefaultHotSize
+	}
+	if opts.HotTTL <= 0 {
+		opts.HotTTL = DefaultHotTTL
+	}
+	if opts.HotThreshold <= 0 {
+		opts.HotThreshold = DefaultHotThreshold
+	}
+	g := &Group[K, V]{local: local, opts: opts}
+	if g.opts.Fetch == nil {
+		client := opts.Client
+		if client == nil {
+			timeout := opts.Timeout
+			if timeout <= 0 {
+				timeout = DefaultTimeout
+			}
+			client = &http.Client{Timeout: timeout}
+		}
+		g.opts.Fetch = func(peer, key string) ([]byte, error) {
+			return fetchHTTP(client, peer+g.opts.BasePath+url.PathEscape(key))
+		}
+	}
+	if opts.HotSize > 0 {
+		g.hot = xcache.NewXCache[K, V](opts.HotSize).BucketCount(1).Expiration(opts.HotTTL).Build()
+		g.sketch = freq.New(4 * opts.HotSize)
+	}
+	g.ring.Store(NewRing(opts.Replicas))
+	return g
+}
+
+// SetPeers replaces the peers of the group by the base URLs of all processes,
+// which must include Options.Self.
+func (g *Group[K, V]) SetPeers(peers ...string) {
+	g.ring.Store(NewRing(g.opts.Replicas, peers...))
+}
+
+// Owner returns the base URL of the peer that owns key, or "" if the group has no peers.
+func (g *Group[K, V]) Owner(key K) string {
+	return g.ring.Load().(*Ring).Get(g.opts.Key(key))
+}
+
+// Get returns the value of key. The owner of key loads it with the loader of its
+// local cache; the other peers fetch it from the owner, or load it themselves if
+// the owner cannot be reached. Returns an error wrapping xcache.ErrKeyNotFoundError
+// if there is no value for key.
+func (g *Group[K, V]) Get(key K) (V, error) {
+	k := g.opts.Key(key)
+	peer := g.ring.Load().(*Ring).Get(k)
+	if peer == "" || peer == g.opts.Self {
+		return g.local.Get(key)
+	}
+	if g.hot != nil {
+		if v, err := g.hot.GetIFPresent(key); err == nil {
+			atomic.AddUint64(&g.hotHits, 1)
+			return v, nil
+		}
+	}
+	return g.flight.do(k, func() (V, error) {
+		return g.fetch(peer, k, key)
+	})
+}
+
+// fetch fetches key from peer and replicates it if it is hot.
+func (g *Group[K, V]) fetch(peer, k string, key K) (V, error) {
+	atomic.AddUint64(&g.peerFetches, 1)
+	b, err := g.opts.Fetch(peer, k)
+	if err != nil {
+		if errors.Is(err, xcache.ErrKeyNotFoundError) {
+			var zero V
+			return zero, err
+		}
+		atomic.AddUint64(&g.peerErrors, 1)
+		return g.local.Get(key)
+	}
+	value, err := g.opts.Unmarshal(b)
+	if err != nil {
+		return value, err
+	}
+	if g.hot != nil {
+		h := xcache.HashKey(k)
+		g.sketch.Increment(h)
+		if g.sketch.Estimate(h) >= g.opts.HotThreshold {
+			g.hot.Set(key, value)
+			atomic.AddUint64(&g.replications, 1)
+		}
+	}
+	return value, nil
+}
+
+// Stats returns the counters of the group.
+func (g *Group[K, V]) Stats() Stats {
+	return Stats{
+		PeerFetches:  atomic.LoadUint64(&g.peerFetches),
+		PeerErrors:   atomic.LoadUint64(&g.peerErrors),
+		HotHits:      atomic.LoadUint64(&g.hotHits),
+		Replications: atomic.LoadUint64(&g.replications),
+	}
+}
+
+// Close closes the cache of hot keys. It does not close the local cache.
+func (g *Group[K, V]) Close() {
+	if g.hot != nil {
+		g.hot.Close()
+	}
+}
+
+// ServeHTTP serves the values of the local cache to the other peers at
+// BasePath followed by the escaped key.
+func (g *Group[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, g.opts.BasePath) {
+		http.NotFound(w, r)
+		return
+	}
+	s, err := url.PathUnescape(strings.TrimPrefix(path, g.opts.BasePath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, err := g.opts.ParseKey(s)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid key %q: %v", s, err), http.StatusBadRequest)
+		return
+	}
+	value, err := g.local.Get(key)
+	if errors.Is(err, xcache.ErrKeyNotFoundError) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := g.opts.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(b)
+}
+
+// fetchHTTP requests the value at u from the Group of a peer.
+func fetchHTTP(client *http.Client, u string) ([]byte, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", xcache.ErrKeyNotFoundError, u)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("xpeer: %s: %s: %s", u, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return b, err
+}
+
+// flight merges concurrent fetches of the same key into one.
+type flight[V any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[V]
+}
+
+type call[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+}
+
+// do calls fn unless a call for key is in flight, and returns the results of
+// the call in flight otherwise.
+func (f *flight[V]) do(key string, fn func() (V, error)) (V, error) {
+	f.mu.Lock()
+	if c, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		c.wg.Wait()
+		return c.value, c.err
+	}
+	if f.calls == nil {
+		f.calls = make(map[string]*call[V])
+	}
+	c := &call[V]{}
+	c.wg.Add(1)
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err
+}
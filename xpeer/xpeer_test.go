@@ -0,0 +1,159 @@
+package xpeer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SipengXie/xcache"
+)
+
+type peer struct {
+	group *Group[int, string]
+	loads *int64
+}
+
+// newPeers starts n peers whose loaders return the key formatted as a string,
+// except for negative keys, which are missing.
+func newPeers(t *testing.T, n int, opts Options[int, string]) []peer {
+	peers := make([]peer, n)
+	urls := make([]string, n)
+	for i := range peers {
+		loads := new(int64)
+		local := xcache.NewXCache[int, string](100).LoaderFunc(func(key int) (string, error) {
+			atomic.AddInt64(loads, 1)
+			if key < 0 {
+				return "", xcache.ErrKeyNotFoundError
+			}
+			return strconv.Itoa(key), nil
+		}).Build()
+		var handler http.Handler
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(s.Close)
+		o := opts
+		o.Self = s.URL
+		g := New(local, o)
+		handler = g
+		t.Cleanup(g.Close)
+		t.Cleanup(local.Close)
+		peers[i] = peer{group: g, loads: loads}
+		urls[i] = s.URL
+	}
+	for _, p := range peers {
+		p.group.SetPeers(urls...)
+	}
+	return peers
+}
+
+func TestGroup(t *testing.T) {
+	peers := newPeers(t, 3, Options[int, string]{HotSize: -1})
+	for _, p := range peers {
+		for key := 0; key < 30; key++ {
+			if v, err := p.group.Get(key); err != nil || v != strconv.Itoa(key) {
+				t.Errorf("%v, %v != %v", v, err, key)
+			}
+		}
+	}
+	// every key has been loaded once, by its owner
+	var loads int64
+	for _, p := range peers {
+		if *p.loads == 0 {
+			t.Error("every peer should own keys")
+		}
+		loads += *p.loads
+	}
+	if loads != 30 {
+		t.Errorf("%v != %v", loads, 30)
+	}
+	var fetches uint64
+	for _, p := range peers {
+		fetches += p.group.Stats().PeerFetches
+	}
+	if fetches != 60 {
+		t.Errorf("%v != %v", fetches, 60)
+	}
+
+	for _, p := range peers {
+		if _, err := p.group.Get(-1); !errors.Is(err, xcache.ErrKeyNotFoundError) {
+			t.Errorf("%v != %v", err, xcache.ErrKeyNotFoundError)
+		}
+		if s := p.group.Stats(); s.PeerErrors != 0 {
+			t.Errorf("%v != 0", s.PeerErrors)
+		}
+	}
+}
+
+func TestGroupHotKeys(t *testing.T) {
+	peers := newPeers(t, 2, Options[int, string]{HotThreshold: 2})
+	g := peers[0].group
+	key := 0
+	for g.Owner(key) == g.opts.Self {
+		key++
+	}
+	for i := 0; i < 5; i++ {
+		if v, err := g.Get(key); err != nil || v != strconv.Itoa(key) {
+			t.Errorf("%v, %v != %v", v, err, key)
+		}
+	}
+	if s := g.Stats(); s.PeerFetches != 2 || s.Replications != 1 || s.HotHits != 3 {
+		t.Errorf("%+v", s)
+	}
+}
+
+func TestGroupFetchMerged(t *testing.T) {
+	var fetches int64
+	release := make(chan struct{})
+	local := xcache.NewXCache[int, string](10).Build()
+	defer local.Close()
+	g := New(local, Options[int, string]{
+		Self:    "self",
+		HotSize: -1,
+		Fetch: func(peer, key string) ([]byte, error) {
+			atomic.AddInt64(&fetches, 1)
+			<-release
+			return []byte(peer + "/" + key), nil
+		},
+	})
+	g.SetPeers("other")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.Get(1); err != nil || v != "other/1" {
+				t.Errorf("%v, %v != other/1", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt64(&fetches); n != 1 {
+		t.Errorf("%v != 1", n)
+	}
+}
+
+func TestGroupPeerDown(t *testing.T) {
+	local := xcache.NewXCache[int, string](10).LoaderFunc(func(key int) (string, error) {
+		return "local", nil
+	}).Build()
+	defer local.Close()
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	g := New(local, Options[int, string]{Self: "self", HotSize: -1})
+	g.SetPeers(s.URL)
+	if v, err := g.Get(1); err != nil || v != "local" {
+		t.Errorf("%v, %v != local", v, err)
+	}
+	if s := g.Stats(); s.PeerErrors != 1 {
+		t.Errorf("%v != 1", s.PeerErrors)
+	}
+}
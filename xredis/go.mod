@@ -0,0 +1,17 @@
+module github.com/SipengXie/xcache/xredis
+
+go 1.18
+
+require (
+	github.com/SipengXie/xcache v0.0.0-20261016195628-ca2998c57c0a
+	github.com/alicebob/miniredis/v2 v2.37.0
+	github.com/redis/go-redis/v9 v9.17.3
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
+
+replace github.com/SipengXie/xcache => ../
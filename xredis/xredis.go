@@ -0,0 +1,129 @@
+// Package xredis stores the entries of a second cache tier in Redis, so that a
+// process-local xcache and a shared Redis form a two-tier cache, see xcache.Tiered.
+//
+// It is a module of its own, so that xcache does not depend on go-redis.
+package xredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SipengXie/xcache"
+	"github.com/redis/go-redis/v9"
+)
+
+// Options configures a Tier. The zero value is usable.
+type Options[K, V any] struct {
+	// Prefix is prepended to the Redis keys, so that several caches can share a database.
+	Prefix string
+	// Key formats keys as Redis keys. By default it is xcache.FormatKey.
+	Key func(K) string
+	// Marshal and Unmarshal encode and decode the values. By default they are
+	// xcache.MarshalValue and xcache.UnmarshalValue.
+	Marshal   func(V) ([]byte, error)
+	Unmarshal func([]byte) (V, error)
+	// Timeout bounds every Redis command, unless it is zero.
+	Timeout time.Duration
+}
+
+// Tier is a cache tier in Redis. It implements xcache.XTier[K, V] for an XCache
+// with the same types, and xcache.Tier if K and V are interface{}.
+// Entries keep their expiration time as the TTL of their Redis key.
+type Tier[K, V any] struct {
+	client redis.UniversalClient
+	opts   Options[K, V]
+}
+
+// New returns a tier that stores its entries with client.
+func New[K, V any](client redis.UniversalClient, opts Options[K, V]) *Tier[K, V] {
+	if opts.Key == nil {
+		opts.Key = xcache.FormatKey[K]
+	}
+	if opts.Marshal == nil {
+		opts.Marshal = xcache.MarshalValue[V]
+	}
+	if opts.Unmarshal == nil {
+		opts.Unmarshal = xcache.UnmarshalValue[V]
+	}
+	return &Tier[K, V]{client: client, opts: opts}
+}
+
+// context returns the context of a Redis command.
+func (t *Tier[K, V]) context() (context.Context, context.CancelFunc) {
+	if t.opts.Timeout > 0 {
+		return context.WithTimeout(context.Background(), t.opts.Timeout)
+	}
+	return context.Background(), func() {}
+}
+
+func (t *Tier[K, V]) key(key K) string {
+	return t.opts.Prefix + t.opts.Key(key)
+}
+
+// GetWithExpiration returns the value of key and the time at which it expires,
+// which is nil if it does not expire. Returns xcache.ErrKeyNotFoundError if key
+// is not present.
+func (t *Tier[K, V]) GetWithExpiration(key K) (V, *time.Time, error) {
+	var zero V
+	ctx, cancel := t.context()
+	defer cancel()
+	k := t.key(key)
+	var (
+		get *redis.StringCmd
+		ttl *redis.DurationCmd
+	)
+	_, err := t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, k)
+		ttl = pipe.PTTL(ctx, k)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return zero, nil, xcache.ErrKeyNotFoundError
+	}
+	if err != nil {
+		return zero, nil, err
+	}
+	b, err := get.Bytes()
+	if err != nil {
+		return zero, nil, err
+	}
+	value, err := t.opts.Unmarshal(b)
+	if err != nil {
+		return zero, nil, err
+	}
+	var expiration *time.Time
+	if d := ttl.Val(); d > 0 {
+		at := time.Now().Add(d)
+		expiration = &at
+	}
+	return value, expiration, nil
+}
+
+// Set stores the key-value pair without expiration.
+func (t *Tier[K, V]) Set(key K, value V) error {
+	return t.SetWithExpire(key, value, 0)
+}
+
+// SetWithExpire stores the key-value pair, which expires after expiration
+// unless it is not positive.
+func (t *Tier[K, V]) SetWithExpire(key K, value V, expiration time.Duration) error {
+	b, err := t.opts.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if expiration < 0 {
+		expiration = 0
+	}
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.client.Set(ctx, t.key(key), b, expiration).Err()
+}
+
+// Remove removes key and reports whether it was present.
+func (t *Tier[K, V]) Remove(key K) bool {
+	ctx, cancel := t.context()
+	defer cancel()
+	n, err := t.client.Del(ctx, t.key(key)).Result()
+	return err == nil && n > 0
+}
@@ -0,0 +1,95 @@
+package xredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SipengXie/xcache"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return s, client
+}
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func TestTier(t *testing.T) {
+	s, client := newClient(t)
+	tier := New(client, Options[int, user]{Prefix: "users:"})
+
+	if _, _, err := tier.GetWithExpiration(1); err != xcache.ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, xcache.ErrKeyNotFoundError)
+	}
+	if err := tier.Set(1, user{Name: "a", Age: 1}); err != nil {
+		t.Fatal(err)
+	}
+	v, expiration, err := tier.GetWithExpiration(1)
+	if err != nil || v != (user{Name: "a", Age: 1}) || expiration != nil {
+		t.Errorf("%v, %v, %v", v, expiration, err)
+	}
+	if !s.Exists("users:1") {
+		t.Error("the key should be prefixed")
+	}
+
+	if err := tier.SetWithExpire(2, user{Name: "b"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, expiration, err := tier.GetWithExpiration(2); err != nil || expiration == nil || time.Until(*expiration) > time.Minute {
+		t.Errorf("%v, %v", expiration, err)
+	}
+	s.FastForward(2 * time.Minute)
+	if _, _, err := tier.GetWithExpiration(2); err != xcache.ErrKeyNotFoundError {
+		t.Errorf("%v != %v", err, xcache.ErrKeyNotFoundError)
+	}
+
+	if !tier.Remove(1) || tier.Remove(1) {
+		t.Error("Remove should report whether the key was present")
+	}
+}
+
+func TestTierStrings(t *testing.T) {
+	s, client := newClient(t)
+	tier := New(client, Options[string, string]{})
+	tier.Set("a", "b")
+	if v, err := s.Get("a"); err != nil || v != "b" {
+		t.Errorf("%v, %v != b", v, err)
+	}
+}
+
+func TestTiered(t *testing.T) {
+	s, client := newClient(t)
+	tc := xcache.TieredX[string, user](
+		xcache.NewXCache[string, user](1).BucketCount(1).Expiration(time.Hour).Build(),
+		New(client, Options[string, user]{}),
+	)
+	tc.Set("a", user{Name: "a"})
+	tc.Set("b", user{Name: "b"})
+	// the first tier has demoted a with its TTL
+	if ttl := s.TTL("a"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("%v", ttl)
+	}
+	if v, err := tc.Get("a"); err != nil || v.Name != "a" {
+		t.Errorf("%v, %v != a", v, err)
+	}
+	if s.Exists("a") || !s.Exists("b") {
+		t.Errorf("%v, %v != false, true", s.Exists("a"), s.Exists("b"))
+	}
+
+	untyped := xcache.Tiered(xcache.New(1).LRU().Build(), New(client, Options[interface{}, interface{}]{Prefix: "u:"}))
+	untyped.Set("x", "1")
+	untyped.Set("y", "2")
+	if v, err := untyped.Get("x"); err != nil || v != "1" {
+		t.Errorf("%v, %v != 1", v, err)
+	}
+	if !s.Exists("u:y") {
+		t.Error("y should have been demoted")
+	}
+}
@@ -0,0 +1,300 @@
+// Package xrepl replicates an XCache to read replicas by shipping its events.
+//
+// A Primary consumes the events of its cache, see XCacheBuilder.EventBuffer,
+// and sends every set, removal and expiration as a Message with a sequence
+// number through a Transport. A Replica applies the messages it receives to its
+// own cache in order. When it misses a message, because the transport lost it or
+// the event buffer of the primary dropped an event, it notices the gap in the
+// sequence numbers and resynchronizes from a Snapshot of the primary.
+//
+// Evictions are not shipped, since replicas evict entries by their own capacity.
+// Replicas should only be written by their Replica. Values are shipped as they
+// are published in events, so the caches should not use SerializeFunc.
+package xrepl
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SipengXie/xcache"
+)
+
+// Op is the change a Message ships.
+type Op int
+
+const (
+	// OpSet sets the key to the value, which expires after TTL unless it is zero.
+	OpSet Op = iota + 1
+	// OpRemove removes the key.
+	OpRemove
+	// OpExpire removes the key, which has expired.
+	OpExpire
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpSet:
+		return "set"
+	case OpRemove:
+		return "remove"
+	case OpExpire:
+		return "expire"
+	}
+	return "unknown"
+}
+
+// Message is a change of an entry of the primary. Messages are numbered from 1
+// without gaps, so a replica knows that it has missed a message if the sequence
+// number of the next one is not the successor of the last one.
+type Message[K comparable, V any] struct {
+	Seq   uint64        `json:"seq"`
+	Op    Op            `json:"op"`
+	Key   K             `json:"key"`
+	Value V             `json:"value,omitempty"`
+	TTL   time.Duration `json:"ttl,omitempty"`
+}
+
+// Snapshot is the content of the primary after the message with sequence number
+// Seq, as sets that replace the content of a replica.
+type Snapshot[K comparable, V any] struct {
+	Seq     uint64          `json:"seq"`
+	Entries []Message[K, V] `json:"entries"`
+}
+
+// Transport ships the messages of a primary to its replicas, for example over
+// the network. It need not be reliable: replicas resynchronize after messages
+// that are lost. Send is called from a single goroutine in sequence order.
+type Transport[K comparable, V any] interface {
+	Send(msg Message[K, V]) error
+}
+
+// Source provides the snapshots that replicas resynchronize from. A Primary
+// is the Source of replicas in the same process; replicas in other processes
+// need a Source that requests the snapshot from the process of the primary.
+type Source[K comparable, V any] interface {
+	Snapshot() (Snapshot[K, V], error)
+}
+
+// Primary ships the changes of a cache to its replicas.
+type Primary[K comparable, V any] struct {
+	xc        *xcache.XCache[K, V]
+	transport Transport[K, V]
+	mu        sync.Mutex // protects seq and dropped
+	seq       uint64
+	dropped   uint64
+	errors    uint64
+	done      chan struct{}
+	stopped   chan struct{}
+	once      sync.Once
+}
+
+// NewPrimary returns a primary that ships the changes of xc through transport.
+// xc must have been built with an EventBuffer, and the primary consumes its
+// events, so they must not be read by anyone else.
+func NewPrimary[K comparable, V any](xc *xcache.XCache[K, V], transport Transport[K, V]) *Primary[K, V] {
+	p := &Primary[K, V]{
+		xc:        xc,
+		transport: transport,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go p.run(xc.Events())
+	return p
+}
+
+func (p *Primary[K, V]) run(events <-chan xcache.Event) {
+	defer close(p.stopped)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			p.ship(e)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// ship sends the message of e. The TTL of a set is the time left until the
+// expiration the entry had when e was published, by the clock of the cache.
+// If events have been dropped since the last message, it skips a sequence
+// number, so that the replicas resynchronize.
+func (p *Primary[K, V]) ship(e xcache.Event) {
+	key, ok := e.Key.(K)
+	if !ok {
+		return
+	}
+	msg := Message[K, V]{Key: key}
+	switch e.Type {
+	case xcache.EventAdded, xcache.EventUpdated:
+		value, ok := e.Value.(V)
+		if !ok {
+			return
+		}
+		msg.Op, msg.Value = OpSet, value
+		if e.Expiration != nil {
+			if msg.TTL = e.Expiration.Sub(p.xc.Clock().Now()); msg.TTL <= 0 {
+				msg.Op, msg.Value, msg.TTL = OpExpire, *new(V), 0
+			}
+		}
+	case xcache.EventRemoved:
+		msg.Op = OpRemove
+	case xcache.EventExpired:
+		msg.Op = OpExpire
+	default:
+		return
+	}
+
+	p.mu.Lock()
+	p.seq++
+	if dropped := p.xc.DroppedEventCount(); dropped != p.dropped {
+		p.dropped = dropped
+		p.seq++
+	}
+	msg.Seq = p.seq
+	p.mu.Unlock()
+	if err := p.transport.Send(msg); err != nil {
+		atomic.AddUint64(&p.errors, 1)
+	}
+}
+
+// Seq returns the sequence number of the last message.
+func (p *Primary[K, V]) Seq() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seq
+}
+
+// SendErrors returns the number of messages that the transport failed to send.
+func (p *Primary[K, V]) SendErrors() uint64 {
+	return atomic.LoadUint64(&p.errors)
+}
+
+// Snapshot returns the entries of the cache that have not expired. Its sequence
+// number is read before the entries, so the entries reflect at least all messages
+// up to it; replaying the later messages on top of them leads to the same content
+// as the primary, even though some of them may already be reflected.
+func (p *Primary[K, V]) Snapshot() (Snapshot[K, V], error) {
+	snap := Snapshot[K, V]{Seq: p.Seq()}
+	now := p.xc.Clock().Now()
+	for key, value := range p.xc.GetAll(true) {
+		msg := Message[K, V]{Op: OpSet, Key: key, Value: value}
+		if info, ok := p.xc.Info(key); ok && info.Expiration != nil {
+			if msg.TTL = info.Expiration.Sub(now); msg.TTL <= 0 {
+				continue
+			}
+		}
+		snap.Entries = append(snap.Entries, msg)
+	}
+	return snap, nil
+}
+
+// Close stops shipping messages. It does not close the cache.
+func (p *Primary[K, V]) Close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+	<-p.stopped
+}
+
+// Replica applies the messages of a primary to a cache.
+type Replica[K comparable, V any] struct {
+	xc      *xcache.XCache[K, V]
+	source  Source[K, V]
+	mu      sync.Mutex // serializes Apply
+	seq     uint64
+	synced  bool
+	resyncs uint64
+}
+
+// NewReplica returns a replica that applies messages to xc and resynchronizes
+// from source. It resynchronizes when it receives its first message.
+func NewReplica[K comparable, V any](xc *xcache.XCache[K, V], source Source[K, V]) *Replica[K, V] {
+	return &Replica[K, V]{xc: xc, source: source}
+}
+
+// Apply applies msg to the cache of the replica. Messages that have already been
+// applied are ignored. If messages are missing before msg, the replica replaces its
+// content by a snapshot of the source first; if that fails, Apply returns the error
+// and the replica resynchronizes again with the next message.
+func (r *Replica[K, V]) Apply(msg Message[K, V]) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.synced && msg.Seq <= r.seq {
+		return nil
+	}
+	if !r.synced || msg.Seq != r.seq+1 {
+		if err := r.resync(); err != nil {
+			return err
+		}
+		if msg.Seq <= r.seq {
+			return nil
+		}
+	}
+	r.apply(msg)
+	r.seq = msg.Seq
+	return nil
+}
+
+// Resync replaces the content of the cache by a snapshot of the source.
+func (r *Replica[K, V]) Resync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resync()
+}
+
+func (r *Replica[K, V]) resync() error {
+	snap, err := r.source.Snapshot()
+	if err != nil {
+		r.synced = false
+		return err
+	}
+	r.xc.Purge()
+	for _, msg := range snap.Entries {
+		r.apply(msg)
+	}
+	r.seq = snap.Seq
+	r.synced = true
+	r.resyncs++
+	return nil
+}
+
+func (r *Replica[K, V]) apply(msg Message[K, V]) {
+	switch msg.Op {
+	case OpSet:
+		r.xc.SetWithExpireAndIdle(msg.Key, msg.Value, msg.TTL, 0)
+	case OpRemove, OpExpire:
+		r.xc.Remove(msg.Key)
+	}
+}
+
+// Seq returns the sequence number of the last message that has been applied.
+func (r *Replica[K, V]) Seq() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.seq
+}
+
+// ResyncCount returns the number of times the replica has resynchronized.
+func (r *Replica[K, V]) ResyncCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resyncs
+}
+
+// Local is a Transport that applies the messages to replicas in the same process.
+type Local[K comparable, V any] []*Replica[K, V]
+
+// Send applies msg to every replica and returns the first error.
+func (l Local[K, V]) Send(msg Message[K, V]) error {
+	var first error
+	for _, r := range l {
+		if err := r.Apply(msg); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
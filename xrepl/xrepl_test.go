@@ -0,0 +1,183 @@
+package xrepl
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SipengXie/xcache"
+)
+
+// lossy is a transport that forwards messages to replicas unless drop returns true.
+type lossy[K comparable, V any] struct {
+	Local[K, V]
+	mu   sync.Mutex
+	drop func(Message[K, V]) bool
+}
+
+func (l *lossy[K, V]) Send(msg Message[K, V]) error {
+	l.mu.Lock()
+	drop := l.drop != nil && l.drop(msg)
+	l.mu.Unlock()
+	if drop {
+		return errors.New("lost")
+	}
+	return l.Local.Send(msg)
+}
+
+// waitSeq waits until r has applied the message with sequence number seq.
+func waitSeq[K comparable, V any](t *testing.T, r *Replica[K, V], seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for r.Seq() < seq {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v < %v", r.Seq(), seq)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	primary := xcache.NewXCache[string, int](100).EventBuffer(100).Build()
+	defer primary.Close()
+	replica := xcache.NewXCache[string, int](100).Build()
+	defer replica.Close()
+
+	transport := &lossy[string, int]{}
+	p := NewPrimary[string, int](primary, transport)
+	defer p.Close()
+	r := NewReplica[string, int](replica, p)
+	transport.Local = Local[string, int]{r}
+
+	primary.Set("a", 1)
+	primary.SetWithExpire("b", 2, time.Hour)
+	primary.Set("c", 3)
+	primary.Remove("c")
+	waitSeq(t, r, 4)
+
+	if v, err := replica.Get("a"); err != nil || v != 1 {
+		t.Errorf("%v, %v != 1", v, err)
+	}
+	if _, expiration, err := replica.GetWithExpiration("b"); err != nil || expiration == nil || time.Until(*expiration) > time.Hour {
+		t.Errorf("%v, %v", expiration, err)
+	}
+	if replica.Has("c") {
+		t.Error("c should have been removed")
+	}
+	if n := r.ResyncCount(); n != 1 {
+		t.Errorf("%v != 1", n)
+	}
+
+	// a lost message makes the replica resynchronize with the next one
+	transport.mu.Lock()
+	transport.drop = func(msg Message[string, int]) bool { return msg.Key == "d" }
+	transport.mu.Unlock()
+	primary.Set("d", 4)
+	primary.Set("e", 5)
+	waitSeq(t, r, 6)
+	if v, err := replica.Get("d"); err != nil || v != 4 {
+		t.Errorf("%v, %v != 4", v, err)
+	}
+	if n := r.ResyncCount(); n != 2 {
+		t.Errorf("%v != 2", n)
+	}
+	if n := p.SendErrors(); n != 1 {
+		t.Errorf("%v != 1", n)
+	}
+	if n := replica.Len(true); n != primary.Len(true) {
+		t.Errorf("%v != %v", n, primary.Len(true))
+	}
+}
+
+func TestReplicaApply(t *testing.T) {
+	primary := xcache.NewXCache[string, int](100).Build()
+	defer primary.Close()
+	primary.Set("a", 1)
+	replica := xcache.NewXCache[string, int](100).Build()
+	defer replica.Close()
+	replica.Set("stale", 0)
+	p := &Primary[string, int]{xc: primary, seq: 1}
+	r := NewReplica[string, int](replica, p)
+
+	// the first message replaces the content by a snapshot
+	if err := r.Apply(Message[string, int]{Seq: 2, Op: OpSet, Key: "b", Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if replica.Has("stale") || !replica.Has("a") || !replica.Has("b") {
+		t.Errorf("%v", replica.Keys(false))
+	}
+	// messages that have been applied are ignored
+	r.Apply(Message[string, int]{Seq: 1, Op: OpRemove, Key: "a"})
+	if !replica.Has("a") {
+		t.Error("a should not have been removed")
+	}
+	r.Apply(Message[string, int]{Seq: 3, Op: OpExpire, Key: "a"})
+	if replica.Has("a") || r.Seq() != 3 || r.ResyncCount() != 1 {
+		t.Errorf("%v, %v, %v", replica.Has("a"), r.Seq(), r.ResyncCount())
+	}
+}
+
+func TestPrimaryDroppedEvents(t *testing.T) {
+	primary := xcache.NewXCache[int, int](100).EventBuffer(1).Build()
+	defer primary.Close()
+	// fill the buffer before the primary reads it, so that events are dropped
+	primary.Set(1, 1)
+	primary.Set(2, 2)
+	var got []Message[int, int]
+	var mu sync.Mutex
+	p := NewPrimary[int, int](primary, transportFunc[int, int](func(msg Message[int, int]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, msg)
+		return nil
+	}))
+	defer p.Close()
+	deadline := time.Now().Add(time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	for len(got) == 0 && time.Now().Before(deadline) {
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+	}
+	if len(got) != 1 || got[0].Seq != 2 {
+		t.Errorf("%+v", got)
+	}
+}
+
+func TestPrimaryEventExpiration(t *testing.T) {
+	clock := xcache.NewFakeClock()
+	primary := xcache.NewXCache[string, int](100).Clock(clock).EventBuffer(10).Build()
+	defer primary.Close()
+	// the entry changes before the primary ships the first event
+	primary.SetWithExpire("a", 1, time.Minute)
+	primary.SetWithExpire("a", 2, time.Hour)
+	clock.Advance(time.Second)
+	var got []Message[string, int]
+	var mu sync.Mutex
+	p := NewPrimary[string, int](primary, transportFunc[string, int](func(msg Message[string, int]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, msg)
+		return nil
+	}))
+	defer p.Close()
+	deadline := time.Now().Add(time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	for len(got) < 2 && time.Now().Before(deadline) {
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+	}
+	if len(got) != 2 || got[0].TTL != time.Minute-time.Second || got[1].TTL != time.Hour-time.Second {
+		t.Errorf("%+v", got)
+	}
+}
+
+type transportFunc[K comparable, V any] func(Message[K, V]) error
+
+func (f transportFunc[K, V]) Send(msg Message[K, V]) error {
+	return f(msg)
+}